@@ -0,0 +1,34 @@
+package mjpeg
+
+// WithAlignment returns an Option which aligns the start of the movi data (the first chunk in the movi list)
+// to the given boundary (e.g. 512 or 4096 bytes) using JUNK chunks. If frames is true, each frame chunk
+// is also aligned to the boundary. Aligned data improves the performance of O_DIRECT and mmap based readers.
+// The boundary must be even (RIFF chunks are padded to even size), other values are ignored.
+func WithAlignment(boundary int, frames bool) Option {
+	return func(aw *aviWriter) {
+		if boundary > 0 && boundary%2 == 0 {
+			aw.align, aw.alignFrames = int64(boundary), frames
+		}
+	}
+}
+
+// pad writes a JUNK chunk so that the data written after the chunk plus offset bytes
+// starts at the given boundary. Nothing is written if it is already aligned.
+func (aw *aviWriter) pad(boundary, offset int64) error {
+	gap := (boundary - (aw.currentPos()+offset)%boundary) % boundary
+	if gap == 0 {
+		return nil
+	}
+	for gap < 8 {
+		gap += boundary // No room for a JUNK chunk header
+	}
+	aw.rw.WriteFourCC("JUNK")          // Padding
+	aw.rw.WriteUint32(uint32(gap - 8)) // Chunk size
+	for n := gap - 8; n > 0; n -= int64(len(zeroBlock)) {
+		aw.rw.Write(zeroBlock[:min64(n, int64(len(zeroBlock)))])
+	}
+	return aw.rw.Err()
+}
+
+// zeroBlock is a block of zeros for padding.
+var zeroBlock = make([]byte, 4096)
@@ -0,0 +1,95 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/png"
+	"os"
+)
+
+// ExportAPNG exports the clip of the video aviFile specified by cfg as an animated PNG to outFile,
+// e.g. to embed short loops in web pages where AVI can't be played.
+// The frames are lossless, so APNG files are large; see ExportWebP() for smaller files.
+func ExportAPNG(aviFile, outFile string, cfg ClipConfig) error {
+	var frames [][]byte // fcTL fields and the image data of the frames
+	var ihdr []byte
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	var buf bytes.Buffer
+
+	_, err := readClip(aviFile, cfg, func(f *clipFrame) error {
+		buf.Reset()
+		if err := enc.Encode(&buf, f.img); err != nil {
+			return err
+		}
+		var data []byte
+		for p := buf.Bytes()[8:]; len(p) >= 12; {
+			n := int(binary.BigEndian.Uint32(p))
+			typ, body := string(p[4:8]), p[8:8+n]
+			switch typ {
+			case "IHDR":
+				if ihdr == nil {
+					ihdr = append([]byte(nil), body...)
+				}
+			case "IDAT":
+				data = append(data, body...)
+			}
+			p = p[12+n:]
+		}
+
+		num, den := f.scale, f.rate
+		if num > 0xffff || den > 0xffff {
+			num, den = int(f.duration.Milliseconds()), 1000
+			if num > 0xffff {
+				num = 0xffff
+			}
+		}
+		fctl := make([]byte, 22)
+		binary.BigEndian.PutUint32(fctl[0:], uint32(f.img.Rect.Dx())) // width
+		binary.BigEndian.PutUint32(fctl[4:], uint32(f.img.Rect.Dy())) // height
+		binary.BigEndian.PutUint32(fctl[8:], 0)                       // x_offset
+		binary.BigEndian.PutUint32(fctl[12:], 0)                      // y_offset
+		binary.BigEndian.PutUint16(fctl[16:], uint16(num))            // delay_num
+		binary.BigEndian.PutUint16(fctl[18:], uint16(den))            // delay_den
+		fctl[20], fctl[21] = 0, 0                                     // dispose_op: none, blend_op: source
+		frames = append(frames, fctl, data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+	writePNGChunk(&out, "IHDR", ihdr)
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, uint32(len(frames)/2)) // num_frames
+	binary.BigEndian.PutUint32(actl[4:], uint32(cfg.Loops)) // num_plays
+	writePNGChunk(&out, "acTL", actl)
+
+	seq := uint32(0) // Sequence number of fcTL and fdAT chunks
+	for i := 0; i < len(frames); i += 2 {
+		writePNGChunk(&out, "fcTL", append(binary.BigEndian.AppendUint32(nil, seq), frames[i]...))
+		seq++
+		if i == 0 {
+			writePNGChunk(&out, "IDAT", frames[i+1]) // The first frame is the default image
+		} else {
+			writePNGChunk(&out, "fdAT", append(binary.BigEndian.AppendUint32(nil, seq), frames[i+1]...))
+			seq++
+		}
+	}
+	writePNGChunk(&out, "IEND", nil)
+
+	return os.WriteFile(outFile, out.Bytes(), 0644)
+}
+
+// writePNGChunk writes a PNG chunk with the given type and data.
+func writePNGChunk(b *bytes.Buffer, typ string, data []byte) {
+	b.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	b.WriteString(typ)
+	b.Write(data)
+	b.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
@@ -0,0 +1,80 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExportAPNG checks that every frame of the APNG decodes to the frame of the video.
+func TestExportAPNG(t *testing.T) {
+	dir := t.TempDir()
+	name, f := clipTestVideo(t, dir)
+	out := filepath.Join(dir, "test.png")
+	if err := ExportAPNG(name, out, ClipConfig{Loops: 2}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default image is the first frame
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameImage(img, clipImage(t, f[0])) {
+		t.Error("default image differs")
+	}
+
+	// Each frame is decoded as a standalone PNG of its image data
+	var ihdr, actl []byte
+	var frames [][]byte
+	var delays []uint16
+	for p := data[8:]; len(p) >= 12; {
+		n := int(binary.BigEndian.Uint32(p))
+		typ, body := string(p[4:8]), p[8:8+n]
+		switch typ {
+		case "IHDR":
+			ihdr = body
+		case "acTL":
+			actl = body
+		case "fcTL":
+			delays = append(delays, binary.BigEndian.Uint16(body[20:]))
+		case "IDAT":
+			frames = append(frames, body)
+		case "fdAT":
+			frames = append(frames, body[4:]) // Without the sequence number
+		}
+		p = p[12+n:]
+	}
+	if len(actl) != 8 || binary.BigEndian.Uint32(actl) != 3 || binary.BigEndian.Uint32(actl[4:]) != 2 {
+		t.Errorf("got acTL %v", actl)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	for i, want := range []uint16{2, 1, 1} { // In 1/10 seconds
+		if delays[i] != want {
+			t.Errorf("frame %d: got delay %d, want %d", i, delays[i], want)
+		}
+	}
+	for i, fd := range frames {
+		var b bytes.Buffer
+		b.WriteString("\x89PNG\r\n\x1a\n")
+		writePNGChunk(&b, "IHDR", ihdr)
+		writePNGChunk(&b, "IDAT", fd)
+		writePNGChunk(&b, "IEND", nil)
+		img, err := png.Decode(&b)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !sameImage(img, clipImage(t, f[i])) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"io"
+)
+
+// ErrAppendUnsupported reports if a video file can't be opened for appending frames.
+var ErrAppendUnsupported = errors.New("Unsupported file for appending")
+
+// Open opens the existing video aviFile written by this package (MJPEG or raw RGB, optionally with a metadata stream)
+// to continue adding frames to it, e.g. after a recorder was restarted. New frames are added after the existing ones,
+// and the file is finalized again when the writer is closed.
+//
+// If the file was finalized, its index is reloaded. If it was not (e.g. the recorder crashed), the index is rebuilt
+// from the chunks of the movi list, and a truncated last chunk is dropped.
+//
+// Options may be passed, but the structure of the file is kept: the size, frame rate, codec and metadata stream
+// are those of the file. Files with OpenDML indices or 'rec ' lists are not supported (ErrAppendUnsupported).
+// Chunks after the movi list (e.g. trailing custom chunks) are dropped. The poster frame (see WithPosterFrame())
+// can only be recorded if the file already records one. The companion timestamps and SRT files (see
+// AviWriter.SetTimestamp() and AviWriter.Annotate()) are reloaded, so they still cover the existing frames
+// when they are written again at Close().
+// Errors of cleaning up after a failure are joined to the returned error, like by New().
+func Open(aviFile string, opts ...Option) (awr AviWriter, err error) {
+	f, err := openFile(aviFile, true)
+	if err != nil {
+		return nil, err
+	}
+	aw := &aviWriter{
+		aviFile:  aviFile,
+		avif:     f,
+		avifName: aviFile,
+		scale:    1,
+		buf4:     make([]byte, 4),
+		quality:  jpeg.DefaultQuality,
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		cleanupErrs := []error{aw.closeMmap(), f.Close()}
+		if aw.idxf != nil {
+			cleanupErrs = append(cleanupErrs, aw.removeIdx())
+		}
+		err = joinCleanupErrs(err, cleanupErrs)
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ar, err := newReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	info := ar.info
+	if info.Scale <= 0 || info.Rate <= 0 {
+		return nil, ErrInvalidFPS
+	}
+
+	for _, opt := range opts {
+		opt(aw)
+	}
+	if aw.encrypt || aw.proxy != nil {
+		return nil, ErrAppendUnsupported
+	}
+	// The structure comes from the file
+	aw.width, aw.height, aw.fps, aw.scale = info.Width, info.Height, info.Rate, info.Scale
+	switch info.Codec {
+	case "MJPG":
+		aw.fourCC, aw.chunkID, aw.rawRGB, aw.passthrough = "MJPG", 0x63643030, false, false // "00dc"
+	case "DIB ", "\000\000\000\000":
+		aw.fourCC, aw.chunkID, aw.rawRGB, aw.passthrough = "DIB ", 0x62643030, true, false // "00db"
+	default:
+		return nil, ErrAppendUnsupported
+	}
+	aw.gray = ar.bitCount == 8
+	aw.odml, aw.recLists, aw.ffmpeg, aw.idxReserve, aw.aspectX, aw.aspectY = false, false, false, 0, 0, 0
+	aw.audio, aw.videoStreams = nil, nil
+	if aw.align > 0 && !aw.alignFrames {
+		aw.align = 0 // Only applies to the start of the movi list
+	}
+	if aw.rate != nil {
+		aw.rate.init(aw.frameRate())
+	}
+	if aw.throttle != nil {
+		aw.throttle.init(aw.frameTime(1))
+	}
+
+	if err = aw.parseForAppend(ar); err != nil {
+		return nil, err
+	}
+	if err = aw.createIdx(aviFile); err != nil {
+		return nil, err
+	}
+	appendPos, err := aw.loadIndex(ar)
+	if err != nil {
+		return nil, err
+	}
+	if aw.manifest {
+		if err = aw.hashFrames(ar); err != nil {
+			return nil, err
+		}
+	}
+	if err = aw.loadTimestamps(); err != nil {
+		return nil, err
+	}
+	if aw.annotations, err = aw.readSRT(); err != nil {
+		return nil, err
+	}
+
+	// Drop everything after the movi data (the old index), and continue in the movi list
+	if err = f.Truncate(appendPos); err != nil {
+		return nil, err
+	}
+	if _, err = f.Seek(appendPos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	aw.rw = aw.newRIFFWriter()
+	aw.rw.Reopen(4)              // 'RIFF' (nesting level 0)
+	aw.rw.Reopen(aw.moviPos - 4) // LIST 'movi' (nesting level 1)
+	if err = aw.rw.Err(); err != nil {
+		return nil, err
+	}
+
+	return aw, nil
+}
+
+// parseForAppend parses the headers of the file to be appended, and locates the fields to be updated at Close().
+func (aw *aviWriter) parseForAppend(ar *aviReader) error {
+	aw.moviPos = ar.moviPos
+	aw.framesCountFieldPos, aw.framesCountFieldPos2, aw.metaLengthFieldPos = -1, -1, -1
+
+	hasPoster := aw.hasPoster
+	aw.hasPoster = false // Only if the file has an IPST entry to be updated
+	err := ar.walk(12, ar.moviPos, func(id string, pos, size int64) error {
+		switch id {
+		case "idx1":
+			// Index written into reserved space ahead of the movi list: it becomes stale, turn it into JUNK
+			if _, err := ar.r.(io.WriterAt).WriteAt([]byte("JUNK"), pos-8); err != nil {
+				return err
+			}
+		case "LIST":
+			lt, err := ar.fourCC(pos)
+			if err != nil {
+				return err
+			}
+			if lt == "INFO" {
+				return aw.parseInfoForAppend(ar, pos+4, pos+size)
+			}
+			if lt != "hdrl" {
+				return nil
+			}
+			return ar.walk(pos+4, pos+size, func(id string, pos, size int64) error {
+				switch id {
+				case "avih":
+					data, err := ar.readChunk(pos, size)
+					if err != nil {
+						return err
+					}
+					if len(data) < 40 || binary.LittleEndian.Uint32(data[12:])&0x100 != 0 { // AVIF_ISINTERLEAVED
+						return ErrAppendUnsupported
+					}
+					aw.framesCountFieldPos = pos + 16
+				case "LIST":
+					lt, err := ar.fourCC(pos)
+					if err != nil {
+						return err
+					}
+					switch lt {
+					case "odml":
+						return ErrAppendUnsupported
+					case "strl":
+						return aw.parseStrlForAppend(ar, pos+4, pos+size)
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if aw.framesCountFieldPos < 0 || aw.framesCountFieldPos2 < 0 {
+		return ErrAppendUnsupported
+	}
+	if aw.hasPoster && !hasPoster {
+		aw.poster = ar.info.Poster // Keep the recorded poster frame if not chosen by an option
+	}
+	return nil
+}
+
+// parseInfoForAppend parses the INFO list of the file to be appended.
+// The poster frame can only be recorded if the file has an IPST entry (there is no room to add one).
+func (aw *aviWriter) parseInfoForAppend(ar *aviReader, start, end int64) error {
+	return ar.walk(start, end, func(id string, pos, size int64) error {
+		if id == "IPST" && size >= posterDigits {
+			aw.hasPoster, aw.posterPos = true, pos
+		}
+		return nil
+	})
+}
+
+// parseStrlForAppend parses a stream list of the file to be appended.
+func (aw *aviWriter) parseStrlForAppend(ar *aviReader, start, end int64) error {
+	return ar.walk(start, end, func(id string, pos, size int64) error {
+		switch id {
+		case "strh":
+			typ, err := ar.fourCC(pos)
+			if err != nil {
+				return err
+			}
+			switch {
+			case typ == "vids" && aw.framesCountFieldPos2 < 0:
+				aw.framesCountFieldPos2 = pos + 32
+			case typ == "txts" && !aw.metaStream:
+				aw.metaStream, aw.metaLengthFieldPos = true, pos+32
+			default:
+				return ErrAppendUnsupported
+			}
+		case "indx":
+			return ErrAppendUnsupported
+		}
+		return nil
+	})
+}
+
+// loadIndex loads the index of the file to be appended into the index file, and returns the position
+// where new chunks are to be appended.
+func (aw *aviWriter) loadIndex(ar *aviReader) (appendPos int64, err error) {
+	if ar.idx1Base == ar.moviPos && ar.idx1Pos > ar.moviPos {
+		// Finalized file with an index: reload it
+		data, err := ar.readChunk(ar.idx1Pos, ar.idx1Size&^0x0f)
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i+16 <= len(data); i += 16 {
+			e := data[i : i+16]
+			id := int32(binary.LittleEndian.Uint32(e))
+			flags := IndexFlag(binary.LittleEndian.Uint32(e[4:]))
+			pos := aw.moviPos + int64(binary.LittleEndian.Uint32(e[8:]))
+			size := int(binary.LittleEndian.Uint32(e[12:]))
+			if err := aw.loadIdxEntry(id, flags, pos, size); err != nil {
+				return 0, err
+			}
+		}
+		return ar.moviEnd + ar.moviEnd&0x01, nil
+	}
+
+	// No usable index: rebuild it from the chunks, up to the last complete one
+	appendPos = ar.moviPos + 4
+	err = ar.walk(ar.moviPos+4, ar.moviEnd, func(id string, pos, size int64) error {
+		if pos+size > ar.size {
+			return errStopWalk // Truncated chunk
+		}
+		if id == chunkName(aw.chunkID) || aw.metaStream && id == "01tx" {
+			if err := aw.loadIdxEntry(int32(binary.LittleEndian.Uint32([]byte(id))), FlagKeyFrame, pos-8, int(size)); err != nil {
+				return err
+			}
+		}
+		appendPos = pos + size + size&0x01
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return appendPos, nil
+}
+
+// loadIdxEntry writes an index entry of an existing chunk to the index file, and updates the frame state.
+func (aw *aviWriter) loadIdxEntry(chunkID int32, flags IndexFlag, chunkPos int64, size int) error {
+	if err := aw.writeIdxEntry(chunkID, flags, chunkPos, size); err != nil {
+		return err
+	}
+	if chunkID == aw.chunkID {
+		aw.frames++
+		aw.lastFramePos, aw.lastFrameSize, aw.lastFrameFlags = chunkPos, size, flags
+	}
+	return nil
+}
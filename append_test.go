@@ -0,0 +1,123 @@
+package mjpeg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOpen checks that frames appended to finalized, crashed and truncated videos are read back
+// after the existing ones.
+func TestOpen(t *testing.T) {
+	frames := testFrames(t, 5)
+	for _, c := range []struct {
+		name string
+		// finalize tells if the first session is closed, truncate is the number of bytes cut off the file
+		finalize bool
+		truncate int64
+		// kept is the number of kept frames of the first session
+		kept int
+	}{
+		{"finalized", true, 0, 3},
+		{"crashed", false, 0, 3},
+		{"truncated", false, 10, 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "append.avi")
+			awr, err := New(name, smallWidth, smallHeight, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames[:3] {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.finalize {
+				err = awr.Close()
+			} else {
+				aw := awr.(*aviWriter) // Crash: abandon the writer
+				err = errors.Join(aw.avif.Close(), aw.removeIdx())
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.truncate > 0 {
+				fi, err := os.Stat(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(name, fi.Size()-c.truncate); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if awr, err = Open(name); err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames[3:] {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := awr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, name, append(frames[:c.kept:c.kept], frames[3:]...))
+		})
+	}
+}
+
+// TestOpenKeepsSidecars checks that appending to a video keeps the timestamps and annotations
+// of the existing frames.
+func TestOpenKeepsSidecars(t *testing.T) {
+	data := smallJPEG(t)
+	name := filepath.Join(t.TempDir(), "append.avi")
+	awr, err := New(name, 16, 8, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		awr.SetTimestamp(time.Duration(i) * 40 * time.Millisecond)
+		if err := awr.AddFrame(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	awr.Annotate(1, "first session")
+	if err := awr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if awr, err = Open(name); err != nil {
+		t.Fatal(err)
+	}
+	awr.SetTimestamp(time.Second)
+	if err := awr.AddFrame(data); err != nil {
+		t.Fatal(err)
+	}
+	awr.Annotate(3, "second session")
+	if err := awr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := ReadTimestamps(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FrameTimestamp{{0, 0}, {1, 40 * time.Millisecond}, {2, 80 * time.Millisecond}, {3, time.Second}}
+	if !reflect.DeepEqual(ts, want) {
+		t.Errorf("got timestamps %v, want %v", ts, want)
+	}
+	srt, err := os.ReadFile(strings.TrimSuffix(name, ".avi") + ".srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSRT := "1\n00:00:00,033 --> 00:00:00,100\nfirst session\n\n2\n00:00:00,100 --> 00:00:00,133\nsecond session\n\n"
+	if string(srt) != wantSRT {
+		t.Errorf("got SRT %q, want %q", srt, wantSRT)
+	}
+}
@@ -0,0 +1,159 @@
+package mjpeg
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrQueueFull reports if a frame can't be queued because the queue of the AsyncWriter is full.
+	ErrQueueFull = errors.New("Frame queue full")
+
+	// ErrClosed reports if a frame is added to a closed AsyncWriter.
+	ErrClosed = errors.New("Writer closed")
+)
+
+// AsyncWriter is an asynchronous facade of an AviWriter: frames are queued, and written
+// by a background goroutine, so the caller (e.g. a real-time capture loop) does not block on disk stalls.
+// Its methods are safe for concurrent use.
+type AsyncWriter struct {
+	// aw is the underlying writer
+	aw AviWriter
+	// queue is the queue of frames to write
+	queue chan []byte
+	// errs is the channel errors of writing frames are sent on
+	errs chan error
+	// done is closed when the background goroutine ends
+	done chan struct{}
+	// closeOnce guards closing, closeErr is its result
+	closeOnce sync.Once
+	closeErr  error
+
+	// mu protects the fields below
+	mu sync.Mutex
+	// cond signals when pending changes
+	cond *sync.Cond
+	// pending is the number of frames queued but not yet written
+	pending int
+	// err is the first error since the last Flush()
+	err error
+	// closed tells if the writer is closed
+	closed bool
+}
+
+// NewAsync returns a new AsyncWriter writing frames to aw, queueing at most queueSize frames.
+// The AsyncWriter takes ownership of aw: aw must not be used directly after this,
+// and it is closed by AsyncWriter.Close().
+func NewAsync(aw AviWriter, queueSize int) *AsyncWriter {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	a := &AsyncWriter{
+		aw:    aw,
+		queue: make(chan []byte, queueSize),
+		errs:  make(chan error, queueSize),
+		done:  make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// run writes the queued frames until the queue is closed.
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for data := range a.queue {
+		err := a.aw.AddFrame(data)
+
+		a.mu.Lock()
+		if err != nil {
+			if a.err == nil {
+				a.err = err
+			}
+			select {
+			case a.errs <- err:
+			default: // Nobody is listening, the error is still reported by Flush()
+			}
+		}
+		a.pending--
+		a.cond.Broadcast()
+		a.mu.Unlock()
+	}
+}
+
+// AddFrame queues a frame from a JPEG encoded data slice, and returns immediately.
+// The data is copied, so the caller may reuse the slice.
+// ErrQueueFull is returned if the queue is full (the frame is dropped),
+// errors of writing the frame are reported on the Errors() channel and by Flush().
+func (a *AsyncWriter) AddFrame(jpegData []byte) error {
+	return a.enqueue(jpegData, true)
+}
+
+// AddFrameNoCopy is like AddFrame, but the frame is written directly from the given slice, without copying it.
+// The writer takes ownership of the slice: the caller must not modify it until Flush() or Close() returns
+// (e.g. a pool of capture buffers can be recycled after each Flush()). If an error is returned,
+// the slice is not queued, and the caller may reuse it immediately.
+func (a *AsyncWriter) AddFrameNoCopy(jpegData []byte) error {
+	return a.enqueue(jpegData, false)
+}
+
+// enqueue queues a frame, copying its data if copyData is true.
+func (a *AsyncWriter) enqueue(jpegData []byte, copyData bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return ErrClosed
+	}
+	if len(a.queue) == cap(a.queue) {
+		return ErrQueueFull
+	}
+	if copyData {
+		jpegData = append([]byte(nil), jpegData...)
+	}
+	a.queue <- jpegData // Can't block: only enqueue() sends, and it is serialized by the lock
+	a.pending++
+	return nil
+}
+
+// Errors returns the channel on which errors of writing frames are sent.
+// Errors are not sent (but are still reported by Flush()) if the channel is full.
+// The channel is closed by Close().
+func (a *AsyncWriter) Errors() <-chan error {
+	return a.errs
+}
+
+// Flush waits until the queued frames are written.
+// Returns the first error of writing frames since the last Flush().
+func (a *AsyncWriter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.pending > 0 {
+		a.cond.Wait()
+	}
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Close writes the queued frames, and finalizes and closes the underlying AviWriter.
+// Returns the first error of writing frames since the last Flush(), or the error of closing.
+// Close may be called multiple times (e.g. deferred), subsequent calls return the result of the first call.
+func (a *AsyncWriter) Close() error {
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		close(a.queue)
+		a.mu.Unlock()
+
+		<-a.done
+		close(a.errs)
+
+		a.closeErr = a.Flush()
+		if cerr := a.aw.Close(); a.closeErr == nil {
+			a.closeErr = cerr
+		}
+	})
+	return a.closeErr
+}
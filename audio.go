@@ -0,0 +1,233 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"time"
+)
+
+var (
+	// ErrNoAudio reports if audio is added to a video without an audio stream.
+	ErrNoAudio = errors.New("No audio stream")
+
+	// ErrPartialSample reports if audio data does not consist of whole samples (of all channels).
+	ErrPartialSample = errors.New("Partial audio sample")
+)
+
+// audioEnd is the time passed to audioSource.next() to get the rest of the audio.
+const audioEnd = time.Duration(math.MaxInt64)
+
+// audioStream holds the state of the audio stream of a video (see WithPCMAudio(), MuxWav() and MuxMP3()).
+type audioStream struct {
+	// format is the data of the stream format chunk (a WAVEFORMATEX structure)
+	format []byte
+	// scale and rate are the dwScale and dwRate of the stream header: rate/scale units per second
+	scale, rate int32
+	// sampleSize is the dwSampleSize of the stream header: the size of a unit, 0 if units are chunks of varying size
+	sampleSize int32
+
+	// chunkID is the id of the audio chunks, e.g. "01wb"
+	chunkID int32
+	// lengthFieldPos is the position of the dwLength field of the stream header
+	lengthFieldPos int64
+	// length is the number of units written so far
+	length int64
+	// maxChunk is the size of the largest audio chunk
+	maxChunk int
+}
+
+// audioSource is the source of an audio stream to mux with a video.
+type audioSource interface {
+	// stream returns the properties of the audio stream.
+	stream() *audioStream
+
+	// next returns the next chunk of the audio played before time t, and the number of units in it.
+	// Returns nil data if there is no more audio before t.
+	next(t time.Duration) (data []byte, units int64, err error)
+}
+
+// WithPCMAudio returns an Option which adds a PCM audio stream to the video with the given sample rate
+// (in Hz), number of channels and bits per sample (8 or 16), e.g. for recording a microphone along with a camera.
+// Audio is added with AviWriter.AddAudio(), interleaved with the frames in the order they are added
+// (see WithAVSync() to keep the audio and the video in sync).
+//
+// Audio chunks are not indexed by OpenDML indices (see WithODMLIndex()).
+// Not supported by Open(), Resume(), Checkpoint() and NewPlan().
+func WithPCMAudio(sampleRate, channels, bitsPerSample int) Option {
+	return func(aw *aviWriter) {
+		blockAlign := channels * (bitsPerSample + 7) / 8
+		format := make([]byte, 18)                                               // WAVEFORMATEX
+		binary.LittleEndian.PutUint16(format, 1)                                 // wFormatTag: WAVE_FORMAT_PCM
+		binary.LittleEndian.PutUint16(format[2:], uint16(channels))              // nChannels
+		binary.LittleEndian.PutUint32(format[4:], uint32(sampleRate))            // nSamplesPerSec
+		binary.LittleEndian.PutUint32(format[8:], uint32(sampleRate*blockAlign)) // nAvgBytesPerSec
+		binary.LittleEndian.PutUint16(format[12:], uint16(blockAlign))           // nBlockAlign
+		binary.LittleEndian.PutUint16(format[14:], uint16(bitsPerSample))        // wBitsPerSample
+		binary.LittleEndian.PutUint16(format[16:], 0)                            // cbSize: no extra fields
+		aw.audio = &audioStream{
+			format:     format,
+			scale:      int32(blockAlign),
+			rate:       int32(sampleRate * blockAlign),
+			sampleSize: int32(blockAlign),
+		}
+	}
+}
+
+// AddAudio implements AviWriter.AddAudio().
+func (aw *aviWriter) AddAudio(data []byte) error {
+	if aw.audio == nil {
+		return aw.notifyErr(ErrNoAudio)
+	}
+	ss := int(aw.audio.sampleSize)
+	if ss == 0 || len(data)%ss != 0 {
+		return aw.notifyErr(ErrPartialSample)
+	}
+	if len(data) == 0 || aw.paused && aw.pausePolicy == PauseFreeze {
+		return nil
+	}
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	return aw.notifyErr(aw.addAudio(data, int64(len(data)/ss)))
+}
+
+// audioTime returns the duration of the audio written so far.
+func (aw *aviWriter) audioTime() time.Duration {
+	a := aw.audio
+	return time.Duration(float64(a.length) * float64(a.scale) / float64(a.rate) * float64(time.Second))
+}
+
+// withAudio returns an Option which adds an audio stream with the given properties to the video.
+func withAudio(as *audioStream) Option {
+	return func(aw *aviWriter) {
+		aw.audio = as
+	}
+}
+
+// writeAudioStreamHeader writes the stream list of the audio stream.
+func (aw *aviWriter) writeAudioStreamHeader() {
+	wstr, wint32, wint16 := aw.writeStr, aw.writeInt32, aw.writeInt16
+	a := aw.audio
+	a.chunkID = 0x62773130 // "01wb" audio chunk of stream 1
+	if aw.metaStream {
+		a.chunkID = 0x62773230 // "02wb" audio chunk of stream 2
+	}
+
+	aw.pushList("strl") // LIST chunk: stream headers (nesting level 2)
+	wstr("strh")        // Stream header
+	wint32(56)          // Length of the strh sub-chunk
+	wstr("auds")        // fccType - type of data stream - here 'auds' for audio stream
+	wint32(0)           // fccHandler, the codec is given by the format tag of strf
+	wint32(0)           // dwFlags
+	wint32(0)           // wPriority, wLanguage
+	wint32(0)           // dwInitialFrames
+	wint32(a.scale)     // dwScale
+	wint32(a.rate)      // dwRate, rate/scale: units per second
+	wint32(0)           // dwStart
+	a.lengthFieldPos = aw.currentPos()
+	wint32(0)            // dwLength, number of units (filled at Close())
+	wint32(0)            // dwSuggestedBufferSize (filled at Close())
+	wint32(-1)           // dwQuality, -1: default quality
+	wint32(a.sampleSize) // dwSampleSize, the size of a unit (0: each chunk is a unit)
+	wint16(0)            // left of rcFrame (unused)
+	wint16(0)            //   ..top
+	wint16(0)            //   ..right
+	wint16(0)            //   ..bottom
+
+	aw.pushChunk("strf") // stream format chunk: the WAVEFORMATEX of the audio (nesting level 3)
+	aw.write(a.format)
+	aw.pop() // 'strf' chunk finished (nesting level 3)
+	aw.pop() // LIST 'strl' finished (nesting level 2)
+}
+
+// addAudio writes an audio chunk with the given data, holding the given number of units.
+func (aw *aviWriter) addAudio(data []byte, units int64) error {
+	if err := aw.checkSize(9+int64(len(data)), 1); err != nil {
+		return err
+	}
+	pos := aw.currentPos()
+	return fatal(aw.do(func() error {
+		// "01wb" or "02wb" audio chunk (nesting level 2)
+		if err := aw.writeChunk(chunkName(aw.audio.chunkID), data); err != nil {
+			return err
+		}
+		if err := aw.writeIdxEntry(aw.audio.chunkID, FlagKeyFrame, pos, len(data)); err != nil {
+			return err
+		}
+
+		aw.audio.length += units
+		if len(data) > aw.audio.maxChunk {
+			aw.audio.maxChunk = len(data)
+		}
+		return nil
+	}))
+}
+
+// finalizeAudio fills the length and buffer size fields of the audio stream header.
+func (aw *aviWriter) finalizeAudio() {
+	pos := aw.currentPos()
+	aw.seek(aw.audio.lengthFieldPos, 0)
+	aw.writeInt32(int32(aw.audio.length))   // dwLength
+	aw.writeInt32(int32(aw.audio.maxChunk)) // dwSuggestedBufferSize
+	aw.seek(pos, 0)
+}
+
+// muxAudio writes the frames of the video aviPath and the audio of src into a new video file outPath,
+// without re-encoding frames. Each frame is preceded by the audio played until its end,
+// the rest of the audio (if it is longer than the video) is written after the last frame.
+func muxAudio(aviPath, outPath string, src audioSource) (err error) {
+	ar, err := NewReader(aviPath)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if info.Scale <= 0 || info.Rate <= 0 {
+		return ErrInvalidFPS
+	}
+	opts := append([]Option{withAudio(src.stream()), withScale(info.Scale)}, codecOptions(ar.(*aviReader))...)
+
+	awr, err := New(outPath, info.Width, info.Height, info.Rate, opts...)
+	if err != nil {
+		return err
+	}
+	aw := awr.(*aviWriter)
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(outPath)})
+		}
+	}()
+
+	// audioUntil writes the audio played before t
+	audioUntil := func(t time.Duration) error {
+		for {
+			data, units, err := src.next(t)
+			if err != nil || data == nil {
+				return err
+			}
+			if err = aw.notifyErr(aw.addAudio(data, units)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := 0; i < info.Frames; i++ {
+		if err = audioUntil(timestamp(i+1, info.FPS())); err != nil {
+			return err
+		}
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		if err = aw.AddFrameFlags(data, IndexFlag(ar.(*aviReader).frames[i].flags)); err != nil {
+			return err
+		}
+	}
+	return audioUntil(audioEnd)
+}
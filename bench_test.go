@@ -0,0 +1,193 @@
+package mjpeg
+
+// Benchmarks of the writer and the reader, to validate and guard performance-motivated changes.
+// Compare runs before and after a change with benchstat:
+//
+//	go test -run=^$ -bench=. -count=10 > old.txt
+//	(apply the change)
+//	go test -run=^$ -bench=. -count=10 > new.txt
+//	benchstat old.txt new.txt
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// Dimensions of the generated test frames.
+const benchWidth, benchHeight = 640, 480
+
+// testImage generates a test image: a gradient with some noise (so it compresses like camera footage),
+// varying with seed.
+func testImage(seed int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, benchWidth, benchHeight))
+	rnd := rand.New(rand.NewSource(int64(seed)))
+	for y := 0; y < benchHeight; y++ {
+		for x := 0; x < benchWidth; x++ {
+			p := img.Pix[img.PixOffset(x, y):]
+			n := uint8(rnd.Intn(16))
+			p[0], p[1], p[2], p[3] = uint8(x+seed)+n, uint8(y)+n, uint8(x+y)+n, 255
+		}
+	}
+	return img
+}
+
+// testJPEG generates a JPEG encoded test frame.
+func testJPEG(tb testing.TB, seed int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(seed), nil); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testVideo generates a test video of the given number of frames in dir, and returns its name.
+func testVideo(tb testing.TB, dir string, frames int) string {
+	name := filepath.Join(dir, "test.avi")
+	aw, err := New(name, benchWidth, benchHeight, 25)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	data := [][]byte{testJPEG(tb, 0), testJPEG(tb, 1)}
+	for i := 0; i < frames; i++ {
+		if err := aw.AddFrame(data[i%2]); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return name
+}
+
+// newBenchWriter returns a writer writing into a temporary directory of the benchmark.
+func newBenchWriter(b *testing.B, opts ...Option) AviWriter {
+	aw, err := New(filepath.Join(b.TempDir(), "bench.avi"), benchWidth, benchHeight, 25, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return aw
+}
+
+// BenchmarkAddFrame measures the throughput of adding JPEG frames.
+func BenchmarkAddFrame(b *testing.B) {
+	data := testJPEG(b, 0)
+	aw := newBenchWriter(b)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := aw.AddFrame(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := aw.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkAddImage measures encoding and muxing images, with image/jpeg and with the built-in encoder.
+func BenchmarkAddImage(b *testing.B) {
+	img := testImage(0)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"stdlib", nil},
+		{"420", []Option{WithSubsampling(Subsampling420)}},
+		{"444", []Option{WithSubsampling(Subsampling444)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			aw := newBenchWriter(b, bc.opts...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := aw.AddImage(img); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if err := aw.Close(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkRecLists measures adding frames grouped into 'rec ' lists of various sizes (see WithRecListFrames()),
+// reporting the resulting file size per frame too (rec lists are padded to 2 KB).
+func BenchmarkRecLists(b *testing.B) {
+	data := testJPEG(b, 0)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"none", nil},
+		{"1", []Option{WithRecListFrames(1)}},
+		{"4", []Option{WithRecListFrames(4)}},
+		{"16", []Option{WithRecListFrames(16)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			aw := newBenchWriter(b, bc.opts...)
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := aw.AddFrame(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(aw.(*aviWriter).currentPos())/float64(b.N), "file-B/frame")
+			if err := aw.Close(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// BenchmarkClose measures finalizing a large file (copying the index and updating the headers).
+func BenchmarkClose(b *testing.B) {
+	data := make([]byte, 256) // Only the number of index entries matters, not the frame data
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"idx1", nil},
+		{"odml", []Option{WithODMLIndex()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				aw := newBenchWriter(b, bc.opts...)
+				for j := 0; j < 20000; j++ {
+					if err := aw.AddFrame(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StartTimer()
+				if err := aw.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkReaderFrame measures random access to the frames of a video.
+func BenchmarkReaderFrame(b *testing.B) {
+	const frames = 1000
+	ar, err := NewReader(testVideo(b, b.TempDir(), frames))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ar.Close()
+	rnd := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ar.Frame(rnd.Intn(frames)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package mjpeg
+
+import (
+	"io"
+	"os"
+)
+
+// Buffer is an in-memory io.ReadWriteSeeker, a video can be written into it with NewWriter()
+// without a file system, e.g. in browser (js/wasm) apps: the finished video can be handed over
+// to JavaScript (e.g. with js.CopyBytesToJS()) to create a Blob.
+// The zero value is an empty buffer ready to use.
+type Buffer struct {
+	// data is the content of the buffer
+	data []byte
+	// pos is the current position
+	pos int64
+}
+
+// Bytes returns the content of the buffer. It is valid until the next modification of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Len returns the size of the buffer.
+func (b *Buffer) Len() int {
+	return len(b.data)
+}
+
+// Reset empties the buffer.
+func (b *Buffer) Reset() {
+	b.data, b.pos = b.data[:0], 0
+}
+
+// Read implements io.Reader.
+func (b *Buffer) Read(p []byte) (int, error) {
+	if b.pos >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[b.pos:])
+	b.pos += int64(n)
+	return n, nil
+}
+
+// Write implements io.Writer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	n, err := b.WriteAt(p, b.pos)
+	b.pos += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off > int64(len(b.data)) {
+		b.Truncate(off)
+	}
+	n := copy(b.data[off:], p)
+	b.data = append(b.data, p[n:]...)
+	return len(p), nil
+}
+
+// Seek implements io.Seeker.
+func (b *Buffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += int64(len(b.data))
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+// Truncate changes the size of the buffer, extending it with zeros if needed.
+func (b *Buffer) Truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if size <= int64(len(b.data)) {
+		b.data = b.data[:size]
+		return nil
+	}
+	b.data = append(b.data, make([]byte, size-int64(len(b.data)))...)
+	return nil
+}
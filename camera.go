@@ -0,0 +1,267 @@
+package mjpeg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CameraConfig configures reading the MJPEG streams of HTTP (IP) cameras (multipart/x-mixed-replace responses),
+// see NewCameraReader(). The zero value autodetects everything; the knobs are for broken servers.
+type CameraConfig struct {
+	// Boundary is the boundary of the parts (with or without the leading "--"; boundary lines are recognized
+	// with any number of leading dashes). If empty, it is taken from the Content-Type header,
+	// or if that has none, from the first line of the body starting with "--"
+	Boundary string
+	// ScanMarkers tells to find the end of the frames by scanning their JPEG markers, ignoring the
+	// Content-Length headers of the parts (for servers sending wrong lengths).
+	// By default the Content-Length is used if present, and markers are scanned if not
+	ScanMarkers bool
+	// AnyContentType tells to accept parts of any content type as frames. By default parts with a content type
+	// other than image/*, application/octet-stream or none (e.g. text/plain status parts) are skipped
+	AnyContentType bool
+	// Client is the HTTP client used by AddJpegFromCamera(), http.DefaultClient if nil
+	Client *http.Client
+}
+
+// cameraReader is a FrameReader of HTTP camera streams.
+type cameraReader struct {
+	r   *bufio.Reader
+	cfg CameraConfig
+	// boundary is the boundary without leading dashes, empty if not yet known
+	boundary string
+	// raw tells if the stream turned out to be a raw MJPEG stream (no parts)
+	raw bool
+	// scanner finds frames by their markers
+	scanner mjpegStreamReader
+	buf     []byte
+	// line is the buffer of lines longer than the buffer of r
+	line []byte
+}
+
+// NewCameraReader returns a FrameReader reading the MJPEG stream of an HTTP (IP) camera: the body r of
+// a multipart/x-mixed-replace response with the given Content-Type header value (may be empty).
+// Servers are tolerated to omit the blank line after the part headers, to send parts without Content-Length
+// (frames are then split by their JPEG markers), and to send raw MJPEG streams (concatenated JPEG images).
+func NewCameraReader(r io.Reader, contentType string, cfg CameraConfig) FrameReader {
+	cr := &cameraReader{r: bufio.NewReader(r), cfg: cfg}
+	cr.scanner.r = cr.r
+	b := cfg.Boundary
+	if b == "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			b = params["boundary"]
+		}
+	}
+	cr.boundary = strings.TrimLeft(b, "-")
+	return cr
+}
+
+// AddJpegFromCamera adds the frames of the MJPEG stream of the HTTP (IP) camera at url to aw,
+// until the stream ends or ctx is cancelled (which is not an error). Returns the number of added frames.
+// See RecordCamera() for recording flaky cameras.
+func AddJpegFromCamera(ctx context.Context, aw AviWriter, url string, cfg CameraConfig) (n int, err error) {
+	fr, body, err := openCamera(ctx, url, cfg)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = nil
+		}
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err = AddEncodedFrames(aw, fr)
+	if ctx.Err() != nil {
+		err = nil
+	}
+	return n, err
+}
+
+// openCamera requests the MJPEG stream of the HTTP camera at url.
+// The returned body must be closed.
+func openCamera(ctx context.Context, url string, cfg CameraConfig) (fr FrameReader, body io.ReadCloser, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("Camera request failed: %s", resp.Status)
+	}
+	return NewCameraReader(resp.Body, resp.Header.Get("Content-Type"), cfg), resp.Body, nil
+}
+
+// ReadFrame implements FrameReader.ReadFrame().
+func (cr *cameraReader) ReadFrame() ([]byte, error) {
+	for {
+		if cr.raw {
+			return cr.scanner.ReadFrame()
+		}
+		length, accept, err := cr.nextPart()
+		if err != nil {
+			return nil, err
+		}
+		if cr.raw {
+			continue
+		}
+		if !accept {
+			continue // The rest of the part is skipped when looking for the next boundary
+		}
+		if length < 0 || cr.cfg.ScanMarkers {
+			return cr.scanner.ReadFrame()
+		}
+
+		if length > maxStreamFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		if cap(cr.buf) < length {
+			cr.buf = make([]byte, length)
+		}
+		cr.buf = cr.buf[:length]
+		if _, err := io.ReadFull(cr.r, cr.buf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if len(cr.buf) < 2 || cr.buf[0] != 0xff || cr.buf[1] != markerSOI {
+			continue // Not a JPEG image
+		}
+		return cr.buf, nil
+	}
+}
+
+// nextPart skips to the next part, and reads its headers.
+// Returns the Content-Length of the part (-1 if unknown), and if it is to be returned as a frame.
+// If no boundary is found but a JPEG image, the stream is switched to raw mode.
+func (cr *cameraReader) nextPart() (length int, accept bool, err error) {
+	if cr.boundary == "" {
+		if err := cr.detect(); err != nil || cr.raw {
+			return -1, false, err
+		}
+	}
+
+	// Find the boundary line
+	for {
+		line, err := cr.readLine()
+		if err != nil {
+			return 0, false, err
+		}
+		switch string(bytes.TrimLeft(line, "-")) {
+		case cr.boundary:
+		case cr.boundary + "--":
+			return 0, false, io.EOF // Closing boundary
+		default:
+			continue
+		}
+		break
+	}
+
+	// Part headers, until a blank line or the start of the image
+	length, accept = -1, true
+	for !cr.atSOI() {
+		line, err := cr.readLine()
+		if err != nil {
+			return 0, false, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		key, value, ok := strings.Cut(string(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "content-length":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				length = n
+			}
+		case "content-type":
+			mt, _, _ := mime.ParseMediaType(value)
+			accept = cr.cfg.AnyContentType || mt == "" || strings.HasPrefix(mt, "image/") || mt == "application/octet-stream"
+		}
+	}
+	return length, accept, nil
+}
+
+// detect detects the boundary from the first line starting with "--", or switches to raw mode if a JPEG image
+// comes first. After detecting the boundary, the boundary line is still to be read.
+func (cr *cameraReader) detect() error {
+	for lineStart := true; ; {
+		p, err := cr.r.Peek(2)
+		if err != nil {
+			return err
+		}
+		switch {
+		case p[0] == 0xff && p[1] == markerSOI:
+			cr.raw = true
+			return nil
+		case lineStart && p[0] == '-' && p[1] == '-':
+			for n := 3; ; n++ {
+				line, err := cr.r.Peek(n)
+				if err != nil {
+					break // Not a line of a boundary (EOF is reported by the next peek)
+				}
+				if line[n-1] == '\n' {
+					cr.boundary = strings.TrimLeft(string(bytes.TrimSpace(line)), "-")
+					break
+				}
+			}
+			if cr.boundary != "" {
+				return nil
+			}
+		}
+		lineStart = p[0] == '\n'
+		cr.r.Discard(1)
+	}
+}
+
+// atSOI tells if a start of image marker follows in the stream, optionally after a line break
+// (which is discarded then).
+func (cr *cameraReader) atSOI() bool {
+	for i := 0; i <= 2; i++ {
+		p, err := cr.r.Peek(i + 2)
+		if err != nil {
+			return false
+		}
+		if p[i] == 0xff && p[i+1] == markerSOI {
+			cr.r.Discard(i)
+			return true
+		}
+		if p[i] != '\r' && p[i] != '\n' {
+			return false
+		}
+	}
+	return false
+}
+
+// readLine reads a line, without the line break and surrounding spaces.
+// The line is only valid until the next read. Lines longer than the buffer are truncated.
+func (cr *cameraReader) readLine() ([]byte, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		cr.line = append(cr.line[:0], line...)
+		for err == bufio.ErrBufferFull {
+			_, err = cr.r.ReadSlice('\n') // E.g. the binary data of a skipped part
+		}
+		line = cr.line
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	return bytes.TrimSpace(line), nil
+}
@@ -0,0 +1,119 @@
+package mjpeg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAddJpegFromCamera checks that the frames of camera streams of various (broken) servers are recorded.
+func TestAddJpegFromCamera(t *testing.T) {
+	frames := testFrames(t, 3)
+	for _, c := range []struct {
+		name string
+		// contentType is the Content-Type of the response, part writes a part of a frame
+		contentType string
+		part        func(w http.ResponseWriter, data []byte)
+	}{
+		{"standard", "multipart/x-mixed-replace; boundary=frame", func(w http.ResponseWriter, data []byte) {
+			fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(data))
+			w.Write(data)
+			fmt.Fprint(w, "\r\n--frame\r\nContent-Type: text/plain\r\n\r\nstatus: ok\r\n") // Skipped
+		}},
+		{"no length, no blank line", "multipart/x-mixed-replace", func(w http.ResponseWriter, data []byte) {
+			fmt.Fprint(w, "----frame\r\nContent-Type: image/jpeg\r\n")
+			w.Write(data)
+			fmt.Fprint(w, "\r\n")
+		}},
+		{"raw", "image/jpeg", func(w http.ResponseWriter, data []byte) {
+			w.Write(data)
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", c.contentType)
+				for _, data := range frames {
+					c.part(w, data)
+				}
+			}))
+			defer ts.Close()
+
+			name := filepath.Join(t.TempDir(), "camera.avi")
+			awr, err := New(name, smallWidth, smallHeight, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := AddJpegFromCamera(context.Background(), awr, ts.URL, CameraConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(frames) {
+				t.Errorf("got %d frames, want %d", n, len(frames))
+			}
+			if err := awr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, name, frames)
+		})
+	}
+}
+
+// TestAddJpegFromCameraStatus checks that failed camera requests are reported.
+func TestAddJpegFromCameraStatus(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	awr, err := New(filepath.Join(t.TempDir(), "camera.avi"), smallWidth, smallHeight, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer awr.Close()
+	if _, err := AddJpegFromCamera(context.Background(), awr, ts.URL, CameraConfig{}); err == nil {
+		t.Error("got no error for a 404 response")
+	}
+}
+
+// TestRecordCamera checks that failing to connect before the first frame doesn't start a new segment with GapCut.
+func TestRecordCamera(t *testing.T) {
+	frames := testFrames(t, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests++; requests {
+		case 1: // Camera not ready yet
+			http.NotFound(w, r)
+		case 2:
+			w.Header().Set("Content-Type", "image/jpeg")
+			for _, data := range frames {
+				w.Write(data)
+			}
+		default: // Stop recording at the reconnect
+			cancel()
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	var names []string
+	newWriter := func(segment int) (AviWriter, error) {
+		names = append(names, filepath.Join(dir, fmt.Sprintf("camera-%d.avi", segment)))
+		return New(names[segment], smallWidth, smallHeight, 10)
+	}
+	cfg := RecorderConfig{Reconnect: RetryPolicy{Delay: time.Millisecond}, Gap: GapCut}
+	n, err := RecordCamera(ctx, ts.URL, newWriter, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(frames) {
+		t.Errorf("got %d frames, want %d", n, len(frames))
+	}
+	if len(names) != 1 {
+		t.Fatalf("got %d segments, want 1", len(names))
+	}
+	checkFrames(t, names[0], frames)
+}
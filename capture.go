@@ -0,0 +1,130 @@
+package mjpeg
+
+import "time"
+
+// CaptureConfig configures a CaptureIngest, see NewCaptureIngest().
+type CaptureConfig struct {
+	// MaxGap is the longest gap between capture timestamps filled by repeating the last frame;
+	// after a longer gap (e.g. the camera was restarted) the timeline continues from the next slot.
+	// 0 means gaps of any length are filled.
+	MaxGap time.Duration
+}
+
+// CaptureStats are the statistics of a CaptureIngest.
+type CaptureStats struct {
+	// Frames is the number of frames received
+	Frames int
+	// Written is the number of frames written
+	Written int
+	// Duplicated is the number of frame slots filled by repeating the last frame (frames dropped at the source)
+	Duplicated int
+	// Dropped is the number of frames dropped because their slot was already filled (frames arriving faster than the FPS)
+	Dropped int
+	// Late is the number of frames dropped because their timestamp was before the last written frame
+	Late int
+}
+
+// CaptureIngest adds raw MJPEG frames with capture timestamps, as delivered by cameras emitting MJPEG natively
+// (e.g. through V4L2 or DirectShow wrappers), to an AviWriter without re-encoding them,
+// keeping the timeline of the video correct.
+//
+// Each timestamp is mapped to the nearest frame slot of the video (of 1/fps duration, counted from the
+// timestamp of the first frame). Slots of frames dropped by the camera or the driver are filled by repeating
+// the last frame (using a duplicate index entry, without storing the frame again), frames in an already filled
+// slot (the camera delivering faster than the FPS) are dropped, and late frames (delivered out of order,
+// with a timestamp before that of the last written frame) are dropped as well.
+// The capture timestamps of the written frames are recorded with AviWriter.SetTimestamp().
+type CaptureIngest struct {
+	// aw is the writer to add frames to
+	aw AviWriter
+	// maxGap is the longest gap to fill, see CaptureConfig.MaxGap
+	maxGap time.Duration
+	// slotDur is the duration of a frame slot
+	slotDur time.Duration
+
+	// started tells if the first frame has been received
+	started bool
+	// base is the timestamp of slot 0
+	base time.Duration
+	// baseSlot is the slot of the base timestamp (changes when the timeline is continued after a long gap)
+	baseSlot int
+	// last is the timestamp of the last written frame
+	last time.Duration
+	// lastJpeg is the last written frame, used if aw doesn't support duplicate index entries
+	lastJpeg []byte
+
+	stats CaptureStats
+}
+
+// NewCaptureIngest returns a new CaptureIngest which adds frames to aw, whose frame rate is fps.
+// fps should be the frame rate the camera is configured to.
+func NewCaptureIngest(aw AviWriter, fps int32, cfg CaptureConfig) *CaptureIngest {
+	ci := &CaptureIngest{aw: aw, maxGap: cfg.MaxGap, slotDur: time.Second}
+	if fps > 0 {
+		ci.slotDur = time.Second / time.Duration(fps)
+	}
+	return ci
+}
+
+// Stats returns the statistics of the frames added so far.
+func (ci *CaptureIngest) Stats() CaptureStats {
+	return ci.stats
+}
+
+// AddFrame adds a JPEG encoded frame with its capture timestamp. Timestamps are only compared to each other,
+// so they may be relative to any epoch, e.g. the monotonic clock of V4L2 buffers.
+func (ci *CaptureIngest) AddFrame(jpegData []byte, timestamp time.Duration) error {
+	ci.stats.Frames++
+	if !ci.started {
+		ci.started, ci.base = true, timestamp
+	} else if timestamp < ci.last {
+		ci.stats.Late++
+		return nil
+	}
+
+	slot := ci.slot(timestamp)
+	written := ci.stats.Written + ci.stats.Duplicated // Slots filled so far
+	if ci.stats.Written == 0 {
+		// No frame to repeat (e.g. adding the first frame failed): the timeline starts with this frame
+		ci.base, ci.baseSlot, slot = timestamp, 0, 0
+	}
+	if slot < written {
+		ci.stats.Dropped++
+		return nil
+	}
+	if ci.maxGap > 0 && timestamp-ci.last > ci.maxGap && ci.stats.Written > 0 {
+		// Continue the timeline from the next slot
+		ci.base, ci.baseSlot = timestamp, written
+		slot = written
+	}
+	for ; written < slot; written++ {
+		if err := ci.addDup(); err != nil {
+			return err
+		}
+		ci.stats.Duplicated++
+	}
+
+	ci.aw.SetTimestamp(timestamp)
+	if err := ci.aw.AddFrame(jpegData); err != nil {
+		return err
+	}
+	ci.stats.Written++
+	ci.last = timestamp
+	if _, ok := ci.aw.(*aviWriter); !ok {
+		ci.lastJpeg = append(ci.lastJpeg[:0], jpegData...)
+	}
+	return nil
+}
+
+// slot returns the frame slot nearest to the timestamp.
+func (ci *CaptureIngest) slot(timestamp time.Duration) int {
+	return ci.baseSlot + int((timestamp-ci.base+ci.slotDur/2)/ci.slotDur)
+}
+
+// addDup repeats the last written frame.
+func (ci *CaptureIngest) addDup() error {
+	if aw, ok := ci.aw.(*aviWriter); ok {
+		return aw.notifyErr(aw.addDupFrame())
+	}
+	return ci.aw.AddFrame(ci.lastJpeg)
+}
@@ -0,0 +1,246 @@
+package mjpeg
+
+import (
+	"errors"
+	"image/jpeg"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrCheckpointUnsupported reports if the state of a writer can't be checkpointed.
+var ErrCheckpointUnsupported = errors.New("Checkpoint unsupported")
+
+// State is the persistable state of an AviWriter, see AviWriter.Checkpoint() and Resume().
+// It can be serialized e.g. with encoding/json.
+type State struct {
+	// AviFile is the name of the video file
+	AviFile string
+	// IdxFile is the name of the temporary index file
+	IdxFile string
+
+	// Width, Height and FPS are the properties of the video
+	Width, Height, FPS int32
+	// Scale is the dwScale of the video stream: the frame rate is FPS/Scale, 0 means 1
+	Scale int32
+	// FourCC is the FOURCC code of the codec
+	FourCC string
+	// ChunkID is the id of video frame chunks
+	ChunkID int32
+	// RawRGB, Passthrough, MetaStream and RecLists are the codec and structure settings
+	RawRGB, Passthrough, MetaStream, RecLists bool
+	// Gray tells if frames are grayscale
+	Gray bool
+	// RecFrames is the number of frames grouped in a 'rec ' list, see WithRecListFrames()
+	RecFrames int
+	// Align is the alignment of frame chunks, 0 if not aligned
+	Align int64
+	// IdxReserve is the number of index entries reserved ahead of the movi list
+	IdxReserve int
+	// IdxReservePos is the position of the chunk reserving space for the index
+	IdxReservePos int64
+
+	// Pos is the size of the written data, data after it is dropped when resuming
+	Pos int64
+	// OpenChunks are the positions of the size fields of the open chunks
+	OpenChunks []int64
+	// MoviPos is the position of the movi list type
+	MoviPos int64
+	// FramesCountFieldPos, FramesCountFieldPos2 and MetaLengthFieldPos are the positions of the header fields
+	// to be filled when the video is closed
+	FramesCountFieldPos, FramesCountFieldPos2, MetaLengthFieldPos int64
+
+	// Poster is the poster frame, see WithPosterFrame(); PosterPos is the position of the frame index
+	// of the IPST entry, 0 if the poster frame is not recorded
+	Poster    int
+	PosterPos int64
+
+	// Timestamps are the capture timestamps of the written frames, see AviWriter.SetTimestamp();
+	// NextTimestamp is the timestamp set for the next frame, valid if HasNextTimestamp is true
+	Timestamps       []FrameTimestamp
+	NextTimestamp    time.Duration
+	HasNextTimestamp bool
+
+	// Frames is the number of written frames
+	Frames int
+	// IdxEntries is the number of written index entries
+	IdxEntries int
+	// LastFramePos, LastFrameSize and LastFrameFlags describe the last written frame chunk
+	LastFramePos   int64
+	LastFrameSize  int
+	LastFrameFlags IndexFlag
+}
+
+// Checkpoint implements AviWriter.Checkpoint().
+// Writers with OpenDML indices, pending trailing custom chunks or annotations, frames queued by the throttle
+// (see WithThrottle()), and writers not writing to a named file (see NewWriter()) are not supported
+// (ErrCheckpointUnsupported).
+func (aw *aviWriter) Checkpoint() (State, error) {
+	if aw.err != nil {
+		return State{}, aw.notifyErr(aw.err)
+	}
+	s, err := aw.checkpoint()
+	return s, aw.notifyErr(err)
+}
+
+// checkpoint flushes the files and returns the state of the writer.
+func (aw *aviWriter) checkpoint() (State, error) {
+	if aw.odml || aw.aviFile == "" || aw.idxFile == "" || len(aw.customChunks) > 0 || len(aw.annotations) > 0 || aw.manifest || aw.encrypt || aw.proxy != nil || aw.ffmpeg || aw.audio != nil || len(aw.videoStreams) > 0 ||
+		aw.throttle != nil && len(aw.throttle.queue) > 0 {
+		return State{}, ErrCheckpointUnsupported
+	}
+	if aw.recOpen {
+		if err := aw.do(aw.endRec); err != nil {
+			return State{}, fatal(err)
+		}
+	}
+	if err := aw.avif.Sync(); err != nil {
+		return State{}, err
+	}
+	if err := aw.idxf.Sync(); err != nil {
+		return State{}, err
+	}
+
+	s := State{
+		AviFile:              aw.aviFile,
+		IdxFile:              aw.idxFile,
+		Width:                aw.width,
+		Height:               aw.height,
+		FPS:                  aw.fps,
+		Scale:                aw.scale,
+		FourCC:               aw.fourCC,
+		ChunkID:              aw.chunkID,
+		RawRGB:               aw.rawRGB,
+		Gray:                 aw.gray,
+		Passthrough:          aw.passthrough,
+		MetaStream:           aw.metaStream,
+		RecLists:             aw.recLists,
+		RecFrames:            aw.recFrames,
+		IdxReserve:           aw.idxReserve,
+		IdxReservePos:        aw.idxReservePos,
+		Pos:                  aw.currentPos(),
+		OpenChunks:           aw.rw.OpenChunks(),
+		MoviPos:              aw.moviPos,
+		FramesCountFieldPos:  aw.framesCountFieldPos,
+		FramesCountFieldPos2: aw.framesCountFieldPos2,
+		MetaLengthFieldPos:   aw.metaLengthFieldPos,
+		Frames:               aw.frames,
+		IdxEntries:           aw.idxEntries,
+		LastFramePos:         aw.lastFramePos,
+		LastFrameSize:        aw.lastFrameSize,
+		LastFrameFlags:       aw.lastFrameFlags,
+	}
+	if aw.alignFrames {
+		s.Align = aw.align
+	}
+	if aw.hasPoster {
+		s.Poster, s.PosterPos = aw.poster, aw.posterPos
+	}
+	s.Timestamps = append([]FrameTimestamp(nil), aw.timestamps...)
+	s.NextTimestamp, s.HasNextTimestamp = aw.timestamp, aw.hasTimestamp
+	return s, nil
+}
+
+// Resume returns an AviWriter continuing to write the video from the given state, returned by AviWriter.Checkpoint()
+// (e.g. in a previous process). Data written after the checkpoint is dropped.
+// The structure of the video comes from the state; options (e.g. quality, overlays) may be passed
+// to configure the encoding of the remaining frames. The poster frame (see WithPosterFrame()) can only be recorded
+// if the video was created with WithPosterFrame().
+// Errors of cleaning up after a failure are joined to the returned error, like by New().
+func Resume(s State, opts ...Option) (awr AviWriter, err error) {
+	aw := &aviWriter{
+		buf4:    make([]byte, 4),
+		quality: jpeg.DefaultQuality,
+	}
+	for _, opt := range opts {
+		opt(aw)
+	}
+	aw.aviFile, aw.avifName, aw.idxFile = s.AviFile, s.AviFile, s.IdxFile
+	aw.width, aw.height, aw.fps, aw.scale = s.Width, s.Height, s.FPS, s.Scale
+	if aw.scale <= 0 {
+		aw.scale = 1
+	}
+	aw.fourCC, aw.chunkID, aw.rawRGB, aw.passthrough = s.FourCC, s.ChunkID, s.RawRGB, s.Passthrough
+	aw.gray = s.Gray
+	aw.metaStream, aw.recLists, aw.recFrames = s.MetaStream, s.RecLists, s.RecFrames
+	aw.align, aw.alignFrames = s.Align, s.Align > 0
+	aw.idxReserve, aw.idxReservePos = s.IdxReserve, s.IdxReservePos
+	aw.odml, aw.trailingChunks, aw.aspectX, aw.aspectY = false, false, 0, 0
+	aw.moviPos = s.MoviPos
+	aw.framesCountFieldPos, aw.framesCountFieldPos2, aw.metaLengthFieldPos =
+		s.FramesCountFieldPos, s.FramesCountFieldPos2, s.MetaLengthFieldPos
+	if s.PosterPos > 0 {
+		if !aw.hasPoster {
+			aw.poster = s.Poster // Not chosen by an option
+		}
+		aw.hasPoster, aw.posterPos = true, s.PosterPos
+	} else {
+		aw.hasPoster = false // There is no IPST entry to be updated
+	}
+	aw.timestamps = append([]FrameTimestamp(nil), s.Timestamps...)
+	aw.timestamp, aw.hasTimestamp = s.NextTimestamp, s.HasNextTimestamp
+	aw.frames, aw.idxEntries = s.Frames, s.IdxEntries
+	aw.lastFramePos, aw.lastFrameSize, aw.lastFrameFlags = s.LastFramePos, s.LastFrameSize, s.LastFrameFlags
+	if aw.rate != nil {
+		aw.rate.init(aw.frameRate())
+	}
+	if aw.throttle != nil {
+		aw.throttle.init(aw.frameTime(1))
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		cleanupErrs := []error{aw.closeMmap()}
+		if aw.avif != nil {
+			cleanupErrs = append(cleanupErrs, aw.avif.Close())
+		}
+		if aw.idxf != nil {
+			cleanupErrs = append(cleanupErrs, aw.idxf.Close())
+		}
+		err = joinCleanupErrs(err, cleanupErrs)
+	}()
+
+	// Reopen the files, dropping data written after the checkpoint
+	if aw.avif, err = openFile(s.AviFile, true); err != nil {
+		return nil, err
+	}
+	if err = resumeFile(aw.avif, s.Pos); err != nil {
+		return nil, err
+	}
+	idxf, err := openFile(s.IdxFile, true)
+	if err != nil {
+		return nil, err
+	}
+	aw.idxf = idxf
+	if err = resumeFile(idxf, int64(s.IdxEntries)*16); err != nil {
+		return nil, err
+	}
+
+	aw.rw = aw.newRIFFWriter()
+	for _, pos := range s.OpenChunks {
+		aw.rw.Reopen(pos)
+	}
+	if err = aw.rw.Err(); err != nil {
+		return nil, err
+	}
+
+	return aw, nil
+}
+
+// resumeFile truncates f to size (which it must have at least), and positions it to its end.
+func resumeFile(f *os.File, size int64) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < size {
+		return io.ErrUnexpectedEOF
+	}
+	if err = f.Truncate(size); err != nil {
+		return err
+	}
+	_, err = f.Seek(size, io.SeekStart)
+	return err
+}
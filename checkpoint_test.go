@@ -0,0 +1,76 @@
+package mjpeg
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckpointResume checks that a video resumed from a checkpoint (after a simulated crash)
+// has the frames written before the checkpoint and after resuming, and not the ones in between.
+func TestCheckpointResume(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"rec lists", []Option{WithRecListFrames(2)}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			frames := testFrames(t, 6)
+			name := filepath.Join(t.TempDir(), "checkpoint.avi")
+			awr, err := New(name, smallWidth, smallHeight, 10, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames[:3] {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := awr.Checkpoint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := awr.AddFrame(frames[5]); err != nil { // Lost in the crash
+				t.Fatal(err)
+			}
+			aw := awr.(*aviWriter) // Crash: abandon the writer
+			aw.avif.Close()
+			aw.idxf.Close()
+
+			data, err := json.Marshal(s) // The state is persisted
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s2 State
+			if err := json.Unmarshal(data, &s2); err != nil {
+				t.Fatal(err)
+			}
+			if awr, err = Resume(s2, c.opts...); err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames[3:5] {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := awr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, name, frames[:5])
+		})
+	}
+}
+
+// TestCheckpointUnsupported checks that writers whose state can't be persisted refuse to checkpoint.
+func TestCheckpointUnsupported(t *testing.T) {
+	awr, err := New(filepath.Join(t.TempDir(), "odml.avi"), smallWidth, smallHeight, 10, WithODMLIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer awr.Close()
+	if _, err := awr.Checkpoint(); err != ErrCheckpointUnsupported {
+		t.Errorf("got error %v, want %v", err, ErrCheckpointUnsupported)
+	}
+}
@@ -0,0 +1,97 @@
+package mjpeg
+
+import (
+	"image"
+	"time"
+)
+
+// ClipConfig specifies the frame range and the size of an exported clip, see ExportAPNG(), ExportWebP() and ExportGIF().
+type ClipConfig struct {
+	// First is the index of the first frame of the clip
+	First int
+	// Frames is the number of frames of the clip, all frames from First if 0
+	Frames int
+	// Step tells to take every Step-th frame only (the taken frames are shown for Step frames), all frames if 0 or 1
+	Step int
+	// Width is the width of the clip (the height follows the aspect ratio of the video), the video width if 0
+	Width int
+	// Loops is the number of times the clip is played, 0 means forever
+	Loops int
+}
+
+// clipFrame is a frame of an exported clip.
+type clipFrame struct {
+	// img is the frame image, only valid during the callback of readClip()
+	img *image.RGBA
+	// duration is the display duration of the frame
+	duration time.Duration
+	// rate and scale are the duration as a fraction: scale/rate seconds
+	rate, scale int
+}
+
+// readClip decodes the frames of the clip of the video aviFile, and calls fn with them.
+// Repeated frames (duplicate index entries) are passed as one frame with a longer duration.
+// Returns the size of the clip.
+func readClip(aviFile string, cfg ClipConfig, fn func(f *clipFrame) error) (size image.Point, err error) {
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return size, err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	r := ar.(*aviReader)
+	if info.Rate <= 0 || info.Scale <= 0 {
+		return size, ErrInvalidFPS
+	}
+	end := info.Frames
+	if cfg.Frames > 0 && cfg.First+cfg.Frames < end {
+		end = cfg.First + cfg.Frames
+	}
+	if cfg.First < 0 || cfg.First >= end {
+		return size, ErrFrameIndex
+	}
+	w, h := int(info.Width), int(info.Height)
+	if cfg.Width > 0 && w > 0 {
+		w, h = cfg.Width, cfg.Width*h/w
+		if h < 1 {
+			h = 1
+		}
+	}
+	size = image.Pt(w, h)
+
+	step := cfg.Step
+	if step < 1 {
+		step = 1
+	}
+
+	var src *image.RGBA
+	for i := cfg.First; i < end; {
+		j := i + step // Index of the next distinct taken frame
+		for j < end && r.frames[j].offset == r.frames[i].offset {
+			j += step
+		}
+		if j > end {
+			j = end
+		}
+		data, err := ar.Frame(i)
+		if err != nil {
+			return size, err
+		}
+		img, err := decodeFrame(r, data)
+		if err != nil {
+			return size, err
+		}
+		src = copyToRGBA(src, img)
+		f := &clipFrame{img: src, rate: int(info.Rate), scale: (j - i) * int(info.Scale)}
+		if src.Rect.Dx() != w || src.Rect.Dy() != h {
+			f.img = resizeBox(src, w, h)
+		}
+		f.duration = time.Duration(int64(f.scale) * int64(time.Second) / int64(f.rate))
+		if err = fn(f); err != nil {
+			return size, err
+		}
+		i = j
+	}
+	return size, nil
+}
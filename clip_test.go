@@ -0,0 +1,87 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+// clipImage returns the image of the JPEG frame as exported into clips.
+func clipImage(tb testing.TB, data []byte) *image.RGBA {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return copyToRGBA(nil, img)
+}
+
+// sameImage tells if the images have the same size and pixels.
+func sameImage(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// clipTestVideo writes the video of the clip tests in dir: 3 distinct frames, the first one repeated.
+// Returns its name and its distinct frames.
+func clipTestVideo(tb testing.TB, dir string) (string, [][]byte) {
+	f := testFrames(tb, 3)
+	return writeTestVideo(tb, dir, [][]byte{f[0], f[0], f[1], f[2]}, WithDedup(0)), f
+}
+
+// TestReadClip checks the frames and durations of clips.
+func TestReadClip(t *testing.T) {
+	name, f := clipTestVideo(t, t.TempDir())
+	for _, c := range []struct {
+		name      string
+		cfg       ClipConfig
+		frames    [][]byte
+		durations []time.Duration
+	}{
+		{"all", ClipConfig{}, [][]byte{f[0], f[1], f[2]}, []time.Duration{200, 100, 100}},
+		{"range", ClipConfig{First: 1, Frames: 2}, [][]byte{f[0], f[1]}, []time.Duration{100, 100}},
+		{"step", ClipConfig{Step: 2}, [][]byte{f[0], f[1]}, []time.Duration{200, 200}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			i := 0
+			size, err := readClip(name, c.cfg, func(cf *clipFrame) error {
+				if i < len(c.frames) {
+					if !sameImage(cf.img, clipImage(t, c.frames[i])) {
+						t.Errorf("frame %d differs", i)
+					}
+					if want := c.durations[i] * time.Millisecond; cf.duration != want {
+						t.Errorf("frame %d: got duration %v, want %v", i, cf.duration, want)
+					}
+				}
+				i++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i != len(c.frames) {
+				t.Errorf("got %d frames, want %d", i, len(c.frames))
+			}
+			if size != image.Pt(smallWidth, smallHeight) {
+				t.Errorf("got size %v", size)
+			}
+		})
+	}
+
+	if _, err := readClip(name, ClipConfig{First: 4}, func(*clipFrame) error { return nil }); err != ErrFrameIndex {
+		t.Errorf("got error %v, want %v", err, ErrFrameIndex)
+	}
+}
@@ -0,0 +1,415 @@
+/*
+Command mjpeg creates and manipulates MJPEG AVI files.
+
+Usage:
+
+	mjpeg <command> [flags] [arguments]
+
+Commands:
+
+	create     create a video from JPEG files:    mjpeg create -fps 10 -o out.avi 'frames/*.jpg'
+	           or from a stream read from stdin:   camera-dump | mjpeg create -o - - | ssh host 'cat > rec.avi'
+	           or from files as they appear:       mjpeg create -watch captures -o live.avi
+	extract    extract frames as JPEG files:      mjpeg extract -o frames video.avi
+	info       print the properties of a video:   mjpeg info [-dump] [-validate] [-index csv|json] video.avi
+	repair     repair a truncated video:          mjpeg repair -o fixed.avi broken.avi
+	concat     concatenate videos:                mjpeg concat -o all.avi a.avi b.avi
+	sheet      create a contact sheet of a video: mjpeg sheet -n 16 -o sheet.jpg video.avi
+	scenes     list the scene changes of a video: mjpeg scenes -threshold 30 video.avi
+	transcode  re-encode a video:                 mjpeg transcode -q 50 -w 320 -o small.avi video.avi
+	clip       export an animated WebP/APNG/GIF:  mjpeg clip -first 100 -n 50 -w 320 -o loop.webp video.avi
+
+Run "mjpeg <command> -h" for the flags of a command.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/icza/mjpeg"
+)
+
+// command describes a subcommand.
+type command struct {
+	name  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"create", "create [-fps n] [-format f] [-watch dir] -o out.avi|- <jpeg files or glob patterns>...|-", create},
+	{"extract", "extract [-o dir] [-name pattern] video.avi", extract},
+	{"info", "info [-dump] [-validate] [-index csv|json] video.avi...", info},
+	{"repair", "repair -o out.avi video.avi", repair},
+	{"concat", "concat -o out.avi video.avi...", concat},
+	{"sheet", "sheet [-n frames] [-cols n] [-w width] [-q quality] -o sheet.jpg|sheet.png video.avi", sheet},
+	{"scenes", "scenes [-threshold t] [-jump j] [-gap duration] video.avi", scenes},
+	{"transcode", "transcode [-q quality] [-w width] [-h height] -o out.avi video.avi", transcode},
+	{"clip", "clip [-first i] [-n frames] [-w width] [-loops n] -o clip.webp|clip.png video.avi", clip},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: mjpeg %s\n", c.usage)
+			fs.PrintDefaults()
+		}
+		if err := c.run(fs, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "mjpeg %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+}
+
+// usage prints the usage and exits.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: mjpeg <command> [flags] [arguments]\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  mjpeg %s\n", c.usage)
+	}
+	os.Exit(2)
+}
+
+// create creates a video from JPEG files or from a stream read from stdin.
+func create(fs *flag.FlagSet, args []string) (err error) {
+	fps := fs.Int("fps", 25, "frames/second of the video")
+	out := fs.String("o", "out.avi", "output video `file`, - for stdout")
+	format := fs.String("format", "mjpeg", "`format` of frames read from stdin: mjpeg (concatenated JPEGs) or length (length-prefixed frames)")
+	watch := fs.String("watch", "", "watch the `directory` and add new JPEG files as they appear (until interrupted)")
+	pattern := fs.String("watch-pattern", "*.jpg", "glob `pattern` of files to add in watch mode")
+	idle := fs.Duration("watch-idle", 0, "stop watching if no new file appears for this `duration` (0: no timeout)")
+	timecode := fs.String("timecode", "", "starting SMPTE `timecode` of the video, HH:MM:SS:FF (HH:MM:SS;FF for drop-frame)")
+	poster := fs.Int("poster", 0, "index of the poster `frame` recorded in the video (-1: the middle frame; not recorded if not set)")
+	fs.Parse(args)
+
+	var opts []mjpeg.Option
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "poster" {
+			opts = append(opts, mjpeg.WithPosterFrame(*poster))
+		}
+	})
+	if *timecode != "" {
+		tc, err := mjpeg.ParseTimecode(*timecode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *timecode, err)
+		}
+		opts = append(opts, mjpeg.WithTimecode(tc))
+	}
+
+	var fr mjpeg.FrameReader
+	if *watch != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		fr = mjpeg.NewDirWatcher(ctx, *watch, mjpeg.WatchConfig{Pattern: *pattern, IdleTimeout: *idle})
+	} else if fs.NArg() == 1 && fs.Arg(0) == "-" {
+		switch *format {
+		case "mjpeg":
+			fr = mjpeg.NewMJPEGStreamReader(os.Stdin)
+		case "length":
+			fr = mjpeg.NewLengthPrefixedReader(os.Stdin)
+		default:
+			return fmt.Errorf("unknown format: %s", *format)
+		}
+	} else {
+		var files []string
+		for _, arg := range fs.Args() {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return err
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+		}
+		fr = &fileReader{files: files}
+	}
+
+	// The size of the video is taken from the first frame
+	first, err := fr.ReadFrame()
+	if err == io.EOF {
+		return fmt.Errorf("no input frames")
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(first))
+	if err != nil {
+		return err
+	}
+
+	var aw mjpeg.AviWriter
+	if *out == "-" {
+		aw, err = mjpeg.NewWriter(os.Stdout, int32(cfg.Width), int32(cfg.Height), int32(*fps), opts...)
+	} else {
+		aw, err = mjpeg.New(*out, int32(cfg.Width), int32(cfg.Height), int32(*fps), opts...)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil && *out != "-" {
+			os.Remove(*out)
+		}
+	}()
+
+	if err = aw.AddFrame(first); err != nil {
+		return err
+	}
+	n, err := mjpeg.AddEncodedFrames(aw, fr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d frames written\n", *out, n+1)
+	return nil
+}
+
+// fileReader is a mjpeg.FrameReader reading frames from files.
+type fileReader struct {
+	files []string
+}
+
+// ReadFrame implements mjpeg.FrameReader.ReadFrame().
+func (fr *fileReader) ReadFrame() ([]byte, error) {
+	if len(fr.files) == 0 {
+		return nil, io.EOF
+	}
+	name := fr.files[0]
+	fr.files = fr.files[1:]
+	return os.ReadFile(name)
+}
+
+// extract extracts the frames of a video as JPEG files.
+func extract(fs *flag.FlagSet, args []string) error {
+	dir := fs.String("o", ".", "output `directory`")
+	name := fs.String("name", "frame%06d.jpg", "file name `pattern` of frames (receives the frame index)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ar, err := mjpeg.NewReader(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	frames := ar.Info().Frames
+	for i := 0; i < frames; i++ {
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*dir, fmt.Sprintf(*name, i)), data, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d frames extracted\n", frames)
+	return nil
+}
+
+// info prints the properties of videos.
+func info(fs *flag.FlagSet, args []string) error {
+	dump := fs.Bool("dump", false, "print the chunk structure")
+	validate := fs.Bool("validate", false, "check the file for structural problems")
+	index := fs.String("index", "", "print the frame index in `format` csv or json")
+	fs.Parse(args)
+
+	var indexFormat mjpeg.IndexFormat
+	switch *index {
+	case "", "csv":
+		indexFormat = mjpeg.IndexCSV
+	case "json":
+		indexFormat = mjpeg.IndexJSON
+	default:
+		return fmt.Errorf("invalid index format: %s", *index)
+	}
+
+	ok := true
+	for _, name := range fs.Args() {
+		ar, err := mjpeg.NewReader(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		i := ar.Info()
+		ar.Close()
+
+		fmt.Printf("%s:\n", name)
+		fmt.Printf("  Size:     %dx%d\n", i.Width, i.Height)
+		fmt.Printf("  Codec:    %s\n", i.Codec)
+		fmt.Printf("  FPS:      %g (%d/%d)\n", i.FPS(), i.Rate, i.Scale)
+		fmt.Printf("  Frames:   %d\n", i.Frames)
+		if fps := i.FPS(); fps > 0 {
+			fmt.Printf("  Duration: %.3fs\n", float64(i.Frames)/fps)
+		}
+		fmt.Printf("  Streams:  %d\n", i.Streams)
+		if i.Name != "" {
+			fmt.Printf("  Name:     %s\n", i.Name)
+		}
+		if i.Timecode != "" {
+			fmt.Printf("  Timecode: %s\n", i.Timecode)
+		}
+		if i.Color != (mjpeg.ColorInfo{}) {
+			fmt.Printf("  Color:    %s\n", i.Color)
+		}
+		if i.HasPoster {
+			fmt.Printf("  Poster:   %d\n", i.Poster)
+		}
+
+		if *dump {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			err = mjpeg.DumpStructure(f, os.Stdout)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		if *validate {
+			rep, err := mjpeg.Validate(name)
+			if err != nil {
+				return err
+			}
+			if len(rep.Issues) == 0 {
+				fmt.Println("  No issues found.")
+			}
+			for _, issue := range rep.Issues {
+				fmt.Printf("  %s\n", issue)
+			}
+			ok = ok && rep.OK()
+		}
+		if *index != "" {
+			if err := mjpeg.ExportIndex(name, os.Stdout, indexFormat); err != nil {
+				return err
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("validation failed")
+	}
+	return nil
+}
+
+// repair repairs a truncated video.
+func repair(fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "", "output video `file`")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return mjpeg.Repair(fs.Arg(0), *out)
+}
+
+// concat concatenates videos.
+func concat(fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "", "output video `file`")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return mjpeg.Concat(*out, fs.Args()...)
+}
+
+// sheet creates a contact sheet of a video.
+func sheet(fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "sheet.jpg", "output image `file` (PNG if it has a .png extension, else JPEG)")
+	n := fs.Int("n", 16, "number of frames to sample")
+	cols := fs.Int("cols", 0, "number of columns (0: a roughly square grid)")
+	width := fs.Int("w", 240, "width of tiles")
+	gap := fs.Int("gap", 4, "space between tiles")
+	quality := fs.Int("q", 85, "JPEG quality")
+	noTime := fs.Bool("notime", false, "don't draw timestamps")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := mjpeg.ContactSheetConfig{Frames: *n, Columns: *cols, TileWidth: *width, Gap: *gap, NoTimestamps: *noTime}
+	return mjpeg.WriteContactSheet(fs.Arg(0), *out, cfg, *quality)
+}
+
+// scenes lists the scene changes of a video.
+func scenes(fs *flag.FlagSet, args []string) error {
+	threshold := fs.Float64("threshold", 30, "minimum mean luminance difference of a change (0..255)")
+	jump := fs.Float64("jump", 0.1, "minimum relative JPEG size change of candidate frames (negative: decode all frames)")
+	gap := fs.Duration("gap", 0, "minimum `duration` between reported changes")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	changes, err := mjpeg.DetectScenes(fs.Arg(0), mjpeg.SceneConfig{Threshold: *threshold, SizeJump: *jump, MinGap: *gap})
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Printf("%v\tframe %d\tscore %.1f\n", c.Time, c.Frame, c.Score)
+	}
+	return nil
+}
+
+// transcode re-encodes a video with a new quality and size.
+func transcode(fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "", "output `file`")
+	quality := fs.Int("q", 75, "JPEG quality")
+	width := fs.Int("w", 0, "width of the output (0: keep, or follow the aspect ratio if -h is given)")
+	height := fs.Int("h", 0, "height of the output (0: keep, or follow the aspect ratio if -w is given)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts := mjpeg.TranscodeOptions{Quality: *quality, Width: int32(*width), Height: int32(*height)}
+	return mjpeg.Transcode(fs.Arg(0), *out, opts)
+}
+
+// clip exports a clip of a video as an animated WebP, APNG or GIF.
+func clip(fs *flag.FlagSet, args []string) error {
+	out := fs.String("o", "clip.webp", "output `file` (APNG or GIF if it has a .png or .gif extension, else WebP)")
+	first := fs.Int("first", 0, "index of the first frame")
+	n := fs.Int("n", 0, "number of frames (0: all frames from -first)")
+	step := fs.Int("step", 1, "take every `n`-th frame only")
+	width := fs.Int("w", 0, "width of the clip (0: the width of the video)")
+	loops := fs.Int("loops", 0, "number of times the clip is played (0: forever)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg := mjpeg.ClipConfig{First: *first, Frames: *n, Step: *step, Width: *width, Loops: *loops}
+	switch ext := filepath.Ext(*out); {
+	case strings.EqualFold(ext, ".png"):
+		return mjpeg.ExportAPNG(fs.Arg(0), *out, cfg)
+	case strings.EqualFold(ext, ".gif"):
+		return mjpeg.ExportGIF(fs.Arg(0), *out, cfg)
+	}
+	return mjpeg.ExportWebP(fs.Arg(0), *out, cfg)
+}
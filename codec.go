@@ -0,0 +1,61 @@
+package mjpeg
+
+import "strings"
+
+// IndexFlag is a flag of an index entry (AVIIF_xxx flags of idx1 entries).
+type IndexFlag uint32
+
+const (
+	// FlagList (AVIIF_LIST) marks chunks that are LIST chunks (e.g. 'rec ' lists).
+	FlagList IndexFlag = 0x01
+	// FlagKeyFrame (AVIIF_KEYFRAME) marks key frames: frames that do not need previous frames to be decoded.
+	// Some editors refuse to scrub files whose index entries carry no key frame flags.
+	FlagKeyFrame IndexFlag = 0x10
+	// FlagNoTime (AVIIF_NOTIME) marks chunks that do not affect the timing of the stream
+	// (e.g. palette changes).
+	FlagNoTime IndexFlag = 0x100
+	// FlagCompressorMask (AVIIF_COMPUSE) is the mask of the bits reserved for the compressor.
+	FlagCompressorMask IndexFlag = 0x0fff0000
+)
+
+// intraFlags returns the flags to use for a frame, given the requested flags.
+// MJPEG and raw RGB frames are all intra frames, so they are always flagged as key frames;
+// the requested flags are honored as-is only in passthrough mode (see WithFourCC()).
+func (aw *aviWriter) intraFlags(flags IndexFlag) IndexFlag {
+	if aw.passthrough {
+		return flags
+	}
+	return flags | FlagKeyFrame
+}
+
+// WithFourCC returns an Option which sets the FOURCC code of the video codec (e.g. "dmb1" or "png "),
+// for advanced users pushing pre-encoded frames. The writer handles only the container structure,
+// the index and the timing, frames passed to AddFrame() and AddFrameFlags() are written as-is,
+// and the flags passed to AddFrameFlags() are written to the index as-is.
+//
+// Images added with AddImage() are still encoded as JPEG, which only makes sense for MJPEG variants.
+func WithFourCC(fourCC string) Option {
+	return func(aw *aviWriter) {
+		aw.fourCC = (fourCC + "    ")[:4]
+		aw.passthrough = true
+	}
+}
+
+// codecOptions returns the options creating videos with the codec and frame format of the video read by ar,
+// so its frames can be written into a new video without re-encoding them.
+func codecOptions(ar *aviReader) (opts []Option) {
+	switch strings.ToUpper(ar.info.Codec) {
+	case "MJPG":
+	case "DIB ", "\000\000\000\000":
+		opts = append(opts, WithRawRGB())
+		if ar.bitCount == 8 {
+			opts = append(opts, WithGrayscale())
+		}
+		if ar.info.TopDown {
+			opts = append(opts, WithTopDown())
+		}
+	default:
+		opts = append(opts, WithFourCC(ar.info.Codec))
+	}
+	return opts
+}
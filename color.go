@@ -0,0 +1,286 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+)
+
+// ColorRange is the range of the sample values of a video.
+type ColorRange int
+
+// Color ranges.
+const (
+	// RangeUnspecified means the range is not known (players usually assume full range for MJPEG)
+	RangeUnspecified ColorRange = iota
+	// RangeFull is the full (PC, JPEG) range: 0..255 luma and chroma (e.g. webcams)
+	RangeFull
+	// RangeLimited is the limited (TV, studio swing) range: 16..235 luma, 16..240 chroma (e.g. broadcast sources)
+	RangeLimited
+)
+
+// String returns the name of the color range as used in the file: "full", "limited" or "unspecified".
+func (r ColorRange) String() string {
+	switch r {
+	case RangeFull:
+		return "full"
+	case RangeLimited:
+		return "limited"
+	}
+	return "unspecified"
+}
+
+// ColorPrimaries are the color primaries (and matrix) of a video.
+type ColorPrimaries int
+
+// Color primaries.
+const (
+	// PrimariesUnspecified means the primaries are not known
+	PrimariesUnspecified ColorPrimaries = iota
+	// PrimariesBT601 are the primaries of standard definition video (ITU-R BT.601), also used by JFIF
+	PrimariesBT601
+	// PrimariesBT709 are the primaries of high definition video (ITU-R BT.709)
+	PrimariesBT709
+	// PrimariesBT2020 are the primaries of ultra high definition video (ITU-R BT.2020)
+	PrimariesBT2020
+)
+
+// String returns the name of the color primaries as used in the file: "bt601", "bt709", "bt2020" or "unspecified".
+func (p ColorPrimaries) String() string {
+	switch p {
+	case PrimariesBT601:
+		return "bt601"
+	case PrimariesBT709:
+		return "bt709"
+	case PrimariesBT2020:
+		return "bt2020"
+	}
+	return "unspecified"
+}
+
+// ColorInfo is the colorimetry information of a video, see WithColorInfo().
+type ColorInfo struct {
+	Range     ColorRange
+	Primaries ColorPrimaries
+}
+
+// String returns the color information as written in the ICLR entry of the INFO list, e.g. "full bt709".
+func (ci ColorInfo) String() string {
+	return ci.Range.String() + " " + ci.Primaries.String()
+}
+
+// parseColorInfo parses color information written by ColorInfo.String(), unknown names are unspecified.
+func parseColorInfo(s string) (ci ColorInfo) {
+	for _, f := range strings.Fields(s) {
+		for r := RangeFull; r <= RangeLimited; r++ {
+			if f == r.String() {
+				ci.Range = r
+			}
+		}
+		for p := PrimariesBT601; p <= PrimariesBT2020; p++ {
+			if f == p.String() {
+				ci.Primaries = p
+			}
+		}
+	}
+	return
+}
+
+// WithColorInfo returns an Option which records the color range and primaries of the video
+// in the ICLR entry of the INFO list (reported by AviReader.Info()), and makes JPEG frames consistent with it:
+// with RangeFull, a JFIF APP0 segment (which implies full range) is added to frames lacking one (including
+// the frames encoded from images, as image/jpeg writes none); with RangeLimited, JFIF segments are removed.
+//
+// Frames from sources of a different range can be normalized to the range of the video,
+// see AviWriter.SetColorRange().
+func WithColorInfo(ci ColorInfo) Option {
+	return func(aw *aviWriter) {
+		aw.color = ci
+	}
+}
+
+// SetColorRange implements AviWriter.SetColorRange().
+func (aw *aviWriter) SetColorRange(r ColorRange) {
+	aw.srcRange = r
+}
+
+// writeColorEntry writes the ICLR entry of the INFO list, if color information is set.
+func (aw *aviWriter) writeColorEntry() {
+	if aw.color == (ColorInfo{}) {
+		return
+	}
+	aw.pushChunk("ICLR")
+	aw.writeStr(aw.color.String() + "\000") // Zero terminated (padded to even size by pop())
+	aw.pop()
+}
+
+// convertsRange tells if frames are converted from the source range to the range of the video.
+func (aw *aviWriter) convertsRange() bool {
+	return aw.srcRange != RangeUnspecified && aw.color.Range != RangeUnspecified && aw.srcRange != aw.color.Range
+}
+
+// convertRange returns the image converted from the source range to the range of the video.
+func (aw *aviWriter) convertRange(img image.Image) image.Image {
+	if aw.rangeConv == nil || aw.rangeConvFrom != aw.srcRange {
+		aw.rangeConv, aw.rangeConvFrom = ConvertRange(aw.srcRange, aw.color.Range), aw.srcRange
+	}
+	return aw.rangeConv(img)
+}
+
+// normalizeJPEG returns the JPEG frame data normalized to the color information of the video:
+// converted from the source range if it differs (re-encoding the frame), and with JFIF segments
+// added or removed according to the range. Data is returned as-is if it can't be decoded.
+func (aw *aviWriter) normalizeJPEG(data []byte) ([]byte, error) {
+	if aw.convertsRange() {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return data, nil
+		}
+		if err := aw.encode(aw.convertRange(img)); err != nil {
+			return nil, err
+		}
+		return aw.frameBuf.Bytes(), nil // encode() takes care of the JFIF segment
+	}
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return data, nil
+	}
+
+	pos, length := jfifPos(data)
+	switch {
+	case aw.color.Range == RangeFull && pos < 0:
+		aw.jfifBuf = append(append(append(aw.jfifBuf[:0], data[:2]...), jfifSegment...), data[2:]...)
+		return aw.jfifBuf, nil
+	case aw.color.Range == RangeLimited && pos >= 0:
+		aw.jfifBuf = append(append(aw.jfifBuf[:0], data[:pos]...), data[pos+length:]...)
+		return aw.jfifBuf, nil
+	}
+	return data, nil
+}
+
+// encodeJFIF encodes the image into frameBuf as JPEG, with a JFIF segment after the SOI marker
+// (image/jpeg writes none) if the encoder wrote none.
+func (aw *aviWriter) encodeJFIF(img image.Image) error {
+	aw.colorBuf.Reset()
+	if err := aw.encodeJPEG(&aw.colorBuf, img); err != nil {
+		return err
+	}
+	data := aw.colorBuf.Bytes()
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		aw.frameBuf.Write(data)
+		return nil
+	}
+	if pos, _ := jfifPos(data); pos >= 0 {
+		aw.frameBuf.Write(data)
+		return nil
+	}
+	aw.frameBuf.Write(data[:2])
+	aw.frameBuf.Write(jfifSegment)
+	aw.frameBuf.Write(data[2:])
+	return nil
+}
+
+// jfifSegment is a JFIF APP0 segment: version 1.01, no density units with 1:1 pixel density, no thumbnail.
+var jfifSegment = []byte{0xff, markerAPP0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0}
+
+// jfifPos returns the position and length of the JFIF APP0 segment among the APPn and COM segments
+// following the SOI marker of JPEG data, -1 if there is none.
+func jfifPos(data []byte) (pos, length int) {
+	for pos = 2; pos+4 <= len(data) && data[pos] == 0xff; pos += length {
+		marker := data[pos+1]
+		if marker < markerAPP0 || marker > markerAPPF && marker != markerCOM {
+			break
+		}
+		length = 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 4 || pos+length > len(data) {
+			break
+		}
+		if marker == markerAPP0 && bytes.HasPrefix(data[pos+4:pos+length], []byte("JFIF\000")) {
+			return pos, length
+		}
+	}
+	return -1, 0
+}
+
+// rangeTables returns the lookup tables mapping luma (and RGB) and chroma sample values from one range to another.
+func rangeTables(from, to ColorRange) (luma, chroma *[256]uint8) {
+	luma, chroma = new([256]uint8), new([256]uint8)
+	scale := func(v, center, fromSpan, toSpan int) uint8 {
+		s := center + ((v-center)*toSpan*2+fromSpan)/(fromSpan*2) // Rounded
+		if v < center {
+			s = center - ((center-v)*toSpan*2+fromSpan)/(fromSpan*2)
+		}
+		if s < 0 {
+			return 0
+		}
+		if s > 255 {
+			return 255
+		}
+		return uint8(s)
+	}
+	for v := 0; v < 256; v++ {
+		if from == RangeFull {
+			luma[v] = scale(v, 0, 255, 219) + 16
+			chroma[v] = scale(v, 128, 255, 224)
+		} else {
+			luma[v] = scale(v-16, 0, 219, 255)
+			chroma[v] = scale(v, 128, 224, 255)
+		}
+	}
+	return
+}
+
+// ConvertRange returns a Transform which converts the sample values of frames from one color range to another,
+// e.g. to normalize the levels of limited range sources to the full range of a video.
+// *image.YCbCr and *image.Gray images are converted as-is (luma and chroma ranges), other images
+// are converted to *image.RGBA (with the luma range applied to the R, G and B channels).
+// Frames are returned unaltered if either range is unspecified or they are the same.
+func ConvertRange(from, to ColorRange) Transform {
+	if from == RangeUnspecified || to == RangeUnspecified || from == to {
+		return func(img image.Image) image.Image { return img }
+	}
+	luma, chroma := rangeTables(from, to)
+	var ycc *image.YCbCr
+	var gray *image.Gray
+	var rgba *image.RGBA
+	return func(img image.Image) image.Image {
+		b := img.Bounds()
+		switch src := img.(type) {
+		case *image.YCbCr:
+			if ycc == nil || ycc.Rect != b || ycc.SubsampleRatio != src.SubsampleRatio {
+				ycc = image.NewYCbCr(b, src.SubsampleRatio)
+			}
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					ycc.Y[ycc.YOffset(x, y)] = luma[src.Y[src.YOffset(x, y)]]
+					si, di := src.COffset(x, y), ycc.COffset(x, y)
+					ycc.Cb[di], ycc.Cr[di] = chroma[src.Cb[si]], chroma[src.Cr[si]]
+				}
+			}
+			return ycc
+		case *image.Gray:
+			if gray == nil || gray.Rect != b {
+				gray = image.NewGray(b)
+			}
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				so, do := src.PixOffset(b.Min.X, y), gray.PixOffset(b.Min.X, y)
+				for i, v := range src.Pix[so : so+b.Dx()] {
+					gray.Pix[do+i] = luma[v]
+				}
+			}
+			return gray
+		}
+
+		if rgba == nil || rgba.Rect != b {
+			rgba = image.NewRGBA(b)
+		}
+		draw.Draw(rgba, b, img, b.Min, draw.Src)
+		for i := 0; i < len(rgba.Pix); i += 4 {
+			p := rgba.Pix[i : i+3 : i+3]
+			p[0], p[1], p[2] = luma[p[0]], luma[p[1]], luma[p[2]]
+		}
+		return rgba
+	}
+}
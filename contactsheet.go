@@ -0,0 +1,147 @@
+package mjpeg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ContactSheetConfig is the configuration of a contact sheet, see ContactSheet().
+type ContactSheetConfig struct {
+	// Frames is the number of frames to sample, 16 if 0
+	Frames int
+	// Columns is the number of columns of the grid, chosen to make the grid roughly square if 0
+	Columns int
+	// TileWidth is the width of the tiles (the height follows the aspect ratio of the video), 240 if 0
+	TileWidth int
+	// Gap is the space between tiles and around the grid, in pixels
+	Gap int
+	// Background is the color of the space between tiles, black if nil
+	Background color.Color
+	// NoTimestamps disables drawing the timestamps of frames onto the tiles
+	NoTimestamps bool
+}
+
+// ContactSheet returns a contact sheet of the video aviFile: a grid of cfg.Frames frames sampled evenly
+// across the video (each from the middle of its part of the video), downscaled to tiles,
+// with their timestamps in the bottom-left corner.
+// If the video has fewer frames than cfg.Frames, all its frames are used.
+//
+// Frames are read through the index, the same codecs are supported as by Thumbnail().
+func ContactSheet(aviFile string, cfg ContactSheetConfig) (image.Image, error) {
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if info.Frames == 0 {
+		return nil, ErrFrameIndex
+	}
+	n := cfg.Frames
+	if n <= 0 {
+		n = 16
+	}
+	if n > info.Frames {
+		n = info.Frames
+	}
+	cols := cfg.Columns
+	if cols <= 0 {
+		for cols = 1; cols*cols < n; cols++ {
+		}
+	}
+	if cols > n {
+		cols = n
+	}
+	rows := (n + cols - 1) / cols
+
+	tw := cfg.TileWidth
+	if tw <= 0 {
+		tw = 240
+	}
+	th := 1
+	if info.Width > 0 {
+		th = tw * int(info.Height) / int(info.Width)
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	gap := cfg.Gap
+	if gap < 0 {
+		gap = 0
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*(tw+gap)+gap, rows*(th+gap)+gap))
+	bg := cfg.Background
+	if bg == nil {
+		bg = color.Black
+	}
+	draw.Draw(sheet, sheet.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	fps := info.FPS()
+	scale := labelScale(image.Rect(0, 0, tw, th))
+	var src *image.RGBA
+	for k := 0; k < n; k++ {
+		i := (2*k + 1) * info.Frames / (2 * n)
+		data, err := ar.Frame(i)
+		if err != nil {
+			return nil, err
+		}
+		img, err := decodeFrame(ar.(*aviReader), data)
+		if err != nil {
+			return nil, err
+		}
+		src = copyToRGBA(src, img)
+		tile := resizeBox(src, tw, th)
+
+		pt := image.Pt(gap+k%cols*(tw+gap), gap+k/cols*(th+gap))
+		r := image.Rectangle{Min: pt, Max: pt.Add(tile.Rect.Size())}
+		draw.Draw(sheet, r, tile, image.Point{}, draw.Src)
+
+		if !cfg.NoTimestamps {
+			s := formatTimestamp(timestamp(i, fps))
+			size := textSize(s, scale)
+			offset := image.Pt(2*scale, 2*scale)
+			drawLabel(sheet, BottomLeft.position(r, size, offset), s, scale, labelFg, labelBg)
+		}
+	}
+	return sheet, nil
+}
+
+// formatTimestamp formats t in the form of HH:MM:SS.
+func formatTimestamp(t time.Duration) string {
+	secs := int(t / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
+
+// WriteContactSheet writes the contact sheet of the video aviFile (see ContactSheet()) into imgFile.
+// The sheet is encoded as PNG if imgFile has a ".png" extension, else as JPEG (with quality).
+func WriteContactSheet(aviFile, imgFile string, cfg ContactSheetConfig, quality int) (err error) {
+	sheet, err := ContactSheet(aviFile, cfg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(imgFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if strings.EqualFold(filepath.Ext(imgFile), ".png") {
+		return png.Encode(f, sheet)
+	}
+	return jpeg.Encode(f, sheet, &jpeg.Options{Quality: quality})
+}
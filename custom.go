@@ -0,0 +1,84 @@
+package mjpeg
+
+import "errors"
+
+// ErrInvalidChunkID reports an invalid or reserved chunk id.
+var ErrInvalidChunkID = errors.New("Invalid chunk id")
+
+// customChunk is a custom chunk to be written at Close().
+type customChunk struct {
+	// fourCC is the chunk id
+	fourCC string
+	// data is the chunk data
+	data []byte
+}
+
+// WithTrailingCustomChunks returns an Option which makes WriteCustomChunk() collect the chunks,
+// and write them at Close() after the index, at the top level of the file (outside of the movi list).
+// By default custom chunks are written immediately, interleaved with the frames in the movi list.
+func WithTrailingCustomChunks() Option {
+	return func(aw *aviWriter) {
+		aw.trailingChunks = true
+	}
+}
+
+// validCustomID tells if fourCC is a valid id for a custom chunk: 4 printable ASCII characters,
+// not a reserved id (e.g. "LIST", "JUNK") and not a stream chunk id (e.g. "00dc", "ix00").
+func validCustomID(fourCC string) bool {
+	if len(fourCC) != 4 {
+		return false
+	}
+	for i := 0; i < 4; i++ {
+		if fourCC[i] < 0x20 || fourCC[i] > 0x7e {
+			return false
+		}
+	}
+	switch fourCC {
+	case "RIFF", "LIST", "JUNK", "idx1", "indx":
+		return false
+	}
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	if isDigit(fourCC[0]) && isDigit(fourCC[1]) || fourCC[:2] == "ix" && isDigit(fourCC[2]) && isDigit(fourCC[3]) {
+		return false
+	}
+	return true
+}
+
+// WriteCustomChunk implements AviWriter.WriteCustomChunk().
+func (aw *aviWriter) WriteCustomChunk(fourCC string, data []byte) error {
+	if !validCustomID(fourCC) {
+		return aw.notifyErr(ErrInvalidChunkID)
+	}
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	return aw.notifyErr(aw.addCustomChunk(fourCC, data))
+}
+
+// addCustomChunk writes (or records for writing after the index) a custom chunk.
+func (aw *aviWriter) addCustomChunk(fourCC string, data []byte) error {
+
+	if aw.trailingChunks {
+		if err := aw.checkSize(9+int64(len(data)), 0); err != nil {
+			return err
+		}
+		aw.customChunks = append(aw.customChunks, customChunk{fourCC: fourCC, data: append([]byte(nil), data...)})
+		return nil
+	}
+
+	if err := aw.checkSize(9+int64(len(data)), 1); err != nil {
+		return err
+	}
+	return fatal(aw.do(func() error { return aw.writeChunk(fourCC, data) }))
+}
+
+// writeTrailingChunks writes the collected custom chunks (see WithTrailingCustomChunks()).
+func (aw *aviWriter) writeTrailingChunks() error {
+	for _, c := range aw.customChunks {
+		if err := aw.writeChunk(c.fourCC, c.data); err != nil {
+			return err
+		}
+	}
+	aw.customChunks = nil
+	return nil
+}
@@ -0,0 +1,174 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// Size of the grid used to calculate the signature of frames for perceptual comparison.
+const sigGridW, sigGridH = 32, 24
+
+// dedup holds the state of frame deduplication.
+type dedup struct {
+	// threshold is the maximum difference of frame signatures to consider frames identical;
+	// 0 means frames are compared byte-by-byte
+	threshold int
+
+	// lastData is the data of the last written frame (used if threshold is 0)
+	lastData []byte
+	// lastSig is the signature of the last written frame (used if threshold is positive)
+	lastSig []uint8
+	// sig is the buffer for the signature of the current frame
+	sig []uint8
+}
+
+// WithDedup returns an Option which enables frame deduplication:
+// if an added frame is identical to the previous one, instead of storing it again,
+// an index entry is written pointing to the chunk of the previous frame.
+// This shrinks videos of static scenes (e.g. surveillance recordings) dramatically.
+//
+// If threshold is 0, frames must be byte-identical (as JPEG data).
+// Else frames are compared perceptually: their luminance is averaged over a grid of 32x24 cells,
+// and frames are identical if no cell differs by more than threshold (in the range of 0..255).
+// Perceptual comparison of frames added with AddFrame() requires decoding them.
+func WithDedup(threshold int) Option {
+	return func(aw *aviWriter) {
+		aw.dedup = &dedup{threshold: threshold}
+	}
+}
+
+// isDupData tells if the JPEG frame data is a duplicate of the last written frame.
+// If it is not and it gets written, it must be recorded with written().
+func (d *dedup) isDupData(jpegData []byte) bool {
+	if d.threshold > 0 {
+		img, err := jpeg.Decode(bytes.NewReader(jpegData))
+		if err != nil {
+			return false // Let the writer deal with invalid frames
+		}
+		return d.isDupImage(img)
+	}
+
+	return d.lastData != nil && bytes.Equal(d.lastData, jpegData)
+}
+
+// isDupImage tells if the image is perceptually a duplicate of the last written frame.
+// If it is not and it gets written, it must be recorded with written().
+func (d *dedup) isDupImage(img image.Image) bool {
+	d.sig = signature(d.sig, img)
+	if d.lastSig == nil {
+		return false
+	}
+	for i, v := range d.sig {
+		if diff := int(v) - int(d.lastSig[i]); diff > d.threshold || -diff > d.threshold {
+			return false
+		}
+	}
+	return true
+}
+
+// written records the last checked frame (with the given JPEG data) as the last written frame,
+// after it has been written successfully.
+func (d *dedup) written(jpegData []byte) {
+	if d.threshold > 0 {
+		d.lastSig, d.sig = d.sig, d.lastSig
+	} else {
+		d.lastData = append(d.lastData[:0], jpegData...)
+	}
+}
+
+// signature calculates the average luminance of the cells of a grid over the image into sig.
+func signature(sig []uint8, img image.Image) []uint8 {
+	if len(sig) != sigGridW*sigGridH {
+		sig = make([]uint8, sigGridW*sigGridH)
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var sums, counts [sigGridW * sigGridH]int
+	// Sampling every pixel is not needed, a sparse sampling is good enough and much faster
+	step := 1
+	if w*h > 4*sigGridW*sigGridH*16 {
+		step = 2
+	}
+	for y := 0; y < h; y += step {
+		row := y * sigGridH / h * sigGridW
+		for x := 0; x < w; x += step {
+			var lum uint8
+			switch im := img.(type) {
+			case *image.YCbCr:
+				lum = im.Y[im.YOffset(b.Min.X+x, b.Min.Y+y)]
+			case *image.Gray:
+				lum = im.Pix[im.PixOffset(b.Min.X+x, b.Min.Y+y)]
+			default:
+				lum = color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+			}
+			cell := row + x*sigGridW/w
+			sums[cell] += int(lum)
+			counts[cell]++
+		}
+	}
+	for i := range sig {
+		if counts[i] > 0 {
+			sig[i] = uint8(sums[i] / counts[i])
+		} else {
+			sig[i] = 0
+		}
+	}
+	return sig
+}
+
+// addDupFrame adds a frame which is a duplicate of the last written frame:
+// only an index entry is written pointing to the chunk of the last frame.
+// Nothing is added if no frame has been written yet.
+func (aw *aviWriter) addDupFrame() error {
+	if aw.frames == 0 {
+		return nil
+	}
+	if err := aw.checkDuration(); err != nil {
+		return err
+	}
+	metaSize, metaEntries := aw.metaChunkSize()
+	if err := aw.checkSize(metaSize, 1+metaEntries); err != nil {
+		return err
+	}
+	err := aw.do(func() error {
+		aw.frames++
+		if err := aw.writeIdxEntry(aw.chunkID, aw.lastFrameFlags, aw.lastFramePos, aw.lastFrameSize); err != nil {
+			return err
+		}
+		if aw.recLists && aw.metaStream {
+			if err := aw.frameRec(); err != nil {
+				return err
+			}
+			if err := aw.writeMetadata(); err != nil {
+				return err
+			}
+			if err := aw.endFrameRec(); err != nil {
+				return err
+			}
+		} else if err := aw.writeMetadata(); err != nil {
+			return err
+		}
+		if aw.odml {
+			return aw.flushODML(false)
+		}
+		return nil
+	})
+	if err != nil {
+		return fatal(err)
+	}
+	if aw.manifest {
+		aw.frameHashes = append(aw.frameHashes, aw.frameHashes[len(aw.frameHashes)-1])
+	}
+	aw.recordTimestamp()
+	if aw.proxy != nil && aw.proxy.aw != nil {
+		aw.proxy.img = nil
+		aw.proxy.addDup()
+	}
+	if aw.hooks.OnFrame != nil {
+		aw.hooks.OnFrame(FrameEvent{Frame: aw.frames - 1, Offset: aw.lastFramePos, Size: aw.lastFrameSize, Dup: true})
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package mjpeg
+
+import (
+	"testing"
+)
+
+// TestDedup checks that repeated frames are read back, but stored only once.
+func TestDedup(t *testing.T) {
+	f := testFrames(t, 2)
+	frames := [][]byte{f[0], f[0], f[1], f[1], f[1], f[0]}
+	for _, c := range []struct {
+		name      string
+		threshold int
+	}{
+		{"exact", 0},
+		{"perceptual", 8},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			name := writeTestVideo(t, t.TempDir(), frames, WithDedup(c.threshold))
+			checkFrames(t, name, frames)
+
+			ar, err := NewReader(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ar.Close()
+			stored := map[int64]bool{}
+			for _, e := range ar.(*aviReader).frames {
+				stored[e.offset] = true
+			}
+			if len(stored) != 3 {
+				t.Errorf("got %d stored frames, want 3", len(stored))
+			}
+		})
+	}
+}
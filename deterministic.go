@@ -0,0 +1,13 @@
+package mjpeg
+
+// WithDeterministic returns an Option which makes the output depend only on the added frames and the options,
+// so writing the same frames twice produces byte-identical videos (e.g. to compare them with golden files in tests):
+// the creation time is omitted from the stream name (the 'strn' chunk).
+// Padding and reserved fields are always zeros.
+//
+// Note that overlays using the wall-clock time (e.g. ClockOverlay()) make the frames themselves nondeterministic.
+func WithDeterministic() Option {
+	return func(aw *aviWriter) {
+		aw.deterministic = true
+	}
+}
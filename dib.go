@@ -0,0 +1,129 @@
+package mjpeg
+
+import (
+	"image"
+	"image/draw"
+)
+
+// WithRawRGB returns an Option which makes the writer create an uncompressed 'DIB ' (BI_RGB) video stream
+// instead of MJPEG, for lossless captures (e.g. UI testing, golden-image pipelines).
+//
+// Images added with AddImage() are written as 24-bit bottom-up BGR rows (each row padded to 4 bytes),
+// or as 8-bit bottom-up rows if WithGrayscale() is also used (rows are top-down with WithTopDown()).
+// Data passed to AddFrame() must already be in this format.
+// Raw frames are large: a 640x480 video takes about 22 MB per second at 25 FPS.
+func WithRawRGB() Option {
+	return func(aw *aviWriter) {
+		aw.rawRGB = true
+		aw.fourCC = "DIB "
+		aw.chunkID = 0x62643030 // "00db" uncompressed frame
+	}
+}
+
+// WithTopDown returns an Option which makes raw ('DIB ') frames top-down: rows are stored from the top
+// of the image, which is signaled by a negative biHeight in the stream format (strf), as some Windows capture
+// stacks produce and expect. By default raw frames are bottom-up (positive biHeight), the DIB convention
+// most players assume; data passed to AddFrame() must be in the row order of the writer.
+//
+// The option has no effect on compressed (e.g. MJPEG) streams: compressed DIBs can't be top-down, their biHeight
+// is always positive, and JPEG images are always stored from the top (use FlipVertical() to flip them).
+func WithTopDown() Option {
+	return func(aw *aviWriter) {
+		aw.topDown = true
+	}
+}
+
+// WithVerticalFlip returns an Option which flips frames vertically (upside down), e.g. for interop with
+// capture stacks delivering bottom-up images: images added with AddImage() (and raw pixel buffers) are flipped
+// like by the FlipVertical() transform, and raw frames passed to AddFrame() (see WithRawRGB()) are written
+// in reversed row order. JPEG data passed to AddFrame() is written unaltered (it can't be flipped without re-encoding).
+func WithVerticalFlip() Option {
+	return func(aw *aviWriter) {
+		aw.transforms = append(aw.transforms, FlipVertical())
+		aw.flipRaw = true
+	}
+}
+
+// frameHeight returns the biHeight of the stream format: negative for top-down raw frames.
+func (aw *aviWriter) frameHeight() int32 {
+	if aw.rawRGB && aw.topDown {
+		return -aw.height
+	}
+	return aw.height
+}
+
+// rawRowY returns the y coordinate of the image row stored as the i-th row of a raw frame.
+func (aw *aviWriter) rawRowY(i int) int {
+	if aw.topDown {
+		return i
+	}
+	return int(aw.height) - 1 - i
+}
+
+// flipRows returns the raw frame data with its rows in reversed order, in frameBuf.
+// data is returned unaltered if its size is not that of a raw frame.
+func (aw *aviWriter) flipRows(data []byte) []byte {
+	stride, h := aw.rawStride(), int(aw.height)
+	if len(data) != stride*h {
+		return data
+	}
+	aw.frameBuf.Reset()
+	for y := h - 1; y >= 0; y-- {
+		aw.frameBuf.Write(data[y*stride : (y+1)*stride])
+	}
+	return aw.frameBuf.Bytes()
+}
+
+// rawStride returns the size of a raw row in bytes (padded to 4 bytes).
+func (aw *aviWriter) rawStride() int {
+	return (int(aw.width)*int(aw.bitCount())/8 + 3) &^ 3
+}
+
+// rawSize returns the size of a decompressed frame in bytes.
+func (aw *aviWriter) rawSize() int32 {
+	if aw.rawRGB {
+		return int32(aw.rawStride()) * aw.height
+	}
+	return aw.width * aw.height * int32(aw.bitCount()) / 8
+}
+
+// writeCompression writes the biCompression field of the stream format.
+func (aw *aviWriter) writeCompression() {
+	if aw.rawRGB {
+		aw.writeInt32(0) // BI_RGB
+		return
+	}
+	aw.writeStr(aw.fourCC)
+}
+
+// encodeRaw encodes the image as bottom-up BGR rows into frameBuf.
+// The image is drawn at the top-left corner of a frame of the video size.
+func (aw *aviWriter) encodeRaw(img image.Image) {
+	if aw.gray {
+		aw.encodeRawGray(img)
+		return
+	}
+	w, h := int(aw.width), int(aw.height)
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Rect.Dx() != w || rgba.Rect.Dy() != h {
+		if aw.rawImg == nil {
+			aw.rawImg = image.NewRGBA(image.Rect(0, 0, w, h))
+		}
+		b := img.Bounds()
+		draw.Draw(aw.rawImg, aw.rawImg.Rect, image.Black, image.Point{}, draw.Src)
+		draw.Draw(aw.rawImg, aw.rawImg.Rect, img, b.Min, draw.Src)
+		rgba = aw.rawImg
+	}
+
+	stride := aw.rawStride()
+	aw.frameBuf.Grow(stride * h)
+	row := make([]byte, stride)
+	for i := 0; i < h; i++ {
+		y := aw.rawRowY(i)
+		pix := rgba.Pix[rgba.PixOffset(rgba.Rect.Min.X, rgba.Rect.Min.Y+y):]
+		for x := 0; x < w; x++ {
+			row[x*3], row[x*3+1], row[x*3+2] = pix[x*4+2], pix[x*4+1], pix[x*4]
+		}
+		aw.frameBuf.Write(row)
+	}
+}
@@ -0,0 +1,101 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// dumpBytes is the number of data bytes printed of chunks by DumpStructure().
+const dumpBytes = 16
+
+// DumpStructure prints the chunk tree of the RIFF (AVI) data read from r to w:
+// the FOURCC, position and size of each chunk (and the type of lists), and the first bytes of chunk data.
+// It is useful to debug player compatibility issues.
+//
+// If r has a Size() int64 method (e.g. *io.SectionReader, *bytes.Reader) or is an *os.File,
+// the data is dumped up to its size, else up to the first read error (e.g. io.EOF).
+func DumpStructure(r io.ReaderAt, w io.Writer) error {
+	size := int64(math.MaxInt64)
+	switch rr := r.(type) {
+	case interface{ Size() int64 }:
+		size = rr.Size()
+	case *os.File:
+		if fi, err := rr.Stat(); err == nil {
+			size = fi.Size()
+		}
+	}
+	return dumpChunks(r, w, 0, size, size, 0)
+}
+
+// dumpChunks prints the chunks between the positions start and end, indented by depth.
+func dumpChunks(r io.ReaderAt, w io.Writer, start, end, size int64, depth int) error {
+	hdr := make([]byte, 12)
+	data := make([]byte, dumpBytes)
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			if err == io.EOF && size == math.MaxInt64 {
+				return nil // Unknown size, end of data
+			}
+			return err
+		}
+		id := string(hdr[:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(hdr[4:]))
+
+		next := pos + 8 + chunkSize + chunkSize&0x01 // Chunks are padded to even size
+		note := ""
+		if pos+8+chunkSize > end {
+			note = " (truncated)"
+		}
+		indent := fmt.Sprintf("%*s", depth*2, "")
+
+		if id == "RIFF" || id == "LIST" {
+			if _, err := r.ReadAt(hdr[8:], pos+8); err != nil {
+				return err
+			}
+			listEnd := pos + 8 + chunkSize
+			if listEnd > end || chunkSize < 4 {
+				listEnd = end // Not finalized or truncated: walk to the end of the parent
+			} else if id == "RIFF" && depth == 0 && listEnd < end {
+				// Data after the RIFF chunk which is not another RIFF chunk (e.g. 'AVIX'): the size is wrong
+				// (e.g. written by buggy versions), so walk to the end of the data.
+				if n, err := r.ReadAt(hdr[:4], listEnd); err == nil && n == 4 && string(hdr[:4]) != "RIFF" {
+					listEnd, next, note = end, end, " (size mismatch, data continues)"
+				}
+				if _, err := r.ReadAt(hdr[8:], pos+8); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s%s '%s' @%d size %d%s\n", indent, id, hdr[8:], pos, chunkSize, note); err != nil {
+				return err
+			}
+			if err := dumpChunks(r, w, pos+12, listEnd, size, depth+1); err != nil {
+				return err
+			}
+			if chunkSize < 4 {
+				return nil
+			}
+		} else {
+			n, err := r.ReadAt(data[:min64(chunkSize, dumpBytes)], pos+8)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s%s @%d size %d%s  % x\n", indent, id, pos, chunkSize, note, data[:n]); err != nil {
+				return err
+			}
+		}
+
+		pos = next
+	}
+	return nil
+}
+
+// min64 returns the smaller of a and b.
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
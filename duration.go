@@ -0,0 +1,43 @@
+package mjpeg
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDurationLimit reports if a frame can't be added because the video would exceed
+// the duration limit set with WithMaxDuration().
+var ErrDurationLimit = errors.New("Video duration limit reached")
+
+// WithMaxDuration returns an Option which limits the duration of the video to d (based on the FPS):
+// adding a frame which would make the video longer fails with ErrDurationLimit, so the caller can
+// finalize the video cleanly, e.g. to record at most 10 minutes. See WithAutoFinalize() to finalize
+// the video automatically when the limit is reached.
+func WithMaxDuration(d time.Duration) Option {
+	return func(aw *aviWriter) {
+		aw.maxDuration = d
+	}
+}
+
+// WithAutoFinalize returns an Option which makes the writer finalize the video when the duration limit
+// set with WithMaxDuration() is reached: the frame that doesn't fit is refused with ErrDurationLimit
+// (and so are all later calls), and the video is finalized as if Close() was called.
+// Close() may still be called, it returns the result of the finalization.
+func WithAutoFinalize() Option {
+	return func(aw *aviWriter) {
+		aw.autoFinalize = true
+	}
+}
+
+// checkDuration checks if the next frame fits the duration limit.
+// If it doesn't and auto finalization is enabled, the video is finalized.
+func (aw *aviWriter) checkDuration() error {
+	if aw.maxDuration <= 0 || aw.frameTime(aw.frames+1) <= aw.maxDuration {
+		return nil
+	}
+	if aw.autoFinalize && !aw.closed {
+		aw.Close()                     // The error is kept and returned by Close()
+		return fatal(ErrDurationLimit) // No more data is accepted
+	}
+	return ErrDurationLimit
+}
@@ -0,0 +1,200 @@
+package mjpeg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEncryption reports an invalid encryption key or IV, see WithEncryption().
+var ErrEncryption = errors.New("Invalid encryption key or IV")
+
+// WithEncryption returns an Option which makes the writer encrypt the whole video file with AES in CTR mode,
+// so recordings (e.g. on removable media) are not readable without the key.
+// key must be 16, 24 or 32 bytes long (AES-128, AES-192 or AES-256).
+//
+// iv is the 16-byte initial counter block, which must be unique for each video written with the same key.
+// If iv is nil, a random one is generated and written hex encoded into a companion .iv file
+// (the IV is not secret). An iv must be given if the video is written to an io.Writer.
+//
+// The byte at offset n of the file is XORed with byte n of the key stream: the counter block is
+// the IV incremented (as a 128-bit big-endian number) by n/16. This is the standard CTR mode, so the file
+// can also be decrypted with e.g.
+//
+//	openssl enc -d -aes-128-ctr -K <hex key> -iv <hex IV> -in video.avi -out plain.avi
+//
+// Use NewEncryptedReader() to read encrypted videos. Encrypted videos can't be reopened with Open(),
+// Checkpoint() and the two-pass mode are not supported with this option.
+func WithEncryption(key, iv []byte) Option {
+	return func(aw *aviWriter) {
+		aw.encrypt, aw.encKey, aw.encIV = true, key, iv
+	}
+}
+
+// ivFile returns the name of the companion IV file of the given AVI file.
+func ivFile(aviFile string) string {
+	return strings.TrimSuffix(aviFile, filepath.Ext(aviFile)) + ".iv"
+}
+
+// initEncryption creates the cipher of the writer, generating and saving a random IV if none is given.
+func (aw *aviWriter) initEncryption() (err error) {
+	if aw.encBlock, err = aes.NewCipher(aw.encKey); err != nil {
+		return ErrEncryption
+	}
+	if aw.encIV != nil {
+		if len(aw.encIV) != aes.BlockSize {
+			return ErrEncryption
+		}
+		return nil
+	}
+	if aw.aviFile == "" {
+		return ErrEncryption
+	}
+	aw.encIV = make([]byte, aes.BlockSize)
+	if _, err = rand.Read(aw.encIV); err != nil {
+		return err
+	}
+	return os.WriteFile(ivFile(aw.aviFile), []byte(hex.EncodeToString(aw.encIV)+"\n"), 0644)
+}
+
+// wrapEncryption returns ws encrypting the data written to it if encryption is enabled, else ws itself.
+func (aw *aviWriter) wrapEncryption(ws io.WriteSeeker) io.WriteSeeker {
+	if aw.encBlock == nil {
+		return ws
+	}
+	pos, _ := ws.Seek(0, io.SeekCurrent)
+	return &ctrWriter{ws: ws, block: aw.encBlock, iv: aw.encIV, pos: pos}
+}
+
+// ctrStream returns the key stream of the cipher starting at the given offset.
+func ctrStream(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	ctr := make([]byte, aes.BlockSize)
+	copy(ctr, iv)
+	// Add offset/16 to the counter, as a 128-bit big-endian number
+	carry := uint64(offset / aes.BlockSize)
+	for i := len(ctr) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(ctr[i]) + carry&0xff
+		ctr[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	s := cipher.NewCTR(block, ctr)
+	if skip := int(offset % aes.BlockSize); skip > 0 {
+		var discard [aes.BlockSize]byte
+		s.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	return s
+}
+
+// ctrWriter is an io.WriteSeeker which encrypts the data written with AES-CTR (see WithEncryption()).
+type ctrWriter struct {
+	// ws is the destination
+	ws io.WriteSeeker
+	// block is the cipher, iv is the initial counter block
+	block cipher.Block
+	iv    []byte
+	// pos is the current position
+	pos int64
+	// stream is the key stream at pos, nil if it has to be recreated (after a seek)
+	stream cipher.Stream
+	// buf is the reused buffer of encrypted data
+	buf []byte
+}
+
+// Write implements io.Writer.
+func (cw *ctrWriter) Write(p []byte) (int, error) {
+	if cw.stream == nil {
+		cw.stream = ctrStream(cw.block, cw.iv, cw.pos)
+	}
+	if cap(cw.buf) < len(p) {
+		cw.buf = make([]byte, len(p))
+	}
+	buf := cw.buf[:len(p)]
+	cw.stream.XORKeyStream(buf, p)
+	n, err := cw.ws.Write(buf)
+	cw.pos += int64(n)
+	if n < len(p) {
+		cw.stream = nil // The key stream is ahead of pos
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (cw *ctrWriter) Seek(offset int64, whence int) (int64, error) {
+	pos, err := cw.ws.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos != cw.pos {
+		cw.pos, cw.stream = pos, nil
+	}
+	return pos, nil
+}
+
+// Truncate truncates the destination if it supports it (see riff.Writer.Rollback()).
+func (cw *ctrWriter) Truncate(size int64) error {
+	if t, ok := cw.ws.(interface{ Truncate(size int64) error }); ok {
+		return t.Truncate(size)
+	}
+	return nil
+}
+
+// ctrReaderAt is an io.ReaderAt which decrypts the data read with AES-CTR (see WithEncryption()).
+type ctrReaderAt struct {
+	// r is the source
+	r io.ReaderAt
+	// block is the cipher, iv is the initial counter block
+	block cipher.Block
+	iv    []byte
+}
+
+// ReadAt implements io.ReaderAt.
+func (cr *ctrReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(p, off)
+	ctrStream(cr.block, cr.iv, off).XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+// NewEncryptedReader returns a new AviReader reading the given video file encrypted with WithEncryption().
+// If iv is nil, it is read from the companion .iv file.
+// The Close() method of the AviReader must be called to release the file.
+func NewEncryptedReader(aviFile string, key, iv []byte) (AviReader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrEncryption
+	}
+	if iv == nil {
+		data, err := os.ReadFile(ivFile(aviFile))
+		if err != nil {
+			return nil, err
+		}
+		if iv, err = hex.DecodeString(strings.TrimSpace(string(data))); err != nil {
+			return nil, ErrEncryption
+		}
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, ErrEncryption
+	}
+
+	f, err := os.Open(aviFile)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ar, err := newReader(&ctrReaderAt{r: f, block: block, iv: iv}, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ar.closer = f
+	return ar, nil
+}
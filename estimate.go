@@ -0,0 +1,85 @@
+package mjpeg
+
+import (
+	"io"
+	"os"
+)
+
+// DryRun is an AviWriter which discards the written data, but computes the exact size of the resulting
+// video file (including headers, padding and index), e.g. to plan uploads before writing the video.
+type DryRun struct {
+	AviWriter
+	// sc counts the size of the video
+	sc *sizeCounter
+}
+
+// NewDryRun returns a new DryRun writer accepting the same options as New().
+// Size() reports the size of the video file after Close().
+func NewDryRun(width, height, fps int32, opts ...Option) (*DryRun, error) {
+	sc := &sizeCounter{}
+	aw, err := newWriter("", sc, width, height, fps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRun{AviWriter: aw, sc: sc}, nil
+}
+
+// Size returns the size of the video file: the size of the data written so far,
+// and the exact size of the finalized video after Close().
+func (d *DryRun) Size() int64 {
+	return d.sc.size
+}
+
+// EstimateSize returns the size of a video file written with default options (see New()),
+// having the given number of frames with the given average size (in bytes).
+func EstimateSize(frames int, avgFrameBytes int) int64 {
+	d, err := NewDryRun(1, 1, 1)
+	if err != nil {
+		return 0
+	}
+	header := d.Size()
+	d.Close()
+
+	chunk := int64(8 + avgFrameBytes + avgFrameBytes&0x01) // Chunks are padded to even size
+	return header + int64(frames)*(chunk+16) + 8           // idx1 chunk: 16 bytes per frame
+}
+
+// sizeCounter is an io.WriteSeeker which discards the data, but tracks the size of the data written.
+type sizeCounter struct {
+	// pos is the current position
+	pos int64
+	// size is the size of the written data
+	size int64
+}
+
+// Write implements io.Writer.
+func (sc *sizeCounter) Write(p []byte) (int, error) {
+	sc.pos += int64(len(p))
+	if sc.pos > sc.size {
+		sc.size = sc.pos
+	}
+	return len(p), nil
+}
+
+// Seek implements io.Seeker.
+func (sc *sizeCounter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += sc.pos
+	case io.SeekEnd:
+		offset += sc.size
+	}
+	if offset < 0 {
+		return sc.pos, os.ErrInvalid
+	}
+	sc.pos = offset
+	return offset, nil
+}
+
+// Truncate discards the data after the given size.
+func (sc *sizeCounter) Truncate(size int64) error {
+	if size < sc.size {
+		sc.size = size
+	}
+	return nil
+}
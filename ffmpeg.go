@@ -0,0 +1,81 @@
+package mjpeg
+
+// ffmpegJunkPadding is the size of the JUNK chunk ffmpeg writes before the movi list (for easier tag editing).
+const ffmpegJunkPadding = 1016
+
+// WithFFmpegLayout returns an Option which makes the writer lay out the headers like
+// ffmpeg does (ffmpeg -c:v mjpeg -f avi), for tools making assumptions based on files produced by ffmpeg:
+//   - avih: AVIF_HASINDEX | AVIF_ISINTERLEAVED | AVIF_TRUSTCKTYPE flags, 1 MB suggested buffer size,
+//     and the average data rate as the maximum data rate;
+//   - strh: rcFrame set to the frame size, the size of the largest frame as the suggested buffer size;
+//   - a JUNK chunk reserving the space of an OpenDML super index after strf (the super index itself
+//     if WithODMLIndex() is used), no strn chunk;
+//   - an 'odml' list with the extended AVI header, an INFO list with the software name (ISFT), and
+//     a JUNK chunk padding the headers before the movi list.
+//
+// The movi list and the idx1 index are the same as without the option (except with other options,
+// e.g. WithRecLists()). Not supported by Checkpoint(), files written with it can't be opened by Open().
+func WithFFmpegLayout() Option {
+	return func(aw *aviWriter) {
+		aw.ffmpeg = true
+	}
+}
+
+// suggestedBufferSize returns the dwSuggestedBufferSize of the AVI header.
+func (aw *aviWriter) suggestedBufferSize() int32 {
+	if aw.ffmpeg {
+		return 1 << 20
+	}
+	return 0
+}
+
+// writeFFmpegIndexJunk writes the JUNK chunk ffmpeg reserves for the OpenDML super index of a stream.
+func (aw *aviWriter) writeFFmpegIndexJunk(chunkID int32) {
+	aw.writeStr("JUNK")                     // Reserved space for the super index
+	aw.writeInt32(24 + odmlSuperEntries*16) // Chunk size
+	aw.writeInt16(4)                        // wLongsPerEntry
+	aw.writeInt16(0)                        // bIndexSubType, bIndexType
+	aw.writeInt32(0)                        // nEntriesInUse
+	aw.writeInt32(chunkID)                  // dwChunkId
+	aw.writeZeros(12 + odmlSuperEntries*16) // dwReserved[3] and the entries
+}
+
+// writeFFmpegInfo writes the INFO list and the JUNK padding ffmpeg writes after the header list.
+func (aw *aviWriter) writeFFmpegInfo() {
+	aw.pushList("INFO") // LIST chunk: file information (nesting level 1)
+	aw.pushChunk("ISFT")
+	aw.writeStr("github.com/icza/mjpeg\000") // Software name, zero terminated (padded to even size by pop())
+	aw.pop()
+	aw.writeTimecodeEntry()
+	aw.writeColorEntry()
+	aw.writePosterEntry()
+	aw.pop() // LIST 'INFO' finished (nesting level 1)
+
+	aw.writeStr("JUNK") // Padding
+	aw.writeInt32(ffmpegJunkPadding)
+	aw.writeZeros(ffmpegJunkPadding)
+}
+
+// recordFFmpegFrame records the size of a written frame for the header fields.
+func (aw *aviWriter) recordFFmpegFrame(size int) {
+	aw.frameBytes += int64(size)
+	if size > aw.maxFrameSize {
+		aw.maxFrameSize = size
+	}
+}
+
+// finalizeFFmpeg fills the header fields ffmpeg sets when the file is finalized.
+func (aw *aviWriter) finalizeFFmpeg() {
+	pos := aw.currentPos()
+	if aw.frames > 0 && aw.fps > 0 {
+		aw.seek(aw.framesCountFieldPos-12, 0)
+		aw.writeInt32(int32(aw.frameBytes * int64(aw.fps) / (int64(aw.frames) * int64(aw.scale)))) // dwMaxBytesPerSec
+	}
+	aw.seek(aw.framesCountFieldPos2+4, 0)
+	aw.writeInt32(int32(aw.maxFrameSize)) // dwSuggestedBufferSize
+	if !aw.odml {                         // Filled by finalizeODML() else
+		aw.seek(aw.dmlhFramesPos, 0)
+		aw.writeInt32(int32(aw.frames)) // dwTotalFrames
+	}
+	aw.seek(pos, 0)
+}
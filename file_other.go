@@ -0,0 +1,18 @@
+//go:build !windows
+
+package mjpeg
+
+import "os"
+
+// createFile creates (or truncates) the named video file for reading and writing.
+func createFile(name string) (*os.File, error) {
+	return os.Create(name)
+}
+
+// openFile opens the named video file for reading, and for writing too if write is true.
+func openFile(name string, write bool) (*os.File, error) {
+	if write {
+		return os.OpenFile(name, os.O_RDWR, 0)
+	}
+	return os.Open(name)
+}
@@ -0,0 +1,54 @@
+package mjpeg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// createFile creates (or truncates) the named video file for reading and writing, see openShared().
+func createFile(name string) (*os.File, error) {
+	return openShared(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, syscall.CREATE_ALWAYS)
+}
+
+// openFile opens the named video file for reading, and for writing too if write is true, see openShared().
+func openFile(name string, write bool) (*os.File, error) {
+	access := uint32(syscall.GENERIC_READ)
+	if write {
+		access |= syscall.GENERIC_WRITE
+	}
+	return openShared(name, access, syscall.OPEN_EXISTING)
+}
+
+// openShared opens a file allowing others to read, write and delete (or rename) it while it is open,
+// so e.g. players can tail a growing video, and retention can remove segments being read.
+// Long (and UNC) paths are supported, relative ones too.
+func openShared(name string, access, mode uint32) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(longPath(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	const share = syscall.FILE_SHARE_READ | syscall.FILE_SHARE_WRITE | syscall.FILE_SHARE_DELETE
+	h, err := syscall.CreateFile(p, access, share, nil, mode, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// longPath returns the extended-length form (\\?\ prefixed) of paths exceeding the MAX_PATH limit of Windows.
+func longPath(name string) string {
+	const maxPath = 248 // MAX_PATH minus room for an 8.3 file name, the limit of directories
+	if len(name) < maxPath || strings.HasPrefix(name, `\\?\`) {
+		return name
+	}
+	abs, err := filepath.Abs(name) // Extended-length paths must be absolute and clean
+	if err != nil {
+		return name
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:] // \\server\share\...
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,22 @@
+package mjpeg
+
+import "errors"
+
+// ErrFinalized reports if data is added to a video finalized with AviWriter.Finalize().
+var ErrFinalized = errors.New("Video finalized")
+
+// Finalize implements AviWriter.Finalize().
+func (aw *aviWriter) Finalize() error {
+	if aw.closed {
+		return aw.closeErr
+	}
+	if !aw.finalized {
+		aw.finalized = true
+		aw.finalizeErr = aw.finalize()
+		if aw.finalizeErr == nil && aw.avif != nil && aw.dst == nil {
+			aw.finalizeErr = aw.avif.Sync()
+		}
+		aw.err = ErrFinalized // Refuse all further writes
+	}
+	return aw.notifyErr(aw.finalizeErr)
+}
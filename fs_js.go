@@ -0,0 +1,4 @@
+package mjpeg
+
+// hasFS tells if the platform has a file system: there is none in browsers, the index is kept in memory.
+const hasFS = false
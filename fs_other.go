@@ -0,0 +1,6 @@
+//go:build !js
+
+package mjpeg
+
+// hasFS tells if the platform has a file system.
+const hasFS = true
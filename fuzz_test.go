@@ -0,0 +1,92 @@
+package mjpeg
+
+// Fuzz targets of the parsers of untrusted input: JPEG frames of cameras, and AVI files.
+// Run them with e.g.:
+//
+//	go test -run=^$ -fuzz=FuzzJPEGMarkers -fuzztime=1m
+//	go test -run=^$ -fuzz=FuzzReader -fuzztime=1m
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// smallJPEG returns a small JPEG encoded image.
+func smallJPEG(tb testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// FuzzJPEGMarkers checks that the JPEG marker scanners don't panic or hang on malformed frames.
+func FuzzJPEGMarkers(f *testing.F) {
+	data := smallJPEG(f)
+	f.Add(data)
+	f.Add(data[:len(data)/2])
+	f.Add(append(append([]byte{0xff, markerSOI}, jfifSegment...), data[2:]...))
+	f.Add([]byte{0xff, markerSOI, 0xff, markerEOI})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseJPEGHeader(data)
+		checkJPEGMarkers(data)
+		aw := &aviWriter{}
+		aw.stripJPEG(data)
+		for _, r := range []ColorRange{RangeFull, RangeLimited} {
+			aw.color.Range = r
+			if _, err := aw.normalizeJPEG(data); err != nil {
+				t.Fatal(err) // Without range conversion, frames are never re-encoded
+			}
+		}
+	})
+}
+
+// FuzzReader checks that the AVI parsers (the reader, the validator and the structure dump)
+// don't panic or hang on corrupt files.
+func FuzzReader(f *testing.F) {
+	dir := f.TempDir()
+	for i, opts := range [][]Option{nil, {WithODMLIndex()}, {WithMetadataStream(), WithTimecode(Timecode{Hours: 1})}} {
+		name := filepath.Join(dir, string(rune('a'+i))+".avi")
+		aw, err := New(name, 16, 8, 25, opts...)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data := smallJPEG(f)
+		for j := 0; j < 3; j++ {
+			if err := aw.AddFrame(data); err != nil {
+				f.Fatal(err)
+			}
+		}
+		if err := aw.Close(); err != nil {
+			f.Fatal(err)
+		}
+		avi, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(avi)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DumpStructure(bytes.NewReader(data), io.Discard)
+
+		ar, err := newReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		for i := 0; i < ar.info.Frames && i < 100; i++ {
+			ar.Frame(i)
+		}
+		v := &validator{ar: ar, rep: &Report{Info: ar.info}}
+		if v.checkChunks(0, ar.size, 0) == nil {
+			v.checkHeaders()
+			v.checkFrames()
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package mjpeg
+
+import "time"
+
+// GapPolicy tells how a period without frames from the source of a video (e.g. while a camera
+// is disconnected) is handled, see AviWriter.FillGap() and RecordCamera().
+type GapPolicy int
+
+// Gap policies.
+const (
+	// GapFreeze repeats the last frame (written as duplicate index entries) for the duration of the gap,
+	// so the video stays in sync with the wall clock
+	GapFreeze GapPolicy = iota
+	// GapSlate inserts a slate frame (e.g. a "No signal" image) repeated for the duration of the gap
+	GapSlate
+	// GapCut writes no frames: the recording is continued in a new segment
+	GapCut
+)
+
+// String returns the name of the gap policy as recorded in manifests: "freeze", "slate" or "cut".
+func (p GapPolicy) String() string {
+	switch p {
+	case GapSlate:
+		return "slate"
+	case GapCut:
+		return "cut"
+	}
+	return "freeze"
+}
+
+// gapEntry is the manifest entry of a gap.
+type gapEntry struct {
+	// Frame is the (zero-based) index of the first frame of (or after) the gap
+	Frame int `json:"frame"`
+	// Frames is the number of frames filling the gap
+	Frames int `json:"frames"`
+	// DurationMS is the duration of the gap in milliseconds
+	DurationMS int64 `json:"duration_ms"`
+	// Policy is the name of the gap policy
+	Policy string `json:"policy"`
+}
+
+// FillGap implements AviWriter.FillGap().
+func (aw *aviWriter) FillGap(d time.Duration, policy GapPolicy, slate []byte) error {
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	first, frames := aw.frames, 0
+	if ft := aw.frameTime(1); ft > 0 && policy != GapCut {
+		frames = int((d + ft/2) / ft)
+	}
+	for i := 0; i < frames; i++ {
+		var err error
+		switch {
+		case policy == GapSlate && i == 0 && slate == nil:
+			err = aw.AddImage(Slate(int(aw.width), int(aw.height), SlateConfig{Time: time.Now().Add(-d)}))
+		case policy == GapSlate && i == 0:
+			err = aw.AddFrame(slate)
+		case aw.frames > 0:
+			err = aw.notifyErr(aw.addDupFrame())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	aw.gaps = append(aw.gaps, gapEntry{Frame: first, Frames: aw.frames - first, DurationMS: d.Milliseconds(), Policy: policy.String()})
+	return nil
+}
@@ -0,0 +1,47 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"time"
+)
+
+// ExportGIF exports the clip of the video aviFile specified by cfg as an animated GIF to outFile,
+// e.g. for previews of recordings in chats. Frames are reduced to the web-safe palette with dithering;
+// GIF delays are in 1/100 seconds, rounding errors don't accumulate over the clip.
+// Use ClipConfig.Width and ClipConfig.Step to keep GIF files small.
+func ExportGIF(aviFile, outFile string, cfg ClipConfig) error {
+	g := &gif.GIF{}
+	switch {
+	case cfg.Loops == 1:
+		g.LoopCount = -1 // Played once
+	case cfg.Loops > 1:
+		g.LoopCount = cfg.Loops - 1 // GIF counts the repetitions after the first play
+	}
+
+	var elapsed time.Duration // End of the previous frame
+	var delays int            // Sum of the delays of the previous frames
+	_, err := readClip(aviFile, cfg, func(f *clipFrame) error {
+		pm := image.NewPaletted(f.img.Rect, palette.WebSafe)
+		draw.FloydSteinberg.Draw(pm, pm.Rect, f.img, f.img.Rect.Min)
+		elapsed += f.duration
+		delay := int((elapsed+5*time.Millisecond)/(10*time.Millisecond)) - delays
+		g.Image = append(g.Image, pm)
+		g.Delay = append(g.Delay, delay)
+		delays += delay
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := gif.EncodeAll(&out, g); err != nil {
+		return err
+	}
+	return os.WriteFile(outFile, out.Bytes(), 0644)
+}
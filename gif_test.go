@@ -0,0 +1,40 @@
+package mjpeg
+
+import (
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestExportGIF checks the frames, delays and loop count of the GIF.
+func TestExportGIF(t *testing.T) {
+	dir := t.TempDir()
+	name, _ := clipTestVideo(t, dir)
+	out := filepath.Join(dir, "test.gif")
+	if err := ExportGIF(name, out, ClipConfig{Width: smallWidth / 2, Loops: 3}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("got %d frames, want 3", len(g.Image))
+	}
+	if b := g.Image[0].Bounds(); b.Dx() != smallWidth/2 || b.Dy() != smallHeight/2 {
+		t.Errorf("got frame size %v", b)
+	}
+	if want := []int{20, 10, 10}; !reflect.DeepEqual(g.Delay, want) {
+		t.Errorf("got delays %v, want %v", g.Delay, want)
+	}
+	if g.LoopCount != 2 {
+		t.Errorf("got loop count %d, want 2", g.LoopCount)
+	}
+}
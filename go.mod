@@ -1,3 +1,5 @@
 module github.com/icza/mjpeg
 
 go 1.20
+
+require golang.org/x/image v0.18.0
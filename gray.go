@@ -0,0 +1,76 @@
+package mjpeg
+
+import (
+	"image"
+	"image/draw"
+)
+
+// WithGrayscale returns an Option which makes the writer create a grayscale (single-channel) video,
+// e.g. for thermal and industrial cameras.
+//
+// Images added with AddImage() are encoded as single-component JPEGs (or as 8-bit raw frames
+// with a grayscale palette if WithRawRGB() is also used). *image.Gray images are encoded directly,
+// other images are converted to grayscale first. The stream format reports 8 bits per pixel.
+func WithGrayscale() Option {
+	return func(aw *aviWriter) {
+		aw.gray = true
+	}
+}
+
+// bitCount returns the number of bits per pixel of decompressed frames.
+func (aw *aviWriter) bitCount() int16 {
+	if aw.gray {
+		return 8
+	}
+	return 24
+}
+
+// paletteSize returns the number of colors of the color table of the stream format.
+// Only 8-bit raw frames have a color table.
+func (aw *aviWriter) paletteSize() int32 {
+	if aw.gray && aw.rawRGB {
+		return 256
+	}
+	return 0
+}
+
+// writePalette writes the grayscale color table of the stream format (if it has one).
+func (aw *aviWriter) writePalette() {
+	for i := int32(0); i < aw.paletteSize(); i++ {
+		v := byte(i)
+		aw.rw.Write([]byte{v, v, v, 0}) // RGBQUAD: blue, green, red, reserved
+	}
+}
+
+// toGray returns img as an *image.Gray, converting it into the reused gray image if needed.
+func (aw *aviWriter) toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	if aw.grayImg == nil || aw.grayImg.Rect != b {
+		aw.grayImg = image.NewGray(b)
+	}
+	draw.Draw(aw.grayImg, b, img, b.Min, draw.Src)
+	return aw.grayImg
+}
+
+// encodeRawGray encodes the image as bottom-up 8-bit rows into frameBuf.
+// The image is placed at the top-left corner of a frame of the video size, the rest of the frame is black.
+func (aw *aviWriter) encodeRawGray(img image.Image) {
+	g := aw.toGray(img)
+	w, h := int(aw.width), int(aw.height)
+	stride := aw.rawStride()
+	aw.frameBuf.Grow(stride * h)
+	row := make([]byte, stride)
+	for i := 0; i < h; i++ {
+		y, n := aw.rawRowY(i), 0
+		if y < g.Rect.Dy() {
+			n = copy(row[:w], g.Pix[g.PixOffset(g.Rect.Min.X, g.Rect.Min.Y+y):g.PixOffset(g.Rect.Max.X, g.Rect.Min.Y+y)])
+		}
+		for i := n; i < len(row); i++ {
+			row[i] = 0
+		}
+		aw.frameBuf.Write(row)
+	}
+}
@@ -0,0 +1,372 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrInvalidHeader reports if an edited header is invalid, see EditHeader().
+	ErrInvalidHeader = errors.New("Invalid header")
+
+	// ErrHeaderSpace reports if there is no room in the file for an edited header field, see EditHeader().
+	ErrHeaderSpace = errors.New("No room for the header field")
+)
+
+// AVI header flags (the dwFlags of the AVI header), see Header.Flags.
+const (
+	AVIFHasIndex       int32 = 0x10    // The file has an idx1 index (derived from the file, it can't be changed)
+	AVIFMustUseIndex   int32 = 0x20    // The order of frames is given by the index, not the order of chunks
+	AVIFIsInterleaved  int32 = 0x100   // The streams are interleaved
+	AVIFTrustCKType    int32 = 0x800   // The key frame flags of the index are to be trusted
+	AVIFWasCaptureFile int32 = 0x10000 // The file was captured in real time
+	AVIFCopyrighted    int32 = 0x20000 // The file contains copyrighted data
+)
+
+// avifKnown is the mask of the known AVI header flags.
+const avifKnown = AVIFHasIndex | AVIFMustUseIndex | AVIFIsInterleaved | AVIFTrustCKType | AVIFWasCaptureFile | AVIFCopyrighted
+
+// avifSettable is the mask of the AVI header flags which can be set with WithAVIFlags().
+const avifSettable = AVIFMustUseIndex | AVIFWasCaptureFile | AVIFCopyrighted
+
+// WithAVIFlags returns an Option which sets additional flags of the AVI header: AVIFWasCaptureFile,
+// AVIFCopyrighted and AVIFMustUseIndex, e.g. to match the spec of an ingest vendor.
+// Other flags are derived from the structure of the file by the writer, and are ignored.
+func WithAVIFlags(flags int32) Option {
+	return func(aw *aviWriter) {
+		aw.extraAVIFlags = flags & avifSettable
+	}
+}
+
+// WithStreamPriority returns an Option which sets the wPriority and wLanguage fields of the stream header
+// of the video stream (0 by default). language is a Windows language identifier (LANGID), e.g. 0x0409 for English (US).
+func WithStreamPriority(priority, language uint16) Option {
+	return func(aw *aviWriter) {
+		aw.streamPriority, aw.streamLanguage = priority, language
+	}
+}
+
+// Header holds the editable fields of the headers of a video file, see EditHeader().
+type Header struct {
+	// Rate and Scale specify the frame rate: Rate/Scale frames per second
+	Rate, Scale int32
+	// Name is the name of the video stream (the strn chunk)
+	Name string
+	// Info holds the entries of the INFO list (file metadata) by chunk id, e.g. "INAM" (title), "ICMT" (comment)
+	Info map[string]string
+	// Flags are the flags of the AVI header (AVIF* constants)
+	Flags int32
+}
+
+// headerRegion is a region of the file holding a chunk (including its header), and the JUNK chunk following it (if any),
+// which the edited chunk may take over.
+type headerRegion struct {
+	// pos is the position of the region, -1 if there is none
+	pos int64
+	// size is the size of the region
+	size int64
+}
+
+// headerLayout holds the positions of the editable fields of a video file.
+type headerLayout struct {
+	// avihPos is the position of the AVI header data
+	avihPos int64
+	// strhPos are the positions of the stream headers timed by frames (the video and e.g. the metadata stream)
+	strhPos []int64
+	// vprpPos is the position of the video properties data of the video stream, -1 if there is none
+	vprpPos int64
+	// strn is the region of the strn chunk of the video stream
+	strn headerRegion
+	// info is the region of the INFO list (or a top-level JUNK chunk to write it in if there is no INFO list)
+	info headerRegion
+	// infoEntries are the entries of the INFO list
+	infoEntries map[string]string
+}
+
+// EditHeader modifies the headers of the video file path in place, without rewriting the file
+// (e.g. to fix metadata of multi-GB files): edit is called with the current values, and may change them.
+// Changed fields are validated (ErrInvalidFPS, ErrInvalidChunkID, ErrInvalidHeader), and written along with
+// the fields derived from them (e.g. the microseconds per frame of the AVI header are derived from the frame rate,
+// see SetPlaybackRate()). Nothing is written if any changed field is invalid or doesn't fit.
+//
+// The stream name and the INFO list keep their place in the file: they can grow only into a JUNK chunk following them
+// (or the INFO list may be written into a top-level JUNK chunk before the movi list, if the file has no INFO list),
+// else ErrHeaderSpace is returned. Files written with WithFFmpegLayout() have such room for the INFO list.
+func EditHeader(path string, edit func(h *Header)) (err error) {
+	f, err := openFile(path, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ar, err := newReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	l, err := ar.headerLayout()
+	if err != nil {
+		return err
+	}
+	avih, err := ar.readChunk(l.avihPos, 56)
+	if err != nil {
+		return err
+	}
+
+	old := Header{
+		Rate:  ar.info.Rate,
+		Scale: ar.info.Scale,
+		Name:  ar.info.Name,
+		Flags: int32(binary.LittleEndian.Uint32(avih[12:])),
+		Info:  l.infoEntries,
+	}
+	h := old
+	h.Info = make(map[string]string, len(old.Info))
+	for k, v := range old.Info {
+		h.Info[k] = v
+	}
+	edit(&h)
+
+	// Collect the changes first, so nothing is written if a change is invalid
+	type patch struct {
+		pos  int64
+		data []byte
+	}
+	var patches []patch
+	put32 := func(pos int64, v uint32) {
+		patches = append(patches, patch{pos, binary.LittleEndian.AppendUint32(nil, v)})
+	}
+
+	if h.Rate != old.Rate || h.Scale != old.Scale {
+		if h.Rate <= 0 || h.Scale <= 0 {
+			return ErrInvalidFPS
+		}
+		fps, oldFPS := float64(h.Rate)/float64(h.Scale), old.FPS()
+		put32(l.avihPos, uint32(int64(h.Scale)*1e6/int64(h.Rate))) // dwMicroSecPerFrame
+		if maxRate := binary.LittleEndian.Uint32(avih[4:]); maxRate > 0 && oldFPS > 0 {
+			put32(l.avihPos+4, uint32(float64(maxRate)*fps/oldFPS)) // dwMaxBytesPerSec
+		}
+		for _, pos := range l.strhPos {
+			put32(pos+20, uint32(h.Scale)) // dwScale
+			put32(pos+24, uint32(h.Rate))  // dwRate
+		}
+		if l.vprpPos >= 0 {
+			put32(l.vprpPos+8, uint32(fps+0.5)) // dwVerticalRefreshRate
+		}
+	}
+
+	if h.Flags != old.Flags {
+		hasIndex := old.Flags & AVIFHasIndex
+		if h.Flags&^avifKnown != 0 || h.Flags&AVIFHasIndex != hasIndex || h.Flags&AVIFMustUseIndex != 0 && hasIndex == 0 {
+			return ErrInvalidHeader
+		}
+		put32(l.avihPos+12, uint32(h.Flags)) // dwFlags
+	}
+
+	if h.Name != old.Name {
+		if bytes.IndexByte([]byte(h.Name), 0) >= 0 {
+			return ErrInvalidHeader
+		}
+		data, err := fitRegion(l.strn, chunkBytes("strn", []byte(h.Name+"\000")))
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch{l.strn.pos, data})
+	}
+
+	if !equalInfo(h.Info, old.Info) {
+		ids := make([]string, 0, len(h.Info))
+		for id := range h.Info {
+			if !validCustomID(id) || bytes.IndexByte([]byte(h.Info[id]), 0) >= 0 {
+				return ErrInvalidChunkID
+			}
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		list := []byte("INFO")
+		for _, id := range ids {
+			list = append(list, chunkBytes(id, []byte(h.Info[id]+"\000"))...)
+		}
+		data, err := fitRegion(l.info, chunkBytes("LIST", list))
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch{l.info.pos, data})
+	}
+
+	for _, p := range patches {
+		if _, err = f.WriteAt(p.data, p.pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FPS returns the frames/second of the header.
+func (h Header) FPS() float64 {
+	if h.Scale == 0 {
+		return 0
+	}
+	return float64(h.Rate) / float64(h.Scale)
+}
+
+// SetPlaybackRate changes the frame rate of the video file path to num/den frames per second in place,
+// by rewriting the dwRate / dwScale fields of the stream headers and the microseconds per frame
+// of the AVI header, without touching the frame data, e.g. to turn a 2 FPS timelapse into a 30 FPS playback file
+// instantly. The maximum data rate of the AVI header and the refresh rate of the video properties (if present,
+// see WithAspectRatio()) are updated accordingly.
+//
+// Streams timed by frames (the metadata stream and other video streams with the frame rate of the video)
+// are changed along with the video; audio streams are not, so audio gets out of sync.
+func SetPlaybackRate(path string, num, den int32) error {
+	if num <= 0 || den <= 0 {
+		return ErrInvalidFPS
+	}
+	return EditHeader(path, func(h *Header) {
+		h.Rate, h.Scale = num, den
+	})
+}
+
+// headerLayout locates the editable fields of the headers.
+func (ar *aviReader) headerLayout() (*headerLayout, error) {
+	l := &headerLayout{avihPos: -1, vprpPos: -1, strn: headerRegion{pos: -1}, info: headerRegion{pos: -1}}
+	hdr := make([]byte, 28)
+	var last *headerRegion // The region of the last chunk, which may be continued by a JUNK chunk
+
+	// strl walks the stream list of the given stream.
+	strl := func(stream int, start, end int64) error {
+		video := stream == ar.videoStream
+		last = nil
+		return ar.walk(start, end, func(id string, pos, size int64) error {
+			switch {
+			case id == "JUNK" && last != nil:
+				last.size += 8 + size + size&1
+				last = nil
+				return nil
+			case id == "strh" && size >= 28:
+				if _, err := ar.r.ReadAt(hdr, pos); err != nil {
+					return err
+				}
+				// Streams timed by frames (e.g. the metadata stream) are changed along with the video
+				scale, rate := int32(binary.LittleEndian.Uint32(hdr[20:])), int32(binary.LittleEndian.Uint32(hdr[24:]))
+				if video || string(hdr[:4]) != "auds" && scale == ar.info.Scale && rate == ar.info.Rate {
+					l.strhPos = append(l.strhPos, pos)
+				}
+			case id == "vprp" && size >= 12 && video:
+				l.vprpPos = pos
+			case id == "strn" && video:
+				l.strn = headerRegion{pos: pos - 8, size: 8 + size + size&1}
+				last = &l.strn
+				return nil
+			}
+			last = nil
+			return nil
+		})
+	}
+
+	err := ar.walk(12, ar.moviPos-8, func(id string, pos, size int64) error {
+		switch id {
+		case "JUNK":
+			if last != nil {
+				last.size += 8 + size + size&1
+			} else if l.info.pos < 0 {
+				l.info = headerRegion{pos: pos - 8, size: 8 + size + size&1} // Room for a new INFO list
+			}
+			last = nil
+			return nil
+		case "LIST":
+			last = nil
+			listType, err := ar.fourCC(pos)
+			if err != nil {
+				return err
+			}
+			switch listType {
+			case "INFO":
+				l.info = headerRegion{pos: pos - 8, size: 8 + size + size&1}
+				l.infoEntries = map[string]string{}
+				err = ar.walk(pos+4, pos+size, func(id string, pos, size int64) error {
+					data, err := ar.readChunk(pos, size)
+					if i := bytes.IndexByte(data, 0); i >= 0 {
+						data = data[:i]
+					}
+					l.infoEntries[id] = string(data)
+					return err
+				})
+				last = &l.info
+			case "hdrl":
+				streams := 0
+				err = ar.walk(pos+4, pos+size, func(id string, pos, size int64) error {
+					switch {
+					case id == "avih" && size >= 56:
+						l.avihPos = pos
+					case id == "LIST":
+						if listType, err := ar.fourCC(pos); err != nil || listType != "strl" {
+							return err
+						}
+						streams++
+						return strl(streams-1, pos+4, pos+size)
+					}
+					return nil
+				})
+				last = nil
+			}
+			return err
+		}
+		last = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l.avihPos < 0 || len(l.strhPos) == 0 {
+		return nil, ErrNotAVI
+	}
+	return l, nil
+}
+
+// chunkBytes returns a chunk with the given id and data, padded to even size.
+func chunkBytes(id string, data []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)&1 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// fitRegion fits the chunk into region r: the rest of the region is filled with a JUNK chunk,
+// or if it is too small for that, the chunk is padded with zeros.
+func fitRegion(r headerRegion, chunk []byte) ([]byte, error) {
+	rest := r.size - int64(len(chunk))
+	switch {
+	case r.pos < 0 || rest < 0:
+		return nil, ErrHeaderSpace
+	case rest >= 8:
+		return append(chunk, chunkBytes("JUNK", make([]byte, rest-8))...), nil
+	case rest > 0:
+		binary.LittleEndian.PutUint32(chunk[4:], uint32(int64(len(chunk))-8+rest)) // The padding becomes data
+		return append(chunk, make([]byte, rest)...), nil
+	}
+	return chunk, nil
+}
+
+// equalInfo tells if the INFO entries a and b are equal.
+func equalInfo(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
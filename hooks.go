@@ -0,0 +1,55 @@
+package mjpeg
+
+// FrameEvent describes a frame written by the writer.
+type FrameEvent struct {
+	// Frame is the (zero-based) index of the frame
+	Frame int
+	// Offset is the file position of the frame chunk
+	Offset int64
+	// Size is the size of the frame data
+	Size int
+	// Dup tells if the frame is a duplicate of the previous frame, referring to its chunk (see WithDedup())
+	Dup bool
+}
+
+// CloseEvent describes the finalization of a video.
+type CloseEvent struct {
+	// Frames is the number of frames in the video
+	Frames int
+	// Size is the size of the video file
+	Size int64
+	// Err is the error of finalizing the video, nil if it succeeded
+	Err error
+}
+
+// Hooks are callbacks invoked by the writer, e.g. to feed metrics and health checks.
+// Callbacks are called synchronously, so they should return quickly. Nil callbacks are skipped.
+type Hooks struct {
+	// OnFrame is called after each written frame
+	OnFrame func(e FrameEvent)
+	// OnError is called with each error returned by the methods of the writer
+	OnError func(err error)
+	// OnClose is called when the video is closed
+	OnClose func(e CloseEvent)
+	// OnDrift is called when the video drifts from the audio, see WithAVSync()
+	OnDrift func(e DriftEvent)
+}
+
+// WithHooks returns an Option which makes the writer invoke the given monitoring callbacks.
+func WithHooks(h Hooks) Option {
+	return func(aw *aviWriter) {
+		aw.hooks = h
+	}
+}
+
+// notifyErr records err as the error of the writer if it is a fatalError (unwrapping it),
+// calls the OnError hook if err is not nil, and returns err.
+func (aw *aviWriter) notifyErr(err error) error {
+	if fe, ok := err.(fatalError); ok {
+		aw.err, err = fe.err, fe.err
+	}
+	if err != nil && aw.hooks.OnError != nil {
+		aw.hooks.OnError(err)
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package mjpeg
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// IndexLocation specifies where the temporary index file of the writer is kept, see WithIndexLocation().
+type IndexLocation int
+
+// Index locations.
+const (
+	// IndexBesideVideo keeps the index file in the directory of the video (the default),
+	// in the temporary directory if the video is not written to a file
+	IndexBesideVideo IndexLocation = iota
+	// IndexTempDir keeps the index file in the temporary directory of the OS (see os.TempDir())
+	IndexTempDir
+	// IndexUnlinked keeps the index in an unnamed file in the directory of the video (O_TMPFILE on Linux,
+	// a file removed right after creation on other Unix systems, a named file elsewhere)
+	IndexUnlinked
+	// IndexInMemory keeps the index in memory (16 bytes per chunk), always used on platforms without a file system (js)
+	IndexInMemory
+)
+
+// WithIndexLocation returns an Option which sets where the index is kept until it is written
+// into the video at Close(), e.g. so that directory watchers never see stray ".idx_" files in the recording directory.
+// Writers with an unlinked or in-memory index can't be checkpointed.
+func WithIndexLocation(loc IndexLocation) Option {
+	return func(aw *aviWriter) {
+		aw.idxLocation = loc
+	}
+}
+
+// WithIndexPattern returns an Option which sets the name pattern of the index file (as of os.CreateTemp(),
+// the last "*" is replaced by a random string), e.g. ".*.idx_" for a hidden file.
+// The default is the name of the video with an ".idx_" suffix, and "mjpeg-*.idx_" in the temporary directory.
+func WithIndexPattern(pattern string) Option {
+	return func(aw *aviWriter) {
+		aw.idxPattern = pattern
+	}
+}
+
+// indexFile is the storage of the index entries until they are written into the video.
+type indexFile interface {
+	io.ReadWriteSeeker
+	io.WriterAt
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// createIdx creates the index file of the video with the given file name (empty if the video is not written to a file).
+func (aw *aviWriter) createIdx(aviFile string) error {
+	dir := os.TempDir()
+	if aviFile != "" && aw.idxLocation != IndexTempDir {
+		dir = filepath.Dir(aviFile)
+	}
+	pattern := aw.idxPattern
+	if pattern == "" {
+		pattern = "mjpeg-*.idx_"
+	}
+
+	switch {
+	case aw.idxLocation == IndexInMemory || !hasFS:
+		aw.idxf = &memIndex{}
+		return nil
+	case aw.idxLocation == IndexUnlinked:
+		f, name, err := createUnlinked(dir, pattern)
+		if err != nil {
+			return err
+		}
+		aw.idxf, aw.idxFile = f, name
+		return nil
+	case aviFile != "" && aw.idxLocation == IndexBesideVideo && aw.idxPattern == "":
+		f, err := createFile(aviFile + ".idx_")
+		if err != nil {
+			return err
+		}
+		aw.idxf, aw.idxFile = f, f.Name()
+		return nil
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return err
+	}
+	aw.idxf, aw.idxFile = f, f.Name()
+	return nil
+}
+
+// removeIdx closes and removes the index file.
+func (aw *aviWriter) removeIdx() error {
+	err := aw.idxf.Close()
+	if aw.idxFile == "" {
+		return err // Unnamed file or in memory
+	}
+	return joinCleanupErrs(err, []error{os.Remove(aw.idxFile)})
+}
+
+// memIndex is an in-memory indexFile.
+type memIndex struct {
+	Buffer
+}
+
+// Sync is a no-op.
+func (m *memIndex) Sync() error {
+	return nil
+}
+
+// Close releases the data.
+func (m *memIndex) Close() error {
+	m.data, m.pos = nil, 0
+	return nil
+}
+
+// createRemoved creates a file in dir with the given name pattern, and removes it right away
+// (it remains accessible through the returned file, on Unix systems). The returned name is empty.
+func createRemoved(dir, pattern string) (f *os.File, name string, err error) {
+	if f, err = os.CreateTemp(dir, pattern); err != nil {
+		return nil, "", err
+	}
+	if err = os.Remove(f.Name()); err != nil {
+		return nil, "", joinCleanupErrs(err, []error{f.Close()})
+	}
+	return f, "", nil
+}
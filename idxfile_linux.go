@@ -0,0 +1,19 @@
+package mjpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// oTmpfile is the O_TMPFILE open flag (__O_TMPFILE | O_DIRECTORY), not defined by package syscall.
+const oTmpfile = 0x400000 | syscall.O_DIRECTORY
+
+// createUnlinked creates an unnamed file in dir with O_TMPFILE. If the file system doesn't support it,
+// a file is created with the given name pattern and removed right away.
+// The returned name is empty if the file is unnamed.
+func createUnlinked(dir, pattern string) (f *os.File, name string, err error) {
+	if f, err := os.OpenFile(dir, os.O_RDWR|oTmpfile, 0600); err == nil {
+		return f, "", nil
+	}
+	return createRemoved(dir, pattern)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package mjpeg
+
+import "os"
+
+// createUnlinked creates a file in dir with the given name pattern: open files can't be removed on the platform,
+// so the file is named (and removed when the writer is closed).
+func createUnlinked(dir, pattern string) (f *os.File, name string, err error) {
+	if f, err = os.CreateTemp(dir, pattern); err != nil {
+		return nil, "", err
+	}
+	return f, f.Name(), nil
+}
@@ -0,0 +1,11 @@
+//go:build unix && !linux
+
+package mjpeg
+
+import "os"
+
+// createUnlinked creates an unnamed file in dir: a file with the given name pattern, removed right away.
+// The returned name is empty.
+func createUnlinked(dir, pattern string) (f *os.File, name string, err error) {
+	return createRemoved(dir, pattern)
+}
@@ -0,0 +1,44 @@
+package mjpeg
+
+// WithIndexReserve returns an Option which reserves space for the given number of index entries
+// ahead of the movi list (as a JUNK chunk). If the index fits into the reserved space at Close(),
+// the idx1 chunk is written there (the rest of the space remains JUNK), so consumers reading the file
+// sequentially (e.g. while downloading) get the index before the frames and can start seeking early.
+// If the index does not fit, it is written after the movi list as usual, and the reserved space is left unused.
+//
+// Each frame takes one entry, plus one more if the metadata stream is enabled.
+func WithIndexReserve(entries int) Option {
+	return func(aw *aviWriter) {
+		if entries > 0 {
+			aw.idxReserve = entries
+		}
+	}
+}
+
+// writeIdxReserve writes the JUNK chunk reserving space for the index.
+func (aw *aviWriter) writeIdxReserve() {
+	aw.idxReservePos = aw.currentPos()
+	aw.writeStr("JUNK")                      // Reserved space for the index
+	aw.writeInt32(int32(aw.idxReserve * 16)) // Chunk size
+	aw.writeZeros(aw.idxReserve * 16)
+}
+
+// writeReservedIdx writes the index into the reserved space.
+// Returns false if no space was reserved or the index does not fit into it.
+func (aw *aviWriter) writeReservedIdx() (bool, error) {
+	if aw.idxReserve == 0 || aw.idxEntries > aw.idxReserve {
+		return false, nil
+	}
+
+	pos := aw.currentPos()
+	aw.seek(aw.idxReservePos, 0)
+	if err := aw.writeIdx(); err != nil {
+		return true, err
+	}
+	if rest := (aw.idxReserve - aw.idxEntries) * 16; rest > 0 {
+		aw.writeStr("JUNK")            // Unused part of the reserved space
+		aw.writeInt32(int32(rest - 8)) // Chunk size
+	}
+	aw.seek(pos, 0)
+	return true, aw.rw.Err()
+}
@@ -0,0 +1,132 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif" // Register GIF decoding for CreateFromFiles()
+	"image/jpeg"
+	_ "image/png" // Register PNG decoding for CreateFromFiles()
+	"os"
+	"runtime"
+)
+
+// CreateFromFiles creates the video aviFile from the image files, in the given order, with fps frames/second.
+// The size of the video is taken from the first file. JPEG files are added as-is, without re-encoding them;
+// other stills (e.g. PNG sequences of render farms) are decoded and JPEG encoded on the fly, in parallel.
+// PNG and GIF files are supported out of the box, other formats (e.g. BMP and TIFF) if their decoder
+// is registered (e.g. by importing golang.org/x/image/bmp and golang.org/x/image/tiff).
+// Returns the number of added frames. The video is removed if an error occurs (an error of removing it
+// is joined to the returned error).
+func CreateFromFiles(aviFile string, fps int32, files []string, opts ...Option) (n int, err error) {
+	if len(files) == 0 {
+		return 0, ErrNoVideo
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return 0, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	awr, err := New(aviFile, int32(cfg.Width), int32(cfg.Height), fps, opts...)
+	if err != nil {
+		return 0, err
+	}
+	aw := awr.(*aviWriter)
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(aviFile)})
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	for f := range importFrames(files, aw.plainEncoding(), aw.quality, done) {
+		if f.err == nil {
+			if f.img != nil {
+				f.err = aw.AddImage(f.img)
+			} else {
+				f.err = aw.AddFrame(f.data)
+			}
+		}
+		if f.err != nil {
+			return n, f.err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// importedFrame is a frame of an image file prepared by importFrames().
+type importedFrame struct {
+	// data is the JPEG encoded frame, img is the decoded image if it is to be encoded by the writer
+	data []byte
+	img  image.Image
+	err  error
+}
+
+// importFrames reads (and decodes and encodes if needed) the image files in parallel, and sends
+// the frames in order on the returned channel, which is closed after the last file or when done is closed.
+// Non-JPEG images are JPEG encoded with the given quality if encode is true.
+func importFrames(files []string, encode bool, quality int, done <-chan struct{}) <-chan importedFrame {
+	// Pending results in file order, the capacity limits the number of files processed in parallel
+	pending := make(chan chan importedFrame, runtime.GOMAXPROCS(0))
+	go func() {
+		defer close(pending)
+		for _, name := range files {
+			result := make(chan importedFrame, 1)
+			select {
+			case pending <- result:
+			case <-done:
+				return
+			}
+			go func(name string) {
+				result <- importFrame(name, encode, quality)
+			}(name)
+		}
+	}()
+
+	frames := make(chan importedFrame)
+	go func() {
+		defer close(frames)
+		for result := range pending {
+			select {
+			case frames <- <-result:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return frames
+}
+
+// importFrame reads the image file name, see importFrames().
+func importFrame(name string, encode bool, quality int) (f importedFrame) {
+	if f.data, f.err = os.ReadFile(name); f.err != nil {
+		return
+	}
+	if len(f.data) >= 2 && f.data[0] == 0xff && f.data[1] == markerSOI {
+		return // JPEG, added as-is
+	}
+	if f.img, _, f.err = image.Decode(bytes.NewReader(f.data)); f.err != nil || !encode {
+		f.data = nil
+		return
+	}
+	var buf bytes.Buffer
+	f.err = jpeg.Encode(&buf, f.img, &jpeg.Options{Quality: quality})
+	f.data, f.img = buf.Bytes(), nil
+	return
+}
+
+// plainEncoding tells if images added with AddImage() are encoded with image/jpeg as they are
+// (without processing and state), so they may be encoded concurrently and added with AddFrame().
+func (aw *aviWriter) plainEncoding() bool {
+	return aw.encoder == nil && !aw.rawRGB && !aw.gray && aw.rate == nil && !aw.convertsRange() &&
+		len(aw.transforms) == 0 && len(aw.overlays) == 0 && (aw.dedup == nil || aw.dedup.threshold == 0)
+}
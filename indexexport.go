@@ -0,0 +1,86 @@
+package mjpeg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// ErrIndexFormat reports if an index export format is unknown.
+var ErrIndexFormat = errors.New("Unknown index format")
+
+// IndexFormat is the output format of ExportIndex().
+type IndexFormat int
+
+// Index export formats.
+const (
+	// IndexCSV is comma separated values with a header line: frame,offset,size,flags,time
+	IndexCSV IndexFormat = iota
+	// IndexJSON is a JSON array of objects with frame, offset, size, flags and time fields
+	IndexJSON
+)
+
+// indexEntry is an exported index entry of a frame.
+type indexEntry struct {
+	// Frame is the index of the frame
+	Frame int `json:"frame"`
+	// Offset is the absolute file position of the frame data
+	Offset int64 `json:"offset"`
+	// Size is the size of the frame data
+	Size uint32 `json:"size"`
+	// Flags are the index flags of the frame
+	Flags IndexFlag `json:"flags"`
+	// Time is the presentation time of the frame in seconds
+	Time float64 `json:"time"`
+}
+
+// ExportIndex writes the frame index of the video aviFile to w in the given format:
+// the file position, size, index flags and presentation time of each frame,
+// e.g. for forensic and QA workflows that need a map of the file without parsing RIFF.
+//
+// Repeated frames have the same offset as the frame they repeat.
+func ExportIndex(aviFile string, w io.Writer, format IndexFormat) error {
+	if format != IndexCSV && format != IndexJSON {
+		return ErrIndexFormat
+	}
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	fps := ar.Info().FPS()
+	frames := ar.(*aviReader).frames
+	entries := make([]indexEntry, len(frames))
+	for i, f := range frames {
+		entries[i] = indexEntry{
+			Frame:  i,
+			Offset: f.offset,
+			Size:   f.size,
+			Flags:  IndexFlag(f.flags),
+			Time:   timestamp(i, fps).Seconds(),
+		}
+	}
+
+	if format == IndexJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"frame", "offset", "size", "flags", "time"})
+	for _, e := range entries {
+		cw.Write([]string{
+			strconv.Itoa(e.Frame),
+			strconv.FormatInt(e.Offset, 10),
+			strconv.FormatUint(uint64(e.Size), 10),
+			strconv.FormatUint(uint64(e.Flags), 10),
+			strconv.FormatFloat(e.Time, 'f', 6, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,192 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcStreamPath is the path of the Stream method of the Ingest service (see ingest.proto).
+const grpcStreamPath = "/mjpeg.ingest.v1.Ingest/Stream"
+
+// gRPC status codes.
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcAborted         = 10
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+var (
+	// errMalformed reports a malformed gRPC message.
+	errMalformed = errors.New("Malformed message")
+	// errIDChanged reports if a message of a gRPC stream has a different stream id than the first one.
+	errIDChanged = errors.New("Stream id changed")
+)
+
+// isGRPC tells if r is a gRPC request.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveGRPC serves a gRPC request: a call of the Stream method of the Ingest service (see ingest.proto).
+// The protocol is implemented directly on net/http (which serves HTTP/2 over TLS), so the package keeps
+// having no dependencies outside the standard library.
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	if r.URL.Path != grpcStreamPath {
+		writeGRPCStatus(w, grpcUnimplemented, "Unknown method "+r.URL.Path)
+		return
+	}
+
+	// The stream id is in the first message
+	var msgBuf []byte
+	first, err := readGRPCFrame(r.Body, &msgBuf)
+	if err == io.EOF {
+		writeGRPCSummary(w, 0)
+		writeGRPCStatus(w, grpcOK, "")
+		return
+	}
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	id, pending := first.id, true
+	n, err := s.ingest(id, func([]byte) (time.Time, []byte, error) {
+		f := first
+		if pending {
+			pending = false
+		} else {
+			var err error
+			if f, err = readGRPCFrame(r.Body, &msgBuf); err != nil {
+				return time.Time{}, nil, err
+			}
+		}
+		if f.id != "" && f.id != id {
+			return time.Time{}, nil, errIDChanged
+		}
+		return time.Unix(0, f.timestamp), f.data, nil
+	})
+	switch {
+	case err == errInvalidID:
+		writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+	case err == errMalformed || err == errIDChanged || err == ErrFrameTooLarge:
+		writeGRPCStatus(w, grpcInvalidArgument, "frames "+strconv.Itoa(n)+": "+err.Error())
+	case err == errBusy:
+		writeGRPCStatus(w, grpcAborted, err.Error())
+	case err != nil:
+		writeGRPCStatus(w, grpcInternal, "frames "+strconv.Itoa(n)+": "+err.Error())
+	default:
+		writeGRPCSummary(w, n)
+		writeGRPCStatus(w, grpcOK, "")
+	}
+}
+
+// grpcFrame is a decoded Frame message.
+type grpcFrame struct {
+	id        string
+	timestamp int64
+	// data is only valid until the next message is read
+	data []byte
+}
+
+// readGRPCFrame reads and decodes a Frame message of a gRPC stream into buf (which is grown if needed).
+// io.EOF is returned if there are no more messages.
+func readGRPCFrame(r io.Reader, buf *[]byte) (f grpcFrame, err error) {
+	var hdr [5]byte // Compressed flag and message length
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errMalformed
+		}
+		return f, err
+	}
+	if hdr[0] != 0 {
+		return f, errors.New("Compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > maxFrameSize+1024 { // Room for the other fields
+		return f, ErrFrameTooLarge
+	}
+	if cap(*buf) < int(size) {
+		*buf = make([]byte, size)
+	}
+	msg := (*buf)[:size]
+	if _, err = io.ReadFull(r, msg); err != nil {
+		return f, errMalformed
+	}
+
+	// Protocol buffers encoding: fields of (key, value) pairs, the key is field number<<3 | wire type
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return f, errMalformed
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case 0: // Varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return f, errMalformed
+			}
+			msg = msg[n:]
+			if key>>3 == 2 {
+				f.timestamp = int64(v)
+			}
+		case 2: // Length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || l > uint64(len(msg)-n) {
+				return f, errMalformed
+			}
+			v := msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+			switch key >> 3 {
+			case 1:
+				f.id = string(v)
+			case 3:
+				if len(v) > maxFrameSize {
+					return f, ErrFrameTooLarge
+				}
+				f.data = v
+			}
+		case 1, 5: // 64-bit and 32-bit (no such fields, skipped)
+			l := 8
+			if key&7 == 5 {
+				l = 4
+			}
+			if len(msg) < l {
+				return f, errMalformed
+			}
+			msg = msg[l:]
+		default:
+			return f, errMalformed
+		}
+	}
+	return f, nil
+}
+
+// writeGRPCSummary writes the StreamSummary response message.
+func writeGRPCSummary(w http.ResponseWriter, frames int) {
+	msg := binary.AppendUvarint([]byte{1<<3 | 0}, uint64(frames)) // Field 1, varint
+	hdr := [5]byte{0}
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	w.Write(hdr[:])
+	w.Write(msg)
+}
+
+// writeGRPCStatus sets the status trailers of the response.
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", url.PathEscape(msg))
+	}
+}
@@ -0,0 +1,109 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// grpcFrameMessage returns a gRPC message of a Frame (see ingest.proto).
+func grpcFrameMessage(id string, timestamp time.Time, data []byte) []byte {
+	var msg []byte
+	if id != "" {
+		msg = binary.AppendUvarint(append(msg, 1<<3|2), uint64(len(id))) // Field 1, length-delimited
+		msg = append(msg, id...)
+	}
+	msg = binary.AppendUvarint(append(msg, 2<<3|0), uint64(timestamp.UnixNano())) // Field 2, varint
+	msg = binary.AppendUvarint(append(msg, 3<<3|2), uint64(len(data)))            // Field 3, length-delimited
+	msg = append(msg, data...)
+	hdr := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	return append(hdr, msg...)
+}
+
+// callStream calls the gRPC method at path of the server with the given request body,
+// and returns the response body and the status trailers.
+func callStream(tb testing.TB, ts *httptest.Server, path string, body []byte) (resp []byte, status, msg string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	r, err := ts.Client().Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.ProtoMajor != 2 {
+		tb.Fatalf("got protocol %s, want HTTP/2", r.Proto)
+	}
+	if resp, err = io.ReadAll(r.Body); err != nil {
+		tb.Fatal(err)
+	}
+	return resp, r.Trailer.Get("Grpc-Status"), r.Trailer.Get("Grpc-Message")
+}
+
+// newGRPCServer returns a test server serving HTTP/2 over TLS.
+func newGRPCServer(srv *Server) *httptest.Server {
+	ts := httptest.NewUnstartedServer(srv)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+// TestGRPCStream checks that frames streamed with the gRPC Stream method are written into segments,
+// and their number is returned.
+func TestGRPCStream(t *testing.T) {
+	dir := t.TempDir()
+	ts := newGRPCServer(NewServer(testConfig(dir)))
+	defer ts.Close()
+
+	data := testFrame(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var body []byte
+	for i := 0; i < 12; i++ {
+		id := ""
+		if i == 0 {
+			id = "cam1" // Only the first message must have the stream id
+		}
+		body = append(body, grpcFrameMessage(id, start.Add(time.Duration(i)*100*time.Millisecond), data)...)
+	}
+	resp, status, msg := callStream(t, ts, grpcStreamPath, body)
+	if status != "0" {
+		t.Fatalf("got status %s (%s), want 0", status, msg)
+	}
+	want := []byte{0, 0, 0, 0, 2, 1 << 3, 12} // StreamSummary{frames: 12}
+	if !bytes.Equal(resp, want) {
+		t.Errorf("got response %v, want %v", resp, want)
+	}
+	checkSegments(t, dir, "cam1", 10, 2)
+}
+
+// TestGRPCErrors checks the status codes of failed gRPC calls.
+func TestGRPCErrors(t *testing.T) {
+	ts := newGRPCServer(NewServer(testConfig(t.TempDir())))
+	defer ts.Close()
+	data := testFrame(t)
+	now := time.Now()
+	for _, c := range []struct {
+		name, path string
+		body       []byte
+		status     string
+	}{
+		{"unknown method", "/mjpeg.ingest.v1.Ingest/Other", nil, "12"},
+		{"invalid id", grpcStreamPath, grpcFrameMessage("cam/1", now, data), "3"},
+		{"id changed", grpcStreamPath, append(grpcFrameMessage("cam1", now, data), grpcFrameMessage("cam2", now, data)...), "3"},
+		{"truncated", grpcStreamPath, grpcFrameMessage("cam1", now, data)[:20], "3"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, status, msg := callStream(t, ts, c.path, c.body); status != c.status {
+				t.Errorf("got status %s (%s), want %s", status, msg, c.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Package ingest implements a frame ingestion service: remote producers (e.g. distributed capture agents)
+stream JPEG frames with capture timestamps to a server, which muxes them into segment-rolled AVI files,
+one series of segments per stream.
+
+The service has two transports, both served by the same handler, with no dependencies outside the standard library:
+
+gRPC: the Ingest service defined in ingest.proto (in the package directory), a client-streaming Stream call
+of Frame messages. Clients in any language can be generated from the proto file with protoc.
+gRPC requires HTTP/2, which net/http serves over TLS (e.g. http.ListenAndServeTLS()).
+
+Streaming HTTP (which works through HTTP/1.1 proxies and load balancers, used by Producer): the producer POSTs
+to /<stream id>, and the request body is a sequence of frames until the producer closes it.
+Each frame is encoded as:
+
+	timestamp  int64, big endian: capture time in Unix nanoseconds
+	size       uint32, big endian: size of the JPEG data
+	data       the JPEG data
+
+Example server:
+
+	srv := ingest.NewServer(ingest.Config{
+	    Dir:             "recordings",
+	    Width:           640,
+	    Height:          480,
+	    FPS:             10,
+	    RotateEvery:     time.Hour,
+	    NamePattern:     "%i/%Y-%m-%d/%H%M%S.avi",
+	})
+	log.Fatal(http.ListenAndServe(":8080", srv))
+
+Example producer:
+
+	p := ingest.NewProducer(ctx, "http://server:8080", "cam1")
+	for {
+	    // Capture frame...
+	    if err := p.AddFrame(jpegData, time.Now()); err != nil {
+	        // Handle error
+	    }
+	}
+	err := p.Close()
+*/
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icza/mjpeg"
+)
+
+// maxFrameSize is the maximum accepted size of a frame.
+const maxFrameSize = 64 << 20
+
+var (
+	// ErrFrameTooLarge reports if a frame exceeds the maximum frame size (64 MB).
+	ErrFrameTooLarge = errors.New("Frame too large")
+
+	// ErrClosed reports if frames are added to a closed producer.
+	ErrClosed = errors.New("Producer closed")
+)
+
+// Config is the configuration of a Server.
+type Config struct {
+	// Dir is the directory of the segment files
+	Dir string
+	// Width, Height and FPS are the properties of the videos
+	Width, Height, FPS int32
+	// SegmentDuration is the (capture) time after which a new segment is started, 0 means no limit
+	SegmentDuration time.Duration
+	// MaxSegmentSize is the size after which a new segment is started, 0 means no limit
+	MaxSegmentSize int64
+	// RotateEvery starts new segments at wall-clock boundaries of this interval (of the capture time),
+	// e.g. time.Hour starts a new segment at the top of every hour, as NVR storage is usually organized.
+	// 0 means no rotation
+	RotateEvery time.Duration
+	// Location is the time zone of the rotation boundaries and of the times in segment names, UTC if nil
+	Location *time.Location
+	// NamePattern is the strftime-like pattern of segment file names in Dir (relative paths create
+	// subdirectories), e.g. "%i/%Y-%m-%d/%H%M%S.avi"; conversions: %Y year, %m month, %d day, %j day of year,
+	// %H hour, %M minute, %S second, %L millisecond, %i stream id, %% a '%' character.
+	// Times are of the first frame of the segment. Defaults to defaultNamePattern.
+	// If the file already exists (e.g. a segment rolled within the resolution of the pattern),
+	// a sequence number is added to the name, e.g. "cam1/120000-1.avi"; existing files are never overwritten
+	NamePattern string
+	// Capture is the configuration of mapping capture timestamps to frame slots
+	Capture mjpeg.CaptureConfig
+	// Options are additional options of the segment writers
+	Options []mjpeg.Option
+	// Retention is the retention policy of the segment files in Dir, applied after each closed segment
+	Retention Retention
+	// Playlist tells to maintain a playlist file of the segments of each stream in Dir (see PlaylistFile()),
+	// updated when a segment is closed, so playback UIs can present a continuous timeline
+	Playlist bool
+	// OnSegment is called after a segment is closed (with the close error, if any), if not nil
+	OnSegment func(stream, file string, err error)
+	// OnRetentionError is called if enforcing the retention policy fails, if not nil; the error doesn't stop recording.
+	// file is the file that couldn't be deleted, or Dir if listing the segments failed
+	OnRetentionError func(file string, err error)
+}
+
+// defaultNamePattern is the default of Config.NamePattern.
+const defaultNamePattern = "%i-%Y%m%dT%H%M%S.%L.avi"
+
+// namePattern returns the pattern of segment file names.
+func (cfg *Config) namePattern() string {
+	if cfg.NamePattern == "" {
+		return defaultNamePattern
+	}
+	return cfg.NamePattern
+}
+
+// Server is the ingestion service, an http.Handler.
+type Server struct {
+	cfg Config
+
+	// mu protects active and open
+	mu sync.Mutex
+	// active holds the ids of the streams being received
+	active map[string]bool
+	// open holds the names of the segment files being written
+	open map[string]bool
+
+	// retMu serializes enforcing the retention policy
+	retMu sync.Mutex
+	// names matches the names of the segment files (relative to Dir), only these are deleted by the retention policy
+	names *regexp.Regexp
+}
+
+// validID matches valid stream ids (which are used in file names).
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// NewServer returns a new Server.
+func NewServer(cfg Config) *Server {
+	return &Server{cfg: cfg, active: map[string]bool{}, open: map[string]bool{}, names: nameRegexp(cfg.namePattern())}
+}
+
+// ServeHTTP implements http.Handler. It receives the frames of a stream, and writes them into segments.
+// A stream may have one producer at a time (409 Conflict is returned for another one).
+// The number of received frames is written in the response.
+// gRPC requests (of the Ingest service, see ingest.proto) are served too.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if isGRPC(r) {
+		s.serveGRPC(w, r)
+		return
+	}
+
+	n, err := s.ingest(strings.TrimPrefix(r.URL.Path, "/"), func(buf []byte) (time.Time, []byte, error) {
+		return ReadFrame(r.Body, buf)
+	})
+	switch {
+	case err == errInvalidID:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err == errBusy:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, fmt.Sprintf("frames %d: %v", n, err), http.StatusBadRequest)
+	default:
+		fmt.Fprintf(w, "frames %d\n", n)
+	}
+}
+
+var (
+	// errInvalidID reports an invalid stream id.
+	errInvalidID = errors.New("Invalid stream id")
+	// errBusy reports if a stream already has a producer.
+	errBusy = errors.New("Stream already active")
+)
+
+// ingest receives the frames of the stream id returned by next (until it returns io.EOF), and writes them
+// into segments. next reads the frame data into buf (like ReadFrame()). Returns the number of received frames.
+func (s *Server) ingest(id string, next func(buf []byte) (time.Time, []byte, error)) (n int, err error) {
+	if !validID.MatchString(id) {
+		return 0, errInvalidID
+	}
+
+	s.mu.Lock()
+	busy := s.active[id]
+	s.active[id] = true
+	s.mu.Unlock()
+	if busy {
+		return 0, errBusy
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.active, id)
+		s.mu.Unlock()
+	}()
+
+	st := &stream{srv: s, id: id}
+	n, err = st.receive(next)
+	if cerr := st.closeSegment(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// stream is a stream being received.
+type stream struct {
+	srv *Server
+	id  string
+
+	// aw is the writer of the current segment, nil if there is none
+	aw mjpeg.AviWriter
+	// ci maps the timestamps of the current segment
+	ci *mjpeg.CaptureIngest
+	// file is the name of the current segment file
+	file string
+	// start is the timestamp of the first frame of the current segment
+	start time.Time
+	// rotate is the wall-clock boundary at which the current segment is rotated, zero if there is no rotation
+	rotate time.Time
+}
+
+// receive receives the frames returned by next, and returns the number of received frames.
+func (st *stream) receive(next func(buf []byte) (time.Time, []byte, error)) (n int, err error) {
+	var buf []byte
+	for {
+		var t time.Time
+		t, buf, err = next(buf)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		if err = st.addFrame(buf, t); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// addFrame adds a frame to the current segment, starting a new segment if needed.
+func (st *stream) addFrame(data []byte, t time.Time) error {
+	cfg := st.srv.cfg
+	if st.aw != nil && (cfg.SegmentDuration > 0 && t.Sub(st.start) >= cfg.SegmentDuration ||
+		!st.rotate.IsZero() && !t.Before(st.rotate)) {
+		if err := st.closeSegment(); err != nil {
+			return err
+		}
+	}
+	if st.aw == nil {
+		if err := st.openSegment(t); err != nil {
+			return err
+		}
+	}
+	err := st.ci.AddFrame(data, t.Sub(st.start))
+	if errors.Is(err, mjpeg.ErrSizeLimit) && st.ci.Stats().Written > 0 {
+		// Roll to a new segment (a segment gets at least one frame)
+		if err = st.closeSegment(); err != nil {
+			return err
+		}
+		if err = st.openSegment(t); err != nil {
+			return err
+		}
+		err = st.ci.AddFrame(data, 0)
+	}
+	return err
+}
+
+// openSegment starts a new segment with a frame captured at t.
+func (st *stream) openSegment(t time.Time) error {
+	cfg := st.srv.cfg
+	loc := cfg.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	file := filepath.Join(cfg.Dir, formatName(cfg.namePattern(), st.id, t.In(loc)))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	file, err := reserveName(file)
+	if err != nil {
+		return err
+	}
+	opts := cfg.Options
+	if cfg.MaxSegmentSize > 0 {
+		opts = append(opts[:len(opts):len(opts)], mjpeg.WithMaxFileSize(cfg.MaxSegmentSize))
+	}
+	aw, err := mjpeg.New(file, cfg.Width, cfg.Height, cfg.FPS, opts...)
+	if err != nil {
+		return errors.Join(err, os.Remove(file))
+	}
+	st.aw, st.file, st.start = aw, file, t
+	st.srv.setOpen(file, true)
+	st.rotate = time.Time{}
+	if cfg.RotateEvery > 0 {
+		st.rotate = nextBoundary(t, cfg.RotateEvery, loc)
+	}
+	st.ci = mjpeg.NewCaptureIngest(aw, cfg.FPS, cfg.Capture)
+	return nil
+}
+
+// closeSegment closes the current segment (if there is one).
+func (st *stream) closeSegment() error {
+	if st.aw == nil {
+		return nil
+	}
+	err := st.aw.Close()
+	st.srv.setOpen(st.file, false)
+	if st.srv.cfg.OnSegment != nil {
+		st.srv.cfg.OnSegment(st.id, st.file, err)
+	}
+	st.aw = nil
+	st.srv.enforceRetention()
+	if err == nil && st.srv.cfg.Playlist {
+		err = st.updatePlaylist(st.playlistEntry())
+	}
+	return err
+}
+
+// setOpen registers or unregisters a segment file being written.
+func (s *Server) setOpen(file string, open bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if open {
+		s.open[file] = true
+	} else {
+		delete(s.open, file)
+	}
+}
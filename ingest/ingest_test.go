@@ -0,0 +1,92 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icza/mjpeg"
+)
+
+// testFrame returns a small JPEG encoded test frame.
+func testFrame(tb testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testConfig returns the configuration of the test servers, writing into dir.
+func testConfig(dir string) Config {
+	return Config{Dir: dir, Width: 16, Height: 8, FPS: 10, SegmentDuration: time.Second, NamePattern: "%i/%H%M%S.avi"}
+}
+
+// checkSegments checks that the segments of the stream in dir have the given numbers of frames.
+func checkSegments(tb testing.TB, dir, stream string, frames ...int) {
+	tb.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, stream, "*.avi"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(files) != len(frames) {
+		tb.Fatalf("got segments %v, want %d", files, len(frames))
+	}
+	for i, file := range files { // Names are in capture order
+		ar, err := mjpeg.NewReader(file)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if n := ar.Info().Frames; n != frames[i] {
+			tb.Errorf("%s: got %d frames, want %d", file, n, frames[i])
+		}
+		ar.Close()
+	}
+}
+
+// TestProducer checks that frames streamed by a Producer over HTTP are written into segments.
+func TestProducer(t *testing.T) {
+	dir := t.TempDir()
+	ts := httptest.NewServer(NewServer(testConfig(dir)))
+	defer ts.Close()
+
+	data := testFrame(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProducerClient(context.Background(), ts.Client(), ts.URL, "cam1")
+	for i := 0; i < 15; i++ {
+		if err := p.AddFrame(data, start.Add(time.Duration(i)*100*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkSegments(t, dir, "cam1", 10, 5)
+}
+
+// TestProducerInvalidID checks that streams with invalid ids are rejected.
+func TestProducerInvalidID(t *testing.T) {
+	ts := httptest.NewServer(NewServer(testConfig(t.TempDir())))
+	defer ts.Close()
+	p := NewProducerClient(context.Background(), ts.Client(), ts.URL, "cam.1")
+	p.AddFrame(testFrame(t), time.Now())
+	if err := p.Close(); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("got error %v, want a 400 response", err)
+	}
+}
+
+// TestServeHTTPMethod checks that only POST requests are served.
+func TestServeHTTPMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(testConfig(t.TempDir())).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cam1", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
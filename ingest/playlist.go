@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Playlist lists the segments of a stream, see Config.Playlist.
+type Playlist struct {
+	// Stream is the id of the stream
+	Stream string `json:"stream"`
+	// Segments are the segments of the stream, in recording order
+	Segments []PlaylistEntry `json:"segments"`
+}
+
+// PlaylistEntry is a segment of a Playlist.
+type PlaylistEntry struct {
+	// File is the name of the segment file, relative to the segment directory
+	File string `json:"file"`
+	// Start is the capture time of the first frame of the segment
+	Start time.Time `json:"start"`
+	// Duration is the duration of the segment, in nanoseconds in JSON
+	Duration time.Duration `json:"duration"`
+	// Frames is the number of frames of the segment
+	Frames int `json:"frames"`
+}
+
+// PlaylistFile returns the name of the playlist file of the given stream in the segment directory dir.
+func PlaylistFile(dir, stream string) string {
+	return filepath.Join(dir, stream+".playlist.json")
+}
+
+// ReadPlaylist reads a playlist file.
+func ReadPlaylist(file string) (*Playlist, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &Playlist{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// updatePlaylist adds the closed segment to the playlist of the stream, and removes the segments deleted since
+// (e.g. by the retention policy). The playlist file is replaced atomically, so readers never see a partial file.
+func (st *stream) updatePlaylist(e PlaylistEntry) error {
+	file := PlaylistFile(st.srv.dir(), st.id)
+	p, err := ReadPlaylist(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		p = &Playlist{Stream: st.id}
+	}
+
+	segs := p.Segments[:0]
+	for _, s := range append(p.Segments, e) {
+		if _, err := os.Stat(filepath.Join(st.srv.dir(), s.File)); err == nil {
+			segs = append(segs, s)
+		}
+	}
+	p.Segments = segs
+
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// playlistEntry returns the playlist entry of the current segment.
+func (st *stream) playlistEntry() PlaylistEntry {
+	stats := st.ci.Stats()
+	e := PlaylistEntry{File: st.file, Start: st.start, Frames: stats.Written + stats.Duplicated}
+	if rel, err := filepath.Rel(st.srv.dir(), st.file); err == nil {
+		e.File = rel
+	}
+	if fps := st.srv.cfg.FPS; fps > 0 {
+		e.Duration = time.Duration(e.Frames) * time.Second / time.Duration(fps)
+	}
+	return e
+}
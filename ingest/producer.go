@@ -0,0 +1,125 @@
+package ingest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteFrame writes a frame encoded in the wire format of the service (see the package doc).
+func WriteFrame(w io.Writer, jpegData []byte, captured time.Time) error {
+	if len(jpegData) > maxFrameSize {
+		return ErrFrameTooLarge
+	}
+	var hdr [12]byte
+	binary.BigEndian.PutUint64(hdr[:], uint64(captured.UnixNano()))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(jpegData)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(jpegData)
+	return err
+}
+
+// ReadFrame reads a frame encoded in the wire format of the service (see the package doc).
+// The frame data is read into buf (which is grown if needed), the returned slice is only valid until buf is reused.
+// io.EOF is returned if there are no more frames, io.ErrUnexpectedEOF if the input ends inside a frame.
+func ReadFrame(r io.Reader, buf []byte) (captured time.Time, data []byte, err error) {
+	var hdr [12]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return time.Time{}, buf, err
+	}
+	size := binary.BigEndian.Uint32(hdr[8:])
+	if size > maxFrameSize {
+		return time.Time{}, buf, ErrFrameTooLarge
+	}
+	if cap(buf) < int(size) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	if _, err = io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return time.Time{}, buf, err
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:]))), buf, nil
+}
+
+// Producer streams frames to a Server.
+type Producer struct {
+	// pw is the writing end of the request body
+	pw *io.PipeWriter
+
+	// mu protects closed
+	mu sync.Mutex
+	// closed tells if the producer is closed
+	closed bool
+	// done receives the result of the request
+	done chan error
+}
+
+// NewProducer returns a new Producer streaming frames of the stream id to the server at serverURL,
+// using http.DefaultClient. The request is started right away, and lasts until Close() is called
+// (or ctx is cancelled).
+func NewProducer(ctx context.Context, serverURL, id string) *Producer {
+	return NewProducerClient(ctx, http.DefaultClient, serverURL, id)
+}
+
+// NewProducerClient is like NewProducer(), but uses the given HTTP client.
+func NewProducerClient(ctx context.Context, client *http.Client, serverURL, id string) *Producer {
+	pr, pw := io.Pipe()
+	p := &Producer{pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		p.done <- func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(serverURL, "/")+"/"+id, pr)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/octet-stream")
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("Ingestion failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			}
+			return nil
+		}()
+		pr.CloseWithError(io.ErrClosedPipe) // Unblock AddFrame() if the request ended early
+	}()
+	return p
+}
+
+// AddFrame sends a JPEG encoded frame captured at the given time.
+// It blocks until the frame is taken by the HTTP transport. If the request ended (e.g. failed),
+// io.ErrClosedPipe is returned, and Close() returns the cause.
+func (p *Producer) AddFrame(jpegData []byte, captured time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	return WriteFrame(p.pw, jpegData, captured)
+}
+
+// Close ends the stream, and waits for the response of the server.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.closed = true
+	p.pw.Close()
+	p.mu.Unlock()
+	return <-p.done
+}
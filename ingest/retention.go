@@ -0,0 +1,150 @@
+package ingest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// companionExts are the extensions of the companion files the writer may write next to a segment
+// (see e.g. mjpeg.WithManifest()), deleted together with the segment.
+var companionExts = []string{".srt", ".manifest.json", ".timestamps.json", ".iv"}
+
+// Retention is a retention policy of segment files, see Config.Retention.
+// Segments are deleted oldest first (by modification time), together with their companion files.
+// Only the files matching Config.NamePattern are considered segments, other files in Dir are never deleted,
+// nor are the segments being written.
+type Retention struct {
+	// MaxAge is the age after which segments are deleted, 0 means no limit
+	MaxAge time.Duration
+	// MaxSize is the total size of the segments in Dir above which the oldest segments are deleted, 0 means no limit
+	MaxSize int64
+}
+
+// segmentFile is a segment file found in the segment directory.
+type segmentFile struct {
+	// files are the segment file and its companion files
+	files []string
+	// size is the total size of the files
+	size int64
+	// modTime is the modification time of the segment file
+	modTime time.Time
+}
+
+// enforceRetention deletes the segments in the segment directory not allowed by the retention policy.
+// Errors are reported to Config.OnRetentionError, so that a failed cleanup doesn't stop recording.
+func (s *Server) enforceRetention() {
+	ret := s.cfg.Retention
+	if ret.MaxAge <= 0 && ret.MaxSize <= 0 {
+		return
+	}
+	s.retMu.Lock()
+	defer s.retMu.Unlock()
+
+	segs, err := s.listSegments()
+	if err != nil {
+		s.retentionError(s.dir(), err)
+		return
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].modTime.Before(segs[j].modTime) })
+
+	var total int64
+	for _, seg := range segs {
+		total += seg.size
+	}
+	now := time.Now()
+	for _, seg := range segs {
+		expired := ret.MaxAge > 0 && now.Sub(seg.modTime) > ret.MaxAge
+		if !expired && (ret.MaxSize <= 0 || total <= ret.MaxSize) {
+			break
+		}
+		if s.isOpen(seg.files[0]) {
+			continue
+		}
+		for _, f := range seg.files {
+			if err := os.Remove(f); err != nil {
+				s.retentionError(f, err)
+			}
+		}
+		total -= seg.size
+		s.removeEmptyDirs(filepath.Dir(seg.files[0]))
+	}
+}
+
+// retentionError reports an error of enforcing the retention policy.
+func (s *Server) retentionError(file string, err error) {
+	if s.cfg.OnRetentionError != nil {
+		s.cfg.OnRetentionError(file, err)
+	}
+}
+
+// listSegments lists the segments (AVI files matching the name pattern) in the segment directory.
+func (s *Server) listSegments() ([]*segmentFile, error) {
+	segs := map[string]*segmentFile{}       // Segments by the name without the extension
+	companions := map[string]*segmentFile{} // Companion files by the name of their segment without the extension
+	err := filepath.Walk(s.dir(), func(name string, fi fs.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(name, ".avi") {
+			if rel, err := filepath.Rel(s.dir(), name); err != nil || !s.names.MatchString(filepath.ToSlash(rel)) {
+				return nil // Not created by the server
+			}
+			segs[strings.TrimSuffix(name, ".avi")] = &segmentFile{files: []string{name}, size: fi.Size(), modTime: fi.ModTime()}
+			return nil
+		}
+		for _, ext := range companionExts {
+			if strings.HasSuffix(name, ext) {
+				stem := strings.TrimSuffix(name, ext)
+				if companions[stem] == nil {
+					companions[stem] = &segmentFile{}
+				}
+				c := companions[stem]
+				c.files, c.size = append(c.files, name), c.size+fi.Size()
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*segmentFile, 0, len(segs))
+	for stem, seg := range segs {
+		if c := companions[stem]; c != nil {
+			seg.files, seg.size = append(seg.files, c.files...), seg.size+c.size
+		}
+		list = append(list, seg)
+	}
+	return list, nil
+}
+
+// removeEmptyDirs removes dir and its parents up to the segment directory while they are empty
+// (e.g. the directories of days created by the name pattern).
+func (s *Server) removeEmptyDirs(dir string) {
+	root := filepath.Clean(s.dir())
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return // Not empty
+		}
+	}
+}
+
+// dir returns the segment directory.
+func (s *Server) dir() string {
+	if s.cfg.Dir == "" {
+		return "."
+	}
+	return s.cfg.Dir
+}
+
+// isOpen tells if the given file is a segment being written.
+func (s *Server) isOpen(file string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.open[file]
+}
@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNameRegexp checks the matching of the segment file names created with name patterns.
+func TestNameRegexp(t *testing.T) {
+	for _, c := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{defaultNamePattern, "cam1-20240101T120000.000.avi", true},
+		{defaultNamePattern, "cam1-20240101T120000.000-2.avi", true},
+		{defaultNamePattern, "cam1-20240101T120000.avi", false},
+		{defaultNamePattern, "movie.avi", false},
+		{"%i/%Y-%m-%d/%H%M%S.avi", "cam_1/2024-01-01/120000.avi", true},
+		{"%i/%Y-%m-%d/%H%M%S.avi", "cam1/2024-01-01/notes.avi", false},
+		{"%i/%Y-%m-%d/%H%M%S.avi", "cam1/2024-01-01/120000.avi.bak", false},
+		{"100%%/%j%q.avi", "100%/032%q.avi", true},
+		{"100%%/%j%q.avi", "100%/032x.avi", false},
+	} {
+		if got := nameRegexp(c.pattern).MatchString(c.name); got != c.match {
+			t.Errorf("pattern %q, name %q: got match %t, want %t", c.pattern, c.name, got, c.match)
+		}
+	}
+}
+
+// TestRetention checks that expired segments are deleted with their companion files, and other files are kept.
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	files := map[string]bool{ // Files existing before recording, and if they are to be deleted
+		"cam1/110000.avi":   true,
+		"cam1/110000.srt":   true,
+		"cam1/110000-1.avi": true,
+		"cam1/notes.avi":    false,
+		"other.avi":         false,
+	}
+	for name := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig(dir)
+	cfg.Retention = Retention{MaxAge: time.Hour}
+	cfg.OnRetentionError = func(file string, err error) { t.Errorf("%s: %v", file, err) }
+	ts := httptest.NewServer(NewServer(cfg))
+	defer ts.Close()
+	data := testFrame(t)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProducerClient(context.Background(), ts.Client(), ts.URL, "cam1")
+	for i := 0; i < 15; i++ {
+		if err := p.AddFrame(data, start.Add(time.Duration(i)*100*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, deleted := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); os.IsNotExist(err) != deleted {
+			t.Errorf("%s: got deleted %t, want %t", name, !deleted, deleted)
+		}
+	}
+	for _, name := range []string{"cam1/120000.avi", "cam1/120001.avi"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("segment %s: %v", name, err)
+		}
+	}
+}
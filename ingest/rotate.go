@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// nextBoundary returns the first wall-clock boundary of the rotation interval after t,
+// in the location loc (e.g. the top of the next hour for an interval of 1 hour).
+func nextBoundary(t time.Time, interval time.Duration, loc *time.Location) time.Time {
+	_, offset := t.In(loc).Zone()
+	local := t.Add(time.Duration(offset) * time.Second)                         // Wall clock time as if it was UTC
+	start := local.Truncate(interval).Add(-time.Duration(offset) * time.Second) // Boundary at or before t
+	return start.Add(interval)
+}
+
+// formatName formats the segment file name pattern (see Config.NamePattern) with the stream id
+// and the time t of the first frame of the segment.
+func formatName(pattern, id string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 == len(pattern) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'L':
+			fmt.Fprintf(&b, "%03d", t.Nanosecond()/1e6)
+		case 'i':
+			b.WriteString(id)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String()
+}
+
+// nameRegexp returns the regexp matching the (slash separated) names of the segment files created with the pattern
+// (see Config.NamePattern), including the names with a sequence number added by reserveName().
+func nameRegexp(pattern string) *regexp.Regexp {
+	ext := filepath.Ext(pattern)
+	pattern = strings.TrimSuffix(pattern, ext)
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i+1 == len(pattern) {
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(`\d{4}`)
+		case 'm', 'd', 'H', 'M', 'S':
+			b.WriteString(`\d{2}`)
+		case 'j', 'L':
+			b.WriteString(`\d{3}`)
+		case 'i':
+			b.WriteString(strings.Trim(validID.String(), "^$"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i-1 : i+1]))
+		}
+	}
+	b.WriteString(`(-\d+)?` + regexp.QuoteMeta(ext) + "$")
+	return regexp.MustCompile(b.String())
+}
+
+// reserveName creates the segment file, or if it already exists, the first free name with a sequence number
+// added (e.g. "name-1.avi"), and returns its name. Creating the file exclusively reserves the name,
+// so segments never overwrite each other.
+func reserveName(file string) (string, error) {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	for seq := 0; ; seq++ {
+		name := file
+		if seq > 0 {
+			name = fmt.Sprintf("%s-%d%s", base, seq, ext)
+		}
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return name, f.Close()
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+}
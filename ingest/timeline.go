@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/icza/mjpeg"
+)
+
+// ErrGap reports if there is no recording at a time of a timeline (recorder downtime, or outside the timeline).
+var ErrGap = errors.New("No recording at the given time")
+
+// Gap is a period of a timeline without recording.
+type Gap struct {
+	// Start is the end of the segment before the gap
+	Start time.Time
+	// End is the start of the segment after the gap
+	End time.Time
+}
+
+// Timeline is a single virtual timeline across the segments of a playlist, e.g. for timeline scrubbers
+// over segmented archives. Periods between segments (recorder downtime) are reported as gaps.
+//
+// Segment files are opened on demand; a Timeline is not safe for concurrent use.
+type Timeline struct {
+	// dir is the directory of the segment files
+	dir string
+	// segs are the segments, ordered by start time
+	segs []PlaylistEntry
+	// gaps are the gaps between the segments
+	gaps []Gap
+
+	// ar is the reader of the segment with index arSeg, nil if no segment is open
+	ar    mjpeg.AviReader
+	arSeg int
+}
+
+// OpenTimeline returns the Timeline of the segments listed in the given playlist file (see Config.Playlist).
+// A gap is reported between two segments if the second starts more than a frame duration after the end of the first.
+func OpenTimeline(playlistFile string) (*Timeline, error) {
+	p, err := ReadPlaylist(playlistFile)
+	if err != nil {
+		return nil, err
+	}
+	tl := &Timeline{dir: filepath.Dir(playlistFile)}
+	for _, e := range p.Segments {
+		if e.Frames > 0 && e.Duration > 0 {
+			tl.segs = append(tl.segs, e)
+		}
+	}
+	sort.SliceStable(tl.segs, func(i, j int) bool { return tl.segs[i].Start.Before(tl.segs[j].Start) })
+
+	for i := 1; i < len(tl.segs); i++ {
+		prev := tl.segs[i-1]
+		end := prev.Start.Add(prev.Duration)
+		if tl.segs[i].Start.Sub(end) > prev.Duration/time.Duration(prev.Frames) {
+			tl.gaps = append(tl.gaps, Gap{Start: end, End: tl.segs[i].Start})
+		}
+	}
+	return tl, nil
+}
+
+// Start returns the start of the timeline, the zero time if it has no segments.
+func (tl *Timeline) Start() time.Time {
+	if len(tl.segs) == 0 {
+		return time.Time{}
+	}
+	return tl.segs[0].Start
+}
+
+// End returns the end of the timeline, the zero time if it has no segments.
+func (tl *Timeline) End() time.Time {
+	if len(tl.segs) == 0 {
+		return time.Time{}
+	}
+	last := tl.segs[len(tl.segs)-1]
+	return last.Start.Add(last.Duration)
+}
+
+// Segments returns the segments of the timeline, ordered by start time.
+func (tl *Timeline) Segments() []PlaylistEntry {
+	return tl.segs
+}
+
+// Gaps returns the gaps of the timeline, ordered by time.
+func (tl *Timeline) Gaps() []Gap {
+	return tl.gaps
+}
+
+// Locate returns the (zero-based) index of the segment and the index of the frame within the segment
+// which is displayed at time t. ErrGap is returned if there is no recording at t.
+func (tl *Timeline) Locate(t time.Time) (seg, frame int, err error) {
+	// The last segment starting at or before t
+	seg = sort.Search(len(tl.segs), func(i int) bool { return tl.segs[i].Start.After(t) }) - 1
+	if seg < 0 {
+		return 0, 0, ErrGap
+	}
+	e := tl.segs[seg]
+	offset := t.Sub(e.Start)
+	if offset >= e.Duration {
+		return 0, 0, ErrGap
+	}
+	frame = int(int64(offset) * int64(e.Frames) / int64(e.Duration))
+	return seg, frame, nil
+}
+
+// FrameAt returns the data of the frame displayed at time t (the JPEG encoded frame for MJPEG segments).
+// ErrGap is returned if there is no recording at t.
+func (tl *Timeline) FrameAt(t time.Time) ([]byte, error) {
+	seg, frame, err := tl.Locate(t)
+	if err != nil {
+		return nil, err
+	}
+	if tl.ar == nil || tl.arSeg != seg {
+		if err := tl.Close(); err != nil {
+			return nil, err
+		}
+		ar, err := mjpeg.NewReader(filepath.Join(tl.dir, tl.segs[seg].File))
+		if err != nil {
+			return nil, err
+		}
+		tl.ar, tl.arSeg = ar, seg
+	}
+	if n := tl.ar.Info().Frames; frame >= n && n > 0 {
+		frame = n - 1 // The playlist may be slightly off for segments closed with an error
+	}
+	return tl.ar.Frame(frame)
+}
+
+// Close closes the segment file opened by the timeline, if any. The timeline remains usable.
+func (tl *Timeline) Close() error {
+	if tl.ar == nil {
+		return nil
+	}
+	err := tl.ar.Close()
+	tl.ar = nil
+	return err
+}
@@ -0,0 +1,105 @@
+package mjpeg
+
+import (
+	"image"
+	"image/draw"
+)
+
+// FieldOrder is the order of the fields of interlaced video.
+type FieldOrder int
+
+// Field orders.
+const (
+	// TopFieldFirst means the field of the even lines (counting from 0 at the top) is displayed first,
+	// e.g. of PAL analog captures and most HD sources
+	TopFieldFirst FieldOrder = iota
+	// BottomFieldFirst means the field of the odd lines is displayed first, e.g. of NTSC DV captures
+	BottomFieldFirst
+)
+
+// WithInterlaced returns an Option which marks the video stream as interlaced (e.g. captured from an analog source
+// through an MJPEG capture dongle): the OpenDML video properties chunk ('vprp') is written with 2 fields per frame
+// in the given field order, so players can deinterlace the video. If no aspect ratio is set with WithAspectRatio(),
+// the aspect ratio of the frame size is signaled. See Deinterlace() to deinterlace frames before they are encoded instead.
+func WithInterlaced(order FieldOrder) Option {
+	return func(aw *aviWriter) {
+		aw.interlaced, aw.fieldOrder = true, order
+	}
+}
+
+// DeinterlaceMode is the method of deinterlacing, see Deinterlace().
+type DeinterlaceMode int
+
+// Deinterlace modes.
+const (
+	// DeinterlaceBlend blends each line with its neighbors (1:2:1), which removes combing but softens the frame
+	DeinterlaceBlend DeinterlaceMode = iota
+	// DeinterlaceBob keeps the first field and interpolates the lines of the other field,
+	// which keeps motion sharp but halves the vertical resolution
+	DeinterlaceBob
+)
+
+// Deinterlace returns a Transform which deinterlaces frames with the given mode, for interlaced sources
+// with the given field order. *image.Gray images are transformed as-is, other images are converted to *image.RGBA.
+func Deinterlace(mode DeinterlaceMode, order FieldOrder) Transform {
+	var src, dst *image.RGBA
+	var grayDst *image.Gray
+	keep := 0 // Parity of the lines of the field kept by bob
+	if order == BottomFieldFirst {
+		keep = 1
+	}
+	filter := func(w, h, bpp int, s []byte, sStride int, d []byte, dStride int) {
+		n := w * bpp
+		for y := 0; y < h; y++ {
+			drow, row := d[y*dStride:y*dStride+n], s[y*sStride:y*sStride+n]
+			if h < 2 || mode == DeinterlaceBob && y%2 == keep {
+				copy(drow, row) // Single line frame, or a line of the kept field
+				continue
+			}
+			up, down := y-1, y+1 // Neighbor lines, mirrored at the edges
+			if up < 0 {
+				up = down
+			}
+			if down >= h {
+				down = up
+			}
+			urow, lrow := s[up*sStride:up*sStride+n], s[down*sStride:down*sStride+n]
+			if mode == DeinterlaceBob {
+				for i := range drow {
+					drow[i] = byte((int(urow[i]) + int(lrow[i]) + 1) / 2)
+				}
+				continue
+			}
+			for i := range drow {
+				drow[i] = byte((int(urow[i]) + 2*int(row[i]) + int(lrow[i]) + 2) / 4)
+			}
+		}
+	}
+
+	return func(img image.Image) image.Image {
+		b := img.Bounds()
+		w, h := b.Dx(), b.Dy()
+
+		if g, ok := img.(*image.Gray); ok {
+			if grayDst == nil || grayDst.Rect.Size() != b.Size() {
+				grayDst = image.NewGray(image.Rectangle{Max: b.Size()})
+			}
+			filter(w, h, 1, g.Pix[g.PixOffset(b.Min.X, b.Min.Y):], g.Stride, grayDst.Pix, grayDst.Stride)
+			return grayDst
+		}
+
+		s, ok := img.(*image.RGBA)
+		if !ok {
+			if src == nil || src.Rect.Size() != b.Size() {
+				src = image.NewRGBA(image.Rectangle{Max: b.Size()})
+			}
+			draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+			s = src
+		}
+		if dst == nil || dst.Rect.Size() != b.Size() {
+			dst = image.NewRGBA(image.Rectangle{Max: b.Size()})
+		}
+		filter(w, h, 4, s.Pix[s.PixOffset(s.Rect.Min.X, s.Rect.Min.Y):], s.Stride, dst.Pix, dst.Stride)
+		return dst
+	}
+}
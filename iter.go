@@ -0,0 +1,40 @@
+package mjpeg
+
+import "image"
+
+// Frames implements AviReader.Frames().
+func (ar *aviReader) Frames() func(yield func(int, []byte) bool) {
+	return func(yield func(int, []byte) bool) {
+		ar.iterErr = nil
+		for i := range ar.frames {
+			data, err := ar.Frame(i)
+			if err != nil {
+				ar.iterErr = err
+				return
+			}
+			if !yield(i, data) {
+				return
+			}
+		}
+	}
+}
+
+// Images implements AviReader.Images().
+func (ar *aviReader) Images() func(yield func(int, image.Image) bool) {
+	return func(yield func(int, image.Image) bool) {
+		// The module supports Go versions before range-over-func, so the iterator is called directly
+		ar.Frames()(func(i int, data []byte) bool {
+			img, err := decodeFrame(ar, data)
+			if err != nil {
+				ar.iterErr = err
+				return false
+			}
+			return yield(i, img)
+		})
+	}
+}
+
+// Err implements AviReader.Err().
+func (ar *aviReader) Err() error {
+	return ar.iterErr
+}
@@ -0,0 +1,453 @@
+package mjpeg
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// Subsampling is the chroma subsampling of JPEG encoded frames.
+type Subsampling int
+
+// Chroma subsampling modes.
+const (
+	// Subsampling420 halves the chroma resolution horizontally and vertically (the only mode of image/jpeg)
+	Subsampling420 Subsampling = iota
+	// Subsampling422 halves the chroma resolution horizontally
+	Subsampling422
+	// Subsampling444 keeps the full chroma resolution, e.g. for sharp colored text in screen recordings
+	Subsampling444
+)
+
+// Encoder encodes an image as JPEG to w with the given quality (1..100), see WithEncoder().
+type Encoder func(w io.Writer, img image.Image, quality int) error
+
+// WithEncoder returns an Option which sets the JPEG encoder used to encode images added with AddImage(),
+// replacing image/jpeg. The encoder must produce baseline JPEG data which MJPEG decoders can play.
+func WithEncoder(enc Encoder) Option {
+	return func(aw *aviWriter) {
+		aw.encoder = enc
+	}
+}
+
+// WithSubsampling returns an Option which makes the writer encode images added with AddImage()
+// with the given chroma subsampling, using the encoder returned by JPEGEncoder().
+// 4:4:4 makes text heavy screen recordings noticeably sharper, at the cost of larger frames.
+func WithSubsampling(s Subsampling) Option {
+	return WithEncoder(JPEGEncoder(s))
+}
+
+// encodeJPEG encodes the image as JPEG to w, with the encoder of the writer.
+func (aw *aviWriter) encodeJPEG(w io.Writer, img image.Image) error {
+	if aw.encoder != nil {
+		return aw.encoder(w, img, aw.quality)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: aw.quality})
+}
+
+// Quantization tables of section K.1 of the JPEG spec, in natural order.
+var (
+	lumaQuant = [64]byte{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	}
+	chromaQuant = [64]byte{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// zigzag maps the zig-zag order index of coefficients to their natural order index.
+var zigzag = [64]byte{
+	0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// huffSpec is a Huffman table: the number of codes of each length (1..16 bits), and the symbols in code order.
+type huffSpec struct {
+	counts  [16]byte
+	symbols []byte
+}
+
+// acSymbols returns the symbols of an AC Huffman table of section K.3 of the JPEG spec, given the symbols
+// of its shorter codes (which differ between luminance and chrominance): the remaining symbols
+// are all run/size pairs with a size of 1..10 not listed, in increasing order.
+func acSymbols(short []byte) []byte {
+	listed := map[byte]bool{}
+	for _, s := range short {
+		listed[s] = true
+	}
+	symbols := append([]byte(nil), short...)
+	for run := 0; run < 16; run++ {
+		for size := 1; size <= 10; size++ {
+			if s := byte(run<<4 | size); !listed[s] {
+				symbols = append(symbols, s)
+			}
+		}
+	}
+	return symbols
+}
+
+// Huffman tables of section K.3 of the JPEG spec.
+var (
+	lumaDCHuff   = huffSpec{[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1}, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}}
+	chromaDCHuff = huffSpec{[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1}, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}}
+	lumaACHuff   = huffSpec{[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125}, acSymbols([]byte{
+		0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12, 0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+		0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08, 0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+		0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+	})}
+	chromaACHuff = huffSpec{[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119}, acSymbols([]byte{
+		0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21, 0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+		0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91, 0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+		0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34, 0xe1, 0x25, 0xf1,
+	})}
+)
+
+// huffCode is the code of a Huffman symbol.
+type huffCode struct {
+	code uint32
+	size uint8
+}
+
+// codes returns the codes of the symbols of the Huffman table, indexed by symbol.
+func (hs *huffSpec) codes() *[256]huffCode {
+	codes := new([256]huffCode)
+	code, k := uint32(0), 0
+	for size, n := range hs.counts {
+		for i := 0; i < int(n); i++ {
+			codes[hs.symbols[k]] = huffCode{code, uint8(size + 1)}
+			code, k = code+1, k+1
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+var lumaDCCodes, lumaACCodes, chromaDCCodes, chromaACCodes = lumaDCHuff.codes(), lumaACHuff.codes(), chromaDCHuff.codes(), chromaACHuff.codes()
+
+// dctCos are the coefficients of the forward DCT: dctCos[u][x] = C(u)/2 * cos((2x+1)uπ/16).
+var dctCos = func() (c [8][8]float64) {
+	for u := range c {
+		cu := 0.5
+		if u == 0 {
+			cu = 0.5 / math.Sqrt2
+		}
+		for x := range c[u] {
+			c[u][x] = cu * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return
+}()
+
+// jpegEncoder is the state of the encoder returned by JPEGEncoder().
+type jpegEncoder struct {
+	// hSamp and vSamp are the luma sampling factors (chroma has 1x1)
+	hSamp, vSamp int
+	// quality is the quality the quantization tables are scaled for, 0 if they are not yet scaled
+	quality int
+	// quant are the scaled luma and chroma quantization tables, in natural order
+	quant [2][64]float64
+	// w and h are the dimensions of the image, planes hold its Y, Cb and Cr samples with a stride of w
+	w, h   int
+	planes [3][]uint8
+	// out is the encoded image, bits holds the nbits bits not yet written to out
+	out   []byte
+	bits  uint32
+	nbits uint
+}
+
+// JPEGEncoder returns a baseline JPEG Encoder with the given chroma subsampling, see WithSubsampling().
+// It uses the quantization and Huffman tables of the JPEG spec (like image/jpeg), and encodes
+// *image.Gray images as grayscale JPEG. The returned Encoder reuses its buffers,
+// it must not be used concurrently.
+func JPEGEncoder(s Subsampling) Encoder {
+	e := &jpegEncoder{hSamp: 2, vSamp: 2}
+	switch s {
+	case Subsampling422:
+		e.vSamp = 1
+	case Subsampling444:
+		e.hSamp, e.vSamp = 1, 1
+	}
+	return e.encode
+}
+
+// encode implements Encoder.
+func (e *jpegEncoder) encode(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return jpeg.UnsupportedError("image size")
+	}
+	e.setQuality(quality)
+	comps := e.loadPlanes(img)
+
+	hs, vs := e.hSamp, e.vSamp
+	if comps == 1 {
+		hs, vs = 1, 1
+	}
+	e.out, e.bits, e.nbits = append(e.out[:0], 0xff, markerSOI), 0, 0
+	e.writeHeaders(comps, hs, vs)
+
+	var dc [3]int
+	var blk [64]int32
+	mcuW, mcuH := 8*hs, 8*vs
+	for my := 0; my < e.h; my += mcuH {
+		for mx := 0; mx < e.w; mx += mcuW {
+			for by := 0; by < vs; by++ {
+				for bx := 0; bx < hs; bx++ {
+					e.fdct(&blk, 0, mx+8*bx, my+8*by, 1, 1)
+					dc[0] = e.writeBlock(&blk, dc[0], lumaDCCodes, lumaACCodes)
+				}
+			}
+			for c := 1; c < comps; c++ {
+				e.fdct(&blk, c, mx, my, hs, vs)
+				dc[c] = e.writeBlock(&blk, dc[c], chromaDCCodes, chromaACCodes)
+			}
+		}
+	}
+	e.writeBits(0x7f, 7) // Pad the last byte with 1 bits
+	e.out = append(e.out, 0xff, markerEOI)
+
+	_, err := w.Write(e.out)
+	return err
+}
+
+// setQuality scales the quantization tables for the given quality, the same way as image/jpeg (and libjpeg).
+func (e *jpegEncoder) setQuality(quality int) {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+	if quality == e.quality {
+		return
+	}
+	e.quality = quality
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i, table := range []*[64]byte{&lumaQuant, &chromaQuant} {
+		for j, q := range table {
+			v := (int(q)*scale + 50) / 100
+			if v < 1 {
+				v = 1
+			} else if v > 255 {
+				v = 255
+			}
+			e.quant[i][j] = float64(v)
+		}
+	}
+}
+
+// loadPlanes converts the image into the Y, Cb and Cr planes, and returns the number of components:
+// 1 for *image.Gray images (Y only), 3 otherwise.
+func (e *jpegEncoder) loadPlanes(img image.Image) int {
+	b := img.Bounds()
+	e.w, e.h = b.Dx(), b.Dy()
+	comps := 3
+	if _, ok := img.(*image.Gray); ok {
+		comps = 1
+	}
+	for c := 0; c < comps; c++ {
+		if n := e.w * e.h; cap(e.planes[c]) < n {
+			e.planes[c] = make([]uint8, n)
+		} else {
+			e.planes[c] = e.planes[c][:n]
+		}
+	}
+	Y, Cb, Cr := e.planes[0], e.planes[1], e.planes[2]
+
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x, i = x+1, i+1 {
+			switch src := img.(type) {
+			case *image.Gray:
+				Y[i] = src.Pix[src.PixOffset(x, y)]
+			case *image.YCbCr:
+				ci := src.COffset(x, y)
+				Y[i], Cb[i], Cr[i] = src.Y[src.YOffset(x, y)], src.Cb[ci], src.Cr[ci]
+			case *image.RGBA:
+				p := src.Pix[src.PixOffset(x, y):]
+				Y[i], Cb[i], Cr[i] = color.RGBToYCbCr(p[0], p[1], p[2])
+			default:
+				r, g, b, _ := img.At(x, y).RGBA()
+				Y[i], Cb[i], Cr[i] = color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			}
+		}
+	}
+	return comps
+}
+
+// fdct computes the quantized DCT coefficients (in zig-zag order) of the 8x8 block of component c, whose
+// top-left sample is at (x0, y0) of the plane. Each sample of the block is the average of hs*vs samples
+// of the plane (subsampling). Samples beyond the edges of the plane repeat the last row or column.
+func (e *jpegEncoder) fdct(blk *[64]int32, c, x0, y0, hs, vs int) {
+	var s, t [8][8]float64
+	plane := e.planes[c]
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			sum := 0
+			for dy := 0; dy < vs; dy++ {
+				py := y0 + y*vs + dy
+				if py >= e.h {
+					py = e.h - 1
+				}
+				for dx := 0; dx < hs; dx++ {
+					px := x0 + x*hs + dx
+					if px >= e.w {
+						px = e.w - 1
+					}
+					sum += int(plane[py*e.w+px])
+				}
+			}
+			s[y][x] = float64(sum)/float64(hs*vs) - 128
+		}
+	}
+
+	// Separable 2D DCT: rows, then columns
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			v := 0.0
+			for x := 0; x < 8; x++ {
+				v += dctCos[u][x] * s[y][x]
+			}
+			t[y][u] = v
+		}
+	}
+	q := &e.quant[0]
+	if c > 0 {
+		q = &e.quant[1]
+	}
+	for k, n := range zigzag {
+		v, u := int(n)/8, int(n)%8
+		f := 0.0
+		for y := 0; y < 8; y++ {
+			f += dctCos[v][y] * t[y][u]
+		}
+		blk[k] = int32(math.Round(f / q[n]))
+	}
+}
+
+// writeBlock writes the Huffman coded coefficients of a block, and returns its DC coefficient.
+// prevDC is the DC coefficient of the previous block of the component.
+func (e *jpegEncoder) writeBlock(blk *[64]int32, prevDC int, dcCodes, acCodes *[256]huffCode) int {
+	dc := int(blk[0])
+	e.writeValue(dcCodes, 0, int32(dc-prevDC))
+	run := 0
+	for _, v := range blk[1:] {
+		if v == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			e.writeCode(acCodes[0xf0]) // ZRL: 16 zeros
+		}
+		e.writeValue(acCodes, run, v)
+		run = 0
+	}
+	if run > 0 {
+		e.writeCode(acCodes[0x00]) // EOB
+	}
+	return dc
+}
+
+// writeValue writes the code of the run/size symbol of a coefficient value, followed by the bits of the value.
+func (e *jpegEncoder) writeValue(codes *[256]huffCode, run int, v int32) {
+	a, size := v, uint(0)
+	if a < 0 {
+		a, v = -a, v-1 // Negative values are written as the one's complement of the absolute value
+	}
+	for ; a > 0; a >>= 1 {
+		size++
+	}
+	e.writeCode(codes[run<<4|int(size)])
+	e.writeBits(uint32(v)&(1<<size-1), size)
+}
+
+// writeCode writes a Huffman code.
+func (e *jpegEncoder) writeCode(hc huffCode) {
+	e.writeBits(hc.code, uint(hc.size))
+}
+
+// writeBits writes the lowest n bits of bits to the entropy coded data, stuffing a zero byte after 0xff bytes.
+func (e *jpegEncoder) writeBits(bits uint32, n uint) {
+	e.bits, e.nbits = e.bits<<n|bits, e.nbits+n
+	for e.nbits >= 8 {
+		e.nbits -= 8
+		v := byte(e.bits >> e.nbits)
+		e.out = append(e.out, v)
+		if v == 0xff {
+			e.out = append(e.out, 0)
+		}
+	}
+	e.bits &= 1<<e.nbits - 1
+}
+
+// writeHeaders writes the quantization tables, the frame header, the Huffman tables and the scan header.
+func (e *jpegEncoder) writeHeaders(comps, hs, vs int) {
+	segment := func(marker byte, length int) {
+		e.out = append(e.out, 0xff, marker, byte((length+2)>>8), byte(length+2))
+	}
+	tables := 1
+	if comps > 1 {
+		tables = 2
+	}
+
+	segment(markerDQT, 65*tables)
+	for i := 0; i < tables; i++ {
+		e.out = append(e.out, byte(i)) // 8 bit precision, table id
+		for _, n := range zigzag {
+			e.out = append(e.out, byte(e.quant[i][n]))
+		}
+	}
+
+	segment(markerSOF0, 6+3*comps)
+	e.out = append(e.out, 8, byte(e.h>>8), byte(e.h), byte(e.w>>8), byte(e.w), byte(comps))
+	for c := 0; c < comps; c++ {
+		sampling, table := byte(0x11), byte(1)
+		if c == 0 {
+			sampling, table = byte(hs<<4|vs), 0
+		}
+		e.out = append(e.out, byte(c+1), sampling, table)
+	}
+
+	specs := []*huffSpec{&lumaDCHuff, &lumaACHuff, &chromaDCHuff, &chromaACHuff}[:2*tables]
+	length := 0
+	for _, hs := range specs {
+		length += 17 + len(hs.symbols)
+	}
+	segment(markerDHT, length)
+	for i, hs := range specs {
+		e.out = append(e.out, byte(i%2<<4|i/2)) // Class (0: DC, 1: AC), table id
+		e.out = append(e.out, hs.counts[:]...)
+		e.out = append(e.out, hs.symbols...)
+	}
+
+	segment(markerSOS, 4+2*comps)
+	e.out = append(e.out, byte(comps))
+	for c := 0; c < comps; c++ {
+		tables := byte(0x00)
+		if c > 0 {
+			tables = 0x11
+		}
+		e.out = append(e.out, byte(c+1), tables)
+	}
+	e.out = append(e.out, 0, 63, 0) // Spectral selection, successive approximation (baseline)
+}
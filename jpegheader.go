@@ -0,0 +1,102 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errInvalidJPEG reports invalid JPEG data.
+var errInvalidJPEG = errors.New("Invalid JPEG data")
+
+// JPEG markers.
+const (
+	markerSOF0 = 0xc0 // Start of frame, baseline DCT
+	markerDHT  = 0xc4 // Define Huffman tables
+	markerSOI  = 0xd8 // Start of image
+	markerEOI  = 0xd9 // End of image
+	markerSOS  = 0xda // Start of scan
+	markerDQT  = 0xdb // Define quantization tables
+	markerAPP0 = 0xe0 // Application segment 0 (JFIF, AVI1)
+	markerAPPF = 0xef // Application segment 15
+	markerCOM  = 0xfe // Comment
+)
+
+// jpegHeader holds the properties of a JPEG image parsed from its marker segments (up to the first scan).
+type jpegHeader struct {
+	// sof is the start of frame marker (markerSOF0 for baseline, 0xc2 for progressive etc.), 0 if there is none
+	sof byte
+	// width and height are the dimensions of the image
+	width, height int
+	// sampling are the sampling factors of the components (horizontal in the high, vertical in the low 4 bits)
+	sampling []byte
+	// hasDHT and hasDQT tell if the image defines Huffman and quantization tables
+	hasDHT, hasDQT bool
+	// sosPos is the position of the first start of scan marker
+	sosPos int
+}
+
+// parseJPEGHeader parses the marker segments of the JPEG data up to the first start of scan marker.
+func parseJPEGHeader(data []byte) (h jpegHeader, err error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return h, errInvalidJPEG
+	}
+	for pos := 2; ; {
+		if pos >= len(data) || data[pos] != 0xff {
+			return h, errInvalidJPEG
+		}
+		for pos < len(data) && data[pos] == 0xff {
+			pos++ // Markers may be preceded by fill bytes
+		}
+		if pos >= len(data) {
+			return h, errInvalidJPEG
+		}
+		marker := data[pos]
+		pos++
+
+		switch {
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			continue // Standalone markers (TEM, RSTn)
+		case marker == markerSOI || marker == markerEOI:
+			return h, errInvalidJPEG // No scan
+		case marker == markerSOS:
+			h.sosPos = pos - 2
+			if h.sof == 0 {
+				return h, errInvalidJPEG
+			}
+			return h, nil
+		}
+
+		if pos+2 > len(data) {
+			return h, errInvalidJPEG
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return h, errInvalidJPEG
+		}
+		seg := data[pos+2 : pos+length]
+		pos += length
+
+		switch {
+		case marker == markerDHT:
+			h.hasDHT = true
+		case marker == markerDQT:
+			h.hasDQT = true
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			// SOFn (except DHT, JPG and DAC)
+			if len(seg) < 6 {
+				return h, errInvalidJPEG
+			}
+			h.sof = marker
+			h.height = int(binary.BigEndian.Uint16(seg[1:]))
+			h.width = int(binary.BigEndian.Uint16(seg[3:]))
+			n := int(seg[5])
+			if len(seg) < 6+n*3 {
+				return h, errInvalidJPEG
+			}
+			h.sampling = make([]byte, n)
+			for i := range h.sampling {
+				h.sampling[i] = seg[6+i*3+1]
+			}
+		}
+	}
+}
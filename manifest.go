@@ -0,0 +1,126 @@
+package mjpeg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrManifest reports if the manifest of a video is invalid.
+var ErrManifest = errors.New("Invalid manifest")
+
+// manifestAlgorithm is the hash algorithm of manifests.
+const manifestAlgorithm = "SHA-256"
+
+// manifest lists the hashes of the frames of a video, see WithManifest().
+type manifest struct {
+	// Video is the (base) name of the video file
+	Video string `json:"video"`
+	// Algorithm is the hash algorithm
+	Algorithm string `json:"algorithm"`
+	// Frames are the entries of the frames
+	Frames []frameHash `json:"frames"`
+	// Gaps are the gaps of the video, see AviWriter.FillGap()
+	Gaps []gapEntry `json:"gaps,omitempty"`
+}
+
+// frameHash is the manifest entry of a frame.
+type frameHash struct {
+	// Offset is the file position of the frame chunk
+	Offset int64 `json:"offset"`
+	// Size is the size of the frame data
+	Size int `json:"size"`
+	// Hash is the hex encoded hash of the frame data
+	Hash string `json:"sha256"`
+}
+
+// WithManifest returns an Option which makes the writer compute the SHA-256 hash of each frame as it is written,
+// and write them into a companion .manifest.json file when the video is closed
+// (e.g. for evidence-grade recordings). Verify() checks a video against its manifest.
+//
+// The manifest is not written if the video is written to an io.Writer (there is no video file to write next to).
+// Checkpoint() is not supported with this option.
+func WithManifest() Option {
+	return func(aw *aviWriter) {
+		aw.manifest = true
+	}
+}
+
+// manifestFile returns the name of the companion manifest file of the given AVI file.
+func manifestFile(aviFile string) string {
+	return strings.TrimSuffix(aviFile, filepath.Ext(aviFile)) + ".manifest.json"
+}
+
+// hashFrame adds the manifest entry of a frame written at the given file position.
+func (aw *aviWriter) hashFrame(pos int64, data []byte) {
+	sum := sha256.Sum256(data)
+	aw.frameHashes = append(aw.frameHashes, frameHash{Offset: pos, Size: len(data), Hash: hex.EncodeToString(sum[:])})
+}
+
+// hashFrames adds the manifest entries of the frames of an existing video (opened for appending).
+func (aw *aviWriter) hashFrames(ar *aviReader) error {
+	for i, e := range ar.frames {
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		aw.hashFrame(e.offset-8, data)
+	}
+	return nil
+}
+
+// writeManifest writes the manifest file of the video.
+func (aw *aviWriter) writeManifest() error {
+	if aw.aviFile == "" {
+		return nil // Writing to an io.Writer, there is no video file to write next to
+	}
+	m := manifest{Video: filepath.Base(aw.aviFile), Algorithm: manifestAlgorithm, Frames: aw.frameHashes, Gaps: aw.gaps}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestFile(aw.aviFile), data, 0644)
+}
+
+// Verify checks the frames of the video aviFile against its companion manifest file, written by
+// a writer created with WithManifest(). Returns the (zero-based) indices of the frames which don't match
+// the manifest: whose data was altered, which are missing from the video or are not in the manifest.
+//
+// ErrManifest is returned if the manifest can't be parsed.
+func Verify(aviFile string) (bad []int, err error) {
+	data, err := os.ReadFile(manifestFile(aviFile))
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil || m.Algorithm != manifestAlgorithm {
+		return nil, ErrManifest
+	}
+
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	frames := ar.Info().Frames
+	for i := 0; i < frames || i < len(m.Frames); i++ {
+		if i >= frames || i >= len(m.Frames) {
+			bad = append(bad, i)
+			continue
+		}
+		data, err := ar.Frame(i)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if len(data) != m.Frames[i].Size || hex.EncodeToString(sum[:]) != m.Frames[i].Hash {
+			bad = append(bad, i)
+		}
+	}
+	return bad, nil
+}
@@ -0,0 +1,72 @@
+package mjpeg
+
+// WithMetadataStream returns an Option which adds a metadata stream to the video (a 'txts' stream),
+// so each video frame can carry a small metadata blob, e.g. GPS coordinates, sensor readings or captions.
+// Metadata is set with AviWriter.SetMetadata() before adding the frame it belongs to.
+//
+// A metadata chunk is written (interleaved) after each video frame chunk, so the timing of the metadata
+// stream matches the video stream; frames without metadata get an empty metadata chunk.
+func WithMetadataStream() Option {
+	return func(aw *aviWriter) {
+		aw.metaStream = true
+	}
+}
+
+// SetMetadata implements AviWriter.SetMetadata().
+func (aw *aviWriter) SetMetadata(meta []byte) {
+	aw.meta = append(aw.meta[:0], meta...)
+}
+
+// writeMetaStreamHeader writes the stream list of the metadata stream.
+func (aw *aviWriter) writeMetaStreamHeader() {
+	wstr, wint32, wint16 := aw.writeStr, aw.writeInt32, aw.writeInt16
+
+	aw.pushList("strl") // LIST chunk: stream headers (nesting level 2)
+	wstr("strh")        // Stream header
+	wint32(56)          // Length of the strh sub-chunk
+	wstr("txts")        // fccType - type of data stream - here 'txts' for text stream
+	wint32(0)           // fccHandler, no handler
+	wint32(0)           // dwFlags
+	wint32(0)           // wPriority, wLanguage
+	wint32(0)           // dwInitialFrames
+	wint32(aw.scale)    // dwScale
+	wint32(aw.fps)      // dwRate, same as the video stream: one metadata chunk per frame
+	wint32(0)           // dwStart
+	aw.metaLengthFieldPos = aw.currentPos()
+	wint32(0)  // dwLength, number of chunks (set equal to the number of frames)
+	wint32(0)  // dwSuggestedBufferSize
+	wint32(-1) // dwQuality, -1: default quality
+	wint32(0)  // dwSampleSize, 0 means that each chunk is a separate sample
+	wint16(0)  // left of rcFrame (unused)
+	wint16(0)  //   ..top
+	wint16(0)  //   ..right
+	wint16(0)  //   ..bottom
+
+	wstr("strf") // stream format chunk, no format for metadata
+	wint32(0)
+
+	if aw.odml {
+		aw.writeSuperIndex(1, 0x78743130) // "01tx" text chunks
+	}
+
+	wstr("strn") // Stream name
+	wint32(10)   // Length of the strn sub-CHUNK (must be even)
+	wstr("Metadata\000\000")
+	aw.pop() // LIST 'strl' finished (nesting level 2)
+}
+
+// writeMetadata writes the metadata chunk of the last written frame, if the metadata stream is enabled.
+func (aw *aviWriter) writeMetadata() error {
+	if !aw.metaStream {
+		return nil
+	}
+	pos := aw.currentPos()
+	if err := aw.writeChunk("01tx", aw.meta); err != nil { // "01tx" text chunk of stream 1 (nesting level 2)
+		return err
+	}
+	if err := aw.writeIdxEntry(0x78743130, FlagKeyFrame, pos, len(aw.meta)); err != nil { // "01tx" text chunk
+		return err
+	}
+	aw.meta = aw.meta[:0]
+	return nil
+}
@@ -34,39 +34,161 @@ Example to add an image.Image as a frame to the video:
     // Acquire / initialize image, e.g.:
     // img = image.NewRGBA(image.Rect(0, 0, 200, 100))
 
-    buf := &bytes.Buffer{}
-    checkErr(jpeg.Encode(buf, img, nil))
-    checkErr(aw.AddFrame(buf.Bytes()))
+    checkErr(aw.AddImage(img))
 
     checkErr(aw.Close())
+
+Example to create a 10-second test video of SMPTE color bars:
+
+    aw, err := mjpeg.New("bars.avi", 320, 240, 25)
+    checkErr(err)
+
+    _, err = mjpeg.AddFrames(aw, mjpeg.NewPatternSource(mjpeg.PatternColorBars, 320, 240, 25, 250))
+    checkErr(err)
+
+    checkErr(aw.Close())
+
+Example to burn the wall-clock time into the top-left corner of frames added with AddImage():
+
+    aw, err := mjpeg.New("cam.avi", 640, 480, 10,
+        mjpeg.WithOverlay(mjpeg.ClockOverlay(mjpeg.TopLeft, "2006-01-02 15:04:05")))
+    checkErr(err)
 */
 package mjpeg
 
 import (
+	"bytes"
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
+	"image"
+	"image/jpeg"
 	"io"
-	"log"
 	"os"
 	"time"
+
+	"github.com/icza/mjpeg/riff"
 )
 
 var (
 	// ErrTooLarge reports if more frames cannot be added,
-	// else the video file would get corrupted.
+	// else the video file would get corrupted. See AviWriter.TooLarge().
 	ErrTooLarge = errors.New("Video file too large")
-
-	// errImproperUse signals improper state (due to a previous error).
-	errImproperState = errors.New("Improper State")
 )
 
 // AviWriter is an *.avi video writer.
 // The video codec is MJPEG.
 type AviWriter interface {
-	// AddFrame adds a frame from a JPEG encoded data slice.
+	// AddFrame adds a frame from a JPEG encoded data slice
+	// (or from raw frame data if the writer uses the raw RGB codec, see WithRawRGB()).
+	// The data is written directly from the given slice, and is not retained (or is copied if it has to be,
+	// e.g. when queued by WithThrottle()), so the caller may reuse the slice when AddFrame returns.
 	AddFrame(jpegData []byte) error
 
-	// Close finalizes and closes the avi file.
+	// AddFrameFlags adds a frame from an encoded data slice, with the given index flags.
+	// It is useful with codecs set by WithFourCC() where not every frame is a key frame.
+	// MJPEG (and raw RGB) frames are always flagged as key frames, since they are all intra frames.
+	AddFrameFlags(data []byte, flags IndexFlag) error
+
+	// AddFrameToStream adds a frame from a JPEG encoded data slice to the video stream with the given index:
+	// 0 is the main stream (same as AddFrame()), additional streams are added with WithVideoStream().
+	// ErrStreamIndex is returned if there is no such stream.
+	AddFrameToStream(stream int, jpegData []byte) error
+
+	// AddImage adds a frame from an image.Image.
+	// Transforms of the writer are applied to and overlays are drawn onto (a copy of) the image,
+	// then it is encoded as JPEG using the quality of the writer.
+	AddImage(img image.Image) error
+
+	// AddRGBA adds a frame from a raw RGBA pixel buffer of the size of the video (see PixelRGBA),
+	// stride is the distance of the rows in bytes. Like AddImage(), but the buffer is used directly
+	// (wrapped in a reused image header), without allocating an image.
+	// The buffer is not retained after AddRGBA returns.
+	AddRGBA(pix []byte, stride int) error
+
+	// AddPixels adds a frame from a raw pixel buffer of the given format and of the size of the video,
+	// stride is the distance of the rows in bytes. PixelRGBA and PixelGray buffers are used directly,
+	// other formats are converted into a reused image. The buffer is not retained after AddPixels returns.
+	AddPixels(format PixelFormat, pix []byte, stride int) error
+
+	// AddAudio adds audio data (whole samples of all channels) to the audio stream, interleaved with the frames.
+	// The audio stream has to be enabled, see WithPCMAudio(), else ErrNoAudio is returned.
+	AddAudio(data []byte) error
+
+	// SetMetadata sets the metadata to be attached to the next added frame.
+	// It has effect only if the metadata stream is enabled, see WithMetadataStream().
+	SetMetadata(meta []byte)
+
+	// SetTimestamp sets the capture timestamp of the next added frame (relative to any epoch).
+	// If timestamps are set, a companion .timestamps.json file is written when the video is closed,
+	// next to the video file, recording the true capture time of the frames (see ReadTimestamps()),
+	// so variable frame rate timing can be reconstructed from the constant frame rate video.
+	SetTimestamp(timestamp time.Duration)
+
+	// SetColorRange sets the color range of the frames added next (e.g. when switching between camera sources).
+	// If it differs from the range of the video (see WithColorInfo()), frames are converted to the range of
+	// the video: images before the transforms are applied, and JPEG frames by re-encoding them.
+	// RangeUnspecified (the default) means frames already have the range of the video.
+	SetColorRange(r ColorRange)
+
+	// SetPosterFrame sets the index of the poster (cover) frame of the video, e.g. to the frame of an event
+	// of a recording. A negative value means the middle frame. The poster frame is only recorded
+	// if the video is created with WithPosterFrame().
+	SetPosterFrame(frame int)
+
+	// Pause pauses the recording without closing the video, e.g. in lecture capture apps:
+	// frames added until Resume() is called are dropped (and so is audio), or are replaced by repeating
+	// the last frame, depending on the pause policy (see WithPausePolicy()).
+	// Frames of additional video streams (see AddFrameToStream()) are dropped while paused.
+	Pause()
+
+	// Resume resumes a paused recording.
+	Resume()
+
+	// Annotate adds a text annotation to the frame with the given (zero-based) index.
+	// If annotations are added, a companion .srt subtitle file is written when the video is closed,
+	// next to the video file with the same name, so captions survive in players that can't read
+	// AVI text streams.
+	Annotate(frame int, text string)
+
+	// WriteCustomChunk writes a chunk with the given id (4 characters, e.g. "CALB") and data,
+	// so applications can embed proprietary data (e.g. calibration data or camera settings) in the file.
+	// The chunk is interleaved with the frames in the movi list, or is written after the index when
+	// the video is closed if the writer was created with WithTrailingCustomChunks().
+	// Chunk sizes and padding are handled by the writer. Reserved ids (e.g. "LIST", "JUNK")
+	// and stream chunk ids (e.g. "00dc") are rejected with ErrInvalidChunkID.
+	WriteCustomChunk(fourCC string, data []byte) error
+
+	// Checkpoint flushes the written data to disk, and returns the state of the writer, from which
+	// writing can be resumed with Resume() e.g. after a deliberate process restart, without re-parsing the file.
+	// The writer remains usable after the checkpoint.
+	Checkpoint() (State, error)
+
+	// Finalize finalizes the video (writes the index and updates the headers), and flushes the file to disk,
+	// but keeps it open, e.g. to serve the finished file without reopening it. Frames can't be added afterwards
+	// (ErrFinalized is returned), Close() only closes the files.
+	// Finalize may be called multiple times, subsequent calls return the result of the first.
+	Finalize() error
+
+	// FillGap handles a gap of the given duration in the frames of the source (e.g. while a camera is disconnected)
+	// according to the policy: repeats the last frame, or the slate frame (JPEG encoded) for the duration,
+	// or with GapCut writes nothing. The gap is recorded in the manifest (see WithManifest()).
+	// If slate is nil, the default slate is rendered with the time of the start of the gap, see Slate().
+	FillGap(d time.Duration, policy GapPolicy, slate []byte) error
+
+	// Slate renders a slate frame (see Slate()) at the dimensions of the video, and encodes it as JPEG
+	// like images added with AddImage() (with the quality and encoder of the writer).
+	Slate(cfg SlateConfig) ([]byte, error)
+
+	// TooLarge returns the details of the last ErrTooLarge returned by the writer (the field that would overflow,
+	// and how many frames fit), or nil if ErrTooLarge hasn't been returned.
+	TooLarge() *SizeError
+
+	// Close finalizes (unless Finalize() has been called) and closes the avi file.
+	// If adding a frame failed with ErrNoSpace, the file is finalized with the frames added before
+	// (if the index doesn't fit on the disk either, it is omitted).
+	// The files are closed and the temporary files are removed even if finalizing fails, all failures are returned joined.
+	// Close may be called multiple times (e.g. deferred), subsequent calls return the result of the first.
 	Close() error
 }
 
@@ -78,22 +200,33 @@ type aviWriter struct {
 	width int32
 	// height is the height of the video
 	height int32
-	// fps is the frames/second (the "speed") of the video
+	// fps is the frames/second (the "speed") of the video, or the dwRate of the video stream if scale is not 1
 	fps int32
+	// scale is the dwScale of the video stream: the frame rate is fps/scale (e.g. 30000/1001 for NTSC)
+	scale int32
 
-	// avif is the avi file descriptor
+	// avif is the avi file descriptor (the temporary file if the video is copied to dst)
 	avif *os.File
+	// avifName is the name of avif if it was created by the writer (empty if avif was passed to NewWriter())
+	avifName string
+	// dst is the destination the finished video is copied to, nil if the video is written to avif directly
+	dst io.Writer
+	// rw is the RIFF writer writing avif
+	rw *riff.Writer
 	// idxFile is the name of the index file
 	idxFile string
 	// idxf is the index file descriptor
-	idxf *os.File
+	idxf indexFile
+	// idxLocation and idxPattern specify where and how the index file is created
+	idxLocation IndexLocation
+	idxPattern  string
 
-	// writeErr holds the last encountered write error (to avif)
+	// err is the error after which no more data is accepted (e.g. a failed write), recorded by notifyErr()
 	err error
-
-	// lengthFields contains the file positions of the length fields
-	// that are filled later; used as a stack (LIFO)
-	lengthFields []int64
+	// snap is the state of the writer before the current write operation, see do()
+	snap snapshot
+	// sizeErr describes the last ErrTooLarge returned, see TooLarge()
+	sizeErr *SizeError
 
 	// Position of the frames count fields
 	framesCountFieldPos, framesCountFieldPos2 int64
@@ -102,95 +235,390 @@ type aviWriter struct {
 
 	// frames is the number of frames written to the AVI file
 	frames int
+	// idxEntries is the number of entries written to the index file
+	idxEntries int
+	// lastFramePos, lastFrameSize and lastFrameFlags are the file position, data size
+	// and index flags of the last written frame chunk
+	lastFramePos   int64
+	lastFrameSize  int
+	lastFrameFlags IndexFlag
+
+	// dedup holds the frame deduplication state, nil if deduplication is disabled
+	dedup *dedup
+
+	// metaStream tells if the metadata stream is enabled
+	metaStream bool
+	// metaLengthFieldPos is the position of the length field of the metadata stream header
+	metaLengthFieldPos int64
+	// meta is the metadata to be attached to the next frame
+	meta []byte
+
+	// annotations are the frame annotations to be written to the SRT file
+	annotations []annotation
+
+	// maxDuration is the duration limit of the video, 0 if there is no limit
+	maxDuration time.Duration
+	// autoFinalize tells if the video is finalized when the duration limit is reached
+	autoFinalize bool
+	// closed tells if Close() has been called, closeErr is its result
+	closed   bool
+	closeErr error
+	// finalized tells if Finalize() has been called, finalizeErr is its result
+	finalized   bool
+	finalizeErr error
+
+	// paused tells if the recording is paused, see Pause()
+	paused bool
+	// pausePolicy tells how the timeline is handled while paused
+	pausePolicy PausePolicy
+
+	// timecode is the starting SMPTE timecode of the video, empty if not set
+	timecode string
+
+	// poster is the index of the poster frame (negative: the middle frame), recorded if hasPoster is true
+	poster    int
+	hasPoster bool
+	// posterPos is the position of the frame index of the IPST entry
+	posterPos int64
+
+	// timestamp is the capture timestamp of the next frame, valid if hasTimestamp is true
+	timestamp    time.Duration
+	hasTimestamp bool
+	// timestamps are the capture timestamps of the frames to be written to the timestamps file
+	timestamps []FrameTimestamp
+
+	// fourCC is the FOURCC code of the video codec
+	fourCC string
+	// chunkID is the id of video frame chunks ("00dc" or "00db")
+	chunkID int32
+	// rawRGB tells if frames are raw RGB (DIB) instead of JPEG
+	rawRGB bool
+	// passthrough tells if frames of a custom codec are written as-is (including their index flags)
+	passthrough bool
+	// topDown tells if raw frames are stored top-down
+	topDown bool
+	// flipRaw tells if the rows of raw frames passed to AddFrame() are reversed
+	flipRaw bool
+	// rawImg is the reused image to prepare raw RGB frames
+	rawImg *image.RGBA
+	// gray tells if frames are grayscale (single-channel)
+	gray bool
+	// grayImg is the reused image to convert images to grayscale
+	grayImg *image.Gray
+	// stripMarkers tells if metadata segments are stripped from JPEG frames
+	stripMarkers bool
+	// stripBuf is the reused buffer of stripped JPEG frames
+	stripBuf []byte
+	// strict tells if JPEG frames are checked before writing them, fixEOI tells if a missing EOI marker is fixed
+	strict, fixEOI bool
+	// fixBuf is the reused buffer of fixed JPEG frames
+	fixBuf []byte
+	// manifest tells if a manifest of the frame hashes is written
+	manifest bool
+	// frameHashes are the manifest entries of the frames
+	frameHashes []frameHash
+	// gaps are the manifest entries of the gaps
+	gaps []gapEntry
+	// encrypt tells if the video is encrypted, encKey and encIV are the key and the initial counter block
+	encrypt       bool
+	encKey, encIV []byte
+	// encBlock is the cipher of the encryption
+	encBlock cipher.Block
+	// partSize is the size of the parts uploaded to a Storage
+	partSize int
+	// proxy is the proxy video written alongside the video
+	proxy *proxy
+
+	// odml tells if OpenDML indices are written
+	odml bool
+	// odmlIndices are the ODML index states of the streams
+	odmlIndices []*odmlIndex
+	// dmlhFramesPos is the position of the total frames field of the extended AVI header
+	dmlhFramesPos int64
+
+	// idxReserve is the number of index entries reserved ahead of the movi list
+	idxReserve int
+	// idxReservePos is the position of the chunk reserving space for the index
+	idxReservePos int64
+
+	// aspectX and aspectY specify the frame aspect ratio written to the 'vprp' chunk, 0 if not written
+	aspectX, aspectY int
+	// interlaced tells if the video is marked interlaced in the 'vprp' chunk, fieldOrder is its field order
+	interlaced bool
+	fieldOrder FieldOrder
+	// color is the color information of the video, see WithColorInfo()
+	color ColorInfo
+	// srcRange is the color range of the frames being added, see SetColorRange()
+	srcRange ColorRange
+	// rangeConv converts images from the range rangeConvFrom to the range of the video, nil if not yet needed
+	rangeConv     Transform
+	rangeConvFrom ColorRange
+
+	// align is the boundary to which the movi data is aligned, 0 if not aligned
+	align int64
+	// alignFrames tells if frame chunks are also aligned
+	alignFrames bool
+
+	// extraAVIFlags are the flags of the AVI header set with WithAVIFlags()
+	extraAVIFlags int32
+	// streamPriority and streamLanguage are the wPriority and wLanguage fields of the video stream header
+	streamPriority, streamLanguage uint16
+
+	// recLists tells if the chunks of frames are wrapped in 'rec ' lists
+	recLists bool
+	// recFrames is the number of frames grouped in a 'rec ' list (0 or 1 if not grouped)
+	recFrames int
+	// recOpen tells if a 'rec ' list is open, recCount is the number of frames in it
+	recOpen  bool
+	recCount int
+	// recPos is the position of the current 'rec ' list
+	recPos int64
+	// recIdxPos is the position of the index entry of the current 'rec ' list in the index file
+	recIdxPos int64
+
+	// trailingChunks tells if custom chunks are written after the index
+	trailingChunks bool
+	// customChunks are the custom chunks to be written after the index
+	customChunks []customChunk
+
+	// retry is the policy of retrying failed writes, nil if writes are not retried
+	retry *RetryPolicy
+
+	// hooks are the monitoring callbacks
+	hooks Hooks
+
+	// throttle enforces the frame rate on the input side, nil if disabled
+	throttle *throttle
+
+	// mmap tells if the video is written through a memory mapping (if supported)
+	mmap bool
+	// mw is the memory mapped writer of avif, nil if avif is not mapped
+	mw *mmapWriter
+
+	// maxSize is the size limit of the video file, 0 if there is no limit
+	maxSize int64
+
+	// audio is the audio stream, nil if there is none (see WithPCMAudio())
+	audio *audioStream
+	// videoStreams are the additional video streams (see WithVideoStream())
+	videoStreams []*videoStream
+	// avSync is the policy of keeping the video in sync with the audio, nil if disabled
+	avSync *SyncPolicy
+
+	// ffmpeg tells if the headers are laid out like ffmpeg does
+	ffmpeg bool
+	// maxFrameSize and frameBytes are the size of the largest frame and the total size of frames (in ffmpeg layout)
+	maxFrameSize int
+	frameBytes   int64
+
+	// deterministic tells if the output must not depend on anything but the frames and options (e.g. the current time)
+	deterministic bool
+
+	// out is the destination of the video if it is not a file (see NewDryRun() and Plan.NewWriter()), nil otherwise
+	out io.WriteSeeker
 
 	// General buffers used to write int values.
-	buf4, buf2 []byte
+	buf4 []byte
+	// idxBuf is the buffer of an index entry
+	idxBuf [16]byte
+
+	// frameBuf is the buffer used to encode images added with AddImage()
+	frameBuf bytes.Buffer
+	// colorBuf is the buffer used to encode images before a JFIF segment is inserted
+	colorBuf bytes.Buffer
+	// jfifBuf is the buffer of JPEG frames whose JFIF segment is added or removed
+	jfifBuf []byte
+	// quality is the JPEG quality used to encode images
+	quality int
+	// encoder is the JPEG encoder of images, nil to use image/jpeg
+	encoder Encoder
+	// rate is the rate controller adjusting quality, nil if rate control is disabled
+	rate *rateControl
+
+	// transforms are applied to images added with AddImage(), in order, before overlays
+	transforms []Transform
+	// overlays are applied to images added with AddImage(), in order
+	overlays []Overlay
+	// filterImg is the reused image on which overlays are drawn
+	filterImg *image.RGBA
+	// pixHdr is the reused image header wrapping RGBA pixel buffers
+	pixHdr image.RGBA
+	// grayHdr is the reused image header wrapping grayscale pixel buffers
+	grayHdr image.Gray
+	// pixImg is the reused image raw pixel buffers are converted into
+	pixImg *image.RGBA
+}
+
+// Option is an optional setting of an AviWriter, to be passed to New().
+type Option func(aw *aviWriter)
+
+// WithQuality returns an Option which sets the JPEG quality used to encode images
+// added with AddImage(), ranging from 1 to 100 inclusive, higher is better.
+// The default is jpeg.DefaultQuality.
+func WithQuality(quality int) Option {
+	return func(aw *aviWriter) {
+		aw.quality = quality
+	}
 }
 
 // New returns a new AviWriter.
 // The Close() method of the AviWriter must be called to finalize the video file.
-func New(aviFile string, width, height, fps int32) (awr AviWriter, err error) {
+//
+// On Windows, the file is opened allowing others to read it while it is written (e.g. to tail a recording),
+// and to delete or rename it; long and UNC paths are supported.
+//
+// If New fails, the files it created are closed and removed. If that fails too (e.g. a file can't be removed),
+// the cleanup errors are joined to the returned error (see errors.Join()).
+func New(aviFile string, width, height, fps int32, opts ...Option) (awr AviWriter, err error) {
+	return newWriter(aviFile, nil, width, height, fps, opts)
+}
+
+// NewWriter returns a new AviWriter writing the video to w.
+// The Close() method of the AviWriter must be called to finalize the video.
+//
+// Finalizing the video requires seeking back to its headers: if w is a seekable *os.File (e.g. a regular file),
+// the video is written to it directly, starting at its current position. Else (e.g. if w is a pipe or os.Stdout
+// attached to a pipe) the video is written to a temporary file, and it is copied to w when the writer is closed.
+// w is not closed by the writer. If w is a *Buffer, the video is written into it directly (in memory).
+//
+// Since there is no video file name, no .srt file is written for annotations.
+func NewWriter(w io.Writer, width, height, fps int32, opts ...Option) (AviWriter, error) {
+	return newWriter("", w, width, height, fps, opts)
+}
+
+// joinCleanupErrs returns err joined with the non-nil errors of cleaning up after it, err itself if there are none
+// (so it can still be compared with ==).
+func joinCleanupErrs(err error, cleanupErrs []error) error {
+	for _, e := range cleanupErrs {
+		if e != nil {
+			return errors.Join(append([]error{err}, cleanupErrs...)...)
+		}
+	}
+	return err
+}
+
+// newWriter returns a new AviWriter writing to the file aviFile, or to w if aviFile is empty.
+func newWriter(aviFile string, w io.Writer, width, height, fps int32, opts []Option) (awr AviWriter, err error) {
 	aw := &aviWriter{
-		aviFile:      aviFile,
-		width:        width,
-		height:       height,
-		fps:          fps,
-		idxFile:      aviFile + ".idx_",
-		lengthFields: make([]int64, 0, 5),
-		buf4:         make([]byte, 4),
-		buf2:         make([]byte, 2),
+		aviFile: aviFile,
+		width:   width,
+		height:  height,
+		fps:     fps,
+		scale:   1,
+		buf4:    make([]byte, 4),
+		quality: jpeg.DefaultQuality,
+		fourCC:  "MJPG",
+		chunkID: 0x63643030, // "00dc" compressed frame
+	}
+	for _, opt := range opts {
+		opt(aw)
+	}
+	if aw.rate != nil {
+		aw.rate.init(aw.frameRate())
+	}
+	if aw.throttle != nil {
+		aw.throttle.init(aw.frameTime(1))
 	}
 
 	defer func() {
 		if err == nil {
 			return
 		}
-		logErr := func(e error) {
-			if e != nil {
-				log.Printf("Error: %v\n", e)
-			}
-		}
-		if aw.avif != nil {
-			logErr(aw.avif.Close())
-			logErr(os.Remove(aviFile))
+		cleanupErrs := []error{aw.closeMmap()}
+		if aw.avif != nil && aw.avifName != "" {
+			cleanupErrs = append(cleanupErrs, aw.avif.Close(), os.Remove(aw.avifName))
 		}
 		if aw.idxf != nil {
-			logErr(aw.idxf.Close())
-			logErr(os.Remove(aw.idxFile))
+			cleanupErrs = append(cleanupErrs, aw.removeIdx())
 		}
+		err = joinCleanupErrs(err, cleanupErrs)
 	}()
 
-	aw.avif, err = os.Create(aviFile)
+	// virtual tells if the data is discarded or planned, direct tells if w is an io.WriteSeeker output of the package
+	var virtual, direct bool
+	switch w.(type) {
+	case *sizeCounter, *planWriter:
+		virtual, direct = true, true
+	case *partWriter, *Buffer:
+		direct = true
+	}
+	if aw.encrypt && !virtual { // Encryption doesn't change the size of the video
+		if err = aw.initEncryption(); err != nil {
+			return nil, err
+		}
+	}
+	switch f, ok := w.(*os.File); {
+	case aviFile != "":
+		aw.avif, err = createFile(aviFile)
+		aw.avifName = aviFile
+	case direct:
+		aw.out = w.(io.WriteSeeker)
+	case ok && isSeekable(f):
+		aw.avif = f
+	default:
+		aw.avif, err = os.CreateTemp("", "mjpeg-*.avi")
+		if err == nil {
+			aw.avifName, aw.dst = aw.avif.Name(), w
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	aw.idxf, err = os.Create(aw.idxFile)
-	if err != nil {
+	aw.rw = aw.newRIFFWriter()
+	if err = aw.rw.Err(); err != nil {
 		return nil, err
 	}
 
-	wstr, wint32, wint16, wLenF, finalizeLenF :=
-		aw.writeStr, aw.writeInt32, aw.writeInt16, aw.writeLengthField, aw.finalizeLengthField
+	if err = aw.createIdx(aviFile); err != nil {
+		return nil, err
+	}
+
+	wstr, wint32, wint16, pushList, pop :=
+		aw.writeStr, aw.writeInt32, aw.writeInt16, aw.pushList, aw.pop
+
+	streams := int32(1)
+	if aw.metaStream {
+		streams++
+	}
+	if aw.audio != nil {
+		streams++
+	}
+	streams += int32(len(aw.videoStreams))
 
 	// Write AVI header
-	wstr("RIFF")          // RIFF type
-	wLenF()               // File length (remaining bytes after this field) (nesting level 0)
-	wstr("AVI ")          // AVI signature
-	wstr("LIST")          // LIST chunk: data encoding
-	wLenF()               // Chunk length (nesting level 1)
-	wstr("hdrl")          // LIST chunk type
-	wstr("avih")          // avih sub-chunk
-	wint32(0x38)          // Sub-chunk length excluding the first 8 bytes of avih signature and size
-	wint32(1000000 / fps) // Frame delay time in microsec
-	wint32(0)             // dwMaxBytesPerSec (maximum data rate of the file in bytes per second)
-	wint32(0)             // Reserved
-	wint32(0x10)          // dwFlags, 0x10 bit: AVIF_HASINDEX (the AVI file has an index chunk at the end of the file - for good performance); Windows Media Player can't even play it if index is missing!
+	aw.pushRIFF("AVI ")                                   // RIFF type with AVI signature, file length is filled at Close() (nesting level 0)
+	pushList("hdrl")                                      // LIST chunk: data encoding (nesting level 1)
+	wstr("avih")                                          // avih sub-chunk
+	wint32(0x38)                                          // Sub-chunk length excluding the first 8 bytes of avih signature and size
+	wint32(int32(int64(aw.scale) * 1000000 / int64(fps))) // Frame delay time in microsec
+	wint32(0)                                             // dwMaxBytesPerSec (maximum data rate of the file in bytes per second), filled at Close() in ffmpeg layout
+	wint32(aw.paddingGranularity())                       // dwPaddingGranularity, alignment of data (rec lists)
+	wint32(aw.aviFlags())                                 // dwFlags, 0x10 bit: AVIF_HASINDEX (the AVI file has an index chunk at the end of the file - for good performance); Windows Media Player can't even play it if index is missing!
 	aw.framesCountFieldPos = aw.currentPos()
-	wint32(0)      // Number of frames
-	wint32(0)      // Initial frame for non-interleaved files; non interleaved files should set this to 0
-	wint32(1)      // Number of streams in the video; here 1 video, no audio
-	wint32(0)      // dwSuggestedBufferSize
-	wint32(width)  // Image width in pixels
-	wint32(height) // Image height in pixels
-	wint32(0)      // Reserved
+	wint32(0)                        // Number of frames
+	wint32(0)                        // Initial frame for non-interleaved files; non interleaved files should set this to 0
+	wint32(streams)                  // Number of streams in the video; here 1 video (plus an optional metadata stream), no audio
+	wint32(aw.suggestedBufferSize()) // dwSuggestedBufferSize
+	wint32(width)                    // Image width in pixels
+	wint32(height)                   // Image height in pixels
+	wint32(0)                        // Reserved
 	wint32(0)
 	wint32(0)
 	wint32(0)
 
 	// Write stream information
-	wstr("LIST") // LIST chunk: stream headers
-	wLenF()      // Chunk size (nesting level 2)
-	wstr("strl") // LIST chunk type: stream list
-	wstr("strh") // Stream header
-	wint32(56)   // Length of the strh sub-chunk
-	wstr("vids") // fccType - type of data stream - here 'vids' for video stream
-	wstr("MJPG") // MJPG for Motion JPEG
-	wint32(0)    // dwFlags
-	wint32(0)    // wPriority, wLanguage
-	wint32(0)    // dwInitialFrames
-	wint32(1)    // dwScale
-	wint32(fps)  // dwRate, Frame rate for video streams (the actual FPS is calculated by dividing this by dwScale)
-	wint32(0)    // usually zero
+	priority := int32(aw.streamPriority) | int32(aw.streamLanguage)<<16
+	pushList("strl") // LIST chunk: stream headers (nesting level 2)
+	wstr("strh")     // Stream header
+	wint32(56)       // Length of the strh sub-chunk
+	wstr("vids")     // fccType - type of data stream - here 'vids' for video stream
+	wstr(aw.fourCC)  // fccHandler: MJPG for Motion JPEG, DIB for raw RGB
+	wint32(0)        // dwFlags
+	wint32(priority) // wPriority, wLanguage
+	wint32(0)        // dwInitialFrames
+	wint32(aw.scale) // dwScale
+	wint32(fps)      // dwRate, Frame rate for video streams (the actual FPS is calculated by dividing this by dwScale)
+	wint32(0)        // usually zero
 	aw.framesCountFieldPos2 = aw.currentPos()
 	wint32(0)  // dwLength, playing time of AVI file as defined by scale and rate (set equal to the number of frames)
 	wint32(0)  // dwSuggestedBufferSize for reading the stream (typically, this contains a value corresponding to the largest chunk in a stream)
@@ -198,198 +626,590 @@ func New(aviFile string, width, height, fps int32) (awr AviWriter, err error) {
 	wint32(0)  // dwSampleSize, 0 means that each frame is in its own chunk
 	wint16(0)  // left of rcFrame if stream has a different size than dwWidth*dwHeight(unused)
 	wint16(0)  //   ..top
-	wint16(0)  //   ..right
-	wint16(0)  //   ..bottom
-	// end of 'strh' chunk, stream format follows
-	wstr("strf")               // stream format chunk
-	wLenF()                    // Chunk size (nesting level 3)
-	wint32(40)                 // biSize, write header size of BITMAPINFO header structure; applications should use this size to determine which BITMAPINFO header structure is being used, this size includes this biSize field
-	wint32(width)              // biWidth, width in pixels
-	wint32(height)             // biWidth, height in pixels (may be negative for uncompressed video to indicate vertical flip)
-	wint16(1)                  // biPlanes, number of color planes in which the data is stored
-	wint16(24)                 // biBitCount, number of bits per pixel #
-	wstr("MJPG")               // biCompression, type of compression used (uncompressed: NO_COMPRESSION=0)
-	wint32(width * height * 3) // biSizeImage (buffer size for decompressed mage) may be 0 for uncompressed data
-	wint32(0)                  // biXPelsPerMeter, horizontal resolution in pixels per meter
-	wint32(0)                  // biYPelsPerMeter, vertical resolution in pixels per meter
-	wint32(0)                  // biClrUsed (color table size; for 8-bit only)
-	wint32(0)                  // biClrImportant, specifies that the first x colors of the color table (0: all the colors are important, or, rather, their relative importance has not been computed)
-	finalizeLenF()             //'strf' chunk finished (nesting level 3)
-
-	wstr("strn") // Use 'strn' to provide a zero terminated text string describing the stream
-	name := "Created with https://github.com/icza/mjpeg" +
-		" at " + time.Now().Format("2006-01-02 15:04:05 MST")
-	// Name must be 0-terminated and stream name length (the length of the chunk) must be even
-	if len(name)&0x01 == 0 {
-		name = name + " \000" // padding space plus terminating 0
+	if aw.ffmpeg {
+		wint16(int16(width))  //   ..right (ffmpeg sets the frame size)
+		wint16(int16(height)) //   ..bottom
 	} else {
-		name = name + "\000" // terminating 0
+		wint16(0) //   ..right
+		wint16(0) //   ..bottom
 	}
-	wint32(int32(len(name))) // Length of the strn sub-CHUNK (must be even)
-	wstr(name)
-	finalizeLenF() // LIST 'strl' finished (nesting level 2)
-	finalizeLenF() // LIST 'hdrl' finished (nesting level 1)
+	// end of 'strh' chunk, stream format follows
+	aw.pushChunk("strf")     // stream format chunk (nesting level 3)
+	wint32(40)               // biSize, write header size of BITMAPINFO header structure; applications should use this size to determine which BITMAPINFO header structure is being used, this size includes this biSize field
+	wint32(width)            // biWidth, width in pixels
+	wint32(aw.frameHeight()) // biHeight, height in pixels (negative for top-down uncompressed video, see WithTopDown())
+	wint16(1)                // biPlanes, number of color planes in which the data is stored
+	wint16(aw.bitCount())    // biBitCount, number of bits per pixel #
+	aw.writeCompression()    // biCompression, type of compression used (uncompressed: NO_COMPRESSION=0)
+	wint32(aw.rawSize())     // biSizeImage (buffer size for decompressed mage) may be 0 for uncompressed data
+	wint32(0)                // biXPelsPerMeter, horizontal resolution in pixels per meter
+	wint32(0)                // biYPelsPerMeter, vertical resolution in pixels per meter
+	wint32(aw.paletteSize()) // biClrUsed (color table size; for 8-bit only)
+	wint32(0)                // biClrImportant, specifies that the first x colors of the color table (0: all the colors are important, or, rather, their relative importance has not been computed)
+	aw.writePalette()        // Color table (for 8-bit raw frames only)
+	pop()                    //'strf' chunk finished (nesting level 3)
 
-	wstr("LIST") // The second LIST chunk, which contains the actual data
-	wLenF()      // Chunk length (nesting level 1)
-	aw.moviPos = aw.currentPos()
-	wstr("movi") // LIST chunk type: 'movi'
+	if aw.odml {
+		aw.writeSuperIndex(0, aw.chunkID)
+	} else if aw.ffmpeg {
+		aw.writeFFmpegIndexJunk(aw.chunkID)
+	}
+	if aw.aspectX > 0 || aw.interlaced {
+		aw.writeVprp()
+	}
+	if !aw.ffmpeg {
+		aw.writeStreamName()
+	}
+	pop() // LIST 'strl' finished (nesting level 2)
 
-	if aw.err != nil {
-		return nil, aw.err
+	if aw.metaStream {
+		aw.writeMetaStreamHeader()
+	}
+	if aw.audio != nil {
+		aw.writeAudioStreamHeader()
+	}
+	if len(aw.videoStreams) > 0 {
+		aw.writeVideoStreamHeaders(int(streams) - len(aw.videoStreams))
+	}
+	if aw.odml || aw.ffmpeg {
+		aw.writeODMLHeader()
+	}
+	pop() // LIST 'hdrl' finished (nesting level 1)
+
+	if aw.ffmpeg {
+		aw.writeFFmpegInfo()
+	} else if aw.timecode != "" || aw.color != (ColorInfo{}) || aw.hasPoster {
+		aw.writeInfo()
+	}
+	if aw.idxReserve > 0 {
+		aw.writeIdxReserve()
+	}
+
+	if aw.align > 0 {
+		aw.pad(aw.align, 12) // Align the first chunk after the LIST header and type
+	}
+
+	aw.moviPos = aw.currentPos() + 8
+	pushList("movi") // The second LIST chunk, which contains the actual data (nesting level 1)
+
+	if err = aw.rw.Err(); err != nil {
+		return nil, err
+	}
+
+	if aw.proxy != nil && !virtual {
+		if err = aw.proxy.open(width, height, fps); err != nil {
+			return nil, err
+		}
 	}
 
 	return aw, nil
 }
 
+// writeStreamName writes the strn chunk of the video stream.
+func (aw *aviWriter) writeStreamName() {
+	aw.writeStr("strn") // Use 'strn' to provide a zero terminated text string describing the stream
+	name := "Created with https://github.com/icza/mjpeg"
+	if !aw.deterministic {
+		name += " at " + time.Now().Format("2006-01-02 15:04:05 MST")
+	}
+	// Name must be 0-terminated and stream name length (the length of the chunk) must be even
+	if len(name)&0x01 == 0 {
+		name = name + " \000" // padding space plus terminating 0
+	} else {
+		name = name + "\000" // terminating 0
+	}
+	aw.writeInt32(int32(len(name))) // Length of the strn sub-CHUNK (must be even)
+	aw.writeStr(name)
+}
+
 // writeStr writes a string to the file.
+// The header writing helpers don't return errors: the RIFF writer records the first one (see riff.Writer.Err()).
 func (aw *aviWriter) writeStr(s string) {
-	if aw.err != nil {
-		return
-	}
-	_, aw.err = aw.avif.WriteString(s)
+	io.WriteString(aw.rw, s)
 }
 
 // writeInt32 writes a 32-bit int value to the file.
 func (aw *aviWriter) writeInt32(n int32) {
-	if aw.err != nil {
-		return
-	}
-	binary.LittleEndian.PutUint32(aw.buf4, uint32(n))
-	_, aw.err = aw.avif.Write(aw.buf4)
+	aw.rw.WriteUint32(uint32(n))
 }
 
-// writeIdxInt32 writes a 32-bit int value to the index file.
-func (aw *aviWriter) writeIdxInt32(n int32) {
-	if aw.err != nil {
-		return
+// writeZeros writes n zero bytes to the file.
+func (aw *aviWriter) writeZeros(n int) {
+	zeros := make([]byte, 4096)
+	for ; n > 0 && aw.rw.Err() == nil; n -= len(zeros) {
+		if n < len(zeros) {
+			zeros = zeros[:n]
+		}
+		aw.write(zeros)
 	}
-	binary.LittleEndian.PutUint32(aw.buf4, uint32(n))
-	_, aw.err = aw.idxf.Write(aw.buf4)
 }
 
-// writeInt16 writes a 16-bit int value to the index file.
+// write writes raw data to the file.
+func (aw *aviWriter) write(data []byte) {
+	aw.rw.Write(data)
+}
+
+// writeInt16 writes a 16-bit int value to the file.
 func (aw *aviWriter) writeInt16(n int16) {
-	if aw.err != nil {
-		return
-	}
-	binary.LittleEndian.PutUint16(aw.buf2, uint16(n))
-	_, aw.err = aw.avif.Write(aw.buf2)
+	aw.rw.WriteUint16(uint16(n))
 }
 
-// writeLengthField writes an empty int field to the avi file, and saves
-// the current file position as it will be filled later.
-func (aw *aviWriter) writeLengthField() {
-	if aw.err != nil {
-		return
-	}
-	pos := aw.currentPos()
-	aw.lengthFields = append(aw.lengthFields, pos)
-	aw.writeInt32(0)
+// pushRIFF starts the RIFF chunk with the given form type, its length is filled by pop().
+func (aw *aviWriter) pushRIFF(formType string) {
+	aw.rw.PushRIFF(formType)
 }
 
-// finalizeLengthField finalizes the last length field.
-func (aw *aviWriter) finalizeLengthField() {
-	if aw.err != nil {
-		return
-	}
-	pos := aw.currentPos()
-	if aw.err != nil {
-		return
-	}
+// pushList starts a LIST chunk with the given list type, its length is filled by pop().
+func (aw *aviWriter) pushList(listType string) {
+	aw.rw.PushList(listType)
+}
 
-	numLenFs := len(aw.lengthFields)
-	if numLenFs == 0 {
-		aw.err = errImproperState
-		return
-	}
-	aw.seek(aw.lengthFields[numLenFs-1], 0)
-	aw.lengthFields = aw.lengthFields[:numLenFs-1]
-	aw.writeInt32(int32(pos - aw.currentPos() - 4))
+// pushChunk starts a chunk with the given id, its length is filled by pop().
+func (aw *aviWriter) pushChunk(id string) {
+	aw.rw.PushChunk(id)
+}
 
-	// Seek "back" but align to a 2-byte boundary
-	if pos&0x01 != 0 {
-		pos++
-	}
-	aw.seek(pos, 0)
+// pop finalizes the length of the last started chunk, and pads it to even size.
+// Returns the error of the RIFF writer.
+func (aw *aviWriter) pop() error {
+	aw.rw.Pop()
+	return aw.rw.Err()
 }
 
 // seek seeks the AVI file.
-func (aw *aviWriter) seek(offset int64, whence int) (pos int64) {
-	if aw.err != nil {
-		return
-	}
-	pos, aw.err = aw.avif.Seek(offset, whence)
-	return
+func (aw *aviWriter) seek(offset int64, whence int) int64 {
+	pos, _ := aw.rw.Seek(offset, whence)
+	return pos
 }
 
 // currentPos returns the current file position of the AVI file.
 func (aw *aviWriter) currentPos() int64 {
-	return aw.seek(0, 1) // Seek relative to current pos
+	return aw.rw.Pos()
 }
 
 // AddFrame implements AviWriter.AddFrame().
-// ErrTooLarge is returned if the vide file is too large and would get corrupted
+// ErrTooLarge is returned if the video file is too large and would get corrupted
 // if the given image would be added. The file limit is about 4GB.
+// TooLarge() tells how many frames fit.
+// ErrNoSpace is returned if the disk got full, in which case no more frames are accepted.
 func (aw *aviWriter) AddFrame(jpegData []byte) error {
+	return aw.AddFrameFlags(jpegData, FlagKeyFrame)
+}
+
+// AddFrameFlags implements AviWriter.AddFrameFlags().
+func (aw *aviWriter) AddFrameFlags(data []byte, flags IndexFlag) error {
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	if aw.paused {
+		return aw.notifyErr(aw.holdFrame())
+	}
+	if aw.flipRaw && aw.rawRGB {
+		data = aw.flipRows(data)
+	}
+	if aw.strict && !aw.rawRGB && !aw.passthrough {
+		var err error
+		if data, err = aw.checkJPEG(data); err != nil {
+			return aw.notifyErr(err)
+		}
+	}
+	if aw.color.Range != RangeUnspecified && !aw.rawRGB && !aw.passthrough {
+		var err error
+		if data, err = aw.normalizeJPEG(data); err != nil {
+			return aw.notifyErr(err)
+		}
+	}
+	if aw.throttle != nil {
+		write, err := aw.admitFrame()
+		if err != nil || !write {
+			if err == nil {
+				aw.throttle.enqueue(data, flags)
+			}
+			return aw.notifyErr(err)
+		}
+	}
+	if write, err := aw.syncFrame(); err != nil || !write {
+		return aw.notifyErr(err)
+	}
+	return aw.notifyErr(aw.addEncodedFrame(data, flags))
+}
+
+// addEncodedFrame adds a frame from an encoded data slice, with the given index flags.
+func (aw *aviWriter) addEncodedFrame(data []byte, flags IndexFlag) error {
+	if aw.stripMarkers && !aw.rawRGB && !aw.passthrough {
+		data = aw.stripJPEG(data)
+	}
+	if aw.dedup == nil {
+		return aw.addFrame(data, aw.intraFlags(flags))
+	}
+	if aw.dedup.isDupData(data) {
+		return aw.addDupFrame()
+	}
+	if err := aw.addFrame(data, aw.intraFlags(flags)); err != nil {
+		return err
+	}
+	aw.dedup.written(data)
+	return nil
+}
+
+// addFrame writes a frame chunk with the given data, and its index entry with the given flags.
+func (aw *aviWriter) addFrame(jpegData []byte, flags IndexFlag) error {
+	if err := aw.checkDuration(); err != nil {
+		return err
+	}
 	framePos := aw.currentPos()
 	// Pointers in AVI are 32 bit. Do not write beyond that else the whole AVI file will be corrupted (not playable).
-	// Index entry size: 16 bytes (for each frame)
-	if framePos+int64(len(jpegData))+int64(aw.frames*16) > 4200000000 { // 2^32 = 4 294 967 296
-		return ErrTooLarge
+	metaSize, metaEntries := aw.metaChunkSize()
+	if err := aw.checkSize(9+int64(len(jpegData))+metaSize, 1+metaEntries); err != nil {
+		return err
 	}
 
-	aw.frames++
+	err := aw.do(func() error {
+		aw.frames++
+
+		if aw.recLists && !aw.recOpen {
+			if err := aw.beginRec(); err != nil {
+				return err
+			}
+			framePos = aw.currentPos()
+		} else if aw.alignFrames {
+			if err := aw.pad(aw.align, 0); err != nil {
+				return err
+			}
+			framePos = aw.currentPos()
+		}
+		// "00dc" compressed frame or "00db" uncompressed frame (nesting level 2)
+		if err := aw.writeChunk(chunkName(aw.chunkID), jpegData); err != nil {
+			return err
+		}
 
-	aw.writeInt32(0x63643030) // "00dc" compressed frame
-	aw.writeLengthField()     // Chunk length (nesting level 2)
-	if aw.err == nil {
-		_, aw.err = aw.avif.Write(jpegData)
+		aw.lastFramePos, aw.lastFrameSize, aw.lastFrameFlags = framePos, len(jpegData), flags
+		if err := aw.writeIdxEntry(aw.chunkID, flags, framePos, len(jpegData)); err != nil {
+			return err
+		}
+		if aw.ffmpeg {
+			aw.recordFFmpegFrame(len(jpegData))
+		}
+		if err := aw.writeMetadata(); err != nil {
+			return err
+		}
+		if aw.recLists {
+			if err := aw.endFrameRec(); err != nil {
+				return err
+			}
+		}
+		if aw.odml && !aw.recOpen {
+			return aw.flushODML(false)
+		}
+		return nil
+	})
+	if err != nil {
+		return fatal(err)
 	}
-	aw.finalizeLengthField() // "00dc" chunk finished (nesting level 2)
 
-	// Write index data
-	aw.writeIdxInt32(0x63643030)                   // "00dc" compressed frame
-	aw.writeIdxInt32(0x10)                         // flags: select AVIIF_KEYFRAME (The flag indicates key frames in the video sequence. Key frames do not need previous video information to be decompressed.)
-	aw.writeIdxInt32(int32(framePos - aw.moviPos)) // offset to the chunk, offset can be relative to file start or 'movi'
-	aw.writeIdxInt32(int32(len(jpegData)))         // length of the chunk
+	if aw.rate != nil {
+		aw.rate.record(len(jpegData))
+	}
+	if aw.manifest {
+		aw.hashFrame(framePos, jpegData)
+	}
+	aw.recordTimestamp()
+	if aw.proxy != nil && aw.proxy.aw != nil {
+		aw.proxy.addFrame(jpegData)
+	}
+	if aw.hooks.OnFrame != nil {
+		aw.hooks.OnFrame(FrameEvent{Frame: aw.frames - 1, Offset: framePos, Size: len(jpegData)})
+	}
 
-	return aw.err
+	return nil
 }
 
-// Close implements AviWriter.Close().
-func (aw *aviWriter) Close() (err error) {
-	defer func() {
-		aw.avif.Close()
-		aw.idxf.Close()
-		os.Remove(aw.idxFile)
-	}()
+// chunkName returns the FOURCC string of a chunk id.
+func chunkName(id int32) string {
+	return string([]byte{byte(id), byte(id >> 8), byte(id >> 16), byte(id >> 24)})
+}
+
+// writeChunk writes a chunk with the given id and data to the file.
+func (aw *aviWriter) writeChunk(id string, data []byte) error {
+	aw.rw.WriteChunk(id, data)
+	return aw.rw.Err()
+}
+
+// writeIdxEntry writes an index entry of a chunk with the given id and flags at the given file position with the given data size.
+// The entry is written to the index file with a single write.
+func (aw *aviWriter) writeIdxEntry(chunkID int32, flags IndexFlag, chunkPos int64, size int) error {
+	aw.idxEntries++
+	e := aw.idxBuf[:]
+	binary.LittleEndian.PutUint32(e[0:], uint32(chunkID))             // chunk id, e.g. "00dc" compressed frame
+	binary.LittleEndian.PutUint32(e[4:], uint32(flags))               // flags, e.g. AVIIF_KEYFRAME (The flag indicates key frames in the video sequence. Key frames do not need previous video information to be decompressed.)
+	binary.LittleEndian.PutUint32(e[8:], uint32(chunkPos-aw.moviPos)) // offset to the chunk, offset can be relative to file start or 'movi'
+	binary.LittleEndian.PutUint32(e[12:], uint32(size))               // length of the chunk
+	if _, err := aw.idxf.Write(e); err != nil {
+		return err
+	}
+
+	if aw.odml {
+		aw.addODMLEntry(chunkID, flags, chunkPos, size)
+	}
+	return nil
+}
+
+// AddImage implements AviWriter.AddImage().
+func (aw *aviWriter) AddImage(img image.Image) error {
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	if aw.paused {
+		return aw.notifyErr(aw.holdFrame())
+	}
+	queue := false
+	if aw.throttle != nil {
+		write, err := aw.admitFrame()
+		if err != nil {
+			return aw.notifyErr(err)
+		}
+		if !write {
+			if !aw.throttle.canQueue() {
+				return nil // Dropped, no need to process it
+			}
+			queue = true
+		}
+	}
+	if !queue {
+		if write, err := aw.syncFrame(); err != nil || !write {
+			return aw.notifyErr(err)
+		}
+	}
+
+	if aw.convertsRange() {
+		img = aw.convertRange(img)
+	}
+	if len(aw.transforms) > 0 {
+		img = aw.applyTransforms(img)
+	}
+	if len(aw.overlays) > 0 {
+		img = aw.applyOverlays(img)
+	}
+
+	if queue {
+		if err := aw.encode(img); err != nil {
+			return aw.notifyErr(err)
+		}
+		aw.throttle.enqueue(aw.frameBuf.Bytes(), FlagKeyFrame)
+		return nil
+	}
+
+	if aw.dedup != nil && aw.dedup.threshold > 0 {
+		// Perceptual comparison: no need to encode duplicates
+		if aw.dedup.isDupImage(img) {
+			return aw.notifyErr(aw.addDupFrame())
+		}
+		if err := aw.encode(img); err != nil {
+			return aw.notifyErr(err)
+		}
+		aw.setProxyImage(img)
+		if err := aw.addFrame(aw.frameBuf.Bytes(), FlagKeyFrame); err != nil {
+			return aw.notifyErr(err)
+		}
+		aw.dedup.written(nil)
+		return nil
+	}
 
-	aw.finalizeLengthField() // LIST 'movi' finished (nesting level 1)
+	if err := aw.encode(img); err != nil {
+		return aw.notifyErr(err)
+	}
+	aw.setProxyImage(img)
+	return aw.notifyErr(aw.addEncodedFrame(aw.frameBuf.Bytes(), FlagKeyFrame))
+}
 
-	// Write index
-	aw.writeStr("idx1") // idx1 chunk
-	var idxLength int64
-	if aw.err == nil {
-		idxLength, aw.err = aw.idxf.Seek(0, 1) // Seek relative to current pos
+// encode encodes the image into frameBuf, as JPEG (or as raw RGB if the DIB codec is used).
+func (aw *aviWriter) encode(img image.Image) error {
+	aw.frameBuf.Reset()
+	if aw.rawRGB {
+		aw.encodeRaw(img)
+		return nil
+	}
+	if aw.gray {
+		img = aw.toGray(img) // *image.Gray is encoded as a single-component JPEG
+	}
+	if aw.rate != nil {
+		aw.quality = aw.rate.adjust(aw.quality)
+	}
+	if aw.color.Range == RangeFull {
+		return aw.encodeJFIF(img)
+	}
+	return aw.encodeJPEG(&aw.frameBuf, img)
+}
+
+// writeIdx writes the idx1 chunk at the current position, copying the temporary index data.
+func (aw *aviWriter) writeIdx() error {
+	aw.writeStr("idx1")                  // idx1 chunk
+	idxLength, err := aw.idxf.Seek(0, 1) // Seek relative to current pos
+	if err != nil {
+		return err
 	}
 	aw.writeInt32(int32(idxLength)) // Chunk length (we know its size, no need to use writeLengthField() and finalizeLengthField() pair)
 	// Copy temporary index data
-	if aw.err == nil {
-		_, aw.err = aw.idxf.Seek(0, 0)
+	if _, err = aw.idxf.Seek(0, 0); err != nil {
+		return err
 	}
-	if aw.err == nil {
-		_, aw.err = io.Copy(aw.avif, aw.idxf)
+	if _, err = io.Copy(aw.rw, aw.idxf); err != nil {
+		return err
 	}
+	return aw.rw.Err()
+}
 
-	pos := aw.currentPos()
-	aw.seek(aw.framesCountFieldPos, 0)
-	aw.writeInt32(int32(aw.frames))
-	aw.seek(aw.framesCountFieldPos2, 0)
-	aw.writeInt32(int32(aw.frames))
-	aw.seek(pos, 0)
+// Close implements AviWriter.Close().
+func (aw *aviWriter) Close() error {
+	if !aw.closed {
+		aw.closed = true
+		aw.closeErr = aw.close()
+	}
+	return aw.closeErr
+}
 
-	aw.finalizeLengthField() // 'RIFF' File finished (nesting level 0)
+// close finalizes and closes the avi file, and removes the temporary files.
+// Cleanup is attempted even if finalizing fails, all failures are reported.
+func (aw *aviWriter) close() error {
+	err := aw.finalizeErr
+	if !aw.finalized {
+		err = aw.finalize()
+	}
+	err = joinCleanupErrs(err, aw.cleanup())
 
-	return aw.err
+	if aw.hooks.OnClose != nil {
+		aw.hooks.OnClose(CloseEvent{Frames: aw.frames, Size: aw.currentPos(), Err: err})
+	}
+	return aw.notifyErr(err)
+}
+
+// cleanup closes the files of the writer and removes the temporary files, and returns the errors of all steps.
+func (aw *aviWriter) cleanup() []error {
+	errs := []error{aw.closeMmap()}
+	if aw.avifName != "" {
+		errs = append(errs, aw.avif.Close())
+	}
+	if aw.dst != nil {
+		errs = append(errs, os.Remove(aw.avifName))
+	}
+	return append(errs, aw.removeIdx())
+}
+
+// finalize finalizes the avi file: writes the index and the sidecar files, and updates the headers.
+// The proxy video is closed even if finalizing fails.
+func (aw *aviWriter) finalize() error {
+	err := aw.finalizeFile()
+	if aw.proxy != nil && aw.proxy.aw != nil {
+		if perr := aw.proxy.close(); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// finalizeFile writes the queued frames, the index and the sidecar files, and updates the headers.
+func (aw *aviWriter) finalizeFile() error {
+	if aw.throttle != nil && aw.err == nil {
+		if err := aw.flushThrottle(); err != nil && err != ErrNoSpace {
+			return err
+		}
+	}
+	if aw.err != nil && aw.err != ErrNoSpace {
+		return aw.err
+	}
+	// If the disk got full, the failed operation has been rolled back: finalize the file with the data written so far.
+	// Writes are retried according to the retry policy (if any).
+	// If the disk is full, data that doesn't fit is dropped, so that at least a valid file remains.
+	if aw.recOpen {
+		if _, err := aw.salvage(aw.endRec); err != nil {
+			return err
+		}
+	}
+	if aw.odml {
+		if _, err := aw.salvage(func() error { return aw.flushODML(true) }); err != nil {
+			return err
+		}
+	}
+	if err := aw.do(aw.pop); err != nil { // LIST 'movi' finished (nesting level 1)
+		return err
+	}
+
+	// Write index (into the reserved space if it fits)
+	hasIdx, err := aw.salvage(func() error {
+		if ok, err := aw.writeReservedIdx(); ok || err != nil {
+			return err
+		}
+		return aw.writeIdx()
+	})
+	if err != nil {
+		return err
+	}
+	if len(aw.customChunks) > 0 {
+		if _, err := aw.salvage(aw.writeTrailingChunks); err != nil {
+			return err
+		}
+	}
+
+	err = aw.do(func() error {
+		pos := aw.currentPos()
+		if !hasIdx {
+			aw.seek(aw.framesCountFieldPos-4, 0)
+			aw.writeInt32(aw.aviFlags() &^ 0x10) // dwFlags without AVIF_HASINDEX
+		}
+		aw.seek(aw.framesCountFieldPos, 0)
+		aw.writeInt32(int32(aw.frames))
+		aw.seek(aw.framesCountFieldPos2, 0)
+		aw.writeInt32(int32(aw.frames))
+		if aw.metaStream {
+			aw.seek(aw.metaLengthFieldPos, 0)
+			aw.writeInt32(int32(aw.frames))
+		}
+		aw.seek(pos, 0)
+		if aw.hasPoster {
+			aw.finalizePoster()
+		}
+		if aw.audio != nil {
+			aw.finalizeAudio()
+		}
+		if len(aw.videoStreams) > 0 {
+			aw.finalizeVideoStreams()
+		}
+		if aw.odml {
+			aw.finalizeODML()
+		}
+		if aw.ffmpeg {
+			aw.finalizeFFmpeg()
+		}
+		return aw.rw.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := aw.do(aw.pop); err != nil { // 'RIFF' File finished (nesting level 0)
+		return err
+	}
+	if err := aw.closeMmap(); err != nil {
+		return err
+	}
+
+	if len(aw.annotations) > 0 {
+		if err := aw.writeSRT(); err != nil {
+			return err
+		}
+	}
+	if aw.manifest {
+		if err := aw.writeManifest(); err != nil {
+			return err
+		}
+	}
+	if len(aw.timestamps) > 0 {
+		if err := aw.writeTimestamps(); err != nil {
+			return err
+		}
+	}
+	if aw.dst != nil {
+		return aw.copyToDst()
+	}
+	return nil
 }
@@ -0,0 +1,89 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"path/filepath"
+	"testing"
+)
+
+// Dimensions of the small test frames.
+const smallWidth, smallHeight = 64, 48
+
+// testFrames returns n distinct small JPEG encoded test frames.
+func testFrames(tb testing.TB, n int) [][]byte {
+	frames := make([][]byte, n)
+	for i := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, smallWidth, smallHeight))
+		for y := 0; y < smallHeight; y++ {
+			for x := 0; x < smallWidth; x++ {
+				img.Set(x, y, color.RGBA{uint8(x*2 + i*40), uint8(y * 5), uint8(i * 40), 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			tb.Fatal(err)
+		}
+		frames[i] = buf.Bytes()
+	}
+	return frames
+}
+
+// writeTestVideo writes the frames into a video in dir with the given options, and returns its name.
+func writeTestVideo(tb testing.TB, dir string, frames [][]byte, opts ...Option) string {
+	name := filepath.Join(dir, "test.avi")
+	aw, err := New(name, smallWidth, smallHeight, 10, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, data := range frames {
+		if err := aw.AddFrame(data); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return name
+}
+
+// checkFrames reads back the frames of the video aviFile, and checks that they are the expected ones.
+func checkFrames(tb testing.TB, aviFile string, want [][]byte) {
+	tb.Helper()
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ar.Close()
+	if n := ar.Info().Frames; n != len(want) {
+		tb.Fatalf("got %d frames, want %d", n, len(want))
+	}
+	for i, w := range want {
+		data, err := ar.Frame(i)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if !bytes.Equal(data, w) {
+			tb.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+// TestWriteRead checks that the frames of a written video are read back.
+func TestWriteRead(t *testing.T) {
+	frames := testFrames(t, 5)
+	name := writeTestVideo(t, t.TempDir(), frames)
+	checkFrames(t, name, frames)
+
+	ar, err := NewReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	info := ar.Info()
+	if info.Width != smallWidth || info.Height != smallHeight || info.FPS() != 10 || info.Codec != "MJPG" {
+		t.Errorf("got info %+v", info)
+	}
+}
@@ -0,0 +1,156 @@
+package mjpeg
+
+import (
+	"io"
+	"math"
+	"os"
+
+	"github.com/icza/mjpeg/riff"
+)
+
+// WithMmap returns an Option which makes the writer write the video through a memory mapping of the file
+// (where supported, the option has no effect elsewhere): frames are copied into the mapped region,
+// and sizes and header fields are back-patched in memory, eliminating the seek and write system calls
+// per chunk. This is useful at high frame rates (e.g. 120 fps screen capture).
+//
+// The file is grown in large steps (space is preallocated where possible, so a full disk is reported
+// as an error as usual), and is truncated to its final size when the video is closed.
+// If the file grows too large to be mapped (beyond 2 GB on 32-bit platforms), the rest is written without mapping.
+// Only videos written to a file are mapped (not videos spooled to a temporary file by NewWriter()).
+func WithMmap() Option {
+	return func(aw *aviWriter) {
+		aw.mmap = true
+	}
+}
+
+// newRIFFWriter returns the RIFF writer writing avif, through a memory mapping if enabled and supported
+// (or writing out if the destination is not a file).
+func (aw *aviWriter) newRIFFWriter() *riff.Writer {
+	if aw.out != nil {
+		return riff.NewWriter(aw.wrapEncryption(aw.out))
+	}
+	if aw.mmap && aw.dst == nil {
+		if pos, err := aw.avif.Seek(0, io.SeekCurrent); err == nil {
+			if mw, err := newMmapWriter(aw.avif, pos); err == nil {
+				aw.mw = mw
+				return riff.NewWriter(aw.wrapEncryption(mw))
+			}
+		}
+	}
+	return riff.NewWriter(aw.wrapEncryption(aw.avif))
+}
+
+// closeMmap closes the memory mapping of avif (if any), truncating the file to the written size.
+func (aw *aviWriter) closeMmap() error {
+	if aw.mw == nil {
+		return nil
+	}
+	err := aw.mw.close()
+	aw.mw = nil
+	return err
+}
+
+// Minimum and maximum steps by which mapped files are grown (else the size is doubled).
+const (
+	mmapMinGrowStep = 64 << 10
+	mmapGrowStep    = 256 << 20
+)
+
+// mmapMaxSize is the maximum size of a mapping, limited by the address space (2 GB on 32-bit platforms).
+var mmapMaxSize int64 = math.MaxInt
+
+// mmapWriter is an io.WriteSeeker writing a file through a memory mapping.
+type mmapWriter struct {
+	// f is the mapped file
+	f *os.File
+	// data is the mapped region (from the start of the file)
+	data []byte
+	// pos is the current position
+	pos int64
+	// size is the size of the written data
+	size int64
+	// unmapped tells if the file grew too large to be mapped, and is written directly
+	unmapped bool
+}
+
+// Write implements io.Writer.
+func (mw *mmapWriter) Write(p []byte) (int, error) {
+	end := mw.pos + int64(len(p))
+	if end > int64(len(mw.data)) && !mw.unmapped {
+		if err := mw.grow(end); err != nil {
+			return 0, err
+		}
+	}
+	if mw.unmapped {
+		n, err := mw.f.WriteAt(p, mw.pos)
+		if mw.pos += int64(n); mw.pos > mw.size {
+			mw.size = mw.pos
+		}
+		return n, err
+	}
+	n := copy(mw.data[mw.pos:], p)
+	mw.pos = end
+	if end > mw.size {
+		mw.size = end
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker.
+func (mw *mmapWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += mw.pos
+	case io.SeekEnd:
+		offset += mw.size
+	}
+	if offset < 0 {
+		return mw.pos, os.ErrInvalid
+	}
+	mw.pos = offset
+	return offset, nil
+}
+
+// Truncate discards the data after the given size.
+func (mw *mmapWriter) Truncate(size int64) error {
+	if size < mw.size {
+		mw.size = size
+	}
+	return nil
+}
+
+// grow grows the file and the mapping to hold at least size bytes.
+func (mw *mmapWriter) grow(size int64) error {
+	capacity := int64(len(mw.data))
+	for capacity < size {
+		step := capacity
+		if step < mmapMinGrowStep {
+			step = mmapMinGrowStep
+		} else if step > mmapGrowStep {
+			step = mmapGrowStep
+		}
+		capacity += step
+	}
+	if err := preallocate(mw.f, capacity); err != nil {
+		// Maybe there is space for what is needed right now (e.g. the disk is almost full)
+		if capacity = size; preallocate(mw.f, capacity) != nil {
+			return err // The current mapping remains usable
+		}
+	}
+	if err := mw.unmap(); err != nil {
+		return err
+	}
+	if capacity > mmapMaxSize {
+		mw.unmapped = true // Fall back to writing the file
+		return nil
+	}
+	return mw.mmap(capacity)
+}
+
+// close unmaps the file and truncates it to the written size.
+func (mw *mmapWriter) close() error {
+	if err := mw.unmap(); err != nil {
+		return err
+	}
+	return mw.f.Truncate(mw.size)
+}
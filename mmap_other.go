@@ -0,0 +1,31 @@
+//go:build !unix
+
+package mjpeg
+
+import (
+	"errors"
+	"os"
+)
+
+// errMmapUnsupported reports if memory mapped output is not supported on the platform.
+var errMmapUnsupported = errors.New("Memory mapping unsupported")
+
+// newMmapWriter reports that memory mapped output is not supported.
+func newMmapWriter(f *os.File, pos int64) (*mmapWriter, error) {
+	return nil, errMmapUnsupported
+}
+
+// mmap reports that memory mapped output is not supported.
+func (mw *mmapWriter) mmap(size int64) error {
+	return errMmapUnsupported
+}
+
+// unmap is a no-op.
+func (mw *mmapWriter) unmap() error {
+	return nil
+}
+
+// preallocate is a no-op.
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
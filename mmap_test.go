@@ -0,0 +1,27 @@
+package mjpeg
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMmapTooLarge checks that a mapped video growing beyond the maximum size of mappings
+// is written on without mapping.
+func TestMmapTooLarge(t *testing.T) {
+	defer func(max int64) { mmapMaxSize = max }(mmapMaxSize)
+	mmapMaxSize = 128 << 10
+
+	frames := make([][]byte, 8)
+	for i := range frames {
+		frames[i] = testJPEG(t, i)
+	}
+	name := writeTestVideo(t, t.TempDir(), frames, WithMmap())
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() <= mmapMaxSize {
+		t.Fatalf("got size %d, want more than %d", fi.Size(), mmapMaxSize)
+	}
+	checkFrames(t, name, frames)
+}
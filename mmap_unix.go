@@ -0,0 +1,33 @@
+//go:build unix
+
+package mjpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// newMmapWriter returns a new mmapWriter writing f, starting at position pos.
+func newMmapWriter(f *os.File, pos int64) (*mmapWriter, error) {
+	mw := &mmapWriter{f: f, pos: pos, size: pos}
+	if err := mw.grow(pos + 1); err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+// mmap maps the first size bytes of the file (size is at most mmapMaxSize, so it fits into an int).
+func (mw *mmapWriter) mmap(size int64) (err error) {
+	mw.data, err = syscall.Mmap(int(mw.f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	return err
+}
+
+// unmap unmaps the file (if mapped).
+func (mw *mmapWriter) unmap() error {
+	if mw.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(mw.data)
+	mw.data = nil
+	return err
+}
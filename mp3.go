@@ -0,0 +1,208 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrNotMP3 reports if the input is not an MP3 file.
+var ErrNotMP3 = errors.New("Not an MP3 file")
+
+// Bitrates (in kbit/s) of MPEG audio layer III frames by bitrate index, for MPEG-1 and MPEG-2/2.5.
+var (
+	mp3Bitrates1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3Bitrates2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+)
+
+// mp3Header is the parsed header of an MPEG audio layer III frame.
+type mp3Header struct {
+	// sampleRate is the sample rate in Hz
+	sampleRate int
+	// channels is the number of channels
+	channels int
+	// samples is the number of samples per frame
+	samples int
+	// size is the size of the frame in bytes
+	size int
+	// mpeg1 tells if the frame is MPEG-1 (else MPEG-2 or 2.5)
+	mpeg1 bool
+}
+
+// parseMP3Header parses the 4-byte header of an MPEG audio layer III frame.
+func parseMP3Header(b []byte) (h mp3Header, ok bool) {
+	if b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, false // No frame sync
+	}
+	version, layer := b[1]>>3&3, b[1]>>1&3
+	brIdx, srIdx, padding := b[2]>>4, b[2]>>2&3, int(b[2]>>1&1)
+	if version == 1 || layer != 1 || brIdx == 0 || brIdx == 15 || srIdx == 3 { // Reserved, not layer III, free or bad bitrate
+		return h, false
+	}
+
+	h.sampleRate = [3]int{44100, 48000, 32000}[srIdx]
+	switch version {
+	case 3: // MPEG-1
+		h.mpeg1 = true
+	case 2: // MPEG-2
+		h.sampleRate /= 2
+	case 0: // MPEG-2.5
+		h.sampleRate /= 4
+	}
+	h.channels = 2
+	if b[3]>>6 == 3 {
+		h.channels = 1 // Mono
+	}
+	if h.mpeg1 {
+		h.samples = 1152
+		h.size = 144*1000*mp3Bitrates1[brIdx]/h.sampleRate + padding
+	} else {
+		h.samples = 576
+		h.size = 72*1000*mp3Bitrates2[brIdx]/h.sampleRate + padding
+	}
+	return h, true
+}
+
+// mp3Frame is the position and size of a frame in an MP3 file.
+type mp3Frame struct {
+	pos  int64
+	size int
+}
+
+// mp3File is an MP3 file opened for reading its frames, it implements audioSource.
+type mp3File struct {
+	// f is the file
+	f *os.File
+	// first is the header of the first frame
+	first mp3Header
+	// frames are the frames of the file
+	frames []mp3Frame
+
+	// as is the audio stream
+	as *audioStream
+	// nextFrame is the index of the next frame to return
+	nextFrame int
+	// buf is the reused buffer of frames
+	buf []byte
+}
+
+// openMP3 opens the MP3 file name, and locates its frames.
+// An ID3v2 tag at the start of the file and data which is not a frame (e.g. an ID3v1 tag) are skipped,
+// frames with a different sample rate or channel count than the first frame are dropped.
+// The first frame must be followed by another frame (or the end of the file).
+func openMP3(name string) (mf *mp3File, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+
+	hdr := make([]byte, 10)
+	pos := int64(0)
+	if _, err := f.ReadAt(hdr, 0); err == nil && string(hdr[:3]) == "ID3" {
+		// ID3v2 tag: the size is a 28-bit syncsafe integer, plus a 10-byte footer if present
+		pos = 10 + (int64(hdr[6])<<21 | int64(hdr[7])<<14 | int64(hdr[8])<<7 | int64(hdr[9]))
+		if hdr[5]&0x10 != 0 {
+			pos += 10
+		}
+	}
+
+	mf = &mp3File{f: f}
+	var bytes int64
+	for pos+4 <= size {
+		if _, err := f.ReadAt(hdr[:4], pos); err != nil && err != io.EOF {
+			return nil, err
+		}
+		h, ok := parseMP3Header(hdr)
+		if ok && len(mf.frames) > 0 && (h.sampleRate != mf.first.sampleRate || h.channels != mf.first.channels) {
+			ok = false
+		}
+		if !ok || pos+int64(h.size) > size {
+			pos++ // Resync
+			continue
+		}
+		if len(mf.frames) == 0 {
+			// Accept the first frame only if it is followed by another one (or the end), other data may look like a frame header
+			if pos+int64(h.size)+4 <= size {
+				if _, err := f.ReadAt(hdr[4:8], pos+int64(h.size)); err != nil {
+					return nil, err
+				}
+				if _, ok := parseMP3Header(hdr[4:8]); !ok {
+					pos++
+					continue
+				}
+			}
+			mf.first = h
+		}
+		mf.frames = append(mf.frames, mp3Frame{pos: pos, size: h.size})
+		bytes += int64(h.size)
+		pos += int64(h.size)
+	}
+	if len(mf.frames) == 0 {
+		return nil, ErrNotMP3
+	}
+
+	// Units are frames (of varying size if the bitrate is variable), the duration of a frame is samples/sampleRate
+	h := mf.first
+	avgBytesPerSec := bytes * int64(h.sampleRate) / (int64(len(mf.frames)) * int64(h.samples))
+	format := make([]byte, 30)                                                      // MPEGLAYER3WAVEFORMAT
+	binary.LittleEndian.PutUint16(format, 0x55)                                     // wFormatTag: WAVE_FORMAT_MPEGLAYER3
+	binary.LittleEndian.PutUint16(format[2:], uint16(h.channels))                   // nChannels
+	binary.LittleEndian.PutUint32(format[4:], uint32(h.sampleRate))                 // nSamplesPerSec
+	binary.LittleEndian.PutUint32(format[8:], uint32(avgBytesPerSec))               // nAvgBytesPerSec
+	binary.LittleEndian.PutUint16(format[12:], uint16(h.samples))                   // nBlockAlign: samples per frame (VBR style)
+	binary.LittleEndian.PutUint16(format[14:], 0)                                   // wBitsPerSample
+	binary.LittleEndian.PutUint16(format[16:], 12)                                  // cbSize: size of the extra fields
+	binary.LittleEndian.PutUint16(format[18:], 1)                                   // wID: MPEGLAYER3_ID_MPEG
+	binary.LittleEndian.PutUint32(format[20:], 0)                                   // fdwFlags: MPEGLAYER3_FLAG_PADDING_ISO
+	binary.LittleEndian.PutUint16(format[24:], uint16(bytes/int64(len(mf.frames)))) // nBlockSize: average frame size
+	binary.LittleEndian.PutUint16(format[26:], 1)                                   // nFramesPerBlock
+	binary.LittleEndian.PutUint16(format[28:], 1393)                                // nCodecDelay: the usual encoder delay
+	mf.as = &audioStream{format: format, scale: int32(h.samples), rate: int32(h.sampleRate)}
+	return mf, nil
+}
+
+// stream implements audioSource.stream().
+func (mf *mp3File) stream() *audioStream {
+	return mf.as
+}
+
+// next implements audioSource.next(). Each chunk is a frame.
+func (mf *mp3File) next(t time.Duration) ([]byte, int64, error) {
+	if mf.nextFrame >= len(mf.frames) {
+		return nil, 0, nil
+	}
+	if t != audioEnd && timestamp(mf.nextFrame*mf.first.samples, float64(mf.first.sampleRate)) >= t {
+		return nil, 0, nil
+	}
+	fr := mf.frames[mf.nextFrame]
+	mf.buf = grow(mf.buf[:0], fr.size)
+	if _, err := mf.f.ReadAt(mf.buf, fr.pos); err != nil {
+		return nil, 0, err
+	}
+	mf.nextFrame++
+	return mf.buf, 1, nil
+}
+
+// MuxMP3 writes the frames of the video aviPath and the audio of the MP3 file mp3Path into
+// a new video file outPath, like MuxWav() does. Constant and variable bitrate MPEG audio layer III files
+// are supported, each MP3 frame is written in its own chunk.
+func MuxMP3(aviPath, mp3Path, outPath string) error {
+	mf, err := openMP3(mp3Path)
+	if err != nil {
+		return err
+	}
+	defer mf.f.Close()
+	return muxAudio(aviPath, outPath, mf)
+}
@@ -0,0 +1,225 @@
+package mjpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
+)
+
+// RemuxToMP4 moves the JPEG frames of the MJPEG video in into an MP4 container written to out,
+// without re-encoding them (so quality is preserved, and it is orders of magnitude faster than transcoding).
+// The sample tables of the MP4 are built from the index of the AVI. Repeated frames (duplicate index entries
+// pointing to the same frame) are stored once, with a longer duration.
+//
+// The frames are stored as MPEG-4 visual samples coded as JPEG (object type 0x6C), like ffmpeg does.
+// Only the video stream is remuxed. ErrUnsupportedCodec is returned if the video is not MJPEG.
+func RemuxToMP4(in, out string) (err error) {
+	ar, err := NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if !strings.EqualFold(info.Codec, "MJPG") {
+		return ErrUnsupportedCodec
+	}
+	if info.Scale <= 0 || info.Rate <= 0 {
+		return ErrInvalidFPS
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(out)})
+		}
+	}()
+	w := bufio.NewWriterSize(f, 1<<20)
+
+	ftyp := mp4Box("ftyp", []byte("isom"), be32(512), []byte("isomiso2mp41"))
+	if _, err = w.Write(ftyp); err != nil {
+		return err
+	}
+	// mdat with a 64-bit size (filled when all frames are written)
+	mdatPos := int64(len(ftyp))
+	if _, err = w.Write(append(be32(1), append([]byte("mdat"), make([]byte, 8)...)...)); err != nil {
+		return err
+	}
+
+	var t mp4Track
+	pos := mdatPos + 16
+	frames := ar.(*aviReader).frames
+	for i := range frames {
+		if i > 0 && frames[i].offset == frames[i-1].offset && len(t.sizes) > 0 {
+			t.durations[len(t.durations)-1] += uint32(info.Scale) // Repeated frame
+			continue
+		}
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+		t.offsets = append(t.offsets, pos)
+		t.sizes = append(t.sizes, uint32(len(data)))
+		t.durations = append(t.durations, uint32(info.Scale))
+		pos += int64(len(data))
+	}
+
+	if _, err = w.Write(t.moov(info)); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(pos-mdatPos))
+	_, err = f.WriteAt(size[:], mdatPos+8)
+	return err
+}
+
+// mp4Track holds the sample tables of the video track of an MP4.
+type mp4Track struct {
+	// offsets are the file positions of the samples
+	offsets []int64
+	// sizes are the sizes of the samples
+	sizes []uint32
+	// durations are the durations of the samples in the media timescale
+	durations []uint32
+}
+
+// moov returns the movie box of the track.
+func (t *mp4Track) moov(info Info) []byte {
+	var duration int64 // In the media timescale (Rate)
+	for _, d := range t.durations {
+		duration += int64(d)
+	}
+	movieDur := uint32(duration * 1000 / int64(info.Rate)) // In the movie timescale (ms)
+	w, h := uint32(info.Width), uint32(info.Height)
+
+	matrix := make([]byte, 0, 36) // Unity matrix
+	for _, v := range []uint32{0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000} {
+		matrix = append(matrix, be32(v)...)
+	}
+
+	mvhd := mp4FullBox("mvhd", 0, 0,
+		be32(0), be32(0), // creation_time, modification_time
+		be32(1000), be32(movieDur), // timescale, duration
+		be32(0x10000), be16(0x100), make([]byte, 10), // rate 1.0, volume 1.0, reserved
+		matrix, make([]byte, 24), // matrix, pre_defined
+		be32(2), // next_track_ID
+	)
+	tkhd := mp4FullBox("tkhd", 0, 3, // Flags: track enabled, in movie
+		be32(0), be32(0), // creation_time, modification_time
+		be32(1), be32(0), be32(movieDur), // track_ID, reserved, duration
+		make([]byte, 8), be16(0), be16(0), be16(0), be16(0), // reserved, layer, alternate_group, volume, reserved
+		matrix, be32(w<<16), be32(h<<16), // matrix, width and height (16.16 fixed point)
+	)
+	mdhd := mp4FullBox("mdhd", 0, 0,
+		be32(0), be32(0), // creation_time, modification_time
+		be32(uint32(info.Rate)), be32(uint32(duration)), // timescale, duration
+		be16(0x55c4), be16(0), // language: "und", pre_defined
+	)
+	hdlr := mp4FullBox("hdlr", 0, 0, be32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\000"))
+
+	// Sample entry: MPEG-4 visual, JPEG object type
+	dcd := append([]byte{0x6c, 0x11}, make([]byte, 11)...) // objectTypeIndication: JPEG, streamType: visual; buffer size and bitrates: 0
+	esd := append(be16(1), 0)                              // ES_ID, flags
+	esd = append(esd, mp4Descr(4, dcd)...)
+	esd = append(esd, mp4Descr(6, []byte{2})...) // SLConfigDescriptor: predefined MP4
+	mp4v := mp4Box("mp4v",
+		make([]byte, 6), be16(1), // reserved, data_reference_index
+		make([]byte, 16), be16(uint16(w)), be16(uint16(h)), // pre_defined, reserved, width, height
+		be32(0x480000), be32(0x480000), be32(0), be16(1), // resolution: 72 dpi, reserved, frame_count
+		make([]byte, 32), be16(0x18), be16(0xffff), // compressorname, depth, pre_defined
+		mp4FullBox("esds", 0, 0, mp4Descr(3, esd)),
+	)
+	stsd := mp4FullBox("stsd", 0, 0, be32(1), mp4v)
+
+	var stts []byte
+	runs := 0
+	for i := 0; i < len(t.durations); runs++ {
+		j := i + 1
+		for j < len(t.durations) && t.durations[j] == t.durations[i] {
+			j++
+		}
+		stts = append(stts, be32(uint32(j-i))...)
+		stts = append(stts, be32(t.durations[i])...)
+		i = j
+	}
+	stsz := make([]byte, 0, 4*len(t.sizes))
+	for _, s := range t.sizes {
+		stsz = append(stsz, be32(s)...)
+	}
+	co := "stco"
+	if len(t.offsets) > 0 && t.offsets[len(t.offsets)-1] > math.MaxUint32 {
+		co = "co64"
+	}
+	stco := make([]byte, 0, 8*len(t.offsets))
+	for _, o := range t.offsets {
+		if co == "co64" {
+			stco = append(stco, be32(uint32(o>>32))...)
+		}
+		stco = append(stco, be32(uint32(o))...)
+	}
+
+	n := uint32(len(t.sizes))
+	stbl := mp4Box("stbl",
+		stsd,
+		mp4FullBox("stts", 0, 0, be32(uint32(runs)), stts),
+		mp4FullBox("stsc", 0, 0, be32(1), be32(1), be32(1), be32(1)), // One sample per chunk
+		mp4FullBox("stsz", 0, 0, be32(0), be32(n), stsz),
+		mp4FullBox(co, 0, 0, be32(n), stco),
+	) // No stss: all samples are sync samples
+	minf := mp4Box("minf",
+		mp4FullBox("vmhd", 0, 1, make([]byte, 8)),
+		mp4Box("dinf", mp4FullBox("dref", 0, 0, be32(1), mp4FullBox("url ", 0, 1))), // Data in the same file
+		stbl,
+	)
+	return mp4Box("moov", mvhd, mp4Box("trak", tkhd, mp4Box("mdia", mdhd, hdlr, minf)))
+}
+
+// mp4Box returns an MP4 box of the given type with the concatenation of parts as its payload.
+func mp4Box(typ string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = append(b, be32(uint32(size))...)
+	b = append(b, typ...)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// mp4FullBox returns an MP4 full box (a box with version and flags).
+func mp4FullBox(typ string, version byte, flags uint32, parts ...[]byte) []byte {
+	vf := be32(uint32(version)<<24 | flags)
+	return mp4Box(typ, append([][]byte{vf}, parts...)...)
+}
+
+// mp4Descr returns an MPEG-4 descriptor with the given tag and payload (of less than 128 bytes).
+func mp4Descr(tag byte, payload []byte) []byte {
+	return append([]byte{tag, byte(len(payload))}, payload...)
+}
+
+// be32 returns v encoded as big endian.
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// be16 returns v encoded as big endian.
+func be16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
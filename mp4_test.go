@@ -0,0 +1,84 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Boxes returns the payloads of the (nested) boxes of MP4 data, by their path (e.g. "moov/trak/tkhd").
+func mp4Boxes(tb testing.TB, data []byte, prefix string, boxes map[string][]byte) {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			tb.Fatalf("truncated box in %q", prefix)
+		}
+		size, typ, hdr := uint64(binary.BigEndian.Uint32(data)), string(data[4:8]), uint64(8)
+		if size == 1 {
+			size, hdr = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < hdr || size > uint64(len(data)) {
+			tb.Fatalf("invalid size of box %q in %q", typ, prefix)
+		}
+		path := prefix + typ
+		boxes[path] = data[hdr:size]
+		switch typ {
+		case "moov", "trak", "mdia", "minf", "stbl":
+			mp4Boxes(tb, data[hdr:size], path+"/", boxes)
+		}
+		data = data[size:]
+	}
+}
+
+// TestRemuxToMP4 checks that the samples of the MP4 are the frames of the video (repeated frames stored once),
+// and they decode.
+func TestRemuxToMP4(t *testing.T) {
+	f := testFrames(t, 2)
+	frames := [][]byte{f[0], f[0], f[0], f[1]}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "test.mp4")
+	if err := RemuxToMP4(writeTestVideo(t, dir, frames, WithDedup(0)), out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := map[string][]byte{}
+	mp4Boxes(t, data, "", boxes)
+	for _, path := range []string{"ftyp", "mdat", "moov/mvhd", "moov/trak/tkhd", "moov/trak/mdia/minf/stbl/stsd"} {
+		if boxes[path] == nil {
+			t.Errorf("missing box %q", path)
+		}
+	}
+
+	stbl := "moov/trak/mdia/minf/stbl/"
+	stsz, stco, stts := boxes[stbl+"stsz"], boxes[stbl+"stco"], boxes[stbl+"stts"]
+	if len(stsz) < 12 || len(stco) < 8 || len(stts) < 8 {
+		t.Fatal("missing sample tables")
+	}
+	n := int(binary.BigEndian.Uint32(stsz[8:]))
+	if n != 2 || int(binary.BigEndian.Uint32(stco[4:])) != n || len(stsz) != 12+4*n || len(stco) != 8+4*n {
+		t.Fatalf("got %d samples, want 2", n)
+	}
+	for i, want := range f {
+		size := binary.BigEndian.Uint32(stsz[12+4*i:])
+		off := binary.BigEndian.Uint32(stco[8+4*i:])
+		sample := data[off : off+size]
+		if !bytes.Equal(sample, want) {
+			t.Errorf("sample %d differs", i)
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(sample)); err != nil {
+			t.Errorf("sample %d: %v", i, err)
+		}
+	}
+	// 2 runs: 1 sample of 3 frames, 1 sample of 1 frame
+	want := []uint32{2, 1, 3, 1, 1}
+	for i, w := range want {
+		if got := binary.BigEndian.Uint32(stts[4+4*i:]); got != w {
+			t.Errorf("stts field %d: got %d, want %d", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package mjpeg
+
+import (
+	"errors"
+	"image"
+	"sync"
+)
+
+// ErrAllFailed reports if all destinations of a MultiWriter failed.
+var ErrAllFailed = errors.New("All destinations failed")
+
+// Destination is a destination of a MultiWriter.
+type Destination struct {
+	// Writer is the writer of the destination
+	Writer AviWriter
+	// Every tells to write only every Nth frame (e.g. for a low-fps preview), every frame if 0 or 1
+	Every int
+}
+
+// MultiWriter writes the same frames to multiple AviWriters (e.g. to a local file and a network copy),
+// handling the errors of the destinations independently: after its first error a destination is skipped,
+// while the others continue. Frames are written to the destinations concurrently.
+type MultiWriter struct {
+	// dests are the destinations
+	dests []Destination
+	// errs are the errors of the destinations
+	errs []error
+	// frames is the number of frames added
+	frames int
+}
+
+// NewMultiWriter returns a new MultiWriter writing to the given destinations.
+// The MultiWriter takes ownership of the writers: they are closed by MultiWriter.Close().
+func NewMultiWriter(dests ...Destination) *MultiWriter {
+	return &MultiWriter{dests: dests, errs: make([]error, len(dests))}
+}
+
+// AddFrame adds a frame from a JPEG encoded data slice to the destinations.
+// ErrAllFailed is returned if no destination remains that can be written, the errors of the destinations
+// are reported by Err().
+func (mw *MultiWriter) AddFrame(jpegData []byte) error {
+	return mw.add(func(aw AviWriter) error { return aw.AddFrame(jpegData) })
+}
+
+// AddImage adds a frame from an image to the destinations (it is encoded by each destination,
+// using its own options). See AddFrame() for the errors.
+func (mw *MultiWriter) AddImage(img image.Image) error {
+	return mw.add(func(aw AviWriter) error { return aw.AddImage(img) })
+}
+
+// add adds the next frame to the destinations using the add function.
+func (mw *MultiWriter) add(add func(aw AviWriter) error) error {
+	frame := mw.frames
+	mw.frames++
+
+	var wg sync.WaitGroup
+	for i, d := range mw.dests {
+		if mw.errs[i] != nil {
+			continue
+		}
+		if d.Every > 1 && frame%d.Every != 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, aw AviWriter) {
+			defer wg.Done()
+			mw.errs[i] = add(aw) // Each goroutine sets its own element
+		}(i, d.Writer)
+	}
+	wg.Wait()
+	return mw.result()
+}
+
+// result returns ErrAllFailed if all destinations failed.
+func (mw *MultiWriter) result() error {
+	for _, err := range mw.errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return ErrAllFailed
+}
+
+// Err returns the error of the destination with the given index, nil if it did not fail.
+func (mw *MultiWriter) Err(i int) error {
+	return mw.errs[i]
+}
+
+// Close finalizes and closes the writers of all destinations (including failed ones,
+// so they are finalized with the frames written to them). Returns ErrAllFailed if all destinations failed,
+// the errors of the destinations are reported by Err().
+func (mw *MultiWriter) Close() error {
+	var wg sync.WaitGroup
+	for i, d := range mw.dests {
+		wg.Add(1)
+		go func(i int, aw AviWriter) {
+			defer wg.Done()
+			if err := aw.Close(); mw.errs[i] == nil {
+				mw.errs[i] = err
+			}
+		}(i, d.Writer)
+	}
+	wg.Wait()
+	return mw.result()
+}
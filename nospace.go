@@ -0,0 +1,127 @@
+package mjpeg
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+// ErrNoSpace reports if the disk got full while writing.
+// The data of the failed operation (e.g. a partially written frame) is discarded, no more frames are accepted,
+// but the video can still be finalized with the frames written so far by calling Close().
+var ErrNoSpace = errors.New("No space left on device")
+
+// isNoSpace tells if err reports that the disk is full.
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || isNoSpaceOS(err)
+}
+
+// snapshot holds the state of the writer before an operation, to which it can be rolled back.
+type snapshot struct {
+	// pos is the position in the AVI file
+	pos int64
+	// openChunks are the positions of the size fields of the open chunks
+	openChunks []int64
+	// frames is the number of frames
+	frames int
+	// idxEntries is the number of index entries
+	idxEntries int
+	// meta is the length of the metadata of the next frame
+	meta int
+	// lastFramePos, lastFrameSize and lastFrameFlags describe the last written frame chunk
+	lastFramePos   int64
+	lastFrameSize  int
+	lastFrameFlags IndexFlag
+	// odml holds the state of the ODML indices
+	odml []odmlSnapshot
+	// recOpen, recCount, recPos and recIdxPos describe the current 'rec ' list
+	recOpen           bool
+	recCount          int
+	recPos, recIdxPos int64
+	// maxFrameSize and frameBytes are the frame statistics of the ffmpeg layout
+	maxFrameSize int
+	frameBytes   int64
+}
+
+// odmlSnapshot holds the state of an ODML index.
+type odmlSnapshot struct {
+	// supers is the number of super index entries
+	supers int
+	// pending is the number of pending entries
+	pending int
+}
+
+// snapshot takes the current state of the writer into aw.snap (reusing its slices), and returns it.
+func (aw *aviWriter) snapshot() *snapshot {
+	s := &aw.snap
+	*s = snapshot{
+		pos:            aw.currentPos(),
+		openChunks:     aw.rw.AppendOpenChunks(s.openChunks[:0]),
+		frames:         aw.frames,
+		idxEntries:     aw.idxEntries,
+		meta:           len(aw.meta),
+		lastFramePos:   aw.lastFramePos,
+		lastFrameSize:  aw.lastFrameSize,
+		lastFrameFlags: aw.lastFrameFlags,
+		recOpen:        aw.recOpen,
+		recCount:       aw.recCount,
+		recPos:         aw.recPos,
+		recIdxPos:      aw.recIdxPos,
+		maxFrameSize:   aw.maxFrameSize,
+		frameBytes:     aw.frameBytes,
+		odml:           s.odml[:0],
+	}
+	for _, oi := range aw.odmlIndices {
+		s.odml = append(s.odml, odmlSnapshot{supers: len(oi.supers), pending: len(oi.pending)})
+	}
+	return s
+}
+
+// checkNoSpace checks if the last operation failed with err because the disk got full, and if so,
+// rolls back the writer to the state s before the operation, and returns ErrNoSpace.
+// Else err is returned.
+func (aw *aviWriter) checkNoSpace(s *snapshot, err error) error {
+	if !isNoSpace(err) {
+		return err
+	}
+	if err = aw.rollback(s); err != nil {
+		return err
+	}
+	return ErrNoSpace
+}
+
+// rollback restores the state s of the writer, discarding the data written since.
+func (aw *aviWriter) rollback(s *snapshot) error {
+	if err := aw.rw.Rollback(s.pos, s.openChunks); err != nil {
+		return err
+	}
+	idxSize := int64(s.idxEntries) * 16
+	if err := aw.idxf.Truncate(idxSize); err != nil {
+		return err
+	}
+	if _, err := aw.idxf.Seek(idxSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Writing the metadata only reslices it to zero length, so it can be restored by reslicing
+	aw.frames, aw.idxEntries, aw.meta = s.frames, s.idxEntries, aw.meta[:s.meta]
+	aw.lastFramePos, aw.lastFrameSize, aw.lastFrameFlags = s.lastFramePos, s.lastFrameSize, s.lastFrameFlags
+	aw.recOpen, aw.recCount, aw.recPos, aw.recIdxPos = s.recOpen, s.recCount, s.recPos, s.recIdxPos
+	aw.maxFrameSize, aw.frameBytes = s.maxFrameSize, s.frameBytes
+	for i, ps := range s.odml {
+		// Flushing pending entries only reslices them to zero length, so they can be restored by reslicing
+		oi := aw.odmlIndices[i]
+		oi.supers, oi.pending = oi.supers[:ps.supers], oi.pending[:ps.pending]
+	}
+	return nil
+}
+
+// salvage calls write, and if it fails because the disk is full, discards the data written by it,
+// so the file can still be finalized without that data.
+// Returns false if the data was discarded, and the error of other failures.
+func (aw *aviWriter) salvage(write func() error) (bool, error) {
+	if err := aw.do(write); err != ErrNoSpace {
+		return true, err
+	}
+	return false, nil
+}
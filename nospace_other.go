@@ -0,0 +1,8 @@
+//go:build !windows
+
+package mjpeg
+
+// isNoSpaceOS tells if err is an OS specific disk full error (other than ENOSPC).
+func isNoSpaceOS(err error) bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package mjpeg
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/icza/mjpeg/riff"
+)
+
+// fullFile is a file on a disk with limited space: writes beyond limit fail with ENOSPC.
+type fullFile struct {
+	*os.File
+	// limit is the size of the file at which the disk gets full
+	limit int64
+}
+
+// Write implements io.Writer, writing as much as fits.
+func (f *fullFile) Write(p []byte) (int, error) {
+	pos, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if room := f.limit - pos; int64(len(p)) > room {
+		if room < 0 {
+			room = 0
+		}
+		n, _ := f.File.Write(p[:room])
+		return n, syscall.ENOSPC
+	}
+	return f.File.Write(p)
+}
+
+// TestNoSpace checks that a frame failing because the disk got full is rolled back,
+// and the video can be finalized with the frames written before.
+func TestNoSpace(t *testing.T) {
+	frames := testFrames(t, 4)
+	for _, c := range []struct {
+		name string
+		opts []Option
+		// freed tells if space is freed before finalizing (else the index doesn't fit)
+		freed bool
+	}{
+		{"plain", nil, true},
+		{"rec lists", []Option{WithRecListFrames(2)}, true},
+		{"odml", []Option{WithODMLIndex()}, true},
+		{"index omitted", nil, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "nospace.avi")
+			awr, err := New(name, smallWidth, smallHeight, 10, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames[:3] {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The disk gets full in the middle of the next frame
+			aw := awr.(*aviWriter)
+			ff := &fullFile{File: aw.avif, limit: aw.currentPos() + int64(len(frames[3])/2)}
+			rw := riff.NewWriter(ff)
+			for _, pos := range aw.rw.OpenChunks() {
+				rw.Reopen(pos)
+			}
+			aw.rw = rw
+			if err := awr.AddFrame(frames[3]); err != ErrNoSpace {
+				t.Fatalf("got error %v, want %v", err, ErrNoSpace)
+			}
+			if err := awr.AddFrame(frames[3]); err != ErrNoSpace {
+				t.Errorf("got error %v after a full disk, want %v", err, ErrNoSpace)
+			}
+
+			if c.freed {
+				ff.limit = 1 << 40
+			} else {
+				ff.limit = aw.currentPos() + 4 // Only the header of the index would fit
+			}
+			if err := awr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, name, frames[:3])
+			if ar, err := NewReader(name); err == nil {
+				if hasIdx := ar.(*aviReader).idx1Pos >= 0; hasIdx != c.freed {
+					t.Errorf("got index %t, want %t", hasIdx, c.freed)
+				}
+				ar.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package mjpeg
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isNoSpaceOS tells if err is a Windows specific disk full error.
+func isNoSpaceOS(err error) bool {
+	const errorHandleDiskFull, errorDiskFull = syscall.Errno(39), syscall.Errno(112)
+	return errors.Is(err, errorHandleDiskFull) || errors.Is(err, errorDiskFull)
+}
@@ -0,0 +1,195 @@
+/*
+Package objstore implements multipart uploads to object stores (Amazon S3 and S3 compatible stores,
+and Google Cloud Storage), so recordings can be written directly to them with mjpeg.NewStorageWriter(),
+without a local temporary file.
+
+Example recording into an S3 bucket:
+
+	up, err := objstore.NewS3(ctx, objstore.Config{
+	    Region:          "eu-central-1",
+	    Bucket:          "recordings",
+	    Key:             "cam1/2024-01-01.avi",
+	    AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+	    SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	})
+	if err != nil {
+	    // Handle error
+	}
+	aw, err := mjpeg.NewStorageWriter(up, 640, 480, 10)
+	// Add frames, then close aw to complete the upload
+*/
+package objstore
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrCompleted reports if parts are uploaded to a completed or aborted upload.
+	ErrCompleted = errors.New("Upload completed")
+
+	// ErrInvalidResponse reports an unexpected response of the store.
+	ErrInvalidResponse = errors.New("Invalid response")
+)
+
+// Config is the configuration of an upload.
+type Config struct {
+	// Endpoint is the URL of the store, e.g. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000"
+	// (for MinIO). If empty, the AWS endpoint of the region is used with virtual-hosted style URLs,
+	// else path style URLs (Endpoint/Bucket/Key) are used.
+	Endpoint string
+	// Region is the region of the bucket, e.g. "us-east-1"
+	Region string
+	// Bucket is the name of the bucket
+	Bucket string
+	// Key is the key (name) of the object to create
+	Key string
+	// AccessKeyID and SecretAccessKey are the credentials (HMAC keys for Google Cloud Storage)
+	AccessKeyID, SecretAccessKey string
+	// SessionToken is the token of temporary credentials (optional)
+	SessionToken string
+	// ContentType is the content type of the object, "video/x-msvideo" if empty
+	ContentType string
+	// Client is the HTTP client to use, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Upload is a multipart upload of an object. It implements mjpeg.Storage.
+// Its methods are safe for concurrent use.
+type Upload struct {
+	// ctx is the context of the requests
+	ctx context.Context
+	// cfg is the configuration
+	cfg Config
+	// url is the URL of the object
+	url string
+	// uploadID is the id of the multipart upload
+	uploadID string
+
+	// mu protects the fields below
+	mu sync.Mutex
+	// etags are the ETags of the uploaded parts, by part number
+	etags map[int]string
+	// done tells if the upload is completed or aborted
+	done bool
+}
+
+// NewS3 initiates a multipart upload to Amazon S3 (or to an S3 compatible store, see Config.Endpoint).
+// ctx is used for all requests of the upload.
+func NewS3(ctx context.Context, cfg Config) (*Upload, error) {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "video/x-msvideo"
+	}
+	u := &Upload{ctx: ctx, cfg: cfg, etags: map[int]string{}}
+	key := escapePath(cfg.Key)
+	if cfg.Endpoint == "" {
+		u.url = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", cfg.Bucket, cfg.Region, key)
+	} else {
+		u.url = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + escapePath(cfg.Bucket) + "/" + key
+	}
+
+	resp, _, err := u.do(http.MethodPost, url.Values{"uploads": {""}}, nil, http.Header{"Content-Type": {cfg.ContentType}})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &result); err != nil || result.UploadID == "" {
+		return nil, ErrInvalidResponse
+	}
+	u.uploadID = result.UploadID
+	return u, nil
+}
+
+// NewGCS initiates a multipart upload to Google Cloud Storage, using its XML API
+// (HMAC keys must be given as AccessKeyID and SecretAccessKey).
+// The endpoint and region default to "https://storage.googleapis.com" and "auto".
+func NewGCS(ctx context.Context, cfg Config) (*Upload, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://storage.googleapis.com"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "auto"
+	}
+	return NewS3(ctx, cfg)
+}
+
+// UploadPart implements mjpeg.Storage.UploadPart().
+func (u *Upload) UploadPart(n int, data []byte) error {
+	u.mu.Lock()
+	done := u.done
+	u.mu.Unlock()
+	if done {
+		return ErrCompleted
+	}
+
+	q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {u.uploadID}}
+	_, h, err := u.do(http.MethodPut, q, data, nil)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.etags[n] = h.Get("ETag")
+	return nil
+}
+
+// Complete implements mjpeg.Storage.Complete().
+func (u *Upload) Complete() error {
+	u.mu.Lock()
+	if u.done {
+		u.mu.Unlock()
+		return ErrCompleted
+	}
+	u.done = true
+	type part struct {
+		PartNumber int
+		ETag       string
+	}
+	var body struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+	for n := 1; n <= len(u.etags); n++ {
+		etag, ok := u.etags[n]
+		if !ok {
+			u.mu.Unlock()
+			return fmt.Errorf("Part %d not uploaded", n)
+		}
+		body.Parts = append(body.Parts, part{PartNumber: n, ETag: etag})
+	}
+	u.mu.Unlock()
+
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, _, err := u.do(http.MethodPost, url.Values{"uploadId": {u.uploadID}}, data, http.Header{"Content-Type": {"application/xml"}})
+	if err != nil {
+		return err
+	}
+	// The request may fail after the response status is sent: the error is reported in the body
+	return responseError(resp)
+}
+
+// Abort implements mjpeg.Storage.Abort().
+func (u *Upload) Abort() error {
+	u.mu.Lock()
+	u.done = true
+	u.mu.Unlock()
+	_, _, err := u.do(http.MethodDelete, url.Values{"uploadId": {u.uploadID}}, nil, nil)
+	return err
+}
@@ -0,0 +1,168 @@
+package mjpeg
+
+import "fmt"
+
+const (
+	// odmlSuperEntries is the number of entries reserved in super indices.
+	odmlSuperEntries = 256
+	// odmlClusterSize is the (maximum) number of entries in a standard index chunk.
+	odmlClusterSize = 16384
+)
+
+// odmlStdEntry is an entry of an ODML standard index.
+type odmlStdEntry struct {
+	// offset is the position of the chunk data relative to the base offset
+	offset uint32
+	// size is the size of the chunk data, bit 31 is set if the chunk is not a key frame
+	size uint32
+}
+
+// odmlSuperEntry is an entry of an ODML super index, describing a standard index chunk.
+type odmlSuperEntry struct {
+	// offset is the file position of the standard index chunk
+	offset int64
+	// size is the size of the standard index chunk (including its header)
+	size int32
+	// duration is the number of chunks indexed by the standard index chunk
+	duration int32
+}
+
+// odmlIndex holds the ODML index state of a stream.
+type odmlIndex struct {
+	// stream is the stream number
+	stream int
+	// chunkID is the id of the chunks of the stream
+	chunkID int32
+	// superPos is the file position of the super index chunk ('indx') of the stream
+	superPos int64
+	// pending are the entries not yet written in a standard index chunk
+	pending []odmlStdEntry
+	// supers are the entries of the super index
+	supers []odmlSuperEntry
+}
+
+// WithODMLIndex returns an Option which makes the writer emit OpenDML indices ('indx' super indices
+// reserved in the stream headers, and standard index chunks 'ix##' interleaved in the movi list)
+// in addition to the legacy idx1 index, so the same file seeks well in players preferring either of them.
+func WithODMLIndex() Option {
+	return func(aw *aviWriter) {
+		aw.odml = true
+	}
+}
+
+// odmlFor returns the ODML index of the stream of the given chunk id, nil if there is none.
+func (aw *aviWriter) odmlFor(chunkID int32) *odmlIndex {
+	for _, oi := range aw.odmlIndices {
+		if oi.chunkID == chunkID {
+			return oi
+		}
+	}
+	return nil
+}
+
+// writeSuperIndex writes an empty super index chunk for the stream with the given chunk id
+// (to be filled at Close()), with space reserved for odmlSuperEntries entries.
+func (aw *aviWriter) writeSuperIndex(stream int, chunkID int32) {
+	oi := &odmlIndex{stream: stream, chunkID: chunkID}
+	aw.odmlIndices = append(aw.odmlIndices, oi)
+
+	aw.writeStr("indx")                     // super index chunk
+	aw.writeInt32(24 + odmlSuperEntries*16) // Chunk size
+	oi.superPos = aw.currentPos()
+	aw.writeInt16(4)              // wLongsPerEntry
+	aw.writeInt16(0x00 | 0x00<<8) // bIndexSubType: 0, bIndexType: AVI_INDEX_OF_INDEXES
+	aw.writeInt32(0)              // nEntriesInUse (filled at Close())
+	aw.writeInt32(chunkID)        // dwChunkId
+	aw.writeInt32(0)              // dwReserved[3]
+	aw.writeInt32(0)
+	aw.writeInt32(0)
+	for i := 0; i < odmlSuperEntries*4; i++ { // Reserved entries: qwOffset, dwSize, dwDuration
+		aw.writeInt32(0)
+	}
+}
+
+// writeODMLHeader writes the 'odml' list with the extended AVI header.
+func (aw *aviWriter) writeODMLHeader() {
+	aw.pushList("odml") // LIST chunk: extended AVI header (nesting level 2)
+	aw.writeStr("dmlh") // Extended AVI header
+	aw.writeInt32(248)  // Chunk size
+	aw.dmlhFramesPos = aw.currentPos()
+	for i := 0; i < 248/4; i++ {
+		aw.writeInt32(0) // dwTotalFrames (filled at Close()), rest is reserved
+	}
+	aw.pop() // LIST 'odml' finished (nesting level 2)
+}
+
+// addODMLEntry records an ODML standard index entry for the chunk
+// with the given id, flags, position and data size.
+func (aw *aviWriter) addODMLEntry(chunkID int32, flags IndexFlag, chunkPos int64, size int) {
+	oi := aw.odmlFor(chunkID)
+	if oi == nil {
+		return
+	}
+	e := odmlStdEntry{offset: uint32(chunkPos + 8 - aw.moviPos), size: uint32(size)}
+	if flags&FlagKeyFrame == 0 {
+		e.size |= 0x80000000
+	}
+	oi.pending = append(oi.pending, e)
+}
+
+// flushODML writes the standard index chunks of streams whose pending entries reached the cluster size,
+// or of all streams with pending entries if force is true.
+func (aw *aviWriter) flushODML(force bool) error {
+	rw := aw.rw
+	for _, oi := range aw.odmlIndices {
+		if len(oi.pending) == 0 || !force && len(oi.pending) < odmlClusterSize {
+			continue
+		}
+		if len(oi.supers) == odmlSuperEntries {
+			return aw.tooLarge("ODML super index")
+		}
+
+		pos := aw.currentPos()
+		rw.PushChunk(fmt.Sprintf("ix%02d", oi.stream)) // standard index chunk (nesting level 2)
+		rw.WriteUint16(2)                              // wLongsPerEntry
+		rw.WriteUint16(0x00 | 0x01<<8)                 // bIndexSubType: 0, bIndexType: AVI_INDEX_OF_CHUNKS
+		rw.WriteUint32(uint32(len(oi.pending)))        // nEntriesInUse
+		rw.WriteUint32(uint32(oi.chunkID))             // dwChunkId
+		rw.WriteUint32(uint32(aw.moviPos))             // qwBaseOffset, offsets are relative to this
+		rw.WriteUint32(uint32(aw.moviPos >> 32))
+		rw.WriteUint32(0) // dwReserved
+		for _, e := range oi.pending {
+			rw.WriteUint32(uint32(e.offset)) // dwOffset
+			rw.WriteUint32(uint32(e.size))   // dwSize, bit 31 set if not a key frame
+		}
+		rw.Pop() // 'ix##' chunk finished (nesting level 2)
+		if err := rw.Err(); err != nil {
+			return err
+		}
+
+		oi.supers = append(oi.supers, odmlSuperEntry{
+			offset:   pos,
+			size:     int32(aw.currentPos() - pos),
+			duration: int32(len(oi.pending)),
+		})
+		oi.pending = oi.pending[:0]
+	}
+	return nil
+}
+
+// finalizeODML fills the super indices and the extended AVI header.
+// Must be called after the last standard index chunks have been written.
+func (aw *aviWriter) finalizeODML() {
+	pos := aw.currentPos()
+	for _, oi := range aw.odmlIndices {
+		aw.seek(oi.superPos+4, 0)
+		aw.writeInt32(int32(len(oi.supers))) // nEntriesInUse
+		aw.seek(oi.superPos+24, 0)
+		for _, se := range oi.supers {
+			aw.writeInt32(int32(se.offset)) // qwOffset
+			aw.writeInt32(int32(se.offset >> 32))
+			aw.writeInt32(se.size)     // dwSize
+			aw.writeInt32(se.duration) // dwDuration
+		}
+	}
+	aw.seek(aw.dmlhFramesPos, 0)
+	aw.writeInt32(int32(aw.frames)) // dwTotalFrames
+	aw.seek(pos, 0)
+}
@@ -0,0 +1,23 @@
+package mjpeg
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestODMLIndex checks that videos with OpenDML indices are read back, and have the indices.
+func TestODMLIndex(t *testing.T) {
+	frames := testFrames(t, 5)
+	name := writeTestVideo(t, t.TempDir(), frames, WithODMLIndex())
+	checkFrames(t, name, frames)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"indx", "ix00", "odml", "idx1"} {
+		if !bytes.Contains(data, []byte(id)) {
+			t.Errorf("no %q chunk", id)
+		}
+	}
+}
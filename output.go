@@ -0,0 +1,25 @@
+package mjpeg
+
+import (
+	"io"
+	"os"
+)
+
+// isSeekable tells if the video can be written to f directly: if it is a regular file which can be seeked.
+func isSeekable(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	_, err = f.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+// copyToDst copies the finished video from the temporary file to dst.
+func (aw *aviWriter) copyToDst() error {
+	if _, err := aw.avif.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(aw.dst, aw.avif)
+	return err
+}
@@ -0,0 +1,42 @@
+package mjpeg
+
+import "fmt"
+
+// maxFileSize is the maximum size of video files: sizes and offsets in AVI files are 32 bit
+// (2^32 = 4 294 967 296, a safety margin is kept below that).
+const maxFileSize = 4200000000
+
+// SizeError describes why the video can't grow further without overflowing a 32-bit field of the AVI format
+// (which would corrupt the whole file), after ErrTooLarge is returned, see AviWriter.TooLarge().
+// errors.Is(err, ErrTooLarge) reports true for it.
+// The video can still be finalized with Close(), and recording may continue in a new video.
+type SizeError struct {
+	// Field is the field that would overflow, e.g. "RIFF size"
+	Field string
+	// Frames is the number of frames that fit (the number of frames written)
+	Frames int
+	// Size is the number of bytes that fit (the size of the file written so far)
+	Size int64
+}
+
+// Error implements error.
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("Video file too large: the %s would overflow 32 bits, %d frames (%d bytes) fit; finalize the video and continue in a new one",
+		e.Field, e.Frames, e.Size)
+}
+
+// Is tells if target is ErrTooLarge.
+func (e *SizeError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+// TooLarge implements AviWriter.TooLarge().
+func (aw *aviWriter) TooLarge() *SizeError {
+	return aw.sizeErr
+}
+
+// tooLarge records the SizeError of the given field, and returns ErrTooLarge.
+func (aw *aviWriter) tooLarge(field string) error {
+	aw.sizeErr = &SizeError{Field: field, Frames: aw.frames, Size: aw.currentPos()}
+	return ErrTooLarge
+}
@@ -0,0 +1,37 @@
+package mjpeg
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// TestTooLarge checks that ErrTooLarge is returned when a field would overflow, and TooLarge() describes it.
+func TestTooLarge(t *testing.T) {
+	frames := testFrames(t, 2)
+	awr, err := New(filepath.Join(t.TempDir(), "large.avi"), smallWidth, smallHeight, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer awr.Close()
+	if err := awr.AddFrame(frames[0]); err != nil {
+		t.Fatal(err)
+	}
+	if se := awr.TooLarge(); se != nil {
+		t.Errorf("got %v before ErrTooLarge", se)
+	}
+
+	aw := awr.(*aviWriter)
+	aw.frames = math.MaxInt32 // Pretend the frame count is full
+	if err := awr.AddFrame(frames[1]); err != ErrTooLarge {
+		t.Fatalf("got error %v, want %v", err, ErrTooLarge)
+	}
+	aw.frames = 1
+	se := awr.TooLarge()
+	if se == nil || se.Field != "frame count" || se.Frames != math.MaxInt32 || se.Size != aw.currentPos() {
+		t.Errorf("got %+v", se)
+	}
+	if err := awr.AddFrame(frames[1]); err != nil {
+		t.Errorf("got error %v after ErrTooLarge, frames still fit", err)
+	}
+}
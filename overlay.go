@@ -0,0 +1,192 @@
+package mjpeg
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+// Overlay is a per-frame filter which draws onto frames added with AddImage(), before they are encoded.
+// frameNo is the (zero-based) index of the frame in the video, t is its timestamp based on the FPS.
+type Overlay func(img draw.Image, frameNo int, t time.Duration)
+
+// WithOverlay returns an Option which adds an overlay to the writer.
+// Multiple overlays may be added, they are applied in the order they were added.
+//
+// Overlays are applied to images added with AddImage() only,
+// frames added as JPEG data with AddFrame() are written unaltered.
+func WithOverlay(o Overlay) Option {
+	return func(aw *aviWriter) {
+		aw.overlays = append(aw.overlays, o)
+	}
+}
+
+// Corner is a corner of the frame, used to position overlays.
+type Corner int
+
+const (
+	// TopLeft is the top-left corner.
+	TopLeft Corner = iota
+	// TopRight is the top-right corner.
+	TopRight
+	// BottomLeft is the bottom-left corner.
+	BottomLeft
+	// BottomRight is the bottom-right corner.
+	BottomRight
+)
+
+// position returns the top-left point of a rectangle of the given size
+// placed in corner c of bounds, moved inside by offset.
+func (c Corner) position(bounds image.Rectangle, size, offset image.Point) image.Point {
+	pt := bounds.Min.Add(offset)
+	if c == TopRight || c == BottomRight {
+		pt.X = bounds.Max.X - offset.X - size.X
+	}
+	if c == BottomLeft || c == BottomRight {
+		pt.Y = bounds.Max.Y - offset.Y - size.Y
+	}
+	return pt
+}
+
+// Colors of the text overlays.
+var (
+	labelFg = color.RGBA{255, 255, 255, 255}
+	labelBg = color.RGBA{0, 0, 0, 160}
+)
+
+// TextOverlay returns an Overlay which draws the text returned by the text function
+// in the given corner of frames, on a semi-transparent background.
+// The text size is chosen based on the frame height.
+func TextOverlay(corner Corner, text func(frameNo int, t time.Duration) string) Overlay {
+	return func(img draw.Image, frameNo int, t time.Duration) {
+		s := text(frameNo, t)
+		if s == "" {
+			return
+		}
+		b := img.Bounds()
+		scale := labelScale(b)
+		size := textSize(s, scale)
+		pt := corner.position(b, size, image.Pt(2*scale, 2*scale))
+		drawLabel(img, pt, s, scale, labelFg, labelBg)
+	}
+}
+
+// labelScale returns the font scale to use for labels on frames of the given bounds.
+func labelScale(b image.Rectangle) int {
+	if scale := b.Dy() / 120; scale > 1 {
+		return scale
+	}
+	return 1
+}
+
+// TimecodeOverlay returns an Overlay which burns the timecode of frames in the given corner,
+// in the form of HH:MM:SS:FF, where FF is the frame number within the second.
+func TimecodeOverlay(corner Corner, fps int32) Overlay {
+	return TimecodeOverlayFrom(corner, Timecode{}, fps)
+}
+
+// TimecodeOverlayFrom returns an Overlay which burns the timecode of frames in the given corner,
+// counted from the starting timecode start (see WithTimecode()).
+func TimecodeOverlayFrom(corner Corner, start Timecode, fps int32) Overlay {
+	return TextOverlay(corner, func(frameNo int, t time.Duration) string {
+		return start.Add(frameNo, fps).String()
+	})
+}
+
+// ClockOverlay returns an Overlay which burns the current wall-clock time in the given corner,
+// formatted with the given layout (see time.Time.Format()), e.g. "2006-01-02 15:04:05".
+//
+// The time is taken when the frame is added, which is what security cameras usually need.
+func ClockOverlay(corner Corner, layout string) Overlay {
+	return TextOverlay(corner, func(frameNo int, t time.Duration) string {
+		return time.Now().Format(layout)
+	})
+}
+
+// applyOverlays copies img to the reused filter image and draws the overlays onto it.
+func (aw *aviWriter) applyOverlays(img image.Image) image.Image {
+	aw.filterImg = copyToRGBA(aw.filterImg, img)
+
+	frameNo := aw.frames
+	t := aw.frameTime(frameNo)
+	for _, o := range aw.overlays {
+		o(aw.filterImg, frameNo, t)
+	}
+	return aw.filterImg
+}
+
+// copyToRGBA copies img into dst, reallocating dst if its size does not match.
+func copyToRGBA(dst *image.RGBA, img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if dst == nil || dst.Rect != b {
+		dst = image.NewRGBA(b)
+	}
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst
+}
+
+// frameTime returns the timestamp of the given frame based on the FPS.
+func (aw *aviWriter) frameTime(frameNo int) time.Duration {
+	if aw.fps <= 0 {
+		return 0
+	}
+	// Split into whole and fractional seconds, so long videos with large scales don't overflow
+	units, fps := time.Duration(frameNo)*time.Duration(aw.scale), time.Duration(aw.fps)
+	return units/fps*time.Second + units%fps*time.Second/fps
+}
+
+// frameRate returns the frame rate of the video in frames per second.
+func (aw *aviWriter) frameRate() float64 {
+	return float64(aw.fps) / float64(aw.scale)
+}
+
+// Watermark returns an Overlay which alpha-composites the logo image onto frames,
+// placed in the given corner, moved inside by offset.
+// opacity is applied on top of the logo's own alpha channel, in the range of 0 (invisible) to 1 (opaque).
+func Watermark(logo image.Image, corner Corner, offset image.Point, opacity float64) Overlay {
+	if opacity < 0 {
+		opacity = 0
+	} else if opacity > 1 {
+		opacity = 1
+	}
+	mask := image.NewUniform(color.Alpha{uint8(opacity*255 + 0.5)})
+	lb := logo.Bounds()
+
+	return func(img draw.Image, frameNo int, t time.Duration) {
+		pt := corner.position(img.Bounds(), lb.Size(), offset)
+		r := image.Rectangle{Min: pt, Max: pt.Add(lb.Size())}
+		draw.DrawMask(img, r, logo, lb.Min, mask, image.Point{}, draw.Over)
+	}
+}
+
+// PictureInPicture returns an Overlay which draws the frames of a secondary source (e.g. a webcam)
+// onto the frames (e.g. a screen capture) in the given corner, moved inside by margin pixels.
+// The inset is scaled to scale times the frame width (e.g. 0.25), keeping the aspect ratio of the secondary frames.
+//
+// secondary is called for each frame and should return the latest frame of the secondary source,
+// nil to leave the frame alone (e.g. before the first secondary frame arrives).
+// Secondary frames are usually produced in another goroutine, so secondary must be safe for concurrent use.
+func PictureInPicture(secondary func(frameNo int, t time.Duration) image.Image, corner Corner, scale float64, margin int) Overlay {
+	var src *image.RGBA // The reused copy of the secondary frame
+	return func(img draw.Image, frameNo int, t time.Duration) {
+		sec := secondary(frameNo, t)
+		if sec == nil {
+			return
+		}
+		sb, b := sec.Bounds(), img.Bounds()
+		w := int(float64(b.Dx())*scale + 0.5)
+		if w < 1 || sb.Dx() < 1 || sb.Dy() < 1 {
+			return
+		}
+		h := w * sb.Dy() / sb.Dx()
+		if h < 1 {
+			h = 1
+		}
+		src = copyToRGBA(src, sec)
+		inset := resizeBox(src, w, h)
+
+		pt := corner.position(b, inset.Rect.Size(), image.Pt(margin, margin))
+		draw.Draw(img, image.Rectangle{Min: pt, Max: pt.Add(inset.Rect.Size())}, inset, image.Point{}, draw.Src)
+	}
+}
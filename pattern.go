@@ -0,0 +1,235 @@
+package mjpeg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"time"
+)
+
+// Pattern is a synthetic test pattern to generate frames from.
+type Pattern int
+
+const (
+	// PatternColorBars is the SMPTE color bars pattern with a moving marker.
+	PatternColorBars Pattern = iota
+	// PatternGradient is a gradient that moves horizontally as frames advance.
+	PatternGradient
+	// PatternCounter shows the frame number and the frame timestamp.
+	PatternCounter
+)
+
+// SMPTE color bar colors.
+var (
+	smpteTop = []color.RGBA{
+		{191, 191, 191, 255}, // gray
+		{191, 191, 0, 255},   // yellow
+		{0, 191, 191, 255},   // cyan
+		{0, 191, 0, 255},     // green
+		{191, 0, 191, 255},   // magenta
+		{191, 0, 0, 255},     // red
+		{0, 0, 191, 255},     // blue
+	}
+	smpteMiddle = []color.RGBA{
+		{0, 0, 191, 255},     // blue
+		{19, 19, 19, 255},    // black
+		{191, 0, 191, 255},   // magenta
+		{19, 19, 19, 255},    // black
+		{0, 191, 191, 255},   // cyan
+		{19, 19, 19, 255},    // black
+		{191, 191, 191, 255}, // gray
+	}
+	smpteMinusI = color.RGBA{0, 33, 76, 255}
+	smpteWhite  = color.RGBA{255, 255, 255, 255}
+	smptePlusQ  = color.RGBA{50, 0, 106, 255}
+	smpteBlack  = color.RGBA{19, 19, 19, 255}
+	smpteSub    = color.RGBA{9, 9, 9, 255}    // PLUGE: below black
+	smpteAbove  = color.RGBA{29, 29, 29, 255} // PLUGE: above black
+)
+
+// patternSource is a FrameSource generating a synthetic test pattern.
+type patternSource struct {
+	// pattern is the pattern to generate
+	pattern Pattern
+	// fps is the frame rate, used to calculate frame timestamps
+	fps int32
+	// frames is the number of frames to generate, 0 means unlimited
+	frames int
+
+	// frame is the index of the next frame
+	frame int
+	// img is the image reused for all frames
+	img *image.RGBA
+	// bg is the static background of the pattern (if the pattern has one)
+	bg *image.RGBA
+}
+
+// NewPatternSource returns a FrameSource which generates frames of the given test pattern.
+// frames is the number of frames to generate, after which NextFrame() returns io.EOF;
+// 0 means the source never runs out of frames.
+// fps is used to calculate the timestamps of frames (shown on PatternCounter frames).
+//
+// Pattern sources are useful to create known-good videos for player compatibility testing.
+func NewPatternSource(p Pattern, width, height, fps int32, frames int) FrameSource {
+	ps := &patternSource{
+		pattern: p,
+		fps:     fps,
+		frames:  frames,
+		img:     image.NewRGBA(image.Rect(0, 0, int(width), int(height))),
+	}
+	if p == PatternColorBars {
+		ps.bg = image.NewRGBA(ps.img.Rect)
+		drawColorBars(ps.bg)
+	}
+	return ps
+}
+
+// NextFrame implements FrameSource.NextFrame().
+func (ps *patternSource) NextFrame() (image.Image, error) {
+	if ps.frames > 0 && ps.frame >= ps.frames {
+		return nil, io.EOF
+	}
+
+	switch ps.pattern {
+	case PatternColorBars:
+		ps.drawColorBarsFrame()
+	case PatternGradient:
+		ps.drawGradientFrame()
+	case PatternCounter:
+		ps.drawCounterFrame()
+	default:
+		return nil, fmt.Errorf("Unknown pattern: %d", ps.pattern)
+	}
+
+	ps.frame++
+	return ps.img, nil
+}
+
+// timestamp returns the timestamp of the current frame.
+func (ps *patternSource) timestamp() time.Duration {
+	if ps.fps <= 0 {
+		return 0
+	}
+	return time.Duration(ps.frame) * time.Second / time.Duration(ps.fps)
+}
+
+// drawColorBars draws the SMPTE color bars onto img.
+func drawColorBars(img *image.RGBA) {
+	b := img.Rect
+	w, h := b.Dx(), b.Dy()
+	fill := func(x0, y0, x1, y1 int, c color.Color) {
+		draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+
+	// Top 2/3: the 7 main bars; next 1/12: the castellations; bottom 1/4: PLUGE row
+	y1, y2 := h*2/3, h*3/4
+	for i, c := range smpteTop {
+		fill(i*w/7, 0, (i+1)*w/7, y1, c)
+	}
+	for i, c := range smpteMiddle {
+		fill(i*w/7, y1, (i+1)*w/7, y2, c)
+	}
+
+	// Bottom row: -I, white, +Q, black take 5/4 bars each, then the PLUGE and black.
+	bottom := []color.RGBA{smpteMinusI, smpteWhite, smptePlusQ, smpteBlack}
+	for i, c := range bottom {
+		fill(i*w*5/28, y2, (i+1)*w*5/28, h, c)
+	}
+	x := w * 5 / 7
+	pluge := []color.RGBA{smpteSub, smpteBlack, smpteAbove}
+	for i, c := range pluge {
+		fill(x+i*w/21, y2, x+(i+1)*w/21, h, c)
+	}
+	fill(w*6/7, y2, w, h, smpteBlack)
+}
+
+// drawColorBarsFrame draws the next color bars frame:
+// the static bars with a small marker moving along the bottom.
+func (ps *patternSource) drawColorBarsFrame() {
+	copy(ps.img.Pix, ps.bg.Pix)
+
+	b := ps.img.Rect
+	size := b.Dy() / 16
+	if size < 2 {
+		size = 2
+	}
+	if b.Dx() <= size {
+		return
+	}
+	x := ps.frame * size % (b.Dx() - size)
+	marker := image.Rect(x, b.Max.Y-size, x+size, b.Max.Y)
+	draw.Draw(ps.img, marker, image.NewUniform(smpteWhite), image.Point{}, draw.Src)
+}
+
+// drawGradientFrame draws the next gradient frame: a horizontal hue gradient with
+// a vertical luminance ramp, shifted by a few pixels at each frame.
+func (ps *patternSource) drawGradientFrame() {
+	b := ps.img.Rect
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+	shift := ps.frame * 4
+	for y := 0; y < h; y++ {
+		lum := 255 - y*255/h
+		for x := 0; x < w; x++ {
+			r, g, bl := hueToRGB((x + shift) % w * 360 / w)
+			i := ps.img.PixOffset(x, y)
+			ps.img.Pix[i+0] = uint8(r * lum / 255)
+			ps.img.Pix[i+1] = uint8(g * lum / 255)
+			ps.img.Pix[i+2] = uint8(bl * lum / 255)
+			ps.img.Pix[i+3] = 255
+		}
+	}
+}
+
+// hueToRGB returns the fully saturated color components (0..255) for the hue (0..359 degrees).
+func hueToRGB(hue int) (r, g, b int) {
+	x := hue % 60 * 255 / 60
+	switch hue / 60 {
+	case 0:
+		return 255, x, 0
+	case 1:
+		return 255 - x, 255, 0
+	case 2:
+		return 0, 255, x
+	case 3:
+		return 0, 255 - x, 255
+	case 4:
+		return x, 0, 255
+	default:
+		return 255, 0, 255 - x
+	}
+}
+
+// drawCounterFrame draws the next counter frame: the frame number and timestamp
+// centered on a background whose shade alternates every second.
+func (ps *patternSource) drawCounterFrame() {
+	bg := color.RGBA{0, 0, 96, 255}
+	if ps.fps > 0 && ps.frame/int(ps.fps)%2 == 1 {
+		bg = color.RGBA{0, 64, 0, 255}
+	}
+	draw.Draw(ps.img, ps.img.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	t := ps.timestamp()
+	lines := []string{
+		fmt.Sprintf("#%d", ps.frame),
+		fmt.Sprintf("%02d:%02d:%02d.%03d", int(t.Hours()), int(t.Minutes())%60, int(t.Seconds())%60, t.Milliseconds()%1000),
+	}
+
+	b := ps.img.Rect
+	// Choose a scale so that the longest line fits in the frame
+	scale := b.Dx() / textSize(lines[1], 1).X * 3 / 4
+	if scale < 1 {
+		scale = 1
+	}
+	lineHeight := (glyphHeight + 2) * scale
+	y := (b.Dy() - len(lines)*lineHeight) / 2
+	for _, line := range lines {
+		size := textSize(line, scale)
+		drawText(ps.img, image.Pt((b.Dx()-size.X)/2, y), line, scale, smpteWhite)
+		y += lineHeight
+	}
+}
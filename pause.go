@@ -0,0 +1,44 @@
+package mjpeg
+
+// PausePolicy tells how the timeline of the video is handled while the writer is paused, see AviWriter.Pause().
+type PausePolicy int
+
+// Pause policies.
+const (
+	// PauseFreeze freezes the timeline: frames (and audio) added while paused are dropped,
+	// so the video continues seamlessly on resume, without a gap
+	PauseFreeze PausePolicy = iota
+	// PauseHold keeps the timeline running: each frame added while paused is replaced by a repeat of
+	// the last frame before the pause (a hold frame, written as a duplicate index entry), and audio is kept,
+	// so the video stays in sync with the wall clock
+	PauseHold
+)
+
+// WithPausePolicy returns an Option which sets how the timeline is handled while the writer is paused.
+// The default is PauseFreeze.
+func WithPausePolicy(p PausePolicy) Option {
+	return func(aw *aviWriter) {
+		aw.pausePolicy = p
+	}
+}
+
+// Pause implements AviWriter.Pause().
+func (aw *aviWriter) Pause() {
+	aw.paused = true
+}
+
+// Resume implements AviWriter.Resume().
+func (aw *aviWriter) Resume() {
+	aw.paused = false
+}
+
+// holdFrame handles a frame of the video stream added while the writer is paused:
+// the frame is dropped, and a hold frame is written if the pause policy is PauseHold.
+func (aw *aviWriter) holdFrame() error {
+	// Metadata and timestamps set for the dropped frame don't belong to the hold frame
+	aw.meta, aw.hasTimestamp = aw.meta[:0], false
+	if aw.pausePolicy != PauseHold || aw.frames == 0 {
+		return nil
+	}
+	return aw.addDupFrame()
+}
@@ -0,0 +1,82 @@
+package mjpeg
+
+import (
+	"errors"
+	"image"
+)
+
+// ErrInvalidPixels reports if a raw pixel buffer is too small for the frame size, or its stride is invalid.
+var ErrInvalidPixels = errors.New("Invalid pixel buffer")
+
+// PixelFormat is the layout of pixels in raw pixel buffers.
+type PixelFormat int
+
+// Pixel formats of raw pixel buffers.
+const (
+	// PixelRGBA is 4 bytes per pixel: red, green, blue, alpha (alpha is ignored)
+	PixelRGBA PixelFormat = iota
+	// PixelBGRA is 4 bytes per pixel: blue, green, red, alpha (alpha is ignored), e.g. of screen captures
+	PixelBGRA
+	// PixelRGB is 3 bytes per pixel: red, green, blue
+	PixelRGB
+	// PixelBGR is 3 bytes per pixel: blue, green, red, e.g. of OpenCV
+	PixelBGR
+	// PixelGray is 1 byte per pixel: luminance (Y8), e.g. of thermal and industrial cameras
+	PixelGray
+)
+
+// bytesPerPixel returns the number of bytes of a pixel.
+func (pf PixelFormat) bytesPerPixel() int {
+	switch pf {
+	case PixelRGB, PixelBGR:
+		return 3
+	case PixelGray:
+		return 1
+	}
+	return 4
+}
+
+// AddRGBA implements AviWriter.AddRGBA().
+func (aw *aviWriter) AddRGBA(pix []byte, stride int) error {
+	return aw.AddPixels(PixelRGBA, pix, stride)
+}
+
+// AddPixels implements AviWriter.AddPixels().
+func (aw *aviWriter) AddPixels(format PixelFormat, pix []byte, stride int) error {
+	w, h := int(aw.width), int(aw.height)
+	bpp := format.bytesPerPixel()
+	if stride < w*bpp || h > 0 && len(pix) < (h-1)*stride+w*bpp {
+		return aw.notifyErr(ErrInvalidPixels)
+	}
+
+	if format == PixelRGBA {
+		// Wrap the buffer in the reused image header, but don't retain it
+		aw.pixHdr.Pix, aw.pixHdr.Stride, aw.pixHdr.Rect = pix, stride, image.Rect(0, 0, w, h)
+		err := aw.AddImage(&aw.pixHdr)
+		aw.pixHdr.Pix = nil
+		return err
+	}
+	if format == PixelGray {
+		aw.grayHdr.Pix, aw.grayHdr.Stride, aw.grayHdr.Rect = pix, stride, image.Rect(0, 0, w, h)
+		err := aw.AddImage(&aw.grayHdr)
+		aw.grayHdr.Pix = nil
+		return err
+	}
+
+	if aw.pixImg == nil || aw.pixImg.Rect.Dx() != w || aw.pixImg.Rect.Dy() != h {
+		aw.pixImg = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	// Offsets of the red and blue components in a source pixel
+	r, b := 0, 2
+	if format == PixelBGRA || format == PixelBGR {
+		r, b = 2, 0
+	}
+	for y := 0; y < h; y++ {
+		src := pix[y*stride : y*stride+w*bpp]
+		dst := aw.pixImg.Pix[y*aw.pixImg.Stride : y*aw.pixImg.Stride+w*4]
+		for i, j := 0, 0; i < len(src); i, j = i+bpp, j+4 {
+			dst[j], dst[j+1], dst[j+2], dst[j+3] = src[i+r], src[i+1], src[i+b], 0xff
+		}
+	}
+	return aw.AddImage(aw.pixImg)
+}
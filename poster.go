@@ -0,0 +1,67 @@
+package mjpeg
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// posterDigits is the number of digits of the frame index in the IPST entry (fixed, so it can be patched at Close()).
+const posterDigits = 10
+
+// WithPosterFrame returns an Option which records the index of the poster (cover) frame of the video
+// in the IPST entry of the INFO list (reported by AviReader.Info()), so gallery software can show
+// consistent covers without decoding the middle of the file (see Thumbnail()).
+// Use 0 for the first frame, or a negative value for the middle frame of the video (resolved at Close()).
+// The poster frame can be changed during the recording, see AviWriter.SetPosterFrame().
+func WithPosterFrame(frame int) Option {
+	return func(aw *aviWriter) {
+		aw.poster, aw.hasPoster = frame, true
+	}
+}
+
+// SetPosterFrame implements AviWriter.SetPosterFrame().
+func (aw *aviWriter) SetPosterFrame(frame int) {
+	aw.poster = frame
+}
+
+// posterFrame returns the index of the poster frame, resolved to an existing frame.
+func (aw *aviWriter) posterFrame() int {
+	switch {
+	case aw.frames == 0:
+		return 0
+	case aw.poster < 0:
+		return aw.frames / 2
+	case aw.poster >= aw.frames:
+		return aw.frames - 1
+	}
+	return aw.poster
+}
+
+// writePosterEntry writes the IPST entry of the INFO list, if the poster frame is recorded.
+// The frame index is filled at Close().
+func (aw *aviWriter) writePosterEntry() {
+	if !aw.hasPoster {
+		return
+	}
+	aw.pushChunk("IPST")
+	aw.posterPos = aw.currentPos()
+	aw.writeStr(fmt.Sprintf("%0*d\000", posterDigits, 0)) // Zero terminated (padded to even size by pop())
+	aw.pop()
+}
+
+// finalizePoster fills the frame index of the IPST entry.
+func (aw *aviWriter) finalizePoster() {
+	pos := aw.currentPos()
+	aw.seek(aw.posterPos, 0)
+	aw.writeStr(fmt.Sprintf("%0*d", posterDigits, aw.posterFrame()))
+	aw.seek(pos, 0)
+}
+
+// parsePoster parses the frame index of an IPST entry.
+func parsePoster(s string) (frame int, ok bool) {
+	frame, err := strconv.Atoi(s)
+	if err != nil || frame < 0 {
+		return 0, false
+	}
+	return frame, true
+}
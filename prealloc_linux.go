@@ -0,0 +1,15 @@
+package mjpeg
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate allocates disk space for the file to be (at least) size bytes,
+// so writing the region later (e.g. through a memory mapping) can't fail due to a full disk.
+func preallocate(f *os.File, size int64) error {
+	if err := syscall.Fallocate(int(f.Fd()), 0, 0, size); err != syscall.EOPNOTSUPP {
+		return err
+	}
+	return f.Truncate(size) // Not supported by the file system
+}
@@ -0,0 +1,10 @@
+//go:build unix && !linux
+
+package mjpeg
+
+import "os"
+
+// preallocate grows the file to size bytes.
+func preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
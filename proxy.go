@@ -0,0 +1,203 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+)
+
+// proxy is the state of the proxy video written alongside the main video, see WithProxy().
+type proxy struct {
+	// aviFile is the name of the proxy video file
+	aviFile string
+	// factor is the downscale factor
+	factor int
+	// quality is the JPEG quality of the proxy
+	quality int
+
+	// aw is the writer of the proxy
+	aw *aviWriter
+	// img is the image of the next frame if it was added with AddImage(), so it doesn't have to be decoded
+	img image.Image
+	// err is the first error of writing the proxy
+	err error
+
+	// ycc, gray and rgba are the reused downscaled images, src is the reused image to convert other images to RGBA
+	ycc       *image.YCbCr
+	gray      *image.Gray
+	rgba, src *image.RGBA
+}
+
+// WithProxy returns an Option which makes the writer write a downscaled proxy video (e.g. for scrubbing
+// in editors) into aviFile simultaneously with the main video, from the same frames.
+// The width and height of the proxy are those of the video divided by factor, frames are encoded
+// with the given JPEG quality.
+//
+// Frames added with AddImage() are downscaled directly, frames added as JPEG data are decoded once for the proxy.
+// Duplicate frames of the main video are duplicated in the proxy too, and frames which can't be decoded
+// (e.g. raw frames added with AddFrame()) are replaced by the previous proxy frame.
+// Errors of writing the proxy don't affect the main video: writing the proxy stops,
+// and the error is returned by Close() (after the main video is finalized).
+// Not supported by Open(), Resume() and Checkpoint().
+func WithProxy(aviFile string, factor, quality int) Option {
+	return func(aw *aviWriter) {
+		if factor < 1 {
+			factor = 1
+		}
+		aw.proxy = &proxy{aviFile: aviFile, factor: factor, quality: quality}
+	}
+}
+
+// open creates the proxy video for a video of the given size and frame rate.
+func (p *proxy) open(width, height, fps int32) error {
+	w, h := width/int32(p.factor), height/int32(p.factor)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	awr, err := New(p.aviFile, w, h, fps, WithQuality(p.quality))
+	if err != nil {
+		return err
+	}
+	p.aw = awr.(*aviWriter)
+	return nil
+}
+
+// setProxyImage sets the image of the next frame for the proxy (if there is one), so it doesn't have to be decoded.
+func (aw *aviWriter) setProxyImage(img image.Image) {
+	if aw.proxy != nil {
+		aw.proxy.img = img
+	}
+}
+
+// addFrame adds the proxy frame of a frame of the main video with the given data.
+func (p *proxy) addFrame(data []byte) {
+	img := p.img
+	p.img = nil
+	if p.err != nil {
+		return
+	}
+	if img == nil {
+		var err error
+		if img, err = jpeg.Decode(bytes.NewReader(data)); err != nil {
+			p.addDup()
+			return
+		}
+	}
+	p.err = p.aw.AddImage(p.downscale(img))
+}
+
+// addDup adds a duplicate of the last proxy frame.
+func (p *proxy) addDup() {
+	if p.err == nil && p.aw.frames > 0 {
+		p.err = p.aw.notifyErr(p.aw.addDupFrame())
+	}
+}
+
+// close finalizes the proxy video, returns the first error of writing the proxy.
+func (p *proxy) close() error {
+	if err := p.aw.Close(); p.err == nil {
+		p.err = err
+	}
+	return p.err
+}
+
+// downscale returns img downscaled to the size of the proxy by averaging the blocks of pixels.
+// YCbCr (decoded JPEG) and Gray images are downscaled by planes, other images are converted to RGBA.
+func (p *proxy) downscale(img image.Image) image.Image {
+	w, h, f := int(p.aw.width), int(p.aw.height), p.factor
+	switch s := img.(type) {
+	case *image.YCbCr:
+		if p.ycc == nil || p.ycc.SubsampleRatio != s.SubsampleRatio {
+			p.ycc = image.NewYCbCr(image.Rect(0, 0, w, h), s.SubsampleRatio)
+		}
+		d := p.ycc
+		b := s.Rect
+		boxPlane(d.Y, d.YStride, w, h, s.Y[s.YOffset(b.Min.X, b.Min.Y):], s.YStride, b.Dx(), b.Dy(), 1, f)
+		cw, ch := chromaSize(d.Rect, d.SubsampleRatio)
+		scw, sch := chromaSize(b, s.SubsampleRatio)
+		off := s.COffset(b.Min.X, b.Min.Y)
+		boxPlane(d.Cb, d.CStride, cw, ch, s.Cb[off:], s.CStride, scw, sch, 1, f)
+		boxPlane(d.Cr, d.CStride, cw, ch, s.Cr[off:], s.CStride, scw, sch, 1, f)
+		return d
+	case *image.Gray:
+		if p.gray == nil {
+			p.gray = image.NewGray(image.Rect(0, 0, w, h))
+		}
+		b := s.Rect
+		boxPlane(p.gray.Pix, p.gray.Stride, w, h, s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), 1, f)
+		return p.gray
+	}
+
+	s, ok := img.(*image.RGBA)
+	if !ok {
+		p.src = copyToRGBA(p.src, img)
+		s = p.src
+	}
+	if p.rgba == nil {
+		p.rgba = image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	b := s.Rect
+	boxPlane(p.rgba.Pix, p.rgba.Stride, w, h, s.Pix[s.PixOffset(b.Min.X, b.Min.Y):], s.Stride, b.Dx(), b.Dy(), 4, f)
+	return p.rgba
+}
+
+// chromaSize returns the size of the chroma planes of a YCbCr image with the given bounds and subsample ratio.
+func chromaSize(r image.Rectangle, ratio image.YCbCrSubsampleRatio) (w, h int) {
+	w, h = r.Dx(), r.Dy()
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		w = (w + 1) / 2
+	case image.YCbCrSubsampleRatio420:
+		w, h = (w+1)/2, (h+1)/2
+	case image.YCbCrSubsampleRatio440:
+		h = (h + 1) / 2
+	case image.YCbCrSubsampleRatio411:
+		w = (w + 3) / 4
+	case image.YCbCrSubsampleRatio410:
+		w, h = (w+3)/4, (h+1)/2
+	}
+	return
+}
+
+// boxPlane downscales the sw x sh source plane to the dw x dh destination plane, each pixel having
+// n channels of 1 byte: each destination pixel is the average of a factor x factor block of source pixels
+// (clamped to the source, black outside of it).
+func boxPlane(dst []byte, dstStride, dw, dh int, src []byte, srcStride, sw, sh, n, factor int) {
+	var sum [4]int
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*factor, dy*factor+factor
+		if y1 > sh {
+			y1 = sh
+		}
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*factor, dx*factor+factor
+			if x1 > sw {
+				x1 = sw
+			}
+			sum = [4]int{}
+			for y := y0; y < y1; y++ {
+				row := src[y*srcStride:]
+				for x := x0; x < x1; x++ {
+					for c := 0; c < n; c++ {
+						sum[c] += int(row[x*n+c])
+					}
+				}
+			}
+			d := dst[dy*dstStride+dx*n:]
+			count := 0
+			if y1 > y0 && x1 > x0 {
+				count = (y1 - y0) * (x1 - x0)
+			}
+			for c := 0; c < n; c++ {
+				if count > 0 {
+					d[c] = byte(sum[c] / count)
+				} else {
+					d[c] = 0
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package mjpeg
+
+// Quality limits of the rate controller.
+const (
+	minRateQuality = 5
+	maxRateQuality = 95
+)
+
+// rateControl adjusts the JPEG quality of encoded frames to keep the output bitrate near a target.
+type rateControl struct {
+	// targetBps is the target bitrate in bits/second
+	targetBps float64
+	// fps is the frames/second of the video
+	fps float64
+
+	// sizes is a ring buffer of the sizes of the last frames (1 second worth of frames)
+	sizes []int
+	// pos is the position of the next size in sizes
+	pos int
+	// count is the number of valid sizes
+	count int
+	// sum is the sum of the valid sizes
+	sum int
+}
+
+// WithTargetBitrate returns an Option which enables rate control of frames added with AddImage():
+// the rolling output bitrate (over the last second) is monitored, and the JPEG quality is adjusted
+// to stay near the given target (in kbit/second).
+//
+// The quality set with WithQuality() is used as the initial quality.
+// Frames added with AddFrame() count towards the bitrate, but are obviously not re-encoded.
+func WithTargetBitrate(kbps int) Option {
+	return func(aw *aviWriter) {
+		aw.rate = &rateControl{targetBps: float64(kbps) * 1000}
+	}
+}
+
+// init initializes the rate controller for the given frame rate.
+func (rc *rateControl) init(fps float64) {
+	rc.fps = fps
+	n := int(fps)
+	if n < 1 {
+		n = 1
+	}
+	rc.sizes = make([]int, n)
+}
+
+// record records the size of a written frame.
+func (rc *rateControl) record(size int) {
+	if rc.count == len(rc.sizes) {
+		rc.sum -= rc.sizes[rc.pos]
+	} else {
+		rc.count++
+	}
+	rc.sizes[rc.pos] = size
+	rc.sum += size
+	rc.pos = (rc.pos + 1) % len(rc.sizes)
+}
+
+// bitrate returns the rolling bitrate in bits/second.
+func (rc *rateControl) bitrate() float64 {
+	if rc.count == 0 {
+		return 0
+	}
+	return float64(rc.sum*8) * rc.fps / float64(rc.count)
+}
+
+// adjust returns the quality to use for the next frame, based on the current quality q.
+func (rc *rateControl) adjust(q int) int {
+	if rc.count == 0 || rc.targetBps <= 0 {
+		return q
+	}
+
+	ratio := rc.bitrate() / rc.targetBps
+	switch {
+	case ratio > 1.05:
+		// Step down proportionally to the excess, faster when far from the target
+		step := int((ratio - 1) * 10)
+		if step < 1 {
+			step = 1
+		}
+		q -= step
+	case ratio < 0.95:
+		q++
+	}
+
+	if q < minRateQuality {
+		q = minRateQuality
+	} else if q > maxRateQuality {
+		q = maxRateQuality
+	}
+	return q
+}
@@ -0,0 +1,443 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+)
+
+var (
+	// ErrNotAVI reports if the input is not an AVI file.
+	ErrNotAVI = errors.New("Not an AVI file")
+
+	// ErrNoVideo reports if the AVI file has no video stream.
+	ErrNoVideo = errors.New("No video stream")
+
+	// ErrFrameIndex reports if a frame index is out of range.
+	ErrFrameIndex = errors.New("Frame index out of range")
+
+	// errStopWalk signals that walking the chunks should stop (without an error).
+	errStopWalk = errors.New("Stop walk")
+)
+
+// AviReader is an *.avi video reader.
+// It provides random access to the frames of the (first) video stream, e.g. of files created by AviWriter.
+type AviReader interface {
+	// Info returns the properties of the video.
+	Info() Info
+
+	// Frame returns the data of the frame at the given (zero-based) index.
+	// For MJPEG videos this is the JPEG encoded frame.
+	Frame(i int) ([]byte, error)
+
+	// Frames returns an iterator over the indices and data of the frames, for use in for range loops
+	// (the returned function is an iter.Seq2[int, []byte] of Go 1.23). Iteration stops at the first error,
+	// which is reported by Err().
+	Frames() func(yield func(int, []byte) bool)
+
+	// Images returns an iterator over the indices and decoded images of the frames, like Frames().
+	// The same codecs are supported as by Thumbnail().
+	Images() func(yield func(int, image.Image) bool)
+
+	// Err returns the error which stopped the last iteration of Frames() or Images(),
+	// nil if the iteration completed or was stopped by the loop.
+	Err() error
+
+	// Close closes the underlying file.
+	Close() error
+}
+
+// Info holds the properties of a video.
+type Info struct {
+	// Width and Height are the dimensions of the video in pixels
+	Width, Height int32
+	// Rate and Scale specify the frame rate: Rate/Scale frames per second
+	Rate, Scale int32
+	// Frames is the number of frames in the video stream
+	Frames int
+	// Codec is the FOURCC of the video codec, e.g. "MJPG"
+	Codec string
+	// Streams is the number of streams in the file
+	Streams int
+	// Name is the stream name (from the strn chunk), if present
+	Name string
+	// TopDown tells if raw frames are stored top-down (the height in the stream format is negative), see WithTopDown()
+	TopDown bool
+	// Timecode is the starting SMPTE timecode (from the ISMP entry of the INFO list), if present, see WithTimecode()
+	Timecode string
+	// Color is the color information (from the ICLR entry of the INFO list), see WithColorInfo()
+	Color ColorInfo
+	// Poster is the index of the poster frame (from the IPST entry of the INFO list), see WithPosterFrame();
+	// the first frame if the file records none
+	Poster int
+	// HasPoster tells if the file records the poster frame
+	HasPoster bool
+}
+
+// FPS returns the frames/second of the video.
+func (i Info) FPS() float64 {
+	if i.Scale == 0 {
+		return 0
+	}
+	return float64(i.Rate) / float64(i.Scale)
+}
+
+// frameEntry describes a frame of the video stream.
+type frameEntry struct {
+	// offset is the absolute file position of the frame data
+	offset int64
+	// size is the size of the frame data
+	size uint32
+	// flags are the idx1 flags of the frame
+	flags uint32
+}
+
+// aviReader is the AviReader implementation.
+type aviReader struct {
+	// r is the source of the data
+	r io.ReaderAt
+	// size is the size of the data
+	size int64
+	// closer closes the source (if it has to be closed)
+	closer io.Closer
+
+	// info holds the parsed properties
+	info Info
+	// videoStream is the index of the video stream
+	videoStream int
+	// bitCount is the number of bits per pixel of the video stream format
+	bitCount int
+
+	// moviPos is the file position of the 'movi' list type (the base of idx1 offsets)
+	moviPos int64
+	// moviEnd is the end position of the movi list
+	moviEnd int64
+	// idx1Pos is the file position of the idx1 chunk data, -1 if there is none
+	idx1Pos int64
+	// idx1Size is the size of the idx1 chunk data
+	idx1Size int64
+	// idx1Base is the base of the idx1 offsets (moviPos if they are relative, 0 if absolute), -1 if idx1 is not used
+	idx1Base int64
+
+	// frames are the entries of the frames of the video stream
+	frames []frameEntry
+
+	// iterErr is the error which stopped the last iteration
+	iterErr error
+}
+
+// NewReader returns a new AviReader reading the given file.
+// The Close() method of the AviReader must be called to release the file.
+func NewReader(aviFile string) (AviReader, error) {
+	f, err := openFile(aviFile, false)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ar, err := newReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	ar.closer = f
+	return ar, nil
+}
+
+// newReader parses the AVI data of the given size from r.
+func newReader(r io.ReaderAt, size int64) (*aviReader, error) {
+	ar := &aviReader{r: r, size: size, videoStream: -1, moviPos: -1, idx1Pos: -1, idx1Base: -1}
+
+	hdr := make([]byte, 12)
+	if _, err := r.ReadAt(hdr, 0); err != nil || string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "AVI " {
+		return nil, ErrNotAVI
+	}
+
+	// The RIFF size is not trusted: it may be not finalized or wrong (e.g. written by buggy versions),
+	// so chunks are walked until the end of the file (or an extension RIFF chunk).
+	err := ar.walk(12, size, func(id string, pos, dataSize int64) error {
+		switch id {
+		case "RIFF":
+			return errStopWalk
+		case "LIST":
+			listType, err := ar.fourCC(pos)
+			if err != nil {
+				return err
+			}
+			switch listType {
+			case "hdrl":
+				return ar.parseHdrl(pos+4, pos+dataSize)
+			case "INFO":
+				return ar.parseInfo(pos+4, pos+dataSize)
+			case "movi":
+				ar.moviPos, ar.moviEnd = pos, pos+dataSize
+				if dataSize < 4 {
+					// Length not finalized: movi extends to the end of the file
+					ar.moviEnd = size
+					return errStopWalk
+				}
+				if ar.moviEnd > size {
+					ar.moviEnd = size
+				}
+			}
+		case "idx1":
+			ar.idx1Pos, ar.idx1Size = pos, dataSize
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ar.videoStream < 0 {
+		return nil, ErrNoVideo
+	}
+	if ar.moviPos < 0 {
+		return nil, ErrNotAVI
+	}
+
+	if !ar.loadIdx1() {
+		if err := ar.scanMovi(); err != nil {
+			return nil, err
+		}
+	}
+	ar.info.Frames = len(ar.frames)
+
+	return ar, nil
+}
+
+// walk calls fn for each chunk between the positions start and end,
+// with the chunk id, the position of the chunk data and the size of the chunk data.
+// Walking stops at the first truncated chunk.
+func (ar *aviReader) walk(start, end int64, fn func(id string, pos, size int64) error) error {
+	hdr := make([]byte, 8)
+	for pos := start; pos+8 <= end; {
+		if _, err := ar.r.ReadAt(hdr, pos); err != nil {
+			return err
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		if err := fn(string(hdr[:4]), pos+8, size); err != nil {
+			if err == errStopWalk {
+				return nil
+			}
+			return err
+		}
+		pos += 8 + size + size&0x01 // Chunks are padded to even size
+	}
+	return nil
+}
+
+// fourCC reads a FOURCC code at the given position.
+func (ar *aviReader) fourCC(pos int64) (string, error) {
+	b := make([]byte, 4)
+	if _, err := ar.r.ReadAt(b, pos); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readChunk reads the data of a chunk at the given position with the given size.
+func (ar *aviReader) readChunk(pos, size int64) ([]byte, error) {
+	if pos+size > ar.size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, size)
+	if _, err := ar.r.ReadAt(data, pos); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseHdrl parses the header list between positions start and end.
+func (ar *aviReader) parseHdrl(start, end int64) error {
+	streams := 0
+	return ar.walk(start, end, func(id string, pos, size int64) error {
+		switch id {
+		case "avih":
+			data, err := ar.readChunk(pos, size)
+			if err != nil {
+				return err
+			}
+			if len(data) >= 40 {
+				ar.info.Streams = int(binary.LittleEndian.Uint32(data[24:]))
+				ar.info.Width = int32(binary.LittleEndian.Uint32(data[32:]))
+				ar.info.Height = int32(binary.LittleEndian.Uint32(data[36:]))
+			}
+		case "LIST":
+			listType, err := ar.fourCC(pos)
+			if err != nil {
+				return err
+			}
+			if listType == "strl" {
+				err = ar.parseStrl(streams, pos+4, pos+size)
+				streams++
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// parseStrl parses the stream list of the given stream between positions start and end.
+func (ar *aviReader) parseStrl(stream int, start, end int64) error {
+	isVideo := false
+	return ar.walk(start, end, func(id string, pos, size int64) error {
+		if id != "strh" && !isVideo {
+			return nil
+		}
+		data, err := ar.readChunk(pos, size)
+		if err != nil {
+			return err
+		}
+		switch id {
+		case "strh":
+			if len(data) < 36 || string(data[:4]) != "vids" || ar.videoStream >= 0 {
+				return nil
+			}
+			isVideo, ar.videoStream = true, stream
+			ar.info.Codec = string(data[4:8])
+			ar.info.Scale = int32(binary.LittleEndian.Uint32(data[20:]))
+			ar.info.Rate = int32(binary.LittleEndian.Uint32(data[24:]))
+		case "strf":
+			if len(data) >= 20 {
+				ar.info.Width = int32(binary.LittleEndian.Uint32(data[4:]))
+				ar.info.Height = int32(binary.LittleEndian.Uint32(data[8:]))
+				if ar.info.Height < 0 {
+					ar.info.Height, ar.info.TopDown = -ar.info.Height, true
+				}
+				if c := string(data[16:20]); c != "\000\000\000\000" {
+					ar.info.Codec = c
+				}
+				ar.bitCount = int(binary.LittleEndian.Uint16(data[14:]))
+			}
+		case "strn":
+			for i, b := range data {
+				if b == 0 {
+					data = data[:i]
+					break
+				}
+			}
+			ar.info.Name = string(data)
+		}
+		return nil
+	})
+}
+
+// parseInfo parses the INFO list between positions start and end.
+func (ar *aviReader) parseInfo(start, end int64) error {
+	return ar.walk(start, end, func(id string, pos, size int64) error {
+		if id != "ISMP" && id != "ICLR" && id != "IPST" {
+			return nil
+		}
+		data, err := ar.readChunk(pos, size)
+		if err != nil {
+			return err
+		}
+		switch value := string(bytes.TrimRight(data, "\000")); id {
+		case "ISMP":
+			ar.info.Timecode = value
+		case "ICLR":
+			ar.info.Color = parseColorInfo(value)
+		default:
+			ar.info.Poster, ar.info.HasPoster = parsePoster(value)
+		}
+		return nil
+	})
+}
+
+// isVideoChunk tells if the chunk id denotes a chunk of the video stream.
+func (ar *aviReader) isVideoChunk(id string) bool {
+	return len(id) == 4 && int(id[0]-'0')*10+int(id[1]-'0') == ar.videoStream &&
+		(id[2:] == "dc" || id[2:] == "db")
+}
+
+// loadIdx1 loads the frame entries from the idx1 chunk.
+// Returns false if there is no usable index.
+func (ar *aviReader) loadIdx1() bool {
+	if ar.idx1Pos < 0 || ar.idx1Pos+ar.idx1Size > ar.size {
+		return false
+	}
+	data, err := ar.readChunk(ar.idx1Pos, ar.idx1Size&^0x0f)
+	if err != nil {
+		return false
+	}
+
+	// Offsets may be relative to the 'movi' list type or absolute: check it with the first entry
+	base := int64(-1)
+	var frames []frameEntry
+	for i := 0; i+16 <= len(data); i += 16 {
+		e := data[i : i+16]
+		id := string(e[:4])
+		if !ar.isVideoChunk(id) {
+			continue
+		}
+		offset := int64(binary.LittleEndian.Uint32(e[8:]))
+		if base < 0 {
+			if c, err := ar.fourCC(ar.moviPos + offset); err == nil && c == id {
+				base = ar.moviPos
+			} else if c, err := ar.fourCC(offset); err == nil && c == id {
+				base = 0
+			} else {
+				return false
+			}
+		}
+		frames = append(frames, frameEntry{
+			offset: base + offset + 8,
+			size:   binary.LittleEndian.Uint32(e[12:]),
+			flags:  binary.LittleEndian.Uint32(e[4:]),
+		})
+	}
+	if len(frames) == 0 && ar.idx1Size > 0 {
+		return false
+	}
+	ar.frames, ar.idx1Base = frames, base
+	return true
+}
+
+// scanMovi loads the frame entries by walking the chunks of the movi list.
+// Used if the file has no index (e.g. it was not finalized).
+func (ar *aviReader) scanMovi() error {
+	var scan func(start, end int64) error
+	scan = func(start, end int64) error {
+		return ar.walk(start, end, func(id string, pos, size int64) error {
+			if id == "LIST" {
+				if lt, err := ar.fourCC(pos); err == nil && lt == "rec " {
+					return scan(pos+4, pos+size)
+				}
+				return nil
+			}
+			if ar.isVideoChunk(id) && pos+size <= ar.size {
+				ar.frames = append(ar.frames, frameEntry{offset: pos, size: uint32(size), flags: 0x10})
+			}
+			return nil
+		})
+	}
+	return scan(ar.moviPos+4, ar.moviEnd)
+}
+
+// Info implements AviReader.Info().
+func (ar *aviReader) Info() Info {
+	return ar.info
+}
+
+// Frame implements AviReader.Frame().
+func (ar *aviReader) Frame(i int) ([]byte, error) {
+	if i < 0 || i >= len(ar.frames) {
+		return nil, ErrFrameIndex
+	}
+	e := ar.frames[i]
+	return ar.readChunk(e.offset, int64(e.size))
+}
+
+// Close implements AviReader.Close().
+func (ar *aviReader) Close() error {
+	if ar.closer == nil {
+		return nil
+	}
+	return ar.closer.Close()
+}
@@ -0,0 +1,114 @@
+package mjpeg
+
+import "encoding/binary"
+
+// recPadding is the granularity to which 'rec ' lists are aligned.
+const recPadding = 2048
+
+// WithRecLists returns an Option which makes the writer wrap the chunks belonging to each frame
+// (the frame and its metadata chunk) in a 'rec ' list, aligned to 2 KB boundaries with JUNK chunks,
+// as required by some standalone (hardware) players for smooth playback of interleaved files.
+// The 'rec ' lists are also listed in the idx1 index.
+func WithRecLists() Option {
+	return func(aw *aviWriter) {
+		aw.recLists = true
+	}
+}
+
+// WithRecListFrames returns an Option which makes the writer group the chunks of n consecutive frames
+// into one 'rec ' list (see WithRecLists(), which is the same as n = 1), including the metadata chunks of
+// the frames, and the audio chunks and frames of additional streams added between them.
+//
+// Players read a rec list in one go: larger groups mean fewer (but larger) reads and less padding,
+// which suits embedded players on slow storage (e.g. SD cards), while n = 1 allows the finest seeking
+// and interleaving. Since rec lists are padded to 2 KB, grouping also reduces the file size of videos
+// with small frames (about 1 KB of padding per list on average). A group is ended early when the video
+// is closed or checkpointed.
+func WithRecListFrames(n int) Option {
+	return func(aw *aviWriter) {
+		aw.recLists = true
+		if n > 1 {
+			aw.recFrames = n
+		}
+	}
+}
+
+// aviFlags returns the dwFlags of the AVI header.
+func (aw *aviWriter) aviFlags() int32 {
+	flags := int32(0x10) // AVIF_HASINDEX
+	if aw.recLists || aw.ffmpeg || aw.audio != nil {
+		flags |= 0x100 // AVIF_ISINTERLEAVED
+	}
+	if aw.ffmpeg {
+		flags |= 0x800 // AVIF_TRUSTCKTYPE
+	}
+	return flags | aw.extraAVIFlags
+}
+
+// paddingGranularity returns the dwPaddingGranularity of the AVI header.
+func (aw *aviWriter) paddingGranularity() int32 {
+	granularity := int64(0)
+	if aw.alignFrames {
+		granularity = aw.align
+	}
+	if aw.recLists && granularity < recPadding {
+		granularity = recPadding
+	}
+	return int32(granularity)
+}
+
+// beginRec pads the file to the next 2 KB boundary (or to the frame alignment if that is larger),
+// and starts a 'rec ' list.
+func (aw *aviWriter) beginRec() error {
+	if err := aw.pad(int64(aw.paddingGranularity()), 0); err != nil {
+		return err
+	}
+
+	aw.recPos = aw.currentPos()
+	aw.rw.PushList("rec ") // LIST chunk: record (nesting level 2)
+	if err := aw.rw.Err(); err != nil {
+		return err
+	}
+
+	// Index entry of the list, its size is filled at endRec()
+	var err error
+	if aw.recIdxPos, err = aw.idxf.Seek(0, 1); err != nil {
+		return err
+	}
+	if err := aw.writeIdxEntry(0x20636572, FlagList, aw.recPos, 0); err != nil { // "rec "
+		return err
+	}
+	aw.recOpen, aw.recCount = true, 0
+	return nil
+}
+
+// endRec finishes the 'rec ' list started with beginRec().
+func (aw *aviWriter) endRec() error {
+	aw.rw.Pop() // LIST 'rec ' finished (nesting level 2)
+	if err := aw.rw.Err(); err != nil {
+		return err
+	}
+	aw.recOpen = false
+
+	size := aw.currentPos() - aw.recPos - 8
+	binary.LittleEndian.PutUint32(aw.buf4, uint32(size))
+	_, err := aw.idxf.WriteAt(aw.buf4, aw.recIdxPos+12)
+	return err
+}
+
+// frameRec starts a 'rec ' list for the chunks of the next frame, unless the current group is still open.
+func (aw *aviWriter) frameRec() error {
+	if aw.recOpen {
+		return nil
+	}
+	return aw.beginRec()
+}
+
+// endFrameRec finishes the 'rec ' list after the chunks of a frame if the group is complete.
+func (aw *aviWriter) endFrameRec() error {
+	aw.recCount++
+	if aw.recCount >= aw.recFrames {
+		return aw.endRec()
+	}
+	return nil
+}
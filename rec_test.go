@@ -0,0 +1,38 @@
+package mjpeg
+
+import (
+	"os"
+	"testing"
+)
+
+// TestRecLists checks that frames wrapped in 'rec ' lists are read back.
+func TestRecLists(t *testing.T) {
+	frames := testFrames(t, 7)
+	for _, c := range []struct {
+		name string
+		opt  Option
+		// lists is the number of 'rec ' lists
+		lists int
+	}{
+		{"one frame per list", WithRecLists(), 7},
+		{"three frames per list", WithRecListFrames(3), 3},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			name := writeTestVideo(t, t.TempDir(), frames, c.opt)
+			checkFrames(t, name, frames)
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0 // The 'rec ' list type follows the id and the size of a LIST (it is also the id of its index entries)
+			for i := 8; i+4 <= len(data); i++ {
+				if string(data[i:i+4]) == "rec " && string(data[i-8:i-4]) == "LIST" {
+					n++
+				}
+			}
+			if n != c.lists {
+				t.Errorf("got %d 'rec ' lists, want %d", n, c.lists)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package mjpeg
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// RecorderConfig configures recording an HTTP camera, see RecordCamera().
+type RecorderConfig struct {
+	// Camera configures reading the stream of the camera
+	Camera CameraConfig
+	// Reconnect is the backoff of reconnecting after the stream drops (or can't be opened):
+	// Delay is 1s if 0, MaxDelay is 30s if 0. Attempts limits the consecutive failed attempts, 0 means no limit.
+	// Retryable is not used, all errors of the camera are retried
+	Reconnect RetryPolicy
+	// Gap tells how the period while the camera is disconnected is handled
+	Gap GapPolicy
+	// Slate is the JPEG encoded frame inserted with GapSlate, the default slate is rendered if nil (see Slate())
+	Slate []byte
+}
+
+// RecordCamera records the MJPEG stream of the HTTP (IP) camera at url until ctx is cancelled.
+// If the stream drops, it is reconnected with backoff, and the outage (from the drop to the first frame
+// after reconnecting) is handled according to the gap policy, see AviWriter.FillGap().
+// Failing to connect before the first frame is retried the same way, but it is not a gap.
+//
+// newWriter is called to create the video: at the start, and with GapCut after each outage for a new segment
+// (segment is the zero-based index of the segment). The videos are closed by RecordCamera.
+// Returns the number of frames added from the camera (in all segments).
+// Cancelling ctx is not an error; the error is returned if the reconnect attempts are exhausted.
+func RecordCamera(ctx context.Context, url string, newWriter func(segment int) (AviWriter, error), cfg RecorderConfig) (n int, err error) {
+	backoff := cfg.Reconnect
+	if backoff.Delay <= 0 {
+		backoff.Delay = time.Second
+	}
+	if backoff.MaxDelay <= 0 {
+		backoff.MaxDelay = 30 * time.Second
+	}
+
+	segment := 0
+	aw, err := newWriter(segment)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	var lost time.Time // The time the stream dropped, zero if connected
+	for failures := 0; ; {
+		fr, body, err := openCamera(ctx, url, cfg.Camera)
+		for err == nil {
+			var data []byte
+			if data, err = fr.ReadFrame(); err != nil {
+				break
+			}
+			if !lost.IsZero() {
+				if aw, segment, err = fillGap(aw, segment, time.Since(lost), newWriter, &cfg); err != nil {
+					body.Close()
+					return n, err
+				}
+				lost = time.Time{}
+			}
+			failures = 0
+			if err = aw.AddFrame(data); err != nil {
+				body.Close()
+				return n, err
+			}
+			n++
+		}
+		if body != nil {
+			body.Close()
+		}
+
+		if ctx.Err() != nil {
+			return n, nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF // Cameras don't end their streams
+		}
+		if lost.IsZero() && n > 0 { // Until the first frame, there is nothing to continue
+			lost = time.Now()
+		}
+		if failures++; backoff.Attempts > 0 && failures >= backoff.Attempts {
+			return n, err
+		}
+		t := time.NewTimer(backoff.delay(failures))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return n, nil
+		case <-t.C:
+		}
+	}
+}
+
+// fillGap handles an outage of duration d according to the gap policy of cfg.
+// With GapCut, aw is closed, and the video of the next segment is returned.
+func fillGap(aw AviWriter, segment int, d time.Duration, newWriter func(segment int) (AviWriter, error), cfg *RecorderConfig) (AviWriter, int, error) {
+	if cfg.Gap == GapCut {
+		if err := aw.Close(); err != nil {
+			return aw, segment, err
+		}
+		next, err := newWriter(segment + 1)
+		if err != nil {
+			return aw, segment, err // aw is closed again in RecordCamera(), which returns the result of its first Close()
+		}
+		aw, segment = next, segment+1
+	}
+	return aw, segment, aw.FillGap(d, cfg.Gap, cfg.Slate)
+}
@@ -0,0 +1,184 @@
+package mjpeg
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrInvalidFPS reports an invalid frame rate.
+	ErrInvalidFPS = errors.New("Invalid FPS")
+
+	// ErrIncompatible reports if videos can't be concatenated (they differ in size or codec).
+	ErrIncompatible = errors.New("Incompatible videos")
+)
+
+// withScale returns an Option which sets the dwScale of the video stream: the frame rate is fps/scale
+// frames per second (e.g. 30000/1001 for NTSC), used to keep the frame rate of the source of remuxed videos.
+func withScale(scale int32) Option {
+	return func(aw *aviWriter) {
+		aw.scale = scale
+	}
+}
+
+// remux writes the frames of the input video to a new video file, in the order given by
+// the frame indices returned by next. next is called with the index of the output frame,
+// and must return -1 when there are no more frames.
+// fps is the frame rate of the output, the properties of the input are used if 0.
+func remux(in, out string, fps int32, next func(info Info, j int) int) (err error) {
+	ar, err := NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if info.Rate <= 0 || info.Scale <= 0 {
+		return ErrInvalidFPS // Frames can't be timed
+	}
+	opts := codecOptions(ar.(*aviReader))
+	if fps == 0 {
+		fps, opts = info.Rate, append(opts, withScale(info.Scale))
+	}
+
+	aw, err := New(out, info.Width, info.Height, fps, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(out)})
+		}
+	}()
+
+	for j := 0; ; j++ {
+		i := next(info, j)
+		if i < 0 {
+			return nil
+		}
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		if err = aw.AddFrame(data); err != nil {
+			return err
+		}
+	}
+}
+
+// ConvertFPS converts the video in to fps frames/second by dropping or duplicating frames (without re-encoding them),
+// and writes the result to out.
+//
+// speed is the playback speed relative to the input: 1 keeps the duration of the video,
+// 0.5 results in a slow-motion video twice as long, 2 results in a video half as long.
+func ConvertFPS(in, out string, fps int32, speed float64) error {
+	if fps <= 0 || speed <= 0 {
+		return ErrInvalidFPS
+	}
+	return remux(in, out, fps, func(info Info, j int) int {
+		// Output frame j is shown at j/fps seconds, which is source time j/fps*speed
+		i := int(float64(j) * speed * info.FPS() / float64(fps))
+		if i >= info.Frames {
+			return -1
+		}
+		return i
+	})
+}
+
+// Reverse writes the frames of the video in in reverse order to out, without decoding them.
+// The frame rate of the input is kept.
+func Reverse(in, out string) error {
+	return remux(in, out, 0, func(info Info, j int) int {
+		if j >= info.Frames {
+			return -1
+		}
+		return info.Frames - 1 - j
+	})
+}
+
+// Repair writes the readable frames of the (e.g. truncated, not finalized) video in to out,
+// with a proper index and headers. The frame rate of the input is kept.
+// Frames are located using the index of the input if it is usable, else by scanning its movi list,
+// in which case a truncated last frame is dropped.
+func Repair(in, out string) error {
+	return remux(in, out, 0, func(info Info, j int) int {
+		if j >= info.Frames {
+			return -1
+		}
+		return j
+	})
+}
+
+// Concat concatenates the videos ins into out, without re-encoding frames.
+// Videos must have the same dimensions and codec (and frame format), the codec and frame rate (Rate/Scale)
+// of the first video are used.
+func Concat(out string, ins ...string) (err error) {
+	if len(ins) == 0 {
+		return ErrNoVideo
+	}
+
+	var first Info
+	var firstBitCount int
+	var opts []Option
+	for i, in := range ins {
+		awr, err := NewReader(in)
+		if err != nil {
+			return err
+		}
+		ar := awr.(*aviReader)
+		info := ar.Info()
+		ar.Close()
+		if i == 0 {
+			first, firstBitCount, opts = info, ar.bitCount, append(codecOptions(ar), withScale(info.Scale))
+			if first.Scale <= 0 || first.Rate <= 0 {
+				return ErrInvalidFPS
+			}
+		} else if info.Width != first.Width || info.Height != first.Height || info.Codec != first.Codec ||
+			ar.bitCount != firstBitCount || info.TopDown != first.TopDown {
+			return ErrIncompatible
+		}
+	}
+
+	aw, err := New(out, first.Width, first.Height, first.Rate, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(out)})
+		}
+	}()
+
+	for _, in := range ins {
+		if err = appendFrames(aw, in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFrames adds all frames of the video in to aw.
+func appendFrames(aw AviWriter, in string) error {
+	ar, err := NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	for i := 0; i < ar.Info().Frames; i++ {
+		data, err := ar.Frame(i)
+		if err != nil {
+			return err
+		}
+		if err = aw.AddFrame(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checkRate checks that the video aviFile has the given frame rate and number of frames.
+func checkRate(tb testing.TB, aviFile string, rate, scale int32, frames int) {
+	tb.Helper()
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ar.Close()
+	info := ar.Info()
+	if info.Rate != rate || info.Scale != scale || info.Frames != frames {
+		tb.Errorf("got rate %d/%d, %d frames, want %d/%d, %d frames", info.Rate, info.Scale, info.Frames, rate, scale, frames)
+	}
+	data, err := os.ReadFile(aviFile)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// dwMicroSecPerFrame of the avih chunk: after the RIFF header, the hdrl list header and the avih chunk header
+	if got, want := binary.LittleEndian.Uint32(data[32:]), uint32(int64(scale)*1e6/int64(rate)); got != want {
+		tb.Errorf("got %d microseconds per frame, want %d", got, want)
+	}
+}
+
+// TestRationalFPS checks that the frame rate of videos with a dwScale other than 1 (e.g. NTSC) is kept
+// by the functions writing new videos from them, and when appending.
+func TestRationalFPS(t *testing.T) {
+	dir := t.TempDir()
+	frames := testFrames(t, 3)
+	in := writeTestVideo(t, dir, frames)
+	if err := SetPlaybackRate(in, 30000, 1001); err != nil {
+		t.Fatal(err)
+	}
+	checkRate(t, in, 30000, 1001, 3)
+
+	for _, c := range []struct {
+		name   string
+		frames int
+		write  func(out string) error
+	}{
+		{"Reverse", 3, func(out string) error { return Reverse(in, out) }},
+		{"Repair", 3, func(out string) error { return Repair(in, out) }},
+		{"Concat", 6, func(out string) error { return Concat(out, in, in) }},
+		{"Transcode", 3, func(out string) error { return Transcode(in, out, TranscodeOptions{}) }},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.avi")
+			if err := c.write(out); err != nil {
+				t.Fatal(err)
+			}
+			checkRate(t, out, 30000, 1001, c.frames)
+		})
+	}
+
+	t.Run("Open", func(t *testing.T) {
+		awr, err := Open(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft := awr.(*aviWriter).frameTime(3); ft.Microseconds() != 100100 {
+			t.Errorf("got frame time %v, want 100.1ms", ft)
+		}
+		if err := awr.AddFrame(frames[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := awr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkRate(t, in, 30000, 1001, 4)
+	})
+}
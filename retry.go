@@ -0,0 +1,106 @@
+package mjpeg
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy specifies how failed writes of frames (and custom chunks, and the finalization of the file)
+// are retried, e.g. for outputs on flaky network filesystems.
+// Before retrying, the data written by the failed attempt is discarded.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts (including the first one)
+	Attempts int
+	// Delay is the delay before the first retry, doubled before each further retry
+	Delay time.Duration
+	// MaxDelay caps the delay between retries if positive
+	MaxDelay time.Duration
+	// Retryable tells if a write may be retried after the error; IsTransient is used if nil
+	Retryable func(err error) bool
+}
+
+// WithRetry returns an Option which makes the writer retry failed writes according to the given policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(aw *aviWriter) {
+		aw.retry = &p
+	}
+}
+
+// IsTransient tells if err is a transient I/O error after which a write may succeed if retried
+// (like EIO, EAGAIN, EINTR, EBUSY, ETIMEDOUT, or an error reporting a timeout),
+// as opposed to fatal errors (e.g. a full disk or a closed file).
+func IsTransient(err error) bool {
+	for _, e := range []error{syscall.EIO, syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ETIMEDOUT} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
+
+// retryable tells if a write may be retried after err, in the given attempt.
+func (p *RetryPolicy) retryable(err error, attempt int) bool {
+	if attempt >= p.Attempts || isNoSpace(err) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// delay returns the delay before retrying after the given attempt.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Delay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// do performs the write operation write. If it fails with an error retryable by the retry policy,
+// the data written by it is discarded and it is retried. If it fails because the disk got full,
+// the data written by it is discarded, and ErrNoSpace is returned.
+// The state to roll back to is taken into the snapshot reused by all operations, so calls must not be nested.
+func (aw *aviWriter) do(write func() error) error {
+	snap := aw.snapshot()
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil {
+			return nil
+		}
+		if aw.retry == nil || !aw.retry.retryable(err, attempt) {
+			return aw.checkNoSpace(snap, err)
+		}
+		if err = aw.rollback(snap); err != nil {
+			return err
+		}
+		time.Sleep(aw.retry.delay(attempt))
+	}
+}
+
+// fatalError wraps an error after which the writer accepts no more data (e.g. a failed write).
+// It is recorded as the error of the writer by notifyErr() at the API boundary.
+type fatalError struct {
+	err error
+}
+
+func (e fatalError) Error() string { return e.err.Error() }
+
+func (e fatalError) Unwrap() error { return e.err }
+
+// fatal wraps err (if not nil) into a fatalError.
+func fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fatalError{err}
+}
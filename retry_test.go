@@ -0,0 +1,127 @@
+package mjpeg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/icza/mjpeg/riff"
+)
+
+// failingFile is a file whose next writes fail with err after writing half of the data.
+type failingFile struct {
+	*os.File
+	// err is the error of the failing writes
+	err error
+	// fails is the number of writes still to fail
+	fails int
+}
+
+// Write implements io.Writer.
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.fails == 0 {
+		return f.File.Write(p)
+	}
+	f.fails--
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, f.err
+}
+
+// failWrites makes the next writes of the AVI file of the writer fail.
+func failWrites(aw *aviWriter, err error, fails int) *failingFile {
+	ff := &failingFile{File: aw.avif, err: err, fails: fails}
+	rw := riff.NewWriter(ff)
+	for _, pos := range aw.rw.OpenChunks() {
+		rw.Reopen(pos)
+	}
+	aw.rw = rw
+	return ff
+}
+
+// TestRetry checks that frames failing with transient errors are rolled back and written again.
+func TestRetry(t *testing.T) {
+	frames := testFrames(t, 4)
+	name := filepath.Join(t.TempDir(), "retry.avi")
+	awr, err := New(name, smallWidth, smallHeight, 10, WithRetry(RetryPolicy{Attempts: 3}), WithRecListFrames(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range frames {
+		if i == 1 {
+			failWrites(awr.(*aviWriter), syscall.EIO, 2)
+		}
+		if err := awr.AddFrame(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := awr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkFrames(t, name, frames)
+}
+
+// TestWriteError checks that a failed write is reported by all further calls (and the OnError hook),
+// while rejected frames are not.
+func TestWriteError(t *testing.T) {
+	frames := testFrames(t, 2)
+	var hooked []error
+	awr, err := New(filepath.Join(t.TempDir(), "error.avi"), smallWidth, smallHeight, 10,
+		WithStrictJPEG(false), WithHooks(Hooks{OnError: func(err error) { hooked = append(hooked, err) }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer awr.Close()
+
+	var fe *FrameError
+	if err := awr.AddFrame([]byte("not a JPEG")); !errors.As(err, &fe) {
+		t.Fatalf("got error %v, want a *FrameError", err)
+	}
+	if err := awr.AddFrame(frames[0]); err != nil {
+		t.Fatalf("got error %v after a rejected frame", err)
+	}
+
+	errBroken := errors.New("broken")
+	failWrites(awr.(*aviWriter), errBroken, 1)
+	if err := awr.AddFrame(frames[1]); err != errBroken {
+		t.Fatalf("got error %v, want %v", err, errBroken)
+	}
+	if err := awr.AddFrame(frames[1]); err != errBroken {
+		t.Errorf("got error %v after a failed write, want %v", err, errBroken)
+	}
+	if err := awr.WriteCustomChunk("test", nil); err != errBroken {
+		t.Errorf("got custom chunk error %v after a failed write, want %v", err, errBroken)
+	}
+	if len(hooked) != 4 || hooked[1] != errBroken {
+		t.Errorf("got hooked errors %v", hooked)
+	}
+}
+
+// TestAddFrameAllocs checks that adding frames doesn't allocate.
+func TestAddFrameAllocs(t *testing.T) {
+	data := testFrames(t, 1)[0]
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"rec lists", []Option{WithRecListFrames(2)}},
+		{"retry", []Option{WithRetry(RetryPolicy{Attempts: 3})}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			awr, err := New(filepath.Join(t.TempDir(), "allocs.avi"), smallWidth, smallHeight, 10, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer awr.Close()
+			if allocs := testing.AllocsPerRun(100, func() {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}); allocs != 0 {
+				t.Errorf("got %v allocs per frame, want 0", allocs)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Package riff implements a low-level writer of RIFF (Resource Interchange File Format) files,
+the container format of e.g. AVI and WAV files.
+
+The Writer keeps track of the open chunks and lists, fills in their sizes when they are closed
+(by seeking back to their size fields), and pads chunks to even size as RIFF requires.
+
+Errors are sticky: after the first error all operations are no-ops, and Err() reports the error.
+So it is enough to check the error once, after writing a whole structure.
+
+Example writing a WAV file:
+
+	w := riff.NewWriter(f)
+	w.PushRIFF("WAVE")
+	w.WriteChunk("fmt ", fmtData)
+	w.PushChunk("data")
+	w.Write(samples)
+	w.Pop() // 'data' chunk
+	w.Pop() // 'RIFF' chunk
+	if err := w.Err(); err != nil {
+	    // Handle error
+	}
+*/
+package riff
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrNoOpenChunk reports if Pop() is called without an open chunk.
+	ErrNoOpenChunk = errors.New("No open chunk")
+
+	// ErrInvalidFourCC reports if a FOURCC code is not 4 bytes long.
+	ErrInvalidFourCC = errors.New("Invalid FOURCC")
+)
+
+// Writer is a RIFF writer.
+type Writer struct {
+	// ws is the destination
+	ws io.WriteSeeker
+	// pos is the current position in ws
+	pos int64
+	// sizeFields are the positions of the size fields of the open chunks
+	sizeFields []int64
+	// buf is a buffer used to write int values
+	buf [4]byte
+	// err is the first error that occurred
+	err error
+}
+
+// NewWriter returns a new Writer writing to ws, starting at its current position.
+func NewWriter(ws io.WriteSeeker) *Writer {
+	w := &Writer{ws: ws, sizeFields: make([]int64, 0, 5)}
+	w.pos, w.err = ws.Seek(0, io.SeekCurrent)
+	return w
+}
+
+// Err returns the first error that occurred.
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Pos returns the current position.
+func (w *Writer) Pos() int64 {
+	return w.pos
+}
+
+// Depth returns the number of open chunks and lists.
+func (w *Writer) Depth() int {
+	return len(w.sizeFields)
+}
+
+// Write writes raw data (e.g. the data of a chunk opened with PushChunk()).
+// It implements io.Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, w.err = w.ws.Write(p)
+	w.pos += int64(n)
+	return n, w.err
+}
+
+// Seek moves the position, e.g. to fill in fields whose values are known only later.
+// It implements io.Seeker.
+func (w *Writer) Seek(offset int64, whence int) (int64, error) {
+	if w.err != nil {
+		return w.pos, w.err
+	}
+	w.pos, w.err = w.ws.Seek(offset, whence)
+	return w.pos, w.err
+}
+
+// WriteFourCC writes a FOURCC code.
+func (w *Writer) WriteFourCC(fourCC string) {
+	if len(fourCC) != 4 {
+		if w.err == nil {
+			w.err = ErrInvalidFourCC
+		}
+		return
+	}
+	copy(w.buf[:], fourCC) // Reusing buf: the conversion to []byte would escape to the destination
+	w.Write(w.buf[:4])
+}
+
+// WriteUint32 writes a 32-bit little endian value.
+func (w *Writer) WriteUint32(v uint32) {
+	binary.LittleEndian.PutUint32(w.buf[:], v)
+	w.Write(w.buf[:4])
+}
+
+// WriteUint16 writes a 16-bit little endian value.
+func (w *Writer) WriteUint16(v uint16) {
+	binary.LittleEndian.PutUint16(w.buf[:], v)
+	w.Write(w.buf[:2])
+}
+
+// PushRIFF starts a RIFF chunk with the given form type (e.g. "AVI " or "WAVE").
+// It must be closed with Pop().
+func (w *Writer) PushRIFF(formType string) {
+	w.PushChunk("RIFF")
+	w.WriteFourCC(formType)
+}
+
+// PushList starts a LIST chunk with the given list type (e.g. "hdrl").
+// It must be closed with Pop().
+func (w *Writer) PushList(listType string) {
+	w.PushChunk("LIST")
+	w.WriteFourCC(listType)
+}
+
+// PushChunk starts a chunk with the given id whose size is not known in advance:
+// its data is to be written with subsequent writes (may contain nested chunks).
+// It must be closed with Pop().
+func (w *Writer) PushChunk(id string) {
+	w.WriteFourCC(id)
+	if w.err != nil {
+		return
+	}
+	w.sizeFields = append(w.sizeFields, w.pos)
+	w.WriteUint32(0) // Size, filled by Pop()
+}
+
+// OpenChunks returns the positions of the size fields of the open chunks, from the outermost to the innermost
+// (e.g. to persist the state of the Writer, and to restore it later with Reopen()).
+func (w *Writer) OpenChunks() []int64 {
+	return w.AppendOpenChunks(nil)
+}
+
+// AppendOpenChunks appends the positions of the size fields of the open chunks to dst, and returns the extended slice.
+// It is like OpenChunks(), but allows reusing a slice.
+func (w *Writer) AppendOpenChunks(dst []int64) []int64 {
+	return append(dst, w.sizeFields...)
+}
+
+// Reopen registers an already written chunk (e.g. written by a previous process) as open,
+// given the position of its size field, so that data can be appended to it.
+// Its size is updated by Pop(). Nested chunks must be reopened from the outermost to the innermost.
+func (w *Writer) Reopen(sizeFieldPos int64) {
+	if w.err != nil {
+		return
+	}
+	w.sizeFields = append(w.sizeFields, sizeFieldPos)
+}
+
+// Rollback discards the data written after pos, e.g. to recover from a failed write of a chunk:
+// the error is cleared, the open chunks are restored to openChunks (as returned by OpenChunks() at pos;
+// chunks closed since are reopened), and the position is set to pos. If the destination has a
+// Truncate(size int64) error method (like *os.File), it is truncated to pos.
+func (w *Writer) Rollback(pos int64, openChunks []int64) error {
+	w.err = nil
+	w.sizeFields = append(w.sizeFields[:0], openChunks...)
+	if t, ok := w.ws.(interface{ Truncate(size int64) error }); ok {
+		if w.err = t.Truncate(pos); w.err != nil {
+			return w.err
+		}
+	}
+	w.Seek(pos, io.SeekStart)
+	return w.err
+}
+
+// Pop closes the last open chunk or list: fills in its size, and pads it to even size.
+func (w *Writer) Pop() {
+	if w.err != nil {
+		return
+	}
+	n := len(w.sizeFields)
+	if n == 0 {
+		w.err = ErrNoOpenChunk
+		return
+	}
+	sizeField := w.sizeFields[n-1]
+	w.sizeFields = w.sizeFields[:n-1]
+
+	end := w.pos
+	w.Seek(sizeField, io.SeekStart)
+	w.WriteUint32(uint32(end - sizeField - 4))
+	w.Seek(end, io.SeekStart)
+	if end&0x01 != 0 {
+		w.buf[0] = 0
+		w.Write(w.buf[:1]) // Padding to even size
+	}
+}
+
+// WriteChunk writes a whole chunk with the given id and data.
+func (w *Writer) WriteChunk(id string, data []byte) {
+	w.PushChunk(id)
+	w.Write(data)
+	w.Pop()
+}
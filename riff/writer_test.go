@@ -0,0 +1,102 @@
+package riff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriter checks the sizes and padding of nested chunks.
+func TestWriter(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.riff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+	w.PushRIFF("TEST")
+	w.WriteChunk("odd ", []byte{1, 2, 3})
+	w.PushList("list")
+	w.PushChunk("data")
+	w.WriteUint16(0x0201)
+	w.Pop() // 'data'
+	w.Pop() // 'list'
+	w.Pop() // 'RIFF'
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Depth() != 0 {
+		t.Errorf("got depth %d, want 0", w.Depth())
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("RIFF\x26\x00\x00\x00TEST" +
+		"odd \x03\x00\x00\x00\x01\x02\x03\x00" + // Padded to even size
+		"LIST\x0e\x00\x00\x00list" +
+		"data\x02\x00\x00\x00\x01\x02")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+// TestWriterErrors checks that errors are sticky.
+func TestWriterErrors(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.riff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+	w.Pop()
+	if w.Err() != ErrNoOpenChunk {
+		t.Errorf("got error %v, want %v", w.Err(), ErrNoOpenChunk)
+	}
+	w.WriteChunk("data", []byte{1})
+	if w.Err() != ErrNoOpenChunk || w.Pos() != 0 {
+		t.Errorf("got error %v at %d after an error", w.Err(), w.Pos())
+	}
+
+	w = NewWriter(f)
+	w.WriteFourCC("toolong")
+	if w.Err() != ErrInvalidFourCC {
+		t.Errorf("got error %v, want %v", w.Err(), ErrInvalidFourCC)
+	}
+}
+
+// TestWriterRollback checks that rolled back data is discarded, and closed chunks are reopened.
+func TestWriterRollback(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.riff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := NewWriter(f)
+	w.PushRIFF("TEST")
+	pos, open := w.Pos(), w.OpenChunks()
+	w.WriteChunk("junk", []byte{1, 2, 3, 4})
+	w.Pop() // 'RIFF', closed by the rolled back operation
+	if err := w.Rollback(pos, open); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteChunk("data", []byte{5, 6})
+	w.Pop() // 'RIFF'
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("RIFF\x0e\x00\x00\x00TESTdata\x02\x00\x00\x00\x05\x06")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
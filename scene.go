@@ -0,0 +1,130 @@
+package mjpeg
+
+import (
+	"strings"
+	"time"
+)
+
+// SceneChange is a significant visual change in a video, see DetectScenes().
+type SceneChange struct {
+	// Frame is the index of the first frame after the change
+	Frame int
+	// Time is the timestamp of Frame
+	Time time.Duration
+	// Score is the mean difference of the luminance of the frame and the previous frame
+	// over a grid of 32x24 cells (in the range of 0..255)
+	Score float64
+}
+
+// SceneConfig is the configuration of scene change detection, see DetectScenes().
+type SceneConfig struct {
+	// Threshold is the minimum Score of a change to be reported, 30 if 0
+	Threshold float64
+	// SizeJump is the minimum relative change of the JPEG size of consecutive frames which makes
+	// a frame a candidate for a change (only candidates are decoded), 0.1 (10%) if 0.
+	// If negative, all frames are decoded.
+	SizeJump float64
+	// MinGap is the minimum time between reported changes, changes closer to the previous one are ignored
+	MinGap time.Duration
+}
+
+// DetectScenes reports the significant visual changes of the video aviFile (e.g. jump points
+// for reviewing long recordings), in the order of frames.
+//
+// Frames are compared in two steps: a frame whose JPEG size differs from the size of the previous frame
+// by at least cfg.SizeJump is a candidate, and candidates are decoded and compared to the previous frame
+// (like perceptual deduplication does, see WithDedup()). The size heuristic may miss changes which don't
+// affect the compressed size of frames (e.g. a pure color shift), set a negative cfg.SizeJump to decode
+// all frames if that matters more than speed. Frames of raw videos are all decoded.
+// The same codecs are supported as by Thumbnail().
+func DetectScenes(aviFile string, cfg SceneConfig) ([]SceneChange, error) {
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 30
+	}
+	if cfg.SizeJump == 0 {
+		cfg.SizeJump = 0.1
+	}
+	info := ar.Info()
+	if !strings.EqualFold(info.Codec, "MJPG") {
+		cfg.SizeJump = -1 // Sizes of raw frames don't change
+	}
+	fps := info.FPS()
+
+	var changes []SceneChange
+	var prevData []byte
+	var sig, prevSig []uint8
+	prevSigFrame := -1 // Frame of prevSig
+	for i := 0; i < info.Frames; i++ {
+		data, err := ar.Frame(i)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && (cfg.SizeJump < 0 || sizeJump(len(prevData), len(data)) >= cfg.SizeJump) {
+			if prevSigFrame != i-1 {
+				if prevSig, err = frameSignature(ar.(*aviReader), prevSig, prevData); err != nil {
+					return nil, err
+				}
+			}
+			if sig, err = frameSignature(ar.(*aviReader), sig, data); err != nil {
+				return nil, err
+			}
+
+			t := timestamp(i, fps)
+			score := sigDiff(sig, prevSig)
+			if score >= cfg.Threshold && (len(changes) == 0 || t-changes[len(changes)-1].Time >= cfg.MinGap) {
+				changes = append(changes, SceneChange{Frame: i, Time: t, Score: score})
+			}
+			sig, prevSig, prevSigFrame = prevSig, sig, i
+		}
+		prevData = data
+	}
+	return changes, nil
+}
+
+// timestamp returns the timestamp of the frame with the given index at the given frame rate.
+func timestamp(i int, fps float64) time.Duration {
+	if fps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(i) / fps * float64(time.Second))
+}
+
+// sizeJump returns the relative change of size b compared to size a.
+func sizeJump(a, b int) float64 {
+	if a == 0 {
+		return 1
+	}
+	d := float64(b-a) / float64(a)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// frameSignature decodes the frame data of the video read by ar, and calculates its signature into sig.
+func frameSignature(ar *aviReader, sig []uint8, data []byte) ([]uint8, error) {
+	img, err := decodeFrame(ar, data)
+	if err != nil {
+		return sig, err
+	}
+	return signature(sig, img), nil
+}
+
+// sigDiff returns the mean absolute difference of the cells of signatures a and b.
+func sigDiff(a, b []uint8) float64 {
+	sum := 0
+	for i, v := range a {
+		if d := int(v) - int(b[i]); d < 0 {
+			sum -= d
+		} else {
+			sum += d
+		}
+	}
+	return float64(sum) / float64(len(a))
+}
@@ -0,0 +1,144 @@
+package mjpeg
+
+import (
+	"context"
+	"image"
+	"io"
+	"time"
+)
+
+// ScreenConfig configures a screen capture source, see NewScreenSource().
+type ScreenConfig struct {
+	// FPS is the target frame rate, 10 if 0
+	FPS int32
+	// Duration stops capturing after this long, 0 means no limit
+	Duration time.Duration
+	// MaxFrames stops capturing after this many frames, 0 means no limit
+	MaxFrames int
+	// RepeatDropped tells to return the previous frame again in place of dropped frames,
+	// so the length of the video matches the wall-clock time of the capture
+	RepeatDropped bool
+}
+
+// screenContentQuality is the JPEG quality of the screen content preset, see WithScreenContent().
+const screenContentQuality = 95
+
+// WithScreenContent returns an Option which tunes the writer for screen content (e.g. screencasts), where
+// the defaults smear text: images are encoded with 4:4:4 chroma subsampling (see WithSubsampling())
+// at quality 95, which is close to lossless for text and UI elements.
+// If dedup is true, frames identical to the previous one (e.g. while nothing changes on the screen)
+// are deduplicated (see WithDedup()); they are compared exactly, so small changes like a blinking cursor are kept.
+//
+// Options passed after it override its settings, e.g. WithQuality().
+func WithScreenContent(dedup bool) Option {
+	return func(aw *aviWriter) {
+		WithSubsampling(Subsampling444)(aw)
+		aw.quality = screenContentQuality
+		if dedup {
+			WithDedup(0)(aw)
+		}
+	}
+}
+
+// ScreenSource is a FrameSource which takes screenshots with a user-provided function, paced to a target frame rate.
+//
+// A frame is taken at each frame slot (every 1/FPS seconds from the start). If taking a screenshot
+// (or processing the previous frame, e.g. encoding it) takes longer than a frame slot, the missed slots are dropped.
+// Dropped frames are counted, see Dropped().
+type ScreenSource struct {
+	ctx     context.Context
+	capture func() image.Image
+	cfg     ScreenConfig
+
+	// slotDur is the duration of a frame slot
+	slotDur time.Duration
+	// start is the time of the first frame slot, zero before the first frame
+	start time.Time
+	// next is the index of the next frame slot
+	next int
+	// frames is the number of returned frames
+	frames int
+	// dropped is the number of dropped frames
+	dropped int
+	// last is the last screenshot
+	last image.Image
+}
+
+// NewScreenSource returns a ScreenSource which calls capture to take screenshots, e.g. with a screenshot library:
+//
+//	aw, err := mjpeg.New("screen.avi", 1920, 1080, 10, mjpeg.WithScreenContent(true))
+//	checkErr(err)
+//	src := mjpeg.NewScreenSource(ctx, func() image.Image {
+//		img, _ := screenshot.CaptureDisplay(0)
+//		return img
+//	}, mjpeg.ScreenConfig{FPS: 10, Duration: time.Minute})
+//	_, err = mjpeg.AddFrames(aw, src)
+//	checkErr(err)
+//	checkErr(aw.Close())
+//
+// If capture returns nil, the frame is dropped. NextFrame() blocks until the next frame slot.
+// It returns io.EOF if ctx is cancelled, or if the duration or the frame limit of cfg is reached.
+// The FPS of cfg should match the FPS of the video.
+func NewScreenSource(ctx context.Context, capture func() image.Image, cfg ScreenConfig) *ScreenSource {
+	if cfg.FPS <= 0 {
+		cfg.FPS = 10
+	}
+	return &ScreenSource{ctx: ctx, capture: capture, cfg: cfg, slotDur: time.Second / time.Duration(cfg.FPS)}
+}
+
+// NextFrame implements FrameSource.NextFrame().
+func (ss *ScreenSource) NextFrame() (image.Image, error) {
+	for {
+		if ss.cfg.MaxFrames > 0 && ss.frames >= ss.cfg.MaxFrames || ss.ctx.Err() != nil {
+			return nil, io.EOF
+		}
+		if ss.start.IsZero() {
+			ss.start = time.Now()
+		}
+		slotStart := ss.start.Add(time.Duration(ss.next) * ss.slotDur)
+		if ss.cfg.Duration > 0 && slotStart.Sub(ss.start) >= ss.cfg.Duration {
+			return nil, io.EOF
+		}
+
+		now := time.Now()
+		if now.Sub(slotStart) >= ss.slotDur {
+			// Missed the slot
+			ss.next++
+			ss.dropped++
+			if ss.cfg.RepeatDropped && ss.last != nil {
+				ss.frames++
+				return ss.last, nil
+			}
+			continue
+		}
+		if wait := slotStart.Sub(now); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-ss.ctx.Done():
+				t.Stop()
+				return nil, io.EOF
+			case <-t.C:
+			}
+		}
+
+		ss.next++
+		img := ss.capture()
+		if img == nil {
+			ss.dropped++
+			continue
+		}
+		ss.last = img
+		ss.frames++
+		return img, nil
+	}
+}
+
+// Frames returns the number of frames returned so far (including repeated frames).
+func (ss *ScreenSource) Frames() int {
+	return ss.frames
+}
+
+// Dropped returns the number of frames dropped so far (including repeated frames).
+func (ss *ScreenSource) Dropped() int {
+	return ss.dropped
+}
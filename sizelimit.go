@@ -0,0 +1,64 @@
+package mjpeg
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrSizeLimit reports if a frame can't be added because the video file would exceed
+// the size limit set with WithMaxFileSize(). The video can still be finalized with Close().
+var ErrSizeLimit = errors.New("Video file size limit reached")
+
+// WithMaxFileSize returns an Option which limits the size of the video file to n bytes:
+// adding a frame (or custom chunk) which would make the finalized file (including the index to come)
+// exceed the limit fails with ErrSizeLimit, so the caller can finalize the video cleanly.
+// The size of the finalized file is estimated conservatively, so it may end up slightly below the limit.
+func WithMaxFileSize(n int64) Option {
+	return func(aw *aviWriter) {
+		aw.maxSize = n
+	}
+}
+
+// checkSize checks if the finalized file would fit the limits of the AVI format and the size limit
+// after writing chunks of the given total size (including chunk headers and padding) with the given number
+// of index entries.
+func (aw *aviWriter) checkSize(chunks int64, entries int) error {
+	if aw.frames >= math.MaxInt32 {
+		return aw.tooLarge("frame count")
+	}
+	size := aw.finalSize(chunks, entries)
+	if size > maxFileSize {
+		return aw.tooLarge("RIFF size")
+	}
+	if aw.maxSize > 0 && size > aw.maxSize {
+		return ErrSizeLimit
+	}
+	return nil
+}
+
+// finalSize returns a (conservative) estimate of the size of the finalized file after writing chunks
+// of the given total size (including chunk headers and padding) with the given number of index entries.
+func (aw *aviWriter) finalSize(chunks int64, entries int) int64 {
+	size := aw.currentPos() + chunks
+	if pg := int64(aw.paddingGranularity()); pg > 0 {
+		size += pg + 8 + 12 // Padding JUNK chunk, 'rec ' list header
+		entries++           // Index entry of the 'rec ' list
+	}
+	size += 8 + int64(aw.idxEntries+entries)*16 // idx1 chunk
+	for _, oi := range aw.odmlIndices {
+		size += 32 + int64(len(oi.pending)+entries)*8 // Last ix## chunk
+	}
+	for _, c := range aw.customChunks {
+		size += 9 + int64(len(c.data))
+	}
+	return size
+}
+
+// metaChunkSize returns the size of the metadata chunk of the next frame (0 if there is no metadata stream),
+// and the number of its index entries.
+func (aw *aviWriter) metaChunkSize() (int64, int) {
+	if !aw.metaStream {
+		return 0, 0
+	}
+	return 9 + int64(len(aw.meta)), 1
+}
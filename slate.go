@@ -0,0 +1,81 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
+)
+
+// SlateConfig configures a slate frame (a placeholder shown e.g. while a camera is disconnected), see Slate().
+type SlateConfig struct {
+	// Text is the main text of the slate, "SIGNAL LOST" if empty
+	Text string
+	// Time is the timestamp shown under the text, none if zero
+	Time time.Time
+	// TimeLayout is the layout of the timestamp (see time.Time.Format()), "2006-01-02 15:04:05" if empty
+	TimeLayout string
+	// Background is the background color, dark gray if nil
+	Background color.Color
+	// Foreground is the color of the text, white if nil
+	Foreground color.Color
+}
+
+// Colors of slates.
+var (
+	slateBg = color.RGBA{32, 32, 32, 255}
+	slateFg = color.RGBA{255, 255, 255, 255}
+)
+
+// Slate renders a slate frame of the given size: the text of cfg with its timestamp under it,
+// centered on a plain background. The text size is chosen based on the frame size.
+func Slate(width, height int, cfg SlateConfig) *image.RGBA {
+	if cfg.Text == "" {
+		cfg.Text = "SIGNAL LOST"
+	}
+	if cfg.TimeLayout == "" {
+		cfg.TimeLayout = "2006-01-02 15:04:05"
+	}
+	if cfg.Background == nil {
+		cfg.Background = slateBg
+	}
+	if cfg.Foreground == nil {
+		cfg.Foreground = slateFg
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Rect, image.NewUniform(cfg.Background), image.Point{}, draw.Src)
+
+	lines := []string{cfg.Text}
+	if !cfg.Time.IsZero() {
+		lines = append(lines, cfg.Time.Format(cfg.TimeLayout))
+	}
+	// Scale so the longest line covers at most 80% of the width, and the text block half of the height
+	scale := height / (len(lines) * 2 * (glyphHeight + 2))
+	for _, s := range lines {
+		if w := textSize(s, 1).X; w > 0 && width*4/5/w < scale {
+			scale = width * 4 / 5 / w
+		}
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	lineHeight := (glyphHeight + 2) * scale
+	y := (height - len(lines)*lineHeight) / 2
+	for _, s := range lines {
+		size := textSize(s, scale)
+		drawText(img, image.Pt((width-size.X)/2, y+scale), s, scale, cfg.Foreground)
+		y += lineHeight
+	}
+	return img
+}
+
+// Slate implements AviWriter.Slate().
+func (aw *aviWriter) Slate(cfg SlateConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := aw.encodeJPEG(&buf, Slate(int(aw.width), int(aw.height), cfg)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+package mjpeg
+
+import (
+	"image"
+	"io"
+)
+
+// FrameSource is a source of video frames.
+type FrameSource interface {
+	// NextFrame returns the next frame of the source.
+	// io.EOF is returned if the source has no more frames.
+	// The returned image is only valid until the next call to NextFrame().
+	NextFrame() (image.Image, error)
+}
+
+// AddFrames adds all frames from src to aw, until src reports io.EOF.
+// The number of added frames is returned.
+func AddFrames(aw AviWriter, src FrameSource) (n int, err error) {
+	for {
+		img, err := src.NextFrame()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err = aw.AddImage(img); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,143 @@
+package mjpeg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrSubtitles reports if the SRT file of a video can't be parsed.
+var ErrSubtitles = errors.New("Invalid subtitles file")
+
+// maxAnnotationDur is the maximum duration an annotation is displayed for.
+const maxAnnotationDur = 3 * time.Second
+
+// annotation is a text annotation of a frame.
+type annotation struct {
+	// frame is the index of the annotated frame
+	frame int
+	// text is the annotation text
+	text string
+}
+
+// Annotate implements AviWriter.Annotate().
+func (aw *aviWriter) Annotate(frame int, text string) {
+	aw.annotations = append(aw.annotations, annotation{frame: frame, text: text})
+}
+
+// srtFile returns the name of the companion SRT file of the given AVI file.
+func srtFile(aviFile string) string {
+	return strings.TrimSuffix(aviFile, filepath.Ext(aviFile)) + ".srt"
+}
+
+// writeSRT writes the annotations into an SRT subtitle file.
+// An annotation is displayed from its frame until the next annotated frame,
+// but at most for maxAnnotationDur and not beyond the end of the video.
+func (aw *aviWriter) writeSRT() (err error) {
+	anns := aw.annotations
+	sort.SliceStable(anns, func(i, j int) bool { return anns[i].frame < anns[j].frame })
+
+	if aw.aviFile == "" {
+		return nil // Writing to an io.Writer, there is no video file to write next to
+	}
+	f, err := os.Create(srtFile(aw.aviFile))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	videoEnd := aw.frameTime(aw.frames)
+	for i, seq := 0, 1; i < len(anns); seq++ {
+		// Annotations of the same frame are displayed together
+		frame, lines := anns[i].frame, []string{anns[i].text}
+		for i++; i < len(anns) && anns[i].frame == frame; i++ {
+			lines = append(lines, anns[i].text)
+		}
+
+		start := aw.frameTime(frame)
+		end := start + maxAnnotationDur
+		if i < len(anns) {
+			if next := aw.frameTime(anns[i].frame); next < end {
+				end = next
+			}
+		}
+		if end > videoEnd && videoEnd > start {
+			end = videoEnd
+		}
+
+		fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", seq, formatSRTTime(start), formatSRTTime(end), strings.Join(lines, "\n"))
+	}
+	return w.Flush()
+}
+
+// formatSRTTime formats a timestamp in SRT format: HH:MM:SS,mmm
+func formatSRTTime(t time.Duration) string {
+	ms := t.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// readSRT reads the annotations from the SRT file of the video (opened for appending), written by writeSRT().
+// Returns no annotations if there is no SRT file.
+func (aw *aviWriter) readSRT() ([]annotation, error) {
+	data, err := os.ReadFile(srtFile(aw.aviFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var anns []annotation
+	for _, block := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n\n") {
+		block = strings.Trim(block, "\n")
+		if block == "" {
+			continue
+		}
+		lines := strings.Split(block, "\n")
+		if len(lines) < 3 {
+			return nil, ErrSubtitles
+		}
+		start, _, _ := strings.Cut(lines[1], " --> ")
+		t, ok := parseSRTTime(start)
+		if !ok {
+			return nil, ErrSubtitles
+		}
+		frame := aw.srtFrame(t)
+		for _, text := range lines[2:] {
+			anns = append(anns, annotation{frame: frame, text: text})
+		}
+	}
+	return anns, nil
+}
+
+// srtFrame returns the index of the frame whose start time is formatted as the SRT timestamp t
+// (times are truncated to milliseconds).
+func (aw *aviWriter) srtFrame(t time.Duration) int {
+	if aw.fps <= 0 {
+		return 0
+	}
+	frame := int(t.Milliseconds() * int64(aw.fps) / (1000 * int64(aw.scale))) // Not after the frame
+	for aw.frameTime(frame).Milliseconds() < t.Milliseconds() {
+		frame++
+	}
+	return frame
+}
+
+// parseSRTTime parses a timestamp in SRT format: HH:MM:SS,mmm
+func parseSRTTime(s string) (time.Duration, bool) {
+	var h, m, sec, ms int64
+	if n, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d:%d,%d", &h, &m, &sec, &ms); err != nil || n != 4 {
+		return 0, false
+	}
+	return time.Duration(((h*60+m)*60+sec)*1000+ms) * time.Millisecond, true
+}
@@ -0,0 +1,93 @@
+package mjpeg
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// ErrStereoSize reports if the left and right images of a stereo pair differ in size.
+var ErrStereoSize = errors.New("Stereo images differ in size")
+
+// StereoLayout is the layout of the left and right images of a stereo pair in a frame.
+type StereoLayout int
+
+const (
+	// SideBySide places the left image on the left, the right image on the right (the frame is twice as wide).
+	SideBySide StereoLayout = iota
+	// TopBottom places the left image on the top, the right image at the bottom (the frame is twice as high).
+	TopBottom
+)
+
+// String returns the name of the layout, as used in the metadata tag (see StereoWriter).
+func (l StereoLayout) String() string {
+	if l == TopBottom {
+		return "top-bottom"
+	}
+	return "side-by-side"
+}
+
+// Size returns the size of a composed frame with the given size of the left and right images.
+func (l StereoLayout) Size(eye image.Point) image.Point {
+	if l == TopBottom {
+		return image.Pt(eye.X, 2*eye.Y)
+	}
+	return image.Pt(2*eye.X, eye.Y)
+}
+
+// StereoWriter composes synchronized left and right images (e.g. of two webcams of a stereoscopic rig)
+// into single frames and adds them to an AviWriter. The size of the AviWriter must be the composed size,
+// see StereoLayout.Size().
+type StereoWriter struct {
+	// aw is the destination
+	aw AviWriter
+	// layout is the layout of the frames
+	layout StereoLayout
+	// tag tells if the layout is set as the metadata of frames
+	tag bool
+	// img is the reused composed image
+	img *image.RGBA
+}
+
+// NewStereoWriter returns a new StereoWriter adding frames to aw, composed with the given layout.
+// If tag is true, the layout ("stereo=side-by-side" or "stereo=top-bottom") is set as the metadata of each frame,
+// so players can detect it; this has effect only if the metadata stream of aw is enabled, see WithMetadataStream().
+func NewStereoWriter(aw AviWriter, layout StereoLayout, tag bool) *StereoWriter {
+	return &StereoWriter{aw: aw, layout: layout, tag: tag}
+}
+
+// AddPair composes the left and right images into a frame, and adds it to the AviWriter.
+// ErrStereoSize is returned if the images differ in size.
+func (sw *StereoWriter) AddPair(left, right image.Image) error {
+	img, err := ComposeStereo(sw.img, left, right, sw.layout)
+	if err != nil {
+		return err
+	}
+	sw.img = img
+	if sw.tag {
+		sw.aw.SetMetadata([]byte("stereo=" + sw.layout.String()))
+	}
+	return sw.aw.AddImage(img)
+}
+
+// ComposeStereo composes the left and right images into one image with the given layout.
+// dst is reused if it is not nil and has the composed size. ErrStereoSize is returned if the images differ in size.
+func ComposeStereo(dst *image.RGBA, left, right image.Image, layout StereoLayout) (*image.RGBA, error) {
+	lb, rb := left.Bounds(), right.Bounds()
+	if lb.Size() != rb.Size() {
+		return nil, ErrStereoSize
+	}
+	r := image.Rectangle{Max: layout.Size(lb.Size())}
+	if dst == nil || dst.Rect != r {
+		dst = image.NewRGBA(r)
+	}
+
+	offset := image.Pt(lb.Dx(), 0)
+	if layout == TopBottom {
+		offset = image.Pt(0, lb.Dy())
+	}
+	eye := image.Rectangle{Max: lb.Size()}
+	draw.Draw(dst, eye, left, lb.Min, draw.Src)
+	draw.Draw(dst, eye.Add(offset), right, rb.Min, draw.Src)
+	return dst, nil
+}
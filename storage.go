@@ -0,0 +1,194 @@
+package mjpeg
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrUploaded reports if data to be overwritten (e.g. a back-patched header field) was already uploaded
+// to the Storage. Increase the part size (see WithPartSize()) if it happens.
+var ErrUploaded = errors.New("Data already uploaded")
+
+// defaultPartSize is the default size of the parts uploaded to a Storage.
+const defaultPartSize = 8 << 20
+
+// Storage is a destination of videos which can't seek, e.g. a multipart upload to an object store
+// (see the objstore package for S3 and GCS adapters).
+//
+// The video is uploaded in parts of the same size (except the last one, which may be larger or smaller),
+// so parts can be uploaded as the video is being written. Since the headers at the start of the video are
+// finalized when it is closed, the first part is kept in memory and is uploaded last, by Close().
+// Chunk sizes and other fields are back-patched while they are still in memory,
+// so no local temporary file of the video is needed (only the index is spooled to a temporary file).
+type Storage interface {
+	// UploadPart uploads the part of the video with the given number (starting at 1).
+	// data must not be retained after UploadPart returns.
+	UploadPart(n int, data []byte) error
+
+	// Complete completes the upload, after all parts are uploaded.
+	Complete() error
+
+	// Abort aborts the upload, discarding the uploaded parts.
+	Abort() error
+}
+
+// WithPartSize returns an Option which sets the size of the parts uploaded to a Storage (see NewStorageWriter()).
+// The default is 8 MB. The part size must be at least the size of the largest frame (and the size of the
+// reserved index, see WithIndexReserve()). Object stores may require a minimum part size, e.g. 5 MB for S3.
+func WithPartSize(size int) Option {
+	return func(aw *aviWriter) {
+		aw.partSize = size
+	}
+}
+
+// NewStorageWriter returns a new AviWriter writing the video to the given storage.
+// The Close() method of the AviWriter must be called to finalize the video and complete the upload,
+// the upload is aborted if writing the video fails.
+func NewStorageWriter(s Storage, width, height, fps int32, opts ...Option) (AviWriter, error) {
+	pw := &partWriter{s: s, partSize: defaultPartSize, next: 2}
+	opts = append(opts, func(aw *aviWriter) {
+		if aw.partSize > 0 {
+			pw.partSize = aw.partSize
+		}
+		pw.tailPos = int64(pw.partSize)
+	})
+	aw, err := newWriter("", pw, width, height, fps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &storageWriter{AviWriter: aw, pw: pw}, nil
+}
+
+// storageWriter is the AviWriter writing to a Storage.
+type storageWriter struct {
+	AviWriter
+	// pw is the output of the writer
+	pw *partWriter
+}
+
+// Close finalizes the video, and completes the upload (or aborts it if writing the video failed,
+// joining the error of aborting to the returned error).
+func (sw *storageWriter) Close() error {
+	err := sw.AviWriter.Close()
+	if err == nil {
+		err = sw.pw.complete()
+	}
+	if err != nil {
+		err = joinCleanupErrs(err, []error{sw.pw.s.Abort()})
+	}
+	return err
+}
+
+// partWriter is an io.WriteSeeker uploading the written data to a Storage by parts.
+// The first part (head) is kept until the upload is completed, and the data after the uploaded parts (tail)
+// is kept until it reaches 2 parts, so recently written data can be overwritten.
+type partWriter struct {
+	// s is the destination
+	s Storage
+	// partSize is the size of parts
+	partSize int
+	// head is the data of the first part
+	head []byte
+	// tail is the data after the uploaded parts, starting at tailPos
+	tail    []byte
+	tailPos int64
+	// next is the number of the next part to upload (after the head)
+	next int
+	// pos is the current position
+	pos int64
+	// size is the size of the written data
+	size int64
+}
+
+// Write implements io.Writer.
+func (pw *partWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		var c int
+		switch end := pw.pos + int64(len(p)); {
+		case pw.pos < int64(pw.partSize):
+			if end > int64(pw.partSize) {
+				end = int64(pw.partSize)
+			}
+			pw.head = grow(pw.head, int(end))
+			c = copy(pw.head[pw.pos:end], p)
+		case pw.pos < pw.tailPos:
+			return n, ErrUploaded
+		default:
+			pw.tail = grow(pw.tail, int(end-pw.tailPos))
+			c = copy(pw.tail[pw.pos-pw.tailPos:], p)
+		}
+		pw.pos += int64(c)
+		p = p[c:]
+		n += c
+	}
+	if pw.pos > pw.size {
+		pw.size = pw.pos
+	}
+
+	for len(pw.tail) >= 2*pw.partSize {
+		if err = pw.s.UploadPart(pw.next, pw.tail[:pw.partSize]); err != nil {
+			return n, err
+		}
+		pw.tail = append(pw.tail[:0], pw.tail[pw.partSize:]...)
+		pw.tailPos += int64(pw.partSize)
+		pw.next++
+	}
+	return n, nil
+}
+
+// grow returns b extended to (at least) size bytes (with zeros).
+func grow(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(b, make([]byte, size-len(b))...)
+}
+
+// Seek implements io.Seeker.
+func (pw *partWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += pw.pos
+	case io.SeekEnd:
+		offset += pw.size
+	}
+	if offset < 0 {
+		return pw.pos, os.ErrInvalid
+	}
+	pw.pos = offset
+	return pw.pos, nil
+}
+
+// Truncate discards the data after size, if it is not yet uploaded (see riff.Writer.Rollback()).
+func (pw *partWriter) Truncate(size int64) error {
+	if pw.next > 2 && size < pw.tailPos {
+		return ErrUploaded
+	}
+	if size < int64(len(pw.head)) {
+		pw.head = pw.head[:size]
+	}
+	switch {
+	case size <= pw.tailPos:
+		pw.tail = pw.tail[:0]
+	case size-pw.tailPos < int64(len(pw.tail)):
+		pw.tail = pw.tail[:size-pw.tailPos]
+	}
+	if size < pw.size {
+		pw.size = size
+	}
+	return nil
+}
+
+// complete uploads the remaining parts (the tail and the head), and completes the upload.
+func (pw *partWriter) complete() error {
+	if len(pw.tail) > 0 {
+		if err := pw.s.UploadPart(pw.next, pw.tail); err != nil {
+			return err
+		}
+	}
+	if err := pw.s.UploadPart(1, pw.head); err != nil {
+		return err
+	}
+	return pw.s.Complete()
+}
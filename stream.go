@@ -0,0 +1,161 @@
+package mjpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrFrameTooLarge reports if a frame in a stream is larger than the allowed maximum.
+var ErrFrameTooLarge = errors.New("Frame too large")
+
+// maxStreamFrameSize is the maximum size of a frame read from streams.
+const maxStreamFrameSize = 64 << 20
+
+// FrameReader reads encoded (e.g. JPEG) frames from a stream.
+type FrameReader interface {
+	// ReadFrame returns the next frame, io.EOF if there are no more frames.
+	// The returned slice is only valid until the next call.
+	ReadFrame() ([]byte, error)
+}
+
+// AddEncodedFrames adds all frames read from fr to aw with AddFrame().
+// Returns the number of added frames. Reaching the end of the stream is not an error.
+func AddEncodedFrames(aw AviWriter, fr FrameReader) (n int, err error) {
+	for {
+		data, err := fr.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		if err = aw.AddFrame(data); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// mjpegStreamReader is a FrameReader of raw MJPEG streams.
+type mjpegStreamReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewMJPEGStreamReader returns a FrameReader reading a raw MJPEG stream: concatenated JPEG images
+// (as output by many cameras and tools, e.g. ffmpeg -f mjpeg). Images are split by parsing
+// their markers, so embedded thumbnails (e.g. in EXIF data) do not confuse the reader.
+// Data between images (before the start of image marker) is skipped.
+func NewMJPEGStreamReader(r io.Reader) FrameReader {
+	return &mjpegStreamReader{r: bufio.NewReader(r)}
+}
+
+// ReadFrame implements FrameReader.ReadFrame().
+func (mr *mjpegStreamReader) ReadFrame() ([]byte, error) {
+	// Find the start of image marker
+	for prev := byte(0); ; {
+		b, err := mr.r.ReadByte()
+		if err != nil {
+			return nil, err // io.EOF: no more frames
+		}
+		if prev == 0xff && b == markerSOI {
+			break
+		}
+		prev = b
+	}
+	mr.buf = append(mr.buf[:0], 0xff, markerSOI)
+
+	readByte := func() (byte, error) {
+		b, err := mr.r.ReadByte()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		mr.buf = append(mr.buf, b)
+		if err == nil && len(mr.buf) > maxStreamFrameSize {
+			err = ErrFrameTooLarge
+		}
+		return b, err
+	}
+
+	inScan := false
+	for {
+		b, err := readByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != 0xff {
+			if inScan {
+				continue // Entropy coded data
+			}
+			return nil, errInvalidJPEG
+		}
+		for b == 0xff { // Fill bytes
+			if b, err = readByte(); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case b == 0x00 || b >= 0xd0 && b <= 0xd7 || b == 0x01:
+			continue // Stuffed 0xff in entropy coded data, or standalone marker
+		case b == markerEOI:
+			return mr.buf, nil
+		}
+
+		// Marker segment with length
+		hi, err := readByte()
+		if err != nil {
+			return nil, err
+		}
+		lo, err := readByte()
+		if err != nil {
+			return nil, err
+		}
+		length := int(hi)<<8 | int(lo)
+		if length < 2 {
+			return nil, errInvalidJPEG
+		}
+		for i := 2; i < length; i++ {
+			if _, err := readByte(); err != nil {
+				return nil, err
+			}
+		}
+		inScan = b == markerSOS
+	}
+}
+
+// lengthPrefixedReader is a FrameReader of length-prefixed frames.
+type lengthPrefixedReader struct {
+	r   io.Reader
+	buf []byte
+	hdr [4]byte
+}
+
+// NewLengthPrefixedReader returns a FrameReader reading frames each prefixed with its size
+// as a 4-byte big endian (network byte order) unsigned integer.
+func NewLengthPrefixedReader(r io.Reader) FrameReader {
+	return &lengthPrefixedReader{r: r}
+}
+
+// ReadFrame implements FrameReader.ReadFrame().
+func (lr *lengthPrefixedReader) ReadFrame() ([]byte, error) {
+	if _, err := io.ReadFull(lr.r, lr.hdr[:]); err != nil {
+		return nil, err // io.EOF if there are no more frames, io.ErrUnexpectedEOF if the size is truncated
+	}
+	size := binary.BigEndian.Uint32(lr.hdr[:])
+	if size > maxStreamFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	if cap(lr.buf) < int(size) {
+		lr.buf = make([]byte, size)
+	}
+	lr.buf = lr.buf[:size]
+	if _, err := io.ReadFull(lr.r, lr.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return lr.buf, nil
+}
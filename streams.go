@@ -0,0 +1,142 @@
+package mjpeg
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStreamIndex reports if a video stream index is out of range.
+var ErrStreamIndex = errors.New("Stream index out of range")
+
+// videoStream is an additional MJPEG video stream of a video, see WithVideoStream().
+type videoStream struct {
+	// width and height are the dimensions of the stream
+	width, height int32
+	// chunkID is the id of the frame chunks of the stream, e.g. "02dc"
+	chunkID int32
+	// lengthFieldPos is the position of the dwLength field of the stream header
+	lengthFieldPos int64
+	// frames is the number of frames written to the stream
+	frames int
+}
+
+// WithVideoStream returns an Option which adds an additional MJPEG video stream of the given size
+// to the video (e.g. the rear camera of a dashcam besides the front one).
+// The option may be used multiple times, the streams get the indices 1, 2, ... (index 0 is the main stream).
+// Frames of additional streams are added with AviWriter.AddFrameToStream(), and have the same frame rate
+// as the main stream. Frames of the streams are interleaved in the order they are added, so frames
+// of the same time should be added together.
+//
+// Options processing frames (e.g. WithDedup(), WithStrictJPEG(), overlays) only apply to the main stream.
+// Not supported by Open(), Resume(), Checkpoint() and NewPlan().
+func WithVideoStream(width, height int32) Option {
+	return func(aw *aviWriter) {
+		aw.videoStreams = append(aw.videoStreams, &videoStream{width: width, height: height})
+	}
+}
+
+// writeVideoStreamHeaders writes the stream lists of the additional video streams.
+// first is the stream number of the first additional stream.
+func (aw *aviWriter) writeVideoStreamHeaders(first int) {
+	wstr, wint32, wint16 := aw.writeStr, aw.writeInt32, aw.writeInt16
+
+	for i, vs := range aw.videoStreams {
+		stream := first + i
+		vs.chunkID = int32('0'+stream/10) | int32('0'+stream%10)<<8 | 'd'<<16 | 'c'<<24 // "##dc" compressed frame
+
+		aw.pushList("strl") // LIST chunk: stream headers (nesting level 2)
+		wstr("strh")        // Stream header
+		wint32(56)          // Length of the strh sub-chunk
+		wstr("vids")        // fccType - type of data stream - here 'vids' for video stream
+		wstr("MJPG")        // fccHandler: MJPG for Motion JPEG
+		wint32(0)           // dwFlags
+		wint32(0)           // wPriority, wLanguage
+		wint32(0)           // dwInitialFrames
+		wint32(aw.scale)    // dwScale
+		wint32(aw.fps)      // dwRate, same as the main stream
+		wint32(0)           // dwStart
+		vs.lengthFieldPos = aw.currentPos()
+		wint32(0)  // dwLength, number of frames (filled at Close())
+		wint32(0)  // dwSuggestedBufferSize
+		wint32(-1) // dwQuality, -1: default quality
+		wint32(0)  // dwSampleSize, 0 means that each frame is in its own chunk
+		wint16(0)  // left of rcFrame (unused)
+		wint16(0)  //   ..top
+		wint16(0)  //   ..right
+		wint16(0)  //   ..bottom
+
+		aw.pushChunk("strf")                  // stream format chunk (nesting level 3)
+		wint32(40)                            // biSize
+		wint32(vs.width)                      // biWidth
+		wint32(vs.height)                     // biHeight
+		wint16(1)                             // biPlanes
+		wint16(24)                            // biBitCount
+		wstr("MJPG")                          // biCompression
+		wint32(vs.width * vs.height * 24 / 8) // biSizeImage
+		wint32(0)                             // biXPelsPerMeter
+		wint32(0)                             // biYPelsPerMeter
+		wint32(0)                             // biClrUsed
+		wint32(0)                             // biClrImportant
+		aw.pop()                              // 'strf' chunk finished (nesting level 3)
+
+		if aw.odml {
+			aw.writeSuperIndex(stream, vs.chunkID)
+		}
+
+		wstr("strn") // Stream name
+		name := fmt.Sprintf("Video %d\000", i+1)
+		if len(name)&1 != 0 {
+			name += "\000"
+		}
+		wint32(int32(len(name)))
+		wstr(name)
+		aw.pop() // LIST 'strl' finished (nesting level 2)
+	}
+}
+
+// AddFrameToStream implements AviWriter.AddFrameToStream().
+func (aw *aviWriter) AddFrameToStream(stream int, jpegData []byte) error {
+	if stream == 0 {
+		return aw.AddFrame(jpegData)
+	}
+	if stream < 0 || stream > len(aw.videoStreams) {
+		return aw.notifyErr(ErrStreamIndex)
+	}
+	if aw.paused {
+		return nil
+	}
+	if aw.err != nil {
+		return aw.notifyErr(aw.err)
+	}
+	vs := aw.videoStreams[stream-1]
+	if err := aw.checkSize(9+int64(len(jpegData)), 1); err != nil {
+		return aw.notifyErr(err)
+	}
+	pos := aw.currentPos()
+	return aw.notifyErr(fatal(aw.do(func() error {
+		// "##dc" compressed frame (nesting level 2)
+		if err := aw.writeChunk(chunkName(vs.chunkID), jpegData); err != nil {
+			return err
+		}
+		if err := aw.writeIdxEntry(vs.chunkID, FlagKeyFrame, pos, len(jpegData)); err != nil {
+			return err
+		}
+		if aw.odml {
+			if err := aw.flushODML(false); err != nil {
+				return err
+			}
+		}
+		vs.frames++
+		return nil
+	})))
+}
+
+// finalizeVideoStreams fills the length fields of the additional video stream headers.
+func (aw *aviWriter) finalizeVideoStreams() {
+	pos := aw.currentPos()
+	for _, vs := range aw.videoStreams {
+		aw.seek(vs.lengthFieldPos, 0)
+		aw.writeInt32(int32(vs.frames)) // dwLength
+	}
+	aw.seek(pos, 0)
+}
@@ -0,0 +1,130 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrCorruptFrame reports if a JPEG frame is corrupt, see WithStrictJPEG().
+var ErrCorruptFrame = errors.New("Corrupt JPEG frame")
+
+// FrameError describes a corrupt JPEG frame rejected in strict mode, see WithStrictJPEG().
+// errors.Is(err, ErrCorruptFrame) reports true for it.
+type FrameError struct {
+	// Frame is the index the frame would have had in the video
+	Frame int
+	// Offset is the offset of the problem in the frame data
+	Offset int
+	// Reason describes the problem
+	Reason string
+}
+
+// Error implements error.
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("Corrupt JPEG frame %d at offset %d: %s", e.Frame, e.Offset, e.Reason)
+}
+
+// Is tells if target is ErrCorruptFrame.
+func (e *FrameError) Is(target error) bool {
+	return target == ErrCorruptFrame
+}
+
+// WithStrictJPEG returns an Option which makes the writer check the JPEG frames added with AddFrame()
+// before writing them: a frame must start with SOI, end with EOI, and have a parseable marker sequence.
+// Corrupt frames are rejected with a *FrameError (the writer remains usable), so they don't break
+// the playback of the video.
+//
+// If fixEOI is true, a frame whose only problem is a missing EOI marker (e.g. a truncated camera frame)
+// is fixed by appending the marker, instead of being rejected.
+func WithStrictJPEG(fixEOI bool) Option {
+	return func(aw *aviWriter) {
+		aw.strict, aw.fixEOI = true, fixEOI
+	}
+}
+
+// checkJPEG checks the JPEG data in strict mode (see WithStrictJPEG()).
+// Returns the data to be written: a copy with an EOI marker appended if it was missing and fixEOI is set.
+func (aw *aviWriter) checkJPEG(data []byte) ([]byte, error) {
+	offset, reason := checkJPEGMarkers(data)
+	if reason == "" {
+		return data, nil
+	}
+	if reason == reasonNoEOI && aw.fixEOI {
+		aw.fixBuf = append(append(aw.fixBuf[:0], data...), 0xff, markerEOI)
+		return aw.fixBuf, nil
+	}
+	return nil, &FrameError{Frame: aw.frames, Offset: offset, Reason: reason}
+}
+
+// reasonNoEOI is the problem reported by checkJPEGMarkers() if the EOI marker is missing.
+const reasonNoEOI = "missing EOI marker"
+
+// checkJPEGMarkers checks the marker sequence of the JPEG data.
+// Returns the offset and description of the first problem, an empty reason if the data is valid.
+// Zero bytes after the EOI marker (padding of capture buffers) are allowed.
+func checkJPEGMarkers(data []byte) (offset int, reason string) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return 0, "missing SOI marker"
+	}
+	scan := false // Tells if we're in entropy-coded data
+	for pos := 2; pos < len(data); {
+		if data[pos] != 0xff {
+			if !scan {
+				return pos, "marker expected"
+			}
+			pos++
+			continue
+		}
+		start := pos
+		for pos < len(data) && data[pos] == 0xff {
+			pos++ // Markers may be preceded by fill bytes
+		}
+		if pos >= len(data) {
+			break
+		}
+		marker := data[pos]
+		pos++
+
+		switch {
+		case marker == 0x00:
+			if !scan {
+				return start, "marker expected"
+			}
+			continue // Stuffed 0xff byte of entropy-coded data
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			continue // Standalone markers (TEM, RSTn)
+		case marker == markerSOI:
+			return start, "unexpected SOI marker"
+		case marker == markerEOI:
+			if !scan {
+				return start, "EOI marker before scan data"
+			}
+			for i := pos; i < len(data); i++ {
+				if data[i] != 0 {
+					return pos, "data after EOI marker"
+				}
+			}
+			return 0, ""
+		}
+
+		if pos+2 > len(data) {
+			return start, "truncated marker segment"
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 {
+			return pos, "invalid marker segment length"
+		}
+		if pos+length > len(data) {
+			return start, "truncated marker segment"
+		}
+		pos += length
+		if marker == markerSOS {
+			scan = true
+		}
+	}
+	if !scan {
+		return len(data), "missing scan data"
+	}
+	return len(data), reasonNoEOI
+}
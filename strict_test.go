@@ -0,0 +1,41 @@
+package mjpeg
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestStrictJPEG checks that corrupt frames are rejected without breaking the writer,
+// and that missing EOI markers are fixed if asked for.
+func TestStrictJPEG(t *testing.T) {
+	frames := testFrames(t, 2)
+	truncated := frames[1][:len(frames[1])-2] // Without EOI
+	for _, fixEOI := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "strict.avi")
+		awr, err := New(name, smallWidth, smallHeight, 10, WithStrictJPEG(fixEOI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := awr.AddFrame(frames[0]); err != nil {
+			t.Fatal(err)
+		}
+		err = awr.AddFrame([]byte{0xff, markerSOI, 0x12, 0x34})
+		var fe *FrameError
+		if !errors.As(err, &fe) || !errors.Is(err, ErrCorruptFrame) || fe.Frame != 1 {
+			t.Errorf("fixEOI %t: got error %v, want a *FrameError of frame 1", fixEOI, err)
+		}
+		err = awr.AddFrame(truncated)
+		if fixEOI && err != nil || !fixEOI && !errors.Is(err, ErrCorruptFrame) {
+			t.Errorf("fixEOI %t: got error %v for a missing EOI", fixEOI, err)
+		}
+		if err := awr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := [][]byte{frames[0]}
+		if fixEOI {
+			want = append(want, frames[1])
+		}
+		checkFrames(t, name, want)
+	}
+}
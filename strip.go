@@ -0,0 +1,77 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// WithStripMarkers returns an Option which makes the writer strip metadata segments from JPEG frames
+// as they are written: APPn segments (e.g. EXIF with thumbnails in APP1) and comments (COM),
+// except the JFIF and AVI1 APP0 segments. This makes frames of cameras smaller,
+// and avoids confusing MJPEG decoders.
+//
+// Only the segments before the first scan are processed, the image data is copied unaltered.
+// Frames which can't be parsed as JPEG are written as-is.
+func WithStripMarkers() Option {
+	return func(aw *aviWriter) {
+		aw.stripMarkers = true
+	}
+}
+
+// stripJPEG returns the JPEG data without its metadata segments (see WithStripMarkers()).
+// The result is built in the reused strip buffer, data is returned if there is nothing to strip
+// or it can't be parsed.
+func (aw *aviWriter) stripJPEG(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return data
+	}
+	out := append(aw.stripBuf[:0], 0xff, markerSOI)
+	stripped := false
+	for pos := 2; ; {
+		if pos >= len(data) || data[pos] != 0xff {
+			return data
+		}
+		for pos < len(data) && data[pos] == 0xff {
+			pos++ // Markers may be preceded by fill bytes
+		}
+		if pos >= len(data) {
+			return data
+		}
+		marker := data[pos]
+		start := pos - 1
+		pos++
+
+		switch {
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			out = append(out, 0xff, marker) // Standalone markers (TEM, RSTn)
+			continue
+		case marker == markerSOI || marker == markerEOI:
+			return data // No scan
+		case marker == markerSOS:
+			if !stripped {
+				return data
+			}
+			aw.stripBuf = append(out, data[start:]...)
+			return aw.stripBuf
+		}
+
+		if pos+2 > len(data) {
+			return data
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return data
+		}
+		seg := data[pos+2 : pos+length]
+		pos += length
+
+		if marker >= markerAPP0 && marker <= markerAPPF || marker == markerCOM {
+			if marker != markerAPP0 || !bytes.HasPrefix(seg, []byte("JFIF\000")) && !bytes.HasPrefix(seg, []byte("AVI1")) {
+				stripped = true
+				continue
+			}
+		}
+		out = append(out, 0xff, marker)
+		out = append(out, data[pos-length:pos]...)
+	}
+}
@@ -0,0 +1,24 @@
+package mjpeg
+
+import (
+	"testing"
+)
+
+// withSegment returns the JPEG data with a segment of the given marker and payload inserted after SOI.
+func withSegment(data []byte, marker byte, payload string) []byte {
+	n := len(payload) + 2
+	seg := append([]byte{0xff, marker, byte(n >> 8), byte(n)}, payload...)
+	return append(append(append([]byte(nil), data[:2]...), seg...), data[2:]...)
+}
+
+// TestStripMarkers checks that metadata segments are stripped, and the JFIF segment and the image data are kept.
+func TestStripMarkers(t *testing.T) {
+	frames := testFrames(t, 2)
+	jfif := withSegment(frames[1], markerAPP0, "JFIF\000\001\002\000\000\001\000\001\000\000")
+	added := [][]byte{
+		withSegment(withSegment(frames[0], markerCOM, "comment"), markerAPP0+1, "Exif\000\000thumbnail"),
+		withSegment(jfif, markerAPP0+2, "ICC_PROFILE"),
+	}
+	name := writeTestVideo(t, t.TempDir(), added, WithStripMarkers())
+	checkFrames(t, name, [][]byte{frames[0], jfif})
+}
@@ -0,0 +1,75 @@
+package mjpeg
+
+import "time"
+
+// SyncPolicy specifies how the writer keeps the video in sync with the audio added live, see WithAVSync().
+type SyncPolicy struct {
+	// MaxDrift is the maximum difference of the video and the audio timeline tolerated,
+	// the duration of 2 frames if 0
+	MaxDrift time.Duration
+	// LogOnly tells to only report the drift to Hooks.OnDrift (the drift is ignored if there is no hook),
+	// without dropping or duplicating frames
+	LogOnly bool
+}
+
+// DriftEvent describes a drift of the video from the audio, see WithAVSync().
+type DriftEvent struct {
+	// Frame is the index the added frame would have
+	Frame int
+	// Drift is the time the video timeline is ahead of the audio (negative if it is behind)
+	Drift time.Duration
+	// Dropped tells if the added frame was dropped to correct the drift
+	Dropped bool
+	// Duplicated is the number of times the last frame was repeated to correct the drift
+	Duplicated int
+}
+
+// WithAVSync returns an Option which makes the writer keep the video in sync with the audio
+// when both are added live (see WithPCMAudio()), e.g. in hours-long recordings where the clocks
+// of the camera and the sound card differ slightly.
+//
+// When a frame is added, the video timeline (frames/fps) is compared to the duration of the audio added so far.
+// If the video is ahead by more than the tolerated drift, the frame is dropped; if it is behind,
+// the last frame is repeated (using duplicate index entries) before adding the frame.
+// Drift is corrected only after the first audio is added, and is reported to Hooks.OnDrift.
+func WithAVSync(p SyncPolicy) Option {
+	return func(aw *aviWriter) {
+		aw.avSync = &p
+	}
+}
+
+// syncFrame corrects the drift of the video before a frame is added, and tells if the frame is to be written.
+func (aw *aviWriter) syncFrame() (bool, error) {
+	if aw.avSync == nil || aw.audio == nil || aw.audio.length == 0 || aw.fps <= 0 {
+		return true, nil
+	}
+	frameDur := aw.frameTime(1)
+	maxDrift := aw.avSync.MaxDrift
+	if maxDrift <= 0 {
+		maxDrift = 2 * frameDur
+	}
+	audioTime := aw.audioTime()
+	drift := aw.frameTime(aw.frames) - audioTime
+	if drift <= maxDrift && -drift <= maxDrift {
+		return true, nil
+	}
+
+	e := DriftEvent{Frame: aw.frames, Drift: drift}
+	if !aw.avSync.LogOnly {
+		if drift > 0 {
+			e.Dropped = true
+		} else {
+			// Repeat the last frame until the video catches up (leaving the added frame in sync)
+			for aw.frames > 0 && audioTime-aw.frameTime(aw.frames) > frameDur/2 {
+				if err := aw.addDupFrame(); err != nil {
+					return false, err
+				}
+				e.Duplicated++
+			}
+		}
+	}
+	if aw.hooks.OnDrift != nil {
+		aw.hooks.OnDrift(e)
+	}
+	return !e.Dropped, nil
+}
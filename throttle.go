@@ -0,0 +1,114 @@
+package mjpeg
+
+import "time"
+
+// ThrottlePolicy specifies how the writer enforces its frame rate on the input side,
+// see WithThrottle().
+type ThrottlePolicy struct {
+	// MaxQueue is the maximum number of frames arriving early (in an already filled frame slot)
+	// that are queued to fill later empty slots; frames not fitting the queue are dropped.
+	// If 0, early frames are dropped.
+	MaxQueue int
+	// MaxDup is the maximum number of times the last frame is repeated to fill a gap
+	// when frames arrive slower than the frame rate; negative means no limit.
+	// Slots of a gap longer than this are skipped (the video gets shorter than the real time).
+	MaxDup int
+}
+
+// throttle holds the state of the input side frame rate enforcement.
+type throttle struct {
+	ThrottlePolicy
+
+	// tl maps arrival times to frame slots
+	tl timeline
+	// now returns the current time
+	now func() time.Time
+	// next is the next frame slot to fill
+	next int
+	// queue holds the queued early frames
+	queue []queuedFrame
+}
+
+// queuedFrame is a frame queued by the throttle.
+type queuedFrame struct {
+	// data is the encoded frame data
+	data []byte
+	// flags are the index flags of the frame
+	flags IndexFlag
+}
+
+// WithThrottle returns an Option which makes the writer enforce its frame rate on the frames as they arrive
+// (in real time, as AddFrame() / AddImage() is called), e.g. to turn a free-running camera callback
+// into a correctly timed video: each arrival time is mapped to a frame slot of 1/fps duration.
+// Frames arriving faster than the frame rate (in an already filled slot) are dropped or queued,
+// frames arriving slower cause the last frame to be repeated (using a duplicate index entry,
+// without storing the frame again), as specified by the policy.
+// Queued frames still pending are written when the video is closed.
+func WithThrottle(p ThrottlePolicy) Option {
+	return func(aw *aviWriter) {
+		aw.throttle = &throttle{ThrottlePolicy: p, now: time.Now}
+	}
+}
+
+// init initializes the throttle for the given frame duration.
+func (th *throttle) init(frameDur time.Duration) {
+	if frameDur > 0 {
+		th.tl.slotDur = frameDur
+	}
+}
+
+// admitFrame fills the slots up to the slot of the current time (with queued frames or repeating the last frame),
+// and tells if an arriving frame is to be written in the current slot (else it is to be queued or dropped).
+func (aw *aviWriter) admitFrame() (bool, error) {
+	th := aw.throttle
+	slot := th.tl.slot(th.now())
+	for dups := 0; th.next < slot; th.next++ {
+		var err error
+		switch {
+		case len(th.queue) > 0:
+			q := th.queue[0]
+			th.queue = th.queue[1:]
+			err = aw.addEncodedFrame(q.data, q.flags)
+		case aw.frames > 0 && (th.MaxDup < 0 || dups < th.MaxDup):
+			err = aw.addDupFrame()
+			dups++
+		default:
+			th.next = slot - 1 // Skip the rest of the gap (the loop steps to slot)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	if th.next == slot {
+		th.next++
+		return true, nil
+	}
+	return false, nil
+}
+
+// canQueue tells if there is room for a frame in the queue.
+func (th *throttle) canQueue() bool {
+	return len(th.queue) < th.MaxQueue
+}
+
+// enqueue queues (a copy of) the frame data if there is room for it, else it is dropped.
+func (th *throttle) enqueue(data []byte, flags IndexFlag) {
+	if th.canQueue() {
+		th.queue = append(th.queue, queuedFrame{data: append([]byte(nil), data...), flags: flags})
+	}
+}
+
+// flushThrottle writes the queued frames, and returns the error if writing failed.
+// The rest of the queue is dropped if a frame is rejected (e.g. by the size limit).
+func (aw *aviWriter) flushThrottle() error {
+	for _, q := range aw.throttle.queue {
+		if err := aw.addEncodedFrame(q.data, q.flags); err != nil {
+			if fe, ok := err.(fatalError); ok {
+				return fe.err
+			}
+			return nil
+		}
+	}
+	aw.throttle.queue = nil
+	return nil
+}
@@ -0,0 +1,45 @@
+package mjpeg
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestThrottleSlowSource checks that frames of a source slower than the frame rate are all written,
+// and the gaps are filled as the policy specifies.
+func TestThrottleSlowSource(t *testing.T) {
+	data := smallJPEG(t)
+	for _, c := range []struct {
+		maxDup, frames int
+	}{
+		{0, 10},  // No repeats: every arrived frame is written
+		{1, 19},  // Each of the 9 gaps is filled by 1 repeat
+		{-1, 23}, // Gaps are filled completely: the last frame arrives in slot 22
+	} {
+		name := filepath.Join(t.TempDir(), "throttle.avi")
+		awr, err := New(name, 16, 8, 10, WithThrottle(ThrottlePolicy{MaxDup: c.maxDup}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		awr.(*aviWriter).throttle.now = func() time.Time { return now }
+		for i := 0; i < 10; i++ { // 4 fps source into a 10 fps video
+			if err := awr.AddFrame(data); err != nil {
+				t.Fatalf("MaxDup %d: %v", c.maxDup, err)
+			}
+			now = now.Add(250 * time.Millisecond)
+		}
+		if err := awr.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ar, err := NewReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ar.Info().Frames; got != c.frames {
+			t.Errorf("MaxDup %d: got %d frames, want %d", c.maxDup, got, c.frames)
+		}
+		ar.Close()
+	}
+}
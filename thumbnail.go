@@ -0,0 +1,145 @@
+package mjpeg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedCodec reports if frames of the video can't be decoded.
+var ErrUnsupportedCodec = errors.New("Unsupported codec")
+
+// Thumbnail returns the frame of the video aviFile shown at the given time, downscaled (keeping the aspect ratio)
+// so that neither its width nor its height exceeds maxDim (e.g. for galleries of recordings).
+// If at is negative, the poster frame is used (Info.Poster: the first frame if the file records none,
+// see WithPosterFrame()); if at is beyond the end
+// of the video, the last frame is used. The frame is not downscaled if maxDim is 0.
+//
+// MJPEG and raw (24-bit RGB and 8-bit grayscale DIB) videos are supported, ErrUnsupportedCodec
+// is returned for others.
+func Thumbnail(aviFile string, at time.Duration, maxDim int) (image.Image, error) {
+	ar, err := NewReader(aviFile)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if info.Frames == 0 {
+		return nil, ErrFrameIndex
+	}
+	i := info.Poster
+	if at >= 0 {
+		i = int(at.Seconds() * info.FPS())
+	}
+	if i >= info.Frames {
+		i = info.Frames - 1
+	}
+	data, err := ar.Frame(i)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeFrame(ar.(*aviReader), data)
+	if err != nil {
+		return nil, err
+	}
+	if maxDim <= 0 {
+		return img, nil
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxDim && h <= maxDim {
+		return img, nil
+	}
+	if w >= h {
+		w, h = maxDim, h*maxDim/w
+	} else {
+		w, h = w*maxDim/h, maxDim
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return resizeBox(copyToRGBA(nil, img), w, h), nil
+}
+
+// decodeFrame decodes the frame data of the video read by ar.
+func decodeFrame(ar *aviReader, data []byte) (image.Image, error) {
+	switch strings.ToUpper(ar.info.Codec) {
+	case "MJPG":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "DIB ", "\000\000\000\000":
+		return decodeDIB(data, int(ar.info.Width), int(ar.info.Height), ar.bitCount, ar.info.TopDown)
+	}
+	return nil, ErrUnsupportedCodec
+}
+
+// decodeDIB decodes a raw frame of bottom-up rows (or top-down rows if topDown is true,
+// see WithRawRGB() and WithTopDown()) with the given bits per pixel.
+func decodeDIB(data []byte, w, h, bitCount int, topDown bool) (image.Image, error) {
+	if bitCount != 24 && bitCount != 8 {
+		return nil, ErrUnsupportedCodec
+	}
+	bpp := bitCount / 8
+	stride := (w*bpp + 3) &^ 3
+	if w <= 0 || h <= 0 || len(data) < stride*h {
+		return nil, ErrUnsupportedCodec
+	}
+	rowPos := func(y int) int { // Position of the row of the image at y
+		if topDown {
+			return y * stride
+		}
+		return (h - 1 - y) * stride
+	}
+	if bpp == 1 {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			copy(img.Pix[y*img.Stride:y*img.Stride+w], data[rowPos(y):])
+		}
+		return img, nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		row := data[rowPos(y):]
+		pix := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			pix[x*4], pix[x*4+1], pix[x*4+2], pix[x*4+3] = row[x*3+2], row[x*3+1], row[x*3], 0xff
+		}
+	}
+	return img, nil
+}
+
+// resizeBox returns src downscaled to w x h, each destination pixel being the average of the source pixels it covers.
+func resizeBox(src *image.RGBA, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Rect
+	sw, sh := b.Dx(), b.Dy()
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, (dy+1)*sh/h
+		if y1 == y0 {
+			y1++
+		}
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, (dx+1)*sw/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n int
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(b.Min.X+x0, b.Min.Y+y)
+				for x := x0; x < x1; x, i = x+1, i+4 {
+					r, g, bl, a, n = r+int(src.Pix[i]), g+int(src.Pix[i+1]), bl+int(src.Pix[i+2]), a+int(src.Pix[i+3]), n+1
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{byte(r / n), byte(g / n), byte(bl / n), byte(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,138 @@
+package mjpeg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTimecode reports if a timecode can't be parsed.
+var ErrInvalidTimecode = errors.New("Invalid timecode")
+
+// Timecode is an SMPTE timecode: HH:MM:SS:FF, where FF is the frame number within the second.
+//
+// Drop-frame timecodes (HH:MM:SS;FF) are used with the nominal frame rates 30 and 60 of NTSC videos
+// (29.97 and 59.94 frames/second): frame numbers 0 and 1 (0 to 3 at 60 fps) are skipped at the start
+// of each minute except every tenth minute, so the timecode stays in sync with the wall clock.
+type Timecode struct {
+	Hours, Minutes, Seconds, Frames int
+	// DropFrame tells if the timecode is drop-frame
+	DropFrame bool
+}
+
+// ParseTimecode parses a timecode in the form of HH:MM:SS:FF, or HH:MM:SS;FF for drop-frame timecodes.
+func ParseTimecode(s string) (Timecode, error) {
+	var tc Timecode
+	parts := strings.Split(s, ":")
+	if len(parts) == 3 {
+		if i := strings.IndexByte(parts[2], ';'); i >= 0 {
+			parts = append(parts[:2], parts[2][:i], parts[2][i+1:])
+			tc.DropFrame = true
+		}
+	}
+	if len(parts) != 4 {
+		return tc, ErrInvalidTimecode
+	}
+	fields := []*int{&tc.Hours, &tc.Minutes, &tc.Seconds, &tc.Frames}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || len(p) != 2 || n < 0 {
+			return tc, ErrInvalidTimecode
+		}
+		*fields[i] = n
+	}
+	if tc.Hours > 23 || tc.Minutes > 59 || tc.Seconds > 59 {
+		return tc, ErrInvalidTimecode
+	}
+	return tc, nil
+}
+
+// String returns the timecode in the form of HH:MM:SS:FF (HH:MM:SS;FF if it is drop-frame).
+func (tc Timecode) String() string {
+	sep := ':'
+	if tc.DropFrame {
+		sep = ';'
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%c%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+// dropFrames returns the number of frame numbers skipped at the start of minutes at the given (nominal) frame rate,
+// 0 if the timecode is not drop-frame or drop-frame is not defined for the frame rate.
+func (tc Timecode) dropFrames(fps int) int {
+	if !tc.DropFrame || fps != 30 && fps != 60 {
+		return 0
+	}
+	return fps / 15
+}
+
+// FrameCount returns the number of frames from 00:00:00:00 to the timecode at the given (nominal) frame rate.
+func (tc Timecode) FrameCount(fps int32) int {
+	f := int(fps)
+	if f <= 0 {
+		f = 1
+	}
+	mins := 60*tc.Hours + tc.Minutes
+	n := (60*mins+tc.Seconds)*f + tc.Frames
+	return n - tc.dropFrames(f)*(mins-mins/10)
+}
+
+// Add returns the timecode frames after tc at the given (nominal) frame rate, wrapping around after 24 hours.
+// E.g. the timecode of a frame of a video is start.Add(frameNo, fps).
+func (tc Timecode) Add(frames int, fps int32) Timecode {
+	f := int(fps)
+	if f <= 0 {
+		f = 1
+	}
+	drop := tc.dropFrames(f)
+	perDay := 24 * 3600 * f
+	if drop > 0 {
+		perDay -= 24 * 6 * 9 * drop
+	}
+	n := (tc.FrameCount(fps) + frames) % perDay
+	if n < 0 {
+		n += perDay
+	}
+
+	if drop > 0 {
+		// Add the skipped frame numbers to get the frame number as if nothing was skipped
+		per10Min := 600*f - 9*drop
+		perMin := 60*f - drop
+		d, m := n/per10Min, n%per10Min
+		n += 9 * drop * d
+		if m > drop {
+			n += drop * ((m - drop) / perMin)
+		}
+	}
+
+	secs := n / f
+	return Timecode{Hours: secs / 3600, Minutes: secs / 60 % 60, Seconds: secs % 60, Frames: n % f, DropFrame: tc.DropFrame}
+}
+
+// WithTimecode returns an Option which associates the starting timecode start with the video:
+// it is written into the file as the ISMP (SMPTE timecode) entry of the INFO list, reported by AviReader.Info().
+// The timecode of a frame is start.Add(frameNo, fps), see TimecodeOverlayFrom() to burn it into the frames.
+func WithTimecode(start Timecode) Option {
+	return func(aw *aviWriter) {
+		aw.timecode = start.String()
+	}
+}
+
+// writeInfo writes the INFO list with the starting timecode, the color information and the poster frame.
+func (aw *aviWriter) writeInfo() {
+	aw.pushList("INFO") // LIST chunk: file information (nesting level 1)
+	aw.writeTimecodeEntry()
+	aw.writeColorEntry()
+	aw.writePosterEntry()
+	aw.pop() // LIST 'INFO' finished (nesting level 1)
+}
+
+// writeTimecodeEntry writes the ISMP entry of the INFO list, if a starting timecode is set.
+func (aw *aviWriter) writeTimecodeEntry() {
+	if aw.timecode == "" {
+		return
+	}
+	aw.pushChunk("ISMP")
+	aw.writeStr(aw.timecode + "\000") // Zero terminated (padded to even size by pop())
+	aw.pop()
+}
@@ -0,0 +1,84 @@
+package mjpeg
+
+import (
+	"testing"
+)
+
+// TestTimecode checks parsing, formatting and the frame math of timecodes, including drop-frame timecodes.
+func TestTimecode(t *testing.T) {
+	for _, c := range []struct {
+		tc     string
+		fps    int32
+		frames int
+	}{
+		{"00:00:00:00", 25, 0},
+		{"00:00:01:00", 25, 25},
+		{"01:02:03:04", 25, ((60+2)*60+3)*25 + 4},
+		{"00:00:59;29", 30, 1799},
+		{"00:01:00;02", 30, 1800}, // Frame numbers 0 and 1 are skipped
+		{"00:02:00;02", 30, 3598},
+		{"00:10:00;00", 30, 17982}, // Not skipped at every tenth minute
+		{"00:11:00;02", 30, 19782},
+		{"01:00:00;00", 30, 107892},
+		{"00:01:00;04", 60, 3600}, // Frame numbers 0 to 3 are skipped at 60 fps
+		{"00:10:00;00", 60, 35964},
+		{"00:01:00;00", 25, 1500}, // Drop-frame is not defined for 25 fps
+	} {
+		tc, err := ParseTimecode(c.tc)
+		if err != nil {
+			t.Errorf("%s: %v", c.tc, err)
+			continue
+		}
+		if s := tc.String(); s != c.tc {
+			t.Errorf("%s: got string %s", c.tc, s)
+		}
+		if n := tc.FrameCount(c.fps); n != c.frames {
+			t.Errorf("%s: got frame count %d at %d fps, want %d", c.tc, n, c.fps, c.frames)
+		}
+		zero := Timecode{DropFrame: tc.DropFrame}
+		if got := zero.Add(c.frames, c.fps); got != tc {
+			t.Errorf("%s: got %s by adding %d frames at %d fps", c.tc, got, c.frames, c.fps)
+		}
+	}
+}
+
+// TestTimecodeDropFrameAdd checks that adding frames to drop-frame timecodes never yields a skipped frame number,
+// and is consistent with FrameCount().
+func TestTimecodeDropFrameAdd(t *testing.T) {
+	for _, fps := range []int32{30, 60} {
+		drop := int(fps) / 15
+		zero := Timecode{DropFrame: true}
+		for n := 0; n < 11*60*int(fps); n++ {
+			tc := zero.Add(n, fps)
+			if tc.Seconds == 0 && tc.Minutes%10 != 0 && tc.Frames < drop {
+				t.Fatalf("%d fps: frame %d got skipped timecode %s", fps, n, tc)
+			}
+			if fc := tc.FrameCount(fps); fc != n {
+				t.Fatalf("%d fps: frame %d got timecode %s of frame count %d", fps, n, tc, fc)
+			}
+		}
+	}
+}
+
+// TestTimecodeWrap checks that timecodes wrap around after 24 hours.
+func TestTimecodeWrap(t *testing.T) {
+	tc, err := ParseTimecode("23:59:59;29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tc.Add(1, 30); got != (Timecode{DropFrame: true}) {
+		t.Errorf("got %s, want 00:00:00;00", got)
+	}
+	if got := (Timecode{}).Add(-1, 25); got.String() != "23:59:59:24" {
+		t.Errorf("got %s, want 23:59:59:24", got)
+	}
+}
+
+// TestParseTimecodeInvalid checks that invalid timecodes are rejected.
+func TestParseTimecodeInvalid(t *testing.T) {
+	for _, s := range []string{"", "00:00:00", "0:00:00:00", "24:00:00:00", "00:60:00:00", "00:00:00:-1", "00;00:00:00"} {
+		if _, err := ParseTimecode(s); err != ErrInvalidTimecode {
+			t.Errorf("%q: got error %v, want %v", s, err, ErrInvalidTimecode)
+		}
+	}
+}
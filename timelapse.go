@@ -0,0 +1,147 @@
+package mjpeg
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"time"
+)
+
+// timeline maps timestamps to frame slots of fixed duration, relative to the first timestamp.
+type timeline struct {
+	// slotDur is the duration of a slot
+	slotDur time.Duration
+	// start is the timestamp of the first slot, valid if started is true
+	start time.Time
+	// started tells if the start timestamp has been set
+	started bool
+}
+
+// slot returns the slot index of the timestamp t.
+// The first call sets the start of the timeline, so it always returns 0.
+func (tl *timeline) slot(t time.Time) int {
+	if !tl.started {
+		tl.start, tl.started = t, true
+	}
+	if tl.slotDur <= 0 {
+		return 0
+	}
+	return int(t.Sub(tl.start) / tl.slotDur)
+}
+
+// Timelapse adds frames with real capture timestamps (which may be taken minutes apart)
+// to an AviWriter, mapping them onto the fixed FPS of the video.
+type Timelapse struct {
+	// aw is the writer to add frames to
+	aw AviWriter
+	// tl maps capture timestamps to output frames
+	tl timeline
+
+	// labelLayout is the time layout of the capture time label, empty means no label
+	labelLayout string
+	// labelCorner is the corner of the capture time label
+	labelCorner Corner
+
+	// frames is the number of output frames written
+	frames int
+	// last is the last added frame, either JPEG data or an image (reused)
+	lastJpeg []byte
+	lastImg  *image.RGBA
+	// labelImg is the reused image on which labels are drawn
+	labelImg *image.RGBA
+}
+
+// NewTimelapse returns a new Timelapse which adds frames to aw.
+//
+// If interval is 0, each source frame becomes exactly one output frame regardless of the gap
+// between capture timestamps.
+// Else interval is the real time represented by one output frame: source frames falling into
+// the same interval are dropped (only the first one is kept), and gaps spanning multiple intervals
+// are filled by repeating the last frame, so the playback speed is proportional to real time.
+func NewTimelapse(aw AviWriter, interval time.Duration) *Timelapse {
+	return &Timelapse{
+		aw: aw,
+		tl: timeline{slotDur: interval},
+	}
+}
+
+// Label enables burning the capture time of frames into the given corner, formatted with layout
+// (see time.Time.Format()). Labeling JPEG frames requires decoding and re-encoding them.
+func (t *Timelapse) Label(corner Corner, layout string) {
+	t.labelCorner, t.labelLayout = corner, layout
+}
+
+// Frames returns the number of output frames written so far (including repeated frames).
+func (t *Timelapse) Frames() int {
+	return t.frames
+}
+
+// AddFrame adds a JPEG encoded frame captured at the given time.
+func (t *Timelapse) AddFrame(jpegData []byte, captured time.Time) error {
+	if t.labelLayout != "" {
+		img, err := jpeg.Decode(bytes.NewReader(jpegData))
+		if err != nil {
+			return err
+		}
+		return t.AddImage(img, captured)
+	}
+
+	n, err := t.fillGap(captured)
+	if err != nil || n == 0 {
+		return err
+	}
+	if err = t.aw.AddFrame(jpegData); err != nil {
+		return err
+	}
+	t.frames++
+	t.lastJpeg, t.lastImg = append(t.lastJpeg[:0], jpegData...), nil
+	return nil
+}
+
+// AddImage adds an image frame captured at the given time.
+func (t *Timelapse) AddImage(img image.Image, captured time.Time) error {
+	n, err := t.fillGap(captured)
+	if err != nil || n == 0 {
+		return err
+	}
+
+	if t.labelLayout != "" {
+		t.labelImg = copyToRGBA(t.labelImg, img)
+		TextOverlay(t.labelCorner, func(int, time.Duration) string {
+			return captured.Format(t.labelLayout)
+		})(t.labelImg, t.frames, 0)
+		img = t.labelImg
+	}
+
+	if err = t.aw.AddImage(img); err != nil {
+		return err
+	}
+	t.frames++
+	t.lastImg, t.lastJpeg = copyToRGBA(t.lastImg, img), t.lastJpeg[:0]
+	return nil
+}
+
+// fillGap repeats the last frame to fill the slots before the slot of the captured time.
+// Returns the number of frames that should be written for the new frame (0 or 1).
+func (t *Timelapse) fillGap(captured time.Time) (int, error) {
+	if t.tl.slotDur <= 0 {
+		return 1, nil
+	}
+	slot := t.tl.slot(captured)
+	if slot < t.frames {
+		return 0, nil // Slot already filled
+	}
+	for t.frames < slot {
+		var err error
+		if t.lastImg != nil {
+			err = t.aw.AddImage(t.lastImg)
+		} else {
+			err = t.aw.AddFrame(t.lastJpeg)
+		}
+		if err != nil {
+			return 0, err
+		}
+		t.frames++
+	}
+	return 1, nil
+}
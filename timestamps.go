@@ -0,0 +1,99 @@
+package mjpeg
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrTimestamps reports if the timestamps file of a video is invalid.
+var ErrTimestamps = errors.New("Invalid timestamps file")
+
+// FrameTimestamp is the capture timestamp of a frame, see AviWriter.SetTimestamp().
+type FrameTimestamp struct {
+	// Frame is the (zero-based) index of the frame
+	Frame int `json:"frame"`
+	// Time is the capture timestamp of the frame, in nanoseconds in JSON
+	Time time.Duration `json:"time"`
+}
+
+// timestamps lists the capture timestamps of the frames of a video.
+type timestamps struct {
+	// Video is the (base) name of the video file
+	Video string `json:"video"`
+	// Frames are the timestamps of the frames, in frame order
+	Frames []FrameTimestamp `json:"frames"`
+}
+
+// SetTimestamp implements AviWriter.SetTimestamp().
+func (aw *aviWriter) SetTimestamp(timestamp time.Duration) {
+	aw.timestamp, aw.hasTimestamp = timestamp, true
+}
+
+// recordTimestamp records the timestamp set for the last written frame, if any.
+func (aw *aviWriter) recordTimestamp() {
+	if !aw.hasTimestamp {
+		return
+	}
+	aw.timestamps = append(aw.timestamps, FrameTimestamp{Frame: aw.frames - 1, Time: aw.timestamp})
+	aw.hasTimestamp = false
+}
+
+// timestampsFile returns the name of the companion timestamps file of the given AVI file.
+func timestampsFile(aviFile string) string {
+	return strings.TrimSuffix(aviFile, filepath.Ext(aviFile)) + ".timestamps.json"
+}
+
+// writeTimestamps writes the timestamps file of the video.
+func (aw *aviWriter) writeTimestamps() error {
+	if aw.aviFile == "" {
+		return nil // Writing to an io.Writer, there is no video file to write next to
+	}
+	ts := timestamps{Video: filepath.Base(aw.aviFile), Frames: aw.timestamps}
+	data, err := json.MarshalIndent(ts, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(timestampsFile(aw.aviFile), data, 0644)
+}
+
+// ReadTimestamps reads the capture timestamps of the frames of the video aviFile from its companion
+// timestamps file, written if timestamps were set with AviWriter.SetTimestamp().
+// Frames without a timestamp (e.g. slots filled by repeating the previous frame) are not listed,
+// so the exact variable frame rate timing of a recording can be reconstructed even though the AVI has
+// a constant frame rate.
+//
+// ErrTimestamps is returned if the timestamps file can't be parsed.
+func ReadTimestamps(aviFile string) ([]FrameTimestamp, error) {
+	data, err := os.ReadFile(timestampsFile(aviFile))
+	if err != nil {
+		return nil, err
+	}
+	var ts timestamps
+	if err := json.Unmarshal(data, &ts); err != nil {
+		return nil, ErrTimestamps
+	}
+	return ts.Frames, nil
+}
+
+// loadTimestamps loads the timestamps of the existing frames from the timestamps file of the video
+// (opened for appending), if there is one.
+func (aw *aviWriter) loadTimestamps() error {
+	frames, err := ReadTimestamps(aw.aviFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, ft := range frames {
+		if ft.Frame < aw.frames { // Frames of a dropped truncated chunk are not kept
+			aw.timestamps = append(aw.timestamps, ft)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Package tiny implements a reduced-footprint MJPEG AVI writer, e.g. for microcontroller camera boards
+which emit JPEG frames and record to SD cards.
+
+It only depends on the riff package and a few small standard packages (no image/jpeg, no logging,
+no OS file handling), so it compiles under TinyGo. The storage of the video and of its temporary index
+is pluggable: any io.WriteSeeker and io.ReadWriteSeeker (e.g. two files on a FAT file system) will do.
+Use the mjpeg package for encoding images, audio, OpenDML and other features.
+
+Example:
+
+	w, err := tiny.New(videoFile, idxFile, 640, 480, 10)
+	if err != nil {
+	    // Handle error
+	}
+	for frame := range frames {
+	    if err := w.AddFrame(frame); err != nil {
+	        // Handle error
+	    }
+	}
+	if err := w.Close(); err != nil {
+	    // Handle error
+	}
+*/
+package tiny
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/icza/mjpeg/riff"
+)
+
+// ErrTooLarge reports if more frames cannot be added, else the video would exceed the 4 GB limit of AVI files.
+var ErrTooLarge = errors.New("Video file too large")
+
+// maxSize is the size limit of the video.
+const maxSize = 1<<32 - 1
+
+// Writer is a minimal MJPEG AVI writer: a single video stream with an idx1 index.
+// Errors are sticky: after the first error all methods return it.
+type Writer struct {
+	// rw writes the video
+	rw *riff.Writer
+	// idx is the storage of the index entries until they are copied into the video
+	idx io.ReadWriteSeeker
+	// idxSize is the size of the written index entries
+	idxSize int64
+	// moviPos is the position of the 'movi' list type, offsets in the index are relative to it
+	moviPos int64
+	// framesPos and lengthPos are the positions of the frame count fields of the headers
+	framesPos, lengthPos int64
+	// frames is the number of frames written
+	frames int
+	// entry is the buffer of an index entry
+	entry [16]byte
+	// err is the first error that occurred
+	err error
+}
+
+// New returns a new Writer writing a video of the given size and frame rate to out (starting at its current
+// position), storing the index in idx until the video is closed. Neither out nor idx is closed by the Writer.
+func New(out io.WriteSeeker, idx io.ReadWriteSeeker, width, height, fps int32) (*Writer, error) {
+	w := &Writer{rw: riff.NewWriter(out), idx: idx}
+	if _, err := idx.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	put := func(values ...int32) {
+		for _, v := range values {
+			w.rw.WriteUint32(uint32(v))
+		}
+	}
+	w.rw.PushRIFF("AVI ")
+	w.rw.PushList("hdrl")
+	w.rw.PushChunk("avih")
+	put(1000000 / fps) // dwMicroSecPerFrame
+	put(0)             // dwMaxBytesPerSec
+	put(0)             // dwPaddingGranularity
+	put(0x10)          // dwFlags: AVIF_HASINDEX
+	w.framesPos = w.rw.Pos()
+	put(0, 0, 1, 0) // dwTotalFrames, dwInitialFrames, dwStreams, dwSuggestedBufferSize
+	put(width, height, 0, 0, 0, 0)
+	w.rw.Pop() // 'avih'
+
+	w.rw.PushList("strl")
+	w.rw.PushChunk("strh")
+	w.rw.WriteFourCC("vids") // fccType
+	w.rw.WriteFourCC("MJPG") // fccHandler
+	put(0, 0, 0, 1, fps, 0)  // dwFlags, wPriority and wLanguage, dwInitialFrames, dwScale, dwRate, dwStart
+	w.lengthPos = w.rw.Pos()
+	put(0, 0, -1, 0, 0, 0) // dwLength, dwSuggestedBufferSize, dwQuality, dwSampleSize, rcFrame
+	w.rw.Pop()             // 'strh'
+	w.rw.PushChunk("strf")
+	put(40, width, height)          // biSize, biWidth, biHeight
+	w.rw.WriteUint16(1)             // biPlanes
+	w.rw.WriteUint16(24)            // biBitCount
+	w.rw.WriteFourCC("MJPG")        // biCompression
+	put(width*height*3, 0, 0, 0, 0) // biSizeImage, biXPelsPerMeter, biYPelsPerMeter, biClrUsed, biClrImportant
+	w.rw.Pop()                      // 'strf'
+	w.rw.Pop()                      // 'strl'
+	w.rw.Pop()                      // 'hdrl'
+
+	w.rw.PushList("movi")
+	w.moviPos = w.rw.Pos() - 4
+	if err := w.rw.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// AddFrame adds a frame from a JPEG encoded data slice.
+// ErrTooLarge is returned if the video would exceed the size limit.
+func (w *Writer) AddFrame(jpegData []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	// Frame chunk, index entry, the idx1 header and the entries written so far
+	if w.rw.Pos()+8+int64(len(jpegData))+1+8+w.idxSize+16 > maxSize {
+		return ErrTooLarge
+	}
+
+	pos := w.rw.Pos()
+	w.rw.WriteChunk("00dc", jpegData) // Compressed video frame
+	if w.err = w.rw.Err(); w.err != nil {
+		return w.err
+	}
+
+	binary.LittleEndian.PutUint32(w.entry[0:], 0x63643030)             // "00dc"
+	binary.LittleEndian.PutUint32(w.entry[4:], 0x10)                   // AVIIF_KEYFRAME
+	binary.LittleEndian.PutUint32(w.entry[8:], uint32(pos-w.moviPos))  // Offset of the chunk
+	binary.LittleEndian.PutUint32(w.entry[12:], uint32(len(jpegData))) // Size of the chunk data
+	if _, w.err = w.idx.Write(w.entry[:]); w.err != nil {
+		return w.err
+	}
+	w.idxSize += 16
+	w.frames++
+	return nil
+}
+
+// Close finalizes the video: writes the index and updates the headers.
+// Close must be called once, the storages are not closed.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.rw.Pop() // 'movi'
+
+	w.rw.PushChunk("idx1")
+	if _, w.err = w.idx.Seek(0, io.SeekStart); w.err != nil {
+		return w.err
+	}
+	if _, err := io.CopyN(w.rw, w.idx, w.idxSize); err != nil && w.rw.Err() == nil {
+		w.err = err
+		return err
+	}
+	w.rw.Pop() // 'idx1'
+
+	end := w.rw.Pos()
+	for _, pos := range []int64{w.framesPos, w.lengthPos} {
+		w.rw.Seek(pos, io.SeekStart)
+		w.rw.WriteUint32(uint32(w.frames))
+	}
+	w.rw.Seek(end, io.SeekStart)
+	w.rw.Pop() // 'RIFF'
+	w.err = w.rw.Err()
+	return w.err
+}
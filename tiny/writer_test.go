@@ -0,0 +1,70 @@
+package tiny
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/icza/mjpeg"
+)
+
+// TestWriter checks that the frames of a video written by the Writer are read back.
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "tiny.avi")
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	idx, err := os.Create(filepath.Join(dir, "tiny.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	var frames [][]byte
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		img := image.NewGray(image.Rect(0, 0, 16, 8+i)) // An odd size makes padding necessary
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, append(buf.Bytes(), byte(i)))
+	}
+
+	w, err := New(out, idx, 16, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range frames {
+		if err := w.AddFrame(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := mjpeg.NewReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	info := ar.Info()
+	if info.Frames != len(frames) || info.Width != 16 || info.Height != 8 || info.FPS() != 10 || info.Codec != "MJPG" {
+		t.Errorf("got info %+v", info)
+	}
+	for i, want := range frames {
+		data, err := ar.Frame(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package mjpeg
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+)
+
+// TranscodeOptions are the options of Transcode().
+type TranscodeOptions struct {
+	// Quality is the JPEG quality of the output frames, jpeg.DefaultQuality if 0
+	Quality int
+	// Width and Height are the size of the output, the size of the input is kept if both are 0.
+	// If only one of them is 0, it is calculated from the other keeping the aspect ratio.
+	Width, Height int32
+	// Progress is called after each frame with the number of processed and total frames, if not nil
+	Progress func(done, total int)
+	// Options are additional options of the output writer (WithQuality() is overridden by Quality)
+	Options []Option
+}
+
+// Transcode decodes each frame of the video in, and re-encodes it with the JPEG quality and size of opts,
+// writing the result to out, e.g. to shrink archived footage. The frame rate is kept.
+// Repeated frames (duplicate index entries) are kept as duplicate index entries, without re-encoding them again.
+//
+// Frames are decoded as by Thumbnail(), so MJPEG and raw (DIB) inputs are supported.
+// Resizing uses box filtering (averaging pixels) when downscaling.
+func Transcode(in, out string, opts TranscodeOptions) (err error) {
+	ar, err := NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	info := ar.Info()
+	if info.Scale <= 0 || info.Rate <= 0 {
+		return ErrInvalidFPS
+	}
+	w, h := opts.Width, opts.Height
+	switch {
+	case w == 0 && h == 0:
+		w, h = info.Width, info.Height
+	case w == 0 && info.Height > 0:
+		w = int32(int64(h) * int64(info.Width) / int64(info.Height))
+	case h == 0 && info.Width > 0:
+		h = int32(int64(w) * int64(info.Height) / int64(info.Width))
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	quality := opts.Quality
+	if quality <= 0 {
+		quality = jpeg.DefaultQuality
+	}
+
+	awr, err := New(out, w, h, info.Rate, append(opts.Options[:len(opts.Options):len(opts.Options)], WithQuality(quality), withScale(info.Scale))...)
+	if err != nil {
+		return err
+	}
+	aw := awr.(*aviWriter)
+	defer func() {
+		if cerr := aw.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			err = joinCleanupErrs(err, []error{os.Remove(out)})
+		}
+	}()
+
+	r := ar.(*aviReader)
+	var src *image.RGBA
+	for i := 0; i < info.Frames; i++ {
+		if i > 0 && r.frames[i].offset == r.frames[i-1].offset {
+			err = aw.notifyErr(aw.addDupFrame())
+		} else {
+			err = transcodeFrame(aw, r, i, &src, int(w), int(h))
+		}
+		if err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(i+1, info.Frames)
+		}
+	}
+	return nil
+}
+
+// transcodeFrame decodes frame i of ar, and adds it to aw resized to w x h.
+// src is the reused image holding the decoded frame.
+func transcodeFrame(aw *aviWriter, ar *aviReader, i int, src **image.RGBA, w, h int) error {
+	data, err := ar.Frame(i)
+	if err != nil {
+		return err
+	}
+	img, err := decodeFrame(ar, data)
+	if err != nil {
+		return err
+	}
+	if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+		*src = copyToRGBA(*src, img)
+		img = resizeBox(*src, w, h)
+	}
+	return aw.AddImage(img)
+}
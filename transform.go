@@ -0,0 +1,131 @@
+package mjpeg
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Transform is a per-frame geometric transformation applied to frames added with AddImage(),
+// before overlays are drawn and the frame is encoded.
+// The returned image may be reused by the transform, it is only valid until the next call.
+type Transform func(img image.Image) image.Image
+
+// WithTransform returns an Option which adds a transform to the writer.
+// Multiple transforms may be added, they are applied in the order they were added.
+// The result of the transforms should match the width and height of the video.
+//
+// Transforms are applied to images added with AddImage() only,
+// frames added as JPEG data with AddFrame() are written unaltered.
+func WithTransform(t Transform) Option {
+	return func(aw *aviWriter) {
+		aw.transforms = append(aw.transforms, t)
+	}
+}
+
+// Rotate90 returns a Transform which rotates frames by 90 degrees clockwise.
+func Rotate90() Transform {
+	return rotation(func(w, h, x, y int) (int, int) { return h - 1 - y, x }, true)
+}
+
+// Rotate180 returns a Transform which rotates frames by 180 degrees.
+func Rotate180() Transform {
+	return rotation(func(w, h, x, y int) (int, int) { return w - 1 - x, h - 1 - y }, false)
+}
+
+// Rotate270 returns a Transform which rotates frames by 270 degrees clockwise (90 degrees counter-clockwise).
+func Rotate270() Transform {
+	return rotation(func(w, h, x, y int) (int, int) { return y, w - 1 - x }, true)
+}
+
+// FlipHorizontal returns a Transform which mirrors frames horizontally (e.g. for mirrored webcams).
+func FlipHorizontal() Transform {
+	return rotation(func(w, h, x, y int) (int, int) { return w - 1 - x, y }, false)
+}
+
+// FlipVertical returns a Transform which mirrors frames vertically (upside down).
+func FlipVertical() Transform {
+	return rotation(func(w, h, x, y int) (int, int) { return x, h - 1 - y }, false)
+}
+
+// Crop returns a Transform which crops frames to the given region.
+// r is relative to the top-left corner of frames.
+// If the image supports it, a sub-image is returned which shares pixels with the input.
+func Crop(r image.Rectangle) Transform {
+	var buf *image.RGBA
+	return func(img image.Image) image.Image {
+		b := img.Bounds()
+		cr := r.Add(b.Min).Intersect(b)
+		if si, ok := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}); ok {
+			return si.SubImage(cr)
+		}
+		if buf == nil || buf.Rect.Size() != cr.Size() {
+			buf = image.NewRGBA(image.Rectangle{Max: cr.Size()})
+		}
+		draw.Draw(buf, buf.Rect, img, cr.Min, draw.Src)
+		return buf
+	}
+}
+
+// rotation returns a Transform which maps each source pixel (x, y) to the destination pixel
+// returned by dstPos, where w and h are the source dimensions.
+// swap tells if the width and height of the destination are swapped.
+// *image.Gray images are transformed as-is, other images are converted to *image.RGBA.
+func rotation(dstPos func(w, h, x, y int) (int, int), swap bool) Transform {
+	var src, dst *image.RGBA
+	var grayDst *image.Gray
+	return func(img image.Image) image.Image {
+		b := img.Bounds()
+		w, h := b.Dx(), b.Dy()
+
+		dsize := image.Pt(w, h)
+		if swap {
+			dsize = image.Pt(h, w)
+		}
+
+		if g, ok := img.(*image.Gray); ok {
+			if grayDst == nil || grayDst.Rect.Size() != dsize {
+				grayDst = image.NewGray(image.Rectangle{Max: dsize})
+			}
+			remap(dstPos, w, h, 1, g.Pix[g.PixOffset(b.Min.X, b.Min.Y):], g.Stride, grayDst.Pix, grayDst.Stride)
+			return grayDst
+		}
+
+		s, ok := img.(*image.RGBA)
+		if !ok {
+			if src == nil || src.Rect.Size() != b.Size() {
+				src = image.NewRGBA(image.Rectangle{Max: b.Size()})
+			}
+			draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+			s = src
+		}
+
+		if dst == nil || dst.Rect.Size() != dsize {
+			dst = image.NewRGBA(image.Rectangle{Max: dsize})
+		}
+		remap(dstPos, w, h, 4, s.Pix[s.PixOffset(s.Rect.Min.X, s.Rect.Min.Y):], s.Stride, dst.Pix, dst.Stride)
+		return dst
+	}
+}
+
+// remap copies the w x h pixels of bpp bytes each from src to dst, moving each source pixel (x, y)
+// to the destination pixel returned by dstPos.
+func remap(dstPos func(w, h, x, y int) (int, int), w, h, bpp int, src []byte, srcStride int, dst []byte, dstStride int) {
+	for y := 0; y < h; y++ {
+		si := y * srcStride
+		for x := 0; x < w; x, si = x+1, si+bpp {
+			dx, dy := dstPos(w, h, x, y)
+			di := dy*dstStride + dx*bpp
+			copy(dst[di:di+bpp], src[si:si+bpp])
+		}
+	}
+}
+
+// applyTransforms applies the transforms of the writer to img.
+func (aw *aviWriter) applyTransforms(img image.Image) image.Image {
+	for _, t := range aw.transforms {
+		img = t(img)
+	}
+	return img
+}
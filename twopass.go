@@ -0,0 +1,259 @@
+package mjpeg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrPlanMismatch reports if the video written in the second pass of the two-pass mode
+	// differs from the planned one (e.g. a frame has a different size), see Plan.
+	ErrPlanMismatch = errors.New("Video does not match the plan")
+
+	// ErrPlanUnsupported reports if the options are not supported by the two-pass mode.
+	ErrPlanUnsupported = errors.New("Options unsupported in two-pass mode")
+)
+
+// Plan is the first pass of the two-pass mode, for videos whose frame count and frame sizes are known
+// up front (e.g. when converting an existing image set). It holds the final values of all fields which are
+// normally back-patched (sizes, frame counts, indices), so in the second pass the video can be written
+// in a single forward pass, without seeking: e.g. to a pipe or a network connection, without spooling it
+// to a temporary file.
+//
+// In the second pass the frames must be added with AddFrame() or AddFrameFlags() in the planned order
+// and sizes, and options must be the same, else ErrPlanMismatch is returned.
+// Options whose output depends on frame contents or timing (WithDedup(), WithThrottle()) are not supported,
+// neither is metadata (WithMetadataStream()) and custom chunks (whose sizes are not planned).
+// The creation time is omitted from the stream name (as by WithDeterministic()), so both passes write the same name.
+type Plan struct {
+	// width, height and fps are the properties of the video
+	width, height, fps int32
+	// opts are the options of the writer
+	opts []Option
+
+	// patches are the final values of the back-patched fields, by position
+	patches map[int64]*patch
+	// size is the size of the video
+	size int64
+}
+
+// NewPlan runs the first pass of the two-pass mode: it simulates writing a video with frames
+// of the given sizes using the given options, and records the final values of the back-patched fields.
+func NewPlan(width, height, fps int32, frameSizes []int, opts ...Option) (*Plan, error) {
+	// The name must not depend on the time (and the length of the time zone name) of the pass
+	opts = append(opts[:len(opts):len(opts)], WithDeterministic())
+	pr := &planWriter{patches: map[int64]*patch{}}
+	awr, err := newWriter("", pr, width, height, fps, opts)
+	if err != nil {
+		return nil, err
+	}
+	aw := awr.(*aviWriter)
+	if aw.dedup != nil || aw.throttle != nil || aw.encrypt || aw.audio != nil || len(aw.videoStreams) > 0 || aw.metaStream {
+		aw.Close()
+		return nil, ErrPlanUnsupported
+	}
+
+	var data []byte
+	for _, size := range frameSizes {
+		if cap(data) < size {
+			data = make([]byte, size)
+		}
+		if err = aw.AddFrame(data[:size]); err != nil {
+			aw.Close()
+			return nil, err
+		}
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		width:   width,
+		height:  height,
+		fps:     fps,
+		opts:    opts,
+		patches: pr.patches,
+		size:    pr.size,
+	}, nil
+}
+
+// Size returns the size of the planned video file.
+func (p *Plan) Size() int64 {
+	return p.size
+}
+
+// NewWriter returns a new AviWriter for the second pass, writing the video to w in a single forward pass.
+// The Close() method of the AviWriter must be called to finalize the video, w is not closed by the writer.
+func (p *Plan) NewWriter(w io.Writer) (AviWriter, error) {
+	pw := &planWriter{w: w, patches: make(map[int64]*patch, len(p.patches))}
+	for pos, pa := range p.patches {
+		pw.patches[pos] = &patch{data: pa.data, writes: pa.writes} // Writes are counted down
+	}
+	pw.sortPatches()
+	aw, err := newWriter("", pw, p.width, p.height, p.fps, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	return &plannedWriter{AviWriter: aw, pw: pw, size: p.size}, nil
+}
+
+// plannedWriter is the AviWriter of the second pass.
+type plannedWriter struct {
+	AviWriter
+	// pw is the output of the writer
+	pw *planWriter
+	// size is the planned size of the video
+	size int64
+}
+
+// Close finalizes the video, and checks if it has the planned size.
+func (pw *plannedWriter) Close() error {
+	if err := pw.AviWriter.Close(); err != nil {
+		return err
+	}
+	if pw.pw.size != pw.size {
+		return ErrPlanMismatch
+	}
+	return nil
+}
+
+// patch is the final value of overwritten data.
+type patch struct {
+	// data is the final value
+	data []byte
+	// writes is the number of (over)writes of the data
+	writes int
+}
+
+// planWriter is the io.WriteSeeker output of both passes of the two-pass mode.
+// In the first pass (w is nil) it records writes overwriting already written data as patches, and discards the data.
+// In the second pass it writes data to w as it is written the first time, with the recorded patches applied,
+// and checks that the final overwrites match the patches (dropping them).
+type planWriter struct {
+	// w is the destination in the second pass, nil in the first pass
+	w io.Writer
+	// patches are the final values of overwritten data, by position
+	patches map[int64]*patch
+	// patchPos are the sorted positions of patches (in the second pass)
+	patchPos []int64
+	// next is the index of the first patch in patchPos which may affect data not yet written to w
+	next int
+
+	// pos is the current position
+	pos int64
+	// size is the size of the written data (in the second pass the size of the data written to w)
+	size int64
+}
+
+// sortPatches sorts the positions of the patches.
+func (pw *planWriter) sortPatches() {
+	for pos := range pw.patches {
+		pw.patchPos = append(pw.patchPos, pos)
+	}
+	sort.Slice(pw.patchPos, func(i, j int) bool { return pw.patchPos[i] < pw.patchPos[j] })
+}
+
+// Write implements io.Writer.
+func (pw *planWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if pw.pos < pw.size {
+		// Overwriting already written data
+		over := p
+		if end := pw.size - pw.pos; int64(len(over)) > end {
+			over = over[:end]
+		}
+		if err := pw.overwrite(over); err != nil {
+			return 0, err
+		}
+		pw.pos += int64(len(over))
+		p = p[len(over):]
+	}
+	if pw.pos > pw.size {
+		return 0, ErrPlanMismatch // Gaps are not written
+	}
+
+	if len(p) > 0 {
+		if pw.w != nil {
+			if err := pw.forward(p); err != nil {
+				return 0, err
+			}
+		}
+		pw.pos += int64(len(p))
+		pw.size = pw.pos
+	}
+	return n, nil
+}
+
+// overwrite records (in the first pass) or checks (in the second pass) an overwrite of data at the current position.
+func (pw *planWriter) overwrite(p []byte) error {
+	pa := pw.patches[pw.pos]
+	if pw.w == nil {
+		if pa == nil {
+			pa = &patch{}
+			pw.patches[pw.pos] = pa
+		}
+		pa.data = append(pa.data[:0], p...)
+		pa.writes++
+		return nil
+	}
+
+	if pa == nil || pa.writes == 0 {
+		return ErrPlanMismatch
+	}
+	if pa.writes--; pa.writes == 0 && !bytes.Equal(pa.data, p) {
+		return ErrPlanMismatch
+	}
+	return nil
+}
+
+// forward writes p (the data at the current position, never written before) to w, with the patches applied.
+func (pw *planWriter) forward(p []byte) error {
+	start, end := pw.pos, pw.pos+int64(len(p))
+	patched := false
+	for i := pw.next; i < len(pw.patchPos) && pw.patchPos[i] < end; i++ {
+		pos := pw.patchPos[i]
+		data := pw.patches[pos].data
+		patchEnd := pos + int64(len(data))
+		if patchEnd <= start {
+			if i == pw.next {
+				pw.next++
+			}
+			continue
+		}
+		// Copy the part of the patch overlapping p
+		from, to := pos, patchEnd
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if !patched {
+			p, patched = append([]byte(nil), p...), true
+		}
+		copy(p[from-start:to-start], data[from-pos:])
+		if patchEnd <= end && i == pw.next {
+			pw.next++
+		}
+	}
+	_, err := pw.w.Write(p)
+	return err
+}
+
+// Seek implements io.Seeker.
+func (pw *planWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += pw.pos
+	case io.SeekEnd:
+		offset += pw.size
+	}
+	if offset < 0 {
+		return pw.pos, os.ErrInvalid
+	}
+	pw.pos = offset
+	return offset, nil
+}
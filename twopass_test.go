@@ -0,0 +1,89 @@
+package mjpeg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPlan checks that the second pass of the two-pass mode writes the planned video in a single forward pass,
+// identical to the video written to a file.
+func TestPlan(t *testing.T) {
+	frames := testFrames(t, 5)
+	sizes := make([]int, len(frames))
+	for i, data := range frames {
+		sizes[i] = len(data)
+	}
+	for _, c := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"rec lists", []Option{WithRecLists()}},
+		{"odml", []Option{WithODMLIndex()}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := NewPlan(smallWidth, smallHeight, 10, sizes, c.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer // Not seekable: written in a single forward pass
+			awr, err := p.NewWriter(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range frames {
+				if err := awr.AddFrame(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := awr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if int64(buf.Len()) != p.Size() {
+				t.Errorf("got size %d, planned %d", buf.Len(), p.Size())
+			}
+
+			dir := t.TempDir()
+			want, err := os.ReadFile(writeTestVideo(t, dir, frames, append(c.opts, WithDeterministic())...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Error("planned video differs from the video written to a file")
+			}
+			name := filepath.Join(dir, "planned.avi")
+			if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			checkFrames(t, name, frames)
+		})
+	}
+}
+
+// TestPlanMismatch checks that frames deviating from the plan are rejected.
+func TestPlanMismatch(t *testing.T) {
+	frames := testFrames(t, 2)
+	p, err := NewPlan(smallWidth, smallHeight, 10, []int{len(frames[0]), len(frames[0])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	awr, err := p.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	awr.AddFrame(frames[0])
+	awr.AddFrame(append(frames[0], 0, 0)) // A different size
+	if err := awr.Close(); err != ErrPlanMismatch {
+		t.Errorf("got error %v, want %v", err, ErrPlanMismatch)
+	}
+}
+
+// TestPlanUnsupported checks that options depending on the frame contents are rejected.
+func TestPlanUnsupported(t *testing.T) {
+	if _, err := NewPlan(smallWidth, smallHeight, 10, []int{100}, WithDedup(0)); err != ErrPlanUnsupported {
+		t.Errorf("got error %v, want %v", err, ErrPlanUnsupported)
+	}
+}
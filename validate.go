@@ -0,0 +1,308 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Severity is the severity of a validation issue.
+type Severity int
+
+const (
+	// SeverityWarning marks issues which may cause problems in some players.
+	SeverityWarning Severity = iota
+	// SeverityError marks structural problems.
+	SeverityError
+)
+
+// String returns the name of the severity.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue is a problem found by Validate().
+type Issue struct {
+	// Severity is the severity of the issue
+	Severity Severity
+	// Pos is the file position the issue relates to, -1 if it relates to no specific position
+	Pos int64
+	// Message describes the issue
+	Message string
+}
+
+// String returns a human readable form of the issue.
+func (i Issue) String() string {
+	if i.Pos < 0 {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s at %d: %s", i.Severity, i.Pos, i.Message)
+}
+
+// Report is the result of Validate().
+type Report struct {
+	// Info holds the properties of the video
+	Info Info
+	// Issues are the problems found, in the order they were found
+	Issues []Issue
+}
+
+// OK tells if no errors were found (warnings are allowed).
+func (r *Report) OK() bool {
+	for _, i := range r.Issues {
+		if i.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the issues, one per line.
+func (r *Report) String() string {
+	sb := &strings.Builder{}
+	for _, i := range r.Issues {
+		sb.WriteString(i.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// validator holds the state of validating a file.
+type validator struct {
+	ar  *aviReader
+	rep *Report
+
+	// avih is the data of the main AVI header
+	avih []byte
+	// strh is the data of the video stream header
+	strh []byte
+	// dmlh is the data of the extended AVI header, nil if there is none
+	dmlh []byte
+}
+
+// addf adds an issue.
+func (v *validator) addf(severity Severity, pos int64, format string, a ...interface{}) {
+	v.rep.Issues = append(v.rep.Issues, Issue{Severity: severity, Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+// Validate checks the finished AVI file for structural problems, e.g. to gate CI pipelines on its result:
+// RIFF and chunk sizes are consistent, chunks are padded to even size, the frame count fields match the index,
+// dwSuggestedBufferSize fields are large enough, and MJPEG frames are baseline JPEGs with Huffman tables
+// (some players can't decode frames without them).
+//
+// An error is returned only if the file can't be read or is not an AVI file with a video stream,
+// problems are reported in the returned Report.
+func Validate(aviFile string) (*Report, error) {
+	f, err := openFile(aviFile, false)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	ar, err := newReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{ar: ar, rep: &Report{Info: ar.info}}
+
+	if err := v.checkChunks(0, ar.size, 0); err != nil {
+		return nil, err
+	}
+	v.checkHeaders()
+	if err := v.checkFrames(); err != nil {
+		return nil, err
+	}
+
+	return v.rep, nil
+}
+
+// checkChunks checks the chunks between the positions start and end, and collects the headers.
+func (v *validator) checkChunks(start, end int64, depth int) error {
+	ar := v.ar
+	hdr := make([]byte, 12)
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			v.addf(SeverityError, pos, "Truncated chunk header")
+			return nil
+		}
+		if _, err := ar.r.ReadAt(hdr[:8], pos); err != nil {
+			return err
+		}
+		id, size := string(hdr[:4]), int64(binary.LittleEndian.Uint32(hdr[4:]))
+		for i := 0; i < 4; i++ {
+			if id[i] < 0x20 || id[i] > 0x7e {
+				v.addf(SeverityError, pos, "Invalid chunk id %q", id)
+				return nil
+			}
+		}
+		dataEnd := pos + 8 + size
+		if dataEnd > end {
+			if depth == 0 {
+				v.addf(SeverityError, pos, "%s size %d exceeds the file size %d", id, size, end)
+			} else {
+				v.addf(SeverityError, pos, "Chunk %q (size %d) exceeds its parent ending at %d", id, size, end)
+			}
+			return nil
+		}
+		next := dataEnd + size&0x01
+		if next > end {
+			v.addf(SeverityError, pos, "Chunk %q has odd size %d but is not padded", id, size)
+		}
+
+		if depth == 0 {
+			if id != "RIFF" {
+				v.addf(SeverityError, pos, "Chunk %q outside of RIFF chunks", id)
+			} else if pos == 0 && dataEnd < end && !v.nextIsRIFF(dataEnd, end) {
+				v.addf(SeverityError, pos, "RIFF size %d does not match the file size %d", size, end)
+				dataEnd, next = end, end // Check the rest of the data as if the size was right
+			}
+		}
+
+		switch {
+		case id == "RIFF" || id == "LIST":
+			if size < 4 {
+				v.addf(SeverityError, pos, "%s chunk too small (size %d)", id, size)
+				break
+			}
+			if _, err := ar.r.ReadAt(hdr[8:], pos+8); err != nil {
+				return err
+			}
+			if err := v.checkChunks(pos+12, dataEnd, depth+1); err != nil {
+				return err
+			}
+		case depth == 2 && id == "avih" && v.avih == nil:
+			v.avih, _ = ar.readChunk(pos+8, size)
+		case depth == 3 && id == "strh" && v.strh == nil:
+			if data, _ := ar.readChunk(pos+8, size); len(data) >= 4 && string(data[:4]) == "vids" {
+				v.strh = data
+			}
+		case id == "dmlh" && v.dmlh == nil:
+			v.dmlh, _ = ar.readChunk(pos+8, size)
+		}
+
+		pos = next
+	}
+	return nil
+}
+
+// nextIsRIFF tells if an (extension) RIFF chunk starts at the given position.
+func (v *validator) nextIsRIFF(pos, end int64) bool {
+	if pos+4 > end {
+		return false
+	}
+	id, err := v.ar.fourCC(pos)
+	return err == nil && id == "RIFF"
+}
+
+// checkHeaders checks the header fields against the index.
+func (v *validator) checkHeaders() {
+	frames := len(v.ar.frames)
+
+	if len(v.avih) < 40 {
+		v.addf(SeverityError, -1, "Missing or short avih chunk")
+	} else {
+		flags := binary.LittleEndian.Uint32(v.avih[12:])
+		if v.ar.idx1Pos < 0 {
+			if flags&0x10 != 0 {
+				v.addf(SeverityError, -1, "AVIF_HASINDEX is set but there is no idx1 index")
+			} else {
+				v.addf(SeverityWarning, -1, "No idx1 index, some players can't play or seek the file")
+			}
+		}
+		// With OpenDML the avih frame count covers only the first RIFF chunk, the total is in dmlh
+		if total := int(binary.LittleEndian.Uint32(v.avih[16:])); v.dmlh == nil && total != frames {
+			v.addf(SeverityError, -1, "avih dwTotalFrames is %d, but the index has %d frames", total, frames)
+		}
+		v.checkBufferSize("avih", v.avih[28:])
+	}
+
+	if len(v.strh) < 40 {
+		v.addf(SeverityError, -1, "Missing or short video strh chunk")
+	} else {
+		if length := int(binary.LittleEndian.Uint32(v.strh[32:])); length != frames {
+			v.addf(SeverityError, -1, "Video strh dwLength is %d, but the index has %d frames", length, frames)
+		}
+		v.checkBufferSize("Video strh", v.strh[36:])
+	}
+
+	if len(v.dmlh) >= 4 {
+		if total := int(binary.LittleEndian.Uint32(v.dmlh)); total != frames {
+			v.addf(SeverityError, -1, "dmlh dwTotalFrames is %d, but the index has %d frames", total, frames)
+		}
+	}
+
+	if v.ar.info.HasPoster && frames > 0 && v.ar.info.Poster >= frames {
+		v.addf(SeverityWarning, -1, "Poster frame is %d, but the index has %d frames", v.ar.info.Poster, frames)
+	}
+}
+
+// checkBufferSize checks the dwSuggestedBufferSize field (at the start of data) of the named header.
+// 0 means unknown, else it should be able to hold the largest frame.
+func (v *validator) checkBufferSize(name string, data []byte) {
+	size := binary.LittleEndian.Uint32(data)
+	if size == 0 {
+		return
+	}
+	var largest uint32
+	for _, e := range v.ar.frames {
+		if e.size > largest {
+			largest = e.size
+		}
+	}
+	if size < largest {
+		v.addf(SeverityWarning, -1, "%s dwSuggestedBufferSize is %d, smaller than the largest frame (%d bytes)", name, size, largest)
+	}
+}
+
+// checkFrames checks the frames: they must be readable, and MJPEG frames must be baseline JPEGs with Huffman tables.
+func (v *validator) checkFrames() error {
+	isMJPEG := strings.EqualFold(v.ar.info.Codec, "MJPG")
+
+	var invalid, notBaseline, noDHT, badSize []int
+	for i, e := range v.ar.frames {
+		if e.offset+int64(e.size) > v.ar.size {
+			v.addf(SeverityError, e.offset, "Frame %d (size %d) exceeds the file size", i, e.size)
+			continue
+		}
+		if !isMJPEG || e.size == 0 {
+			continue // Empty frames are dropped frames
+		}
+		data, err := v.ar.readChunk(e.offset, int64(e.size))
+		if err != nil {
+			return err
+		}
+		h, err := parseJPEGHeader(data)
+		switch {
+		case err != nil:
+			invalid = append(invalid, i)
+			continue
+		case h.sof != markerSOF0:
+			notBaseline = append(notBaseline, i)
+		}
+		if !h.hasDHT {
+			noDHT = append(noDHT, i)
+		}
+		if h.width != int(v.ar.info.Width) || h.height != int(v.ar.info.Height) {
+			badSize = append(badSize, i)
+		}
+	}
+
+	report := func(severity Severity, frames []int, msg string) {
+		if len(frames) > 0 {
+			f := frames[0]
+			v.addf(severity, v.ar.frames[f].offset, "%d frame(s) %s (first: frame %d)", len(frames), msg, f)
+		}
+	}
+	report(SeverityError, invalid, "are not valid JPEG images")
+	report(SeverityWarning, notBaseline, "are not baseline JPEG images")
+	report(SeverityWarning, noDHT, "have no Huffman tables (DHT), some players can't decode them")
+	report(SeverityWarning, badSize, fmt.Sprintf("have dimensions different from the video size %dx%d", v.ar.info.Width, v.ar.info.Height))
+	return nil
+}
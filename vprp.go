@@ -0,0 +1,56 @@
+package mjpeg
+
+// WithAspectRatio returns an Option which makes the writer include an OpenDML video properties chunk ('vprp')
+// in the stream header, signaling the frame (display) aspect ratio x:y, e.g. 16:9 for anamorphic
+// 720x576 captures meant for widescreen display (which would otherwise play stretched).
+func WithAspectRatio(x, y int) Option {
+	return func(aw *aviWriter) {
+		if x > 0 && y > 0 {
+			aw.aspectX, aw.aspectY = x, y
+		}
+	}
+}
+
+// writeVprp writes the video properties chunk.
+func (aw *aviWriter) writeVprp() {
+	aspectX, aspectY := aw.aspectX, aw.aspectY
+	if aspectX == 0 {
+		aspectX, aspectY = int(aw.width), int(aw.height) // Aspect ratio of the frame size
+		for a, b := aspectX, aspectY; b > 0; {
+			a, b = b, a%b
+			if b == 0 {
+				aspectX, aspectY = aspectX/a, aspectY/a
+			}
+		}
+	}
+	fields, fieldHeight := int32(1), aw.height
+	if aw.interlaced {
+		fields, fieldHeight = 2, aw.height/2
+	}
+
+	aw.writeStr("vprp")                             // Video properties chunk
+	aw.writeInt32(36 + 32*fields)                   // Chunk size
+	aw.writeInt32(0)                                // VideoFormatToken: FORMAT_UNKNOWN
+	aw.writeInt32(0)                                // VideoStandard: STANDARD_UNKNOWN
+	aw.writeInt32((aw.fps + aw.scale/2) / aw.scale) // dwVerticalRefreshRate
+	aw.writeInt32(aw.width)                         // dwHTotalInT
+	aw.writeInt32(aw.height)                        // dwVTotalInLines
+	aw.writeInt32(int32(aspectX<<16 | aspectY))     // dwFrameAspectRatio: x in the high word, y in the low word
+	aw.writeInt32(aw.width)                         // dwFrameWidthInPixels
+	aw.writeInt32(aw.height)                        // dwFrameHeightInLines
+	aw.writeInt32(fields)                           // nbFieldPerFrame: 1 for progressive, 2 for interlaced video
+	for i := int32(0); i < fields; i++ {
+		startLine := i // Line of the field in the frame, in display order
+		if aw.interlaced && aw.fieldOrder == BottomFieldFirst {
+			startLine = 1 - i
+		}
+		aw.writeInt32(fieldHeight) // CompressedBMHeight
+		aw.writeInt32(aw.width)    // CompressedBMWidth
+		aw.writeInt32(fieldHeight) // ValidBMHeight
+		aw.writeInt32(aw.width)    // ValidBMWidth
+		aw.writeInt32(0)           // ValidBMXOffset
+		aw.writeInt32(0)           // ValidBMYOffset
+		aw.writeInt32(0)           // VideoXOffsetInT
+		aw.writeInt32(startLine)   // VideoYValidStartLine
+	}
+}
@@ -0,0 +1,170 @@
+package mjpeg
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WatchConfig configures a directory watcher, see NewDirWatcher().
+type WatchConfig struct {
+	// Pattern is the glob pattern of the file names to add, "*.jpg" if empty
+	Pattern string
+	// Interval is the polling interval of the directory, 500ms if 0
+	Interval time.Duration
+	// Debounce is the time a file must be left unmodified before it is added
+	// (so files being written are not added half-written), 1s if 0
+	Debounce time.Duration
+	// SkipExisting tells to skip files already in the directory when watching starts
+	SkipExisting bool
+	// IdleTimeout stops watching if no new file appears (and no file being written changes) for this long,
+	// 0 means no timeout
+	IdleTimeout time.Duration
+	// MaxFrames stops watching after this many frames, 0 means no limit
+	MaxFrames int
+}
+
+// dirWatcher is a FrameReader watching a directory.
+type dirWatcher struct {
+	ctx context.Context
+	dir string
+	cfg WatchConfig
+
+	// seen are the names of files already added (or skipped)
+	seen map[string]bool
+	// pending are the sizes and modification times of the files not yet ready to be added, by name
+	pending map[string]fileState
+	// queue are the files ready to be added, in creation order
+	queue []string
+	// frames is the number of returned frames
+	frames int
+	// lastNew is the time the last new file was found (or a file not yet ready changed)
+	lastNew time.Time
+}
+
+// fileState is the size and modification time of a file.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewDirWatcher returns a FrameReader which watches the directory dir, and returns the content of newly created
+// files (e.g. JPEG images dropped in the directory by capture tools) in creation (modification time) order.
+// It can be used with AddEncodedFrames() for live conversion.
+//
+// ReadFrame() blocks until the next file is ready. It returns io.EOF if ctx is cancelled, or if
+// the idle timeout or the frame limit of cfg is reached. The directory is polled (there are no
+// platform specific notifications used).
+func NewDirWatcher(ctx context.Context, dir string, cfg WatchConfig) FrameReader {
+	if cfg.Pattern == "" {
+		cfg.Pattern = "*.jpg"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 500 * time.Millisecond
+	}
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = time.Second
+	}
+	dw := &dirWatcher{ctx: ctx, dir: dir, cfg: cfg, seen: map[string]bool{}, lastNew: time.Now()}
+	if cfg.SkipExisting {
+		matches, _ := filepath.Glob(filepath.Join(dir, cfg.Pattern))
+		for _, name := range matches {
+			dw.seen[name] = true
+		}
+	}
+	return dw
+}
+
+// ReadFrame implements FrameReader.ReadFrame().
+func (dw *dirWatcher) ReadFrame() ([]byte, error) {
+	for {
+		if dw.cfg.MaxFrames > 0 && dw.frames >= dw.cfg.MaxFrames || dw.ctx.Err() != nil {
+			return nil, io.EOF
+		}
+
+		for len(dw.queue) > 0 {
+			name := dw.queue[0]
+			dw.queue = dw.queue[1:]
+			data, err := os.ReadFile(name)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue // Removed in the meantime
+				}
+				return nil, err
+			}
+			dw.frames++
+			return data, nil
+		}
+
+		if err := dw.poll(); err != nil {
+			return nil, err
+		}
+		if len(dw.queue) > 0 {
+			continue
+		}
+		if dw.cfg.IdleTimeout > 0 && time.Since(dw.lastNew) >= dw.cfg.IdleTimeout {
+			return nil, io.EOF
+		}
+
+		t := time.NewTimer(dw.cfg.Interval)
+		select {
+		case <-dw.ctx.Done():
+			t.Stop()
+			return nil, io.EOF
+		case <-t.C:
+		}
+	}
+}
+
+// poll checks the directory for new files, and queues the ones ready to be added.
+func (dw *dirWatcher) poll() error {
+	matches, err := filepath.Glob(filepath.Join(dw.dir, dw.cfg.Pattern))
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		name    string
+		modTime time.Time
+	}
+	var ready []file
+	pending := map[string]fileState{}
+	for _, name := range matches {
+		if dw.seen[name] {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			dw.seen[name] = true
+			continue
+		}
+		st := fileState{fi.Size(), fi.ModTime()}
+		if prev, ok := dw.pending[name]; !ok || prev.size != st.size || !prev.modTime.Equal(st.modTime) {
+			dw.lastNew = time.Now() // Even if not ready, a file being written means we're not idle
+		}
+		if fi.Size() == 0 || time.Since(fi.ModTime()) < dw.cfg.Debounce {
+			pending[name] = st
+			continue
+		}
+		ready = append(ready, file{name, fi.ModTime()})
+	}
+	dw.pending = pending
+
+	sort.Slice(ready, func(i, j int) bool {
+		if !ready[i].modTime.Equal(ready[j].modTime) {
+			return ready[i].modTime.Before(ready[j].modTime)
+		}
+		return ready[i].name < ready[j].name
+	})
+	for _, f := range ready {
+		dw.seen[f.name] = true
+		dw.queue = append(dw.queue, f.name)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package mjpeg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDirWatcherIdle checks that the watcher returns the new files, and stops after the idle timeout
+// even if a file never becomes ready.
+func TestDirWatcherIdle(t *testing.T) {
+	dir := t.TempDir()
+	frame := testFrames(t, 1)[0]
+	if err := os.WriteFile(filepath.Join(dir, "1.jpg"), frame, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "empty.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fr := NewDirWatcher(ctx, dir, WatchConfig{Interval: 10 * time.Millisecond, Debounce: time.Nanosecond, IdleTimeout: 100 * time.Millisecond})
+	data, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, frame) {
+		t.Error("got a different frame")
+	}
+
+	start := time.Now()
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Fatalf("got error %v, want %v", err, io.EOF)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("the idle timeout didn't stop watching in %v", time.Since(start))
+	}
+}
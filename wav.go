@@ -0,0 +1,157 @@
+package mjpeg
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// ErrNotWAV reports if the input is not a WAV file.
+	ErrNotWAV = errors.New("Not a WAV file")
+
+	// ErrUnsupportedAudio reports if the format of an audio file is not supported.
+	ErrUnsupportedAudio = errors.New("Unsupported audio")
+)
+
+// wavFile is a WAV file opened for reading its audio data, it implements audioSource.
+type wavFile struct {
+	// f is the file
+	f *os.File
+	// format is the data of the 'fmt ' chunk (a WAVEFORMATEX structure)
+	format []byte
+	// data is the reader of the audio data
+	data *io.SectionReader
+
+	// as is the audio stream
+	as *audioStream
+	// pos is the position of the next chunk in data
+	pos int64
+	// buf is the reused buffer of chunks
+	buf []byte
+}
+
+// blockAlign returns the size of a block (a sample of all channels) in bytes.
+func (wf *wavFile) blockAlign() int {
+	return int(binary.LittleEndian.Uint16(wf.format[12:]))
+}
+
+// avgBytesPerSec returns the data rate of the audio in bytes per second.
+func (wf *wavFile) avgBytesPerSec() int {
+	return int(binary.LittleEndian.Uint32(wf.format[8:]))
+}
+
+// openWAV opens the WAV file name, and locates its format and data chunks.
+func openWAV(name string) (wf *wavFile, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	hdr := make([]byte, 12)
+	if _, err := io.ReadFull(f, hdr); err != nil || string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+	wf = &wavFile{f: f}
+	for pos := int64(12); pos+8 <= fi.Size(); {
+		if _, err := f.ReadAt(hdr[:8], pos); err != nil {
+			return nil, err
+		}
+		id, size := string(hdr[:4]), int64(binary.LittleEndian.Uint32(hdr[4:]))
+		pos += 8
+		if pos+size > fi.Size() {
+			size = fi.Size() - pos // Truncated or streamed (unknown size) data
+		}
+		switch id {
+		case "fmt ":
+			wf.format = make([]byte, size)
+			if _, err := f.ReadAt(wf.format, pos); err != nil {
+				return nil, err
+			}
+		case "data":
+			wf.data = io.NewSectionReader(f, pos, size)
+		}
+		pos += size + size&1
+	}
+	if wf.format == nil || wf.data == nil || len(wf.format) < 16 {
+		return nil, ErrNotWAV
+	}
+	switch tag := binary.LittleEndian.Uint16(wf.format); {
+	case tag == 1: // WAVE_FORMAT_PCM
+	case tag == 0xfffe && len(wf.format) >= 26 && binary.LittleEndian.Uint16(wf.format[24:]) == 1: // WAVE_FORMAT_EXTENSIBLE with PCM subformat
+	case tag == 0x11: // WAVE_FORMAT_IMA_ADPCM
+	case tag == 0x55: // WAVE_FORMAT_MPEGLAYER3 (constant bitrate)
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+	if wf.blockAlign() == 0 || wf.avgBytesPerSec() == 0 {
+		return nil, ErrUnsupportedAudio
+	}
+	// Units are blocks: whole blocks are written in chunks, and the duration of a block is blockAlign/avgBytesPerSec
+	wf.as = &audioStream{
+		format:     wf.format,
+		scale:      int32(wf.blockAlign()),
+		rate:       int32(wf.avgBytesPerSec()),
+		sampleSize: int32(wf.blockAlign()),
+	}
+	return wf, nil
+}
+
+// stream implements audioSource.stream().
+func (wf *wavFile) stream() *audioStream {
+	return wf.as
+}
+
+// next implements audioSource.next(). Chunks are at most 1 second long.
+func (wf *wavFile) next(t time.Duration) ([]byte, int64, error) {
+	rate, block := int64(wf.avgBytesPerSec()), int64(wf.blockAlign())
+	end := wf.pos + rate
+	if t != audioEnd {
+		if e := int64(t.Seconds() * float64(rate)); e < end {
+			end = e
+		}
+	}
+	end -= end % block
+	if end > wf.data.Size() {
+		end = wf.data.Size()
+	}
+	if end <= wf.pos {
+		return nil, 0, nil
+	}
+	wf.buf = grow(wf.buf[:0], int(end-wf.pos))
+	if _, err := wf.data.ReadAt(wf.buf, wf.pos); err != nil {
+		return nil, 0, err
+	}
+	units := (end - wf.pos + block - 1) / block // A truncated last block counts as a block
+	wf.pos = end
+	return wf.buf, units, nil
+}
+
+// MuxWav writes the frames of the video aviPath and the audio of the WAV file wavPath
+// (e.g. a narration recorded afterwards) into a new video file outPath, without re-encoding frames.
+// The audio is interleaved with the frames: each frame is preceded by the audio played during it.
+// If the audio is longer than the video, the rest of the audio is written after the last frame.
+//
+// PCM audio is supported, and compressed audio which is much smaller for long recordings: IMA ADPCM,
+// and constant bitrate MP3 in a WAV container (see MuxMP3() for MP3 files). ErrUnsupportedAudio is returned
+// for other formats. The size, frame rate and codec of the video are kept (other streams of it,
+// e.g. a metadata stream, are dropped).
+func MuxWav(aviPath, wavPath, outPath string) error {
+	wf, err := openWAV(wavPath)
+	if err != nil {
+		return err
+	}
+	defer wf.f.Close()
+	return muxAudio(aviPath, outPath, wf)
+}
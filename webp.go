@@ -0,0 +1,419 @@
+package mjpeg
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"time"
+)
+
+// ErrWebPSize reports if the frames of a clip are too large for WebP.
+var ErrWebPSize = errors.New("Frame too large for WebP")
+
+// vp8lMaxSize is the max width and height of VP8L images (stored in 14-bit fields as size - 1).
+const vp8lMaxSize = 1 << 14
+
+// ExportWebP exports the clip of the video aviFile specified by cfg as an animated WebP to outFile,
+// e.g. to embed short loops in web pages where AVI can't be played.
+//
+// Frames are encoded losslessly (VP8L, with the subtract green and predictor transforms), which is
+// much smaller than APNG, but still larger than lossy WebP; scale the clip down with cfg.Width for previews.
+// Frames wider or higher than 16384 pixels can't be encoded, ErrWebPSize is returned for them
+// (they can be scaled down with cfg.Width too).
+func ExportWebP(aviFile, outFile string, cfg ClipConfig) error {
+	var anmf bytes.Buffer // The ANMF chunks
+	var start time.Duration
+	size, err := readClip(aviFile, cfg, func(f *clipFrame) error {
+		end := start + f.duration
+		ms := end.Milliseconds() - start.Milliseconds() // Rounding the ends keeps the timeline exact
+		start = end
+		if ms > 0xffffff {
+			ms = 0xffffff
+		}
+
+		if f.img.Rect.Dx() > vp8lMaxSize || f.img.Rect.Dy() > vp8lMaxSize {
+			return ErrWebPSize
+		}
+		vp8l := encodeVP8L(f.img)
+		hdr := make([]byte, 16)
+		putUint24(hdr[0:], 0)                         // Frame X / 2
+		putUint24(hdr[3:], 0)                         // Frame Y / 2
+		putUint24(hdr[6:], uint32(f.img.Rect.Dx()-1)) // Frame width - 1
+		putUint24(hdr[9:], uint32(f.img.Rect.Dy()-1)) // Frame height - 1
+		putUint24(hdr[12:], uint32(ms))               // Frame duration in milliseconds
+		hdr[15] = 0x02                                // Flags: do not blend, do not dispose
+		chunk := appendRIFFChunk(hdr, "VP8L", vp8l)   // Frame data
+		anmf.Write(appendRIFFChunk(nil, "ANMF", chunk))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02                                             // Flags: animation
+	putUint24(vp8x[4:], uint32(size.X-1))                      // Canvas width - 1
+	putUint24(vp8x[7:], uint32(size.Y-1))                      // Canvas height - 1
+	anim := make([]byte, 6)                                    // Background color (BGRA): transparent black
+	binary.LittleEndian.PutUint16(anim[4:], uint16(cfg.Loops)) // Loop count, 0: infinite
+
+	body := []byte("WEBP")
+	body = appendRIFFChunk(body, "VP8X", vp8x)
+	body = appendRIFFChunk(body, "ANIM", anim)
+	body = append(body, anmf.Bytes()...)
+	return os.WriteFile(outFile, appendRIFFChunk(nil, "RIFF", body), 0644)
+}
+
+// putUint24 puts v into b as a 24-bit little endian integer.
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// appendRIFFChunk appends a RIFF chunk with the given id and data (padded to even size) to b.
+func appendRIFFChunk(b []byte, id string, data []byte) []byte {
+	b = append(b, id...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)&1 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// vp8lPredBits is the size bits of the predictor transform: blocks of 1<<vp8lPredBits pixels.
+const vp8lPredBits = 4
+
+// encodeVP8L encodes an opaque image in the VP8L (WebP lossless) format.
+// The image must be at most vp8lMaxSize wide and high.
+func encodeVP8L(img *image.RGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	px := make([]uint32, w*h) // ARGB pixels, with the subtract green transform applied
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := uint32(row[4*x]), uint32(row[4*x+1]), uint32(row[4*x+2])
+			px[y*w+x] = 0xff000000 | (r-g)&0xff<<16 | g<<8 | (b-g)&0xff
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.writeBits(0x2f, 8)           // Signature
+	bw.writeBits(uint32(w-1), 14)   // Image width - 1
+	bw.writeBits(uint32(h-1), 14)   // Image height - 1
+	bw.writeBits(0, 1)              // alpha_is_used: opaque
+	bw.writeBits(0, 3)              // Version
+	bw.writeBits(1, 1)              // Transform present
+	bw.writeBits(2, 2)              // SUBTRACT_GREEN_TRANSFORM
+	bw.writeBits(1, 1)              // Transform present
+	bw.writeBits(0, 2)              // PREDICTOR_TRANSFORM
+	bw.writeBits(vp8lPredBits-2, 3) // Size bits
+
+	modes, residuals := vp8lPredict(px, w, h)
+	bw.writeEntropyImage(modes, false)
+	bw.writeBits(0, 1) // No more transforms
+	bw.writeEntropyImage(residuals, true)
+	return bw.flush()
+}
+
+// vp8lPredict chooses the predictor mode of each block of px (left, top, or their average),
+// and returns the predictor sub-image and the residuals.
+func vp8lPredict(px []uint32, w, h int) (modes, residuals []uint32) {
+	const block = 1 << vp8lPredBits
+	bw, bh := (w+block-1)/block, (h+block-1)/block
+	modes = make([]uint32, bw*bh)
+	residuals = make([]uint32, len(px))
+
+	predict := func(mode, x, y int) uint32 {
+		switch {
+		case x == 0 && y == 0:
+			return 0xff000000
+		case y == 0:
+			return px[x-1]
+		case x == 0:
+			return px[(y-1)*w]
+		}
+		l, t := px[y*w+x-1], px[(y-1)*w+x]
+		switch mode {
+		case 1:
+			return l
+		case 2:
+			return t
+		}
+		return ((l^t)&0xfefefefe)>>1 + l&t // Mode 7: Average2(L, T)
+	}
+
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			x0, y0 := bx*block, by*block
+			x1, y1 := x0+block, y0+block
+			if x1 > w {
+				x1 = w
+			}
+			if y1 > h {
+				y1 = h
+			}
+			best, bestCost := 7, -1
+			for _, mode := range []int{7, 1, 2} {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						r := subPixels(px[y*w+x], predict(mode, x, y))
+						for s := 0; s < 32; s += 8 {
+							if c := int(int8(r >> s)); c < 0 {
+								cost -= c
+							} else {
+								cost += c
+							}
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[by*bw+bx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					residuals[y*w+x] = subPixels(px[y*w+x], predict(best, x, y))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// subPixels subtracts the channels of b from the channels of a (modulo 256).
+func subPixels(a, b uint32) uint32 {
+	ag := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	rb := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// bitWriter writes bits LSB first, as VP8L is packed.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+// writeBits writes the n lowest bits of v.
+func (bw *bitWriter) writeBits(v uint32, n uint) {
+	bw.acc |= uint64(v) << bw.n
+	for bw.n += n; bw.n >= 8; bw.n -= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+	}
+}
+
+// flush writes the pending bits, and returns the written data.
+func (bw *bitWriter) flush() []byte {
+	if bw.n > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+	}
+	return bw.buf
+}
+
+// prefixCode is a prefix (Huffman) code. codes are bit reversed for bitWriter.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+// write writes the code of sym.
+func (pc *prefixCode) write(bw *bitWriter, sym int) {
+	bw.writeBits(uint32(pc.codes[sym]), uint(pc.lengths[sym]))
+}
+
+// writeEntropyImage writes an entropy-coded image of literal pixels (no backward references or color cache).
+// main tells if it is the main ARGB image (which may have meta prefix codes).
+func (bw *bitWriter) writeEntropyImage(px []uint32, main bool) {
+	bw.writeBits(0, 1) // No color cache
+	if main {
+		bw.writeBits(0, 1) // No meta prefix codes
+	}
+	green, red, blue, alpha := make([]int, 256+24), make([]int, 256), make([]int, 256), make([]int, 256)
+	for _, p := range px {
+		green[p>>8&0xff]++
+		red[p>>16&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+	g, r, b, a := bw.writePrefixCode(green), bw.writePrefixCode(red), bw.writePrefixCode(blue), bw.writePrefixCode(alpha)
+	bw.writePrefixCode(make([]int, 40)) // Distance code: unused
+	for _, p := range px {
+		g.write(bw, int(p>>8&0xff))
+		r.write(bw, int(p>>16&0xff))
+		b.write(bw, int(p&0xff))
+		a.write(bw, int(p>>24))
+	}
+}
+
+// vp8lCodeLengthOrder is the order of the code length code lengths.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode writes a prefix code of symbols with the given frequencies, and returns it.
+func (bw *bitWriter) writePrefixCode(freq []int) *prefixCode {
+	var used []int
+	for sym, f := range freq {
+		if f > 0 {
+			used = append(used, sym)
+		}
+	}
+	pc := &prefixCode{lengths: make([]uint8, len(freq)), codes: make([]uint16, len(freq))}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		// Simple code: 1 symbol coded with 0 bits, or 2 symbols coded with 1 bit
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(used)-1), 1)
+		if used[0] <= 1 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.writeBits(uint32(used[1]), 8)
+			pc.lengths[used[0]], pc.lengths[used[1]] = 1, 1
+			pc.codes[used[1]] = 1
+		}
+		return pc
+	}
+
+	// Normal code: code lengths coded with a code length code
+	pc.lengths = huffmanLengths(freq, 15)
+	pc.codes = canonicalCodes(pc.lengths)
+	clFreq := make([]int, 19)
+	for _, l := range pc.lengths {
+		clFreq[l]++
+	}
+	cl := &prefixCode{lengths: huffmanLengths(clFreq, 7)}
+	cl.codes = canonicalCodes(cl.lengths)
+
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && cl.lengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.writeBits(0, 1)
+	bw.writeBits(uint32(n-4), 4)
+	for _, sym := range vp8lCodeLengthOrder[:n] {
+		bw.writeBits(uint32(cl.lengths[sym]), 3)
+	}
+	bw.writeBits(0, 1) // All symbols have code lengths
+	for _, l := range pc.lengths {
+		cl.write(bw, int(l))
+	}
+	return pc
+}
+
+// huffmanLengths returns the code lengths of a Huffman code of symbols with the given frequencies,
+// limited to maxLen bits. If there is only one used symbol, another one is added (so the code is complete).
+func huffmanLengths(freq []int, maxLen int) []uint8 {
+	lengths := make([]uint8, len(freq))
+	f := append([]int(nil), freq...)
+	for {
+		h := &huffmanHeap{}
+		for sym, w := range f {
+			if w > 0 {
+				h.nodes = append(h.nodes, huffmanNode{weight: w, sym: sym, left: -1, right: -1})
+				h.items = append(h.items, len(h.nodes)-1)
+			}
+		}
+		switch len(h.items) {
+		case 0:
+			return lengths
+		case 1:
+			sym := h.nodes[0].sym
+			lengths[sym], lengths[1-sym%2] = 1, 1 // Another symbol: 0 or 1
+			return lengths
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(h).(int), heap.Pop(h).(int)
+			h.nodes = append(h.nodes, huffmanNode{weight: h.nodes[a].weight + h.nodes[b].weight, sym: -1, left: a, right: b})
+			heap.Push(h, len(h.nodes)-1)
+		}
+
+		maxDepth := 0
+		var walk func(n, depth int)
+		walk = func(n, depth int) {
+			if nd := h.nodes[n]; nd.sym >= 0 {
+				lengths[nd.sym] = uint8(depth)
+				if depth > maxDepth {
+					maxDepth = depth
+				}
+			} else {
+				walk(nd.left, depth+1)
+				walk(nd.right, depth+1)
+			}
+		}
+		walk(h.items[0], 0)
+		if maxDepth <= maxLen {
+			return lengths
+		}
+		for i, w := range f { // Flatten the distribution until the code fits
+			if w > 0 {
+				f[i] = (w + 1) / 2
+			}
+		}
+	}
+}
+
+// huffmanNode is a node of a Huffman tree: a leaf (sym >= 0) or an internal node.
+type huffmanNode struct {
+	weight      int
+	sym         int
+	left, right int
+}
+
+// huffmanHeap is a min-heap of the nodes (indices of nodes) by weight.
+type huffmanHeap struct {
+	nodes []huffmanNode
+	items []int
+}
+
+func (h *huffmanHeap) Len() int { return len(h.items) }
+func (h *huffmanHeap) Less(i, j int) bool {
+	return h.nodes[h.items[i]].weight < h.nodes[h.items[j]].weight
+}
+func (h *huffmanHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffmanHeap) Push(x any)    { h.items = append(h.items, x.(int)) }
+func (h *huffmanHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// canonicalCodes returns the canonical codes of the given code lengths, bit reversed.
+func canonicalCodes(lengths []uint8) []uint16 {
+	var count [16]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]int
+	for l, code := 1, 0; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint16, len(lengths))
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := next[l]
+		next[l]++
+		var rev uint16
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | uint16(code>>i&1)
+		}
+		codes[sym] = rev
+	}
+	return codes
+}
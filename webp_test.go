@@ -0,0 +1,149 @@
+package mjpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/vp8l"
+)
+
+// webpFrame is a frame of an animated WebP.
+type webpFrame struct {
+	// duration is the duration of the frame in milliseconds
+	duration int
+	// vp8l is the VP8L bitstream of the frame
+	vp8l []byte
+}
+
+// webpFrames returns the frames of an animated WebP.
+func webpFrames(tb testing.TB, data []byte) []webpFrame {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		tb.Fatal("not a WebP file")
+	}
+	var frames []webpFrame
+	for p := data[12:]; len(p) >= 8; {
+		n := int(binary.LittleEndian.Uint32(p[4:]))
+		body := p[8 : 8+n]
+		if string(p[:4]) == "ANMF" {
+			if len(body) < 24 || string(body[16:20]) != "VP8L" {
+				tb.Fatal("invalid ANMF chunk")
+			}
+			d := int(body[12]) | int(body[13])<<8 | int(body[14])<<16
+			frames = append(frames, webpFrame{duration: d, vp8l: body[24 : 24+binary.LittleEndian.Uint32(body[20:])]})
+		}
+		p = p[8+n+n&1:]
+	}
+	return frames
+}
+
+// TestExportWebP checks that every frame of the WebP decodes (losslessly) to the frame of the video.
+func TestExportWebP(t *testing.T) {
+	dir := t.TempDir()
+	name, f := clipTestVideo(t, dir)
+	out := filepath.Join(dir, "test.webp")
+	if err := ExportWebP(name, out, ClipConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := webpFrames(t, data)
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	for i, want := range []int{200, 100, 100} {
+		if frames[i].duration != want {
+			t.Errorf("frame %d: got duration %d ms, want %d", i, frames[i].duration, want)
+		}
+		img, err := vp8l.Decode(bytes.NewReader(frames[i].vp8l))
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !sameImage(img, clipImage(t, f[i])) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+// TestExportWebPNoisy checks the decoding of frames of camera-like noise, scaled to an odd size.
+func TestExportWebPNoisy(t *testing.T) {
+	dir := t.TempDir()
+	name := testVideo(t, dir, 2)
+	out := filepath.Join(dir, "test.webp")
+	if err := ExportWebP(name, out, ClipConfig{Width: 97}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := webpFrames(t, data)
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	for i, fr := range frames {
+		img, err := vp8l.Decode(bytes.NewReader(fr.vp8l))
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		want := resizeBox(clipImage(t, testJPEG(t, i)), 97, 97*benchHeight/benchWidth)
+		if !sameImage(img, want) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+// TestEncodeVP8LMaxSize checks the decoding of images of the max VP8L size.
+func TestEncodeVP8LMaxSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, vp8lMaxSize, 2), image.Rect(0, 0, 3, vp8lMaxSize)} {
+		img := image.NewRGBA(r)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(i * 7 / 3)
+			if i%4 == 3 {
+				img.Pix[i] = 255
+			}
+		}
+		got, err := vp8l.Decode(bytes.NewReader(encodeVP8L(img)))
+		if err != nil {
+			t.Fatalf("%v: %v", r, err)
+		}
+		if !sameImage(got, img) {
+			t.Errorf("%v: image differs", r)
+		}
+	}
+}
+
+// TestExportWebPTooLarge checks that frames too large for WebP are rejected, unless scaled down.
+func TestExportWebPTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	const w, h = vp8lMaxSize + 1, 8
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "large.avi")
+	aw, err := New(name, w, h, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.AddFrame(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "large.webp")
+	if err := ExportWebP(name, out, ClipConfig{}); err != ErrWebPSize {
+		t.Errorf("got error %v, want %v", err, ErrWebPSize)
+	}
+	if err := ExportWebP(name, out, ClipConfig{Width: vp8lMaxSize}); err != nil {
+		t.Error(err)
+	}
+}